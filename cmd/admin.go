@@ -0,0 +1,407 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/application"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/internal/terminal"
+)
+
+const (
+	DEFAULT_KEYS_COUNT     int = 5
+	DEFAULT_ATTEMPTS_COUNT int = 20
+)
+
+var (
+	ErrConfigProblems = errors.New("configuration has problems")
+)
+
+func migrate(args []string) error {
+	if err := parseFlags(flag.NewFlagSet("migrate", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	applied, err := app.Migrate()
+	for _, version := range applied {
+		fmt.Println("Applied:", version)
+	}
+
+	if err == nil && len(applied) == 0 {
+		fmt.Println("Database is up to date")
+	}
+	return err
+}
+
+func configCheck(args []string) error {
+	if err := parseFlags(flag.NewFlagSet("config check", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	cfg, err := application.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	problems := application.CheckConfig(cfg)
+	for _, problem := range problems {
+		fmt.Println("-", problem)
+	}
+
+	if len(problems) > 0 {
+		return ErrConfigProblems
+	}
+
+	fmt.Println("Configuration is OK")
+	return nil
+}
+
+func userAdd(args []string) error {
+	fs := flag.NewFlagSet("user add", flag.ContinueOnError)
+	role := fs.String("role", string(auth.ROLE_USER), "role of user: admin, user or guest")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	user_role, err := auth.ParseRole(*role)
+	if err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	password, err := terminal.ReadNewPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	if err := app.AuthService().AddUser(auth.NewUser(fs.Arg(0), password), user_role); err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s created\n", fs.Arg(0))
+	return nil
+}
+
+func userList(args []string) error {
+	if err := parseFlags(flag.NewFlagSet("user list", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	users, err := app.AuthService().GetUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		state := ""
+		if user.Disabled {
+			state = "disabled"
+		}
+		fmt.Printf("%-30s  %-5s  %s\n", user.Name, user.Role, state)
+	}
+	return nil
+}
+
+func userRole(args []string) error {
+	fs := flag.NewFlagSet("user role", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	role, err := auth.ParseRole(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	if err := app.AuthService().SetRole(fs.Arg(0), role); err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s is %s now\n", fs.Arg(0), role)
+	return nil
+}
+
+// Disable or enable user
+func userSetDisabled(disabled bool) command {
+	return func(args []string) error {
+		fs := flag.NewFlagSet("user disable", flag.ContinueOnError)
+		if err := parseFlags(fs, args, 1, 1); err != nil {
+			return err
+		}
+
+		app, err := application.NewApplication()
+		if err != nil {
+			return err
+		}
+
+		if err := app.AuthService().SetDisabled(fs.Arg(0), disabled); err != nil {
+			return err
+		}
+
+		if disabled {
+			fmt.Printf("User %s disabled\n", fs.Arg(0))
+		} else {
+			fmt.Printf("User %s enabled\n", fs.Arg(0))
+		}
+		return nil
+	}
+}
+
+func userDelete(args []string) error {
+	fs := flag.NewFlagSet("user delete", flag.ContinueOnError)
+	remove_files := fs.Bool("files", false, "remove user files")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	if err := app.AuthService().DeleteUser(fs.Arg(0), *remove_files); err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s deleted\n", fs.Arg(0))
+	return nil
+}
+
+func userPasswd(args []string) error {
+	fs := flag.NewFlagSet("user passwd", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	password, err := terminal.ReadNewPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	if err := app.AuthService().SetPassword(auth.NewUser(fs.Arg(0), password)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Password of %s changed\n", fs.Arg(0))
+	return nil
+}
+
+func userReset(args []string) error {
+	fs := flag.NewFlagSet("user reset", flag.ContinueOnError)
+	expire := fs.Duration("expire", auth.DEFAULT_PASSWORD_RESET_LIFETIME, "token lifetime")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	if *expire <= 0 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return ErrUsage
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	token, err := app.AuthService().CreatePasswordReset(fs.Arg(0), *expire)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	fmt.Fprintf(os.Stderr, "Token expires at %s. Give it to user: mhctl reset <server> <token>\n",
+		time.Now().Add(*expire).Format(time.DateTime))
+	return nil
+}
+
+func userDisableTOTP(args []string) error {
+	fs := flag.NewFlagSet("user disable-totp", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	if err := app.AuthService().ResetTOTP(fs.Arg(0)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Two-factor authentication of %s disabled\n", fs.Arg(0))
+	return nil
+}
+
+func userLockouts(args []string) error {
+	if err := parseFlags(flag.NewFlagSet("user lockouts", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	lockouts, err := app.AuthService().GetLockouts()
+	if err != nil {
+		return err
+	}
+
+	for _, lockout := range lockouts {
+		locked := ""
+		if lockout.LockedUntil != 0 {
+			locked = fmt.Sprintf("locked until %s (lockout %d in a row)",
+				time.Unix(lockout.LockedUntil, 0).Format(time.DateTime), lockout.Lockouts)
+		}
+		fmt.Printf("%-30s  %3d  %s  %s\n", lockout.Username, lockout.Failures,
+			time.Unix(lockout.LastFailure, 0).Format(time.DateTime), locked)
+	}
+	return nil
+}
+
+func userUnlock(args []string) error {
+	fs := flag.NewFlagSet("user unlock", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	if err := app.AuthService().ClearLockout(fs.Arg(0)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Login of %s unlocked\n", fs.Arg(0))
+	return nil
+}
+
+func userAttempts(args []string) error {
+	fs := flag.NewFlagSet("user attempts", flag.ContinueOnError)
+	limit := fs.Int("n", DEFAULT_ATTEMPTS_COUNT, "count of attempts")
+	if err := parseFlags(fs, args, 0, 1); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	attempts, err := app.AuthService().GetLoginAttempts(fs.Arg(0), *limit)
+	if err != nil {
+		return err
+	}
+
+	for _, attempt := range attempts {
+		result := "ok"
+		if !attempt.Success {
+			result = attempt.Reason
+		}
+		fmt.Printf("%s  %-30s  %-15s  %-15s  %s\n", time.Unix(attempt.Time, 0).Format(time.DateTime),
+			attempt.Username, attempt.Method, attempt.IP, result)
+	}
+	return nil
+}
+
+func keysGenerate(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	count := fs.Int("n", DEFAULT_KEYS_COUNT, "count of keys")
+	expire := fs.Duration("expire", 0, "key lifetime, keys never expire by default")
+	uses := fs.Int("uses", 1, "count of users, which can be registered by one key")
+	username := fs.String("user", "", "only user with this name can be registered by key")
+	role := fs.String("role", string(auth.ROLE_USER), "role of registered users: admin, user or guest")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	keys, err := app.AuthService().GenerateRegisterKeys(*count, auth.RegisterKeyOptions{
+		Lifetime: *expire,
+		MaxUses:  *uses,
+		Username: *username,
+		Role:     auth.Role(*role),
+	})
+	for _, key := range keys {
+		fmt.Println(key.Key)
+	}
+	return err
+}
+
+func keysList(args []string) error {
+	if err := parseFlags(flag.NewFlagSet("keys list", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+
+	keys, err := app.AuthService().GetRegisterKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		expires := "never"
+		if key.Expires != 0 {
+			expires = time.Unix(key.Expires, 0).Format(time.DateTime)
+		}
+		fmt.Printf("%s  %-5s  %d/%d  %-19s  %s\n", key.Key, key.Role, key.Uses, key.MaxUses, expires, key.Username)
+	}
+	return nil
+}
+
+func keysRevoke(args []string) error {
+	fs := flag.NewFlagSet("keys revoke", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return err
+	}
+	if err := app.AuthService().RevokeRegisterKey(fs.Arg(0)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Registration key %s deleted\n", fs.Arg(0))
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,32 +11,178 @@ import (
 	"github.com/braginantonev/mhserver/version"
 )
 
+const USAGE string = `Usage: mhserver [command] [flags] [args]
+
+Commands:
+  serve [-M | -S]              run server (default). -M - main server only, -S - subservers only
+  encrypt-files                encrypt files, which were saved before encryption was enabled
+  migrate                      create and update database tables
+  config check                 check configuration, TLS files and database
+  user add [-role user] <name> create user with role: admin, user or guest.
+                               Password is read from terminal or stdin
+  user list                    list users
+  user role <name> <role>      change role of user
+  user disable <name>          forbid user to log in and end his sessions
+  user enable <name>           allow disabled user to log in
+  user delete [-files] <name>  delete user, with -files remove his files too
+  user passwd <name>           set new password of user and end his sessions
+  user reset [-expire 24h] <name>
+                               create one-time token, with which user sets new password
+  user disable-totp <name>     disable two-factor authentication of user, who lost his device
+  user lockouts                list usernames with failed logins and their lockouts
+  user unlock <name>           unlock login of username and forget its failed attempts
+  user attempts [-n 20] [name] show last login attempts of all users or one username
+  keys generate [-n 5] [-expire 72h] [-uses 1] [-user name] [-role user]
+                               generate registration keys. By default key is one-time,
+                               never expires and registers user with "user" role
+  keys list                    list registration keys: role, uses, expiry and bound username
+  keys revoke <key>            delete registration key
+  version                      show version
+`
+
 var (
-	ArgAppMode = map[string]application.ApplicationMode{
-		"-M": application.AppMode_MainServerOnly,
-		"-S": application.AppMode_SubServersOnly,
-	}
+	// Wrong arguments. Usage is already printed.
+	ErrUsage = errors.New("bad usage")
 )
 
-func main() {
+type command func(args []string) error
+
+var commands = map[string]command{
+	"serve":         serve,
+	"encrypt-files": encryptFiles,
+	"migrate":       migrate,
+	"config": group(map[string]command{
+		"check": configCheck,
+	}),
+	"user": group(map[string]command{
+		"add":    userAdd,
+		"list":   userList,
+		"delete": userDelete,
+		"passwd": userPasswd,
+		"reset":  userReset,
+		"role":   userRole,
+
+		"disable":      userSetDisabled(true),
+		"enable":       userSetDisabled(false),
+		"disable-totp": userDisableTOTP,
+
+		"lockouts": userLockouts,
+		"unlock":   userUnlock,
+		"attempts": userAttempts,
+	}),
+	"keys": group(map[string]command{
+		"generate": keysGenerate,
+		"list":     keysList,
+		"revoke":   keysRevoke,
+	}),
+	"version": func([]string) error {
+		fmt.Println(version.Version)
+		return nil
+	},
+}
+
+// Command with subcommands: "user add", "keys list"
+func group(subcommands map[string]command) command {
+	return func(args []string) error {
+		if len(args) == 0 {
+			fmt.Fprint(os.Stderr, USAGE)
+			return ErrUsage
+		}
+
+		cmd, ok := subcommands[args[0]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], USAGE)
+			return ErrUsage
+		}
+		return cmd(args[1:])
+	}
+}
+
+// Parse flags of command and check count of arguments
+func parseFlags(fs *flag.FlagSet, args []string, min_args, max_args int) error {
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, USAGE)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	if fs.NArg() < min_args || fs.NArg() > max_args {
+		fs.Usage()
+		return ErrUsage
+	}
+	return nil
+}
+
+// Run server. Old style arguments ("mhserver -M") are supported.
+func serve(args []string) error {
 	fmt.Printf("Mhserver (ver. %s)\n", version.Version)
 
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	main_only := fs.Bool("M", false, "run main server only")
+	subservers_only := fs.Bool("S", false, "run subservers only")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
 	app, err := application.NewApplication()
 	if err != nil {
-		slog.Error("failed init application", slog.Any("error", err))
-		os.Exit(1)
+		return fmt.Errorf("failed init application: %w", err)
 	}
 
 	app_mode := application.AppMode_AllServers
-	for _, arg := range os.Args {
-		mode, ok := ArgAppMode[arg]
-		if ok {
-			app_mode = mode
+	switch {
+	case *main_only:
+		app_mode = application.AppMode_MainServerOnly
+	case *subservers_only:
+		app_mode = application.AppMode_SubServersOnly
+	}
+
+	return app.Run(app_mode)
+}
+
+func encryptFiles(args []string) error {
+	if err := parseFlags(flag.NewFlagSet("encrypt-files", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+
+	app, err := application.NewApplication()
+	if err != nil {
+		return fmt.Errorf("failed init application: %w", err)
+	}
+	return app.EncryptFiles()
+}
+
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && (len(args[0]) == 0 || args[0][0] != '-') {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		switch name {
+		case "help":
+			fmt.Print(USAGE)
+			return
 		}
+
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, USAGE)
+		os.Exit(2)
+	}
+
+	// Only server logs configuration details
+	if name != "serve" {
+		slog.SetLogLoggerLevel(slog.LevelWarn)
 	}
 
-	if err := app.Run(app_mode); err != nil {
-		slog.Error("Failed run application", slog.Any("error", err))
+	if err := cmd(args); err != nil {
+		if errors.Is(err, ErrUsage) {
+			os.Exit(2)
+		}
+
+		slog.Error("Failed run command", slog.String("command", name), slog.Any("error", err))
 		os.Exit(1)
 	}
 }
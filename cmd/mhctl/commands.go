@@ -0,0 +1,830 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/terminal"
+	"github.com/braginantonev/mhserver/pkg/client"
+)
+
+const (
+	// Interrupted download is kept near target file, so it can be resumed
+	PART_FILE_SUFFIX string = ".mhctl-part"
+
+	PASSWORD_ENV string = "MHCTL_PASSWORD"
+
+	// Message of server error, when delta can't be applied to big file
+	DELTA_TOO_BIG_MESSAGE string = "file is too big for delta"
+)
+
+var (
+	ErrIsDirectory = errors.New("is a directory")
+)
+
+// Client of saved session. Tokens renewed during command are saved by close.
+type session struct {
+	*client.Client
+	cfg Config
+}
+
+func openSession() (*session, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{
+		Client: client.New(client.Config{
+			URL:          cfg.Server,
+			Username:     cfg.User,
+			Password:     os.Getenv(PASSWORD_ENV),
+			Token:        cfg.Token,
+			RefreshToken: cfg.RefreshToken,
+			Device:       deviceName(),
+			UserAgent:    USER_AGENT,
+			Insecure:     cfg.Insecure,
+		}),
+		cfg: cfg,
+	}, nil
+}
+
+// Session is shown in sessions list with name of this computer
+func deviceName() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+func (s *session) close() {
+	token, refresh_token := s.Token(), s.RefreshToken()
+	if token != "" && (token != s.cfg.Token || refresh_token != s.cfg.RefreshToken) {
+		s.cfg.Token, s.cfg.RefreshToken = token, refresh_token
+		if err := saveConfig(s.cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "mhctl: failed save session:", err)
+		}
+	}
+}
+
+// Remote path always starts with "/"
+func remotePath(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return "/" + p
+	}
+	return p
+}
+
+func dirPath(p string) string {
+	p = remotePath(p)
+	if !strings.HasSuffix(p, "/") {
+		return p + "/"
+	}
+	return p
+}
+
+func login(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	insecure := fs.Bool("insecure", false, "don't verify server certificate")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	cfg := Config{
+		Server:   strings.TrimSuffix(fs.Arg(0), "/"),
+		User:     fs.Arg(1),
+		Insecure: *insecure,
+	}
+
+	password := os.Getenv(PASSWORD_ENV)
+	if password == "" {
+		var err error
+		if password, err = terminal.ReadPassword("Password: "); err != nil {
+			return err
+		}
+	}
+	return openNewSession(ctx, cfg, password)
+}
+
+// Log in with password. User with two-factor authentication is asked for code.
+func loginWithCode(ctx context.Context, c *client.Client) (string, error) {
+	token, err := c.Login(ctx)
+
+	var challenge *client.TOTPRequiredError
+	if !errors.As(err, &challenge) {
+		return token, err
+	}
+
+	code, err := terminal.ReadLine("Code from authenticator app or recovery code: ")
+	if err != nil {
+		return "", err
+	}
+	return c.LoginTOTP(ctx, challenge.Challenge, code)
+}
+
+// Log in and save session
+func openNewSession(ctx context.Context, cfg Config, password string) error {
+	c := client.New(client.Config{
+		URL:       cfg.Server,
+		Username:  cfg.User,
+		Password:  password,
+		Device:    deviceName(),
+		UserAgent: USER_AGENT,
+		Insecure:  cfg.Insecure,
+	})
+
+	token, err := loginWithCode(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	cfg.Token, cfg.RefreshToken = token, c.RefreshToken()
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in to %s as %s\n", cfg.Server, cfg.User)
+	return nil
+}
+
+// Register by invite link of other user and log in
+func register(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("register", flag.ContinueOnError)
+	insecure := fs.Bool("insecure", false, "don't verify server certificate")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	server, key, err := client.ParseInviteURL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	cfg := Config{
+		Server:   server,
+		User:     fs.Arg(1),
+		Insecure: *insecure,
+	}
+
+	c := client.New(client.Config{
+		URL:       cfg.Server,
+		Username:  cfg.User,
+		UserAgent: USER_AGENT,
+		Insecure:  cfg.Insecure,
+	})
+
+	info, err := c.CheckInvite(ctx, key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Invite from %s, expires at %s\n", info.InvitedBy, time.Unix(info.Expires, 0).Format(time.DateTime))
+
+	password := os.Getenv(PASSWORD_ENV)
+	if password == "" {
+		if password, err = terminal.ReadNewPassword("Password: "); err != nil {
+			return err
+		}
+	}
+
+	c = client.New(client.Config{
+		URL:       cfg.Server,
+		Username:  cfg.User,
+		Password:  password,
+		UserAgent: USER_AGENT,
+		Insecure:  cfg.Insecure,
+	})
+
+	if err := c.Register(ctx, key); err != nil {
+		return err
+	}
+	return openNewSession(ctx, cfg, password)
+}
+
+// End session on server and forget saved tokens
+func logout(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+
+	// Tokens are forgotten even if server is unavailable
+	err = s.Logout(ctx)
+	s.cfg.Token, s.cfg.RefreshToken = "", ""
+	if save_err := saveConfig(s.cfg); save_err != nil {
+		return save_err
+	}
+
+	if err != nil && !errors.Is(err, client.ErrUnauthorized) {
+		return err
+	}
+
+	fmt.Println("Logged out")
+	return nil
+}
+
+func ls(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 0, 1); err != nil {
+		return err
+	}
+
+	dir := "/"
+	if fs.NArg() == 1 {
+		dir = dirPath(fs.Arg(0))
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	files, err := s.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		size, name := humanSize(file.Size), file.Name
+		if file.IsDir {
+			size, name = "-", name+"/"
+		}
+		fmt.Printf("%10s  %s  %s\n", size, time.Unix(int64(file.ModTime), 0).Format(time.DateTime), name)
+	}
+	return nil
+}
+
+/*
+Upload local file. If file exists on server, only changed blocks are sent (rsync delta),
+so interrupted upload is continued and unchanged file isn't sent again.
+*/
+func put(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, 2); err != nil {
+		return err
+	}
+
+	local := fs.Arg(0)
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s: %w", local, ErrIsDirectory)
+	}
+
+	if info.Size() == 0 {
+		return fmt.Errorf("%s: %w", local, client.ErrEmptyFile)
+	}
+
+	remote := "/" + filepath.Base(local)
+	if fs.NArg() == 2 {
+		if remote = remotePath(fs.Arg(1)); strings.HasSuffix(remote, "/") {
+			remote += filepath.Base(local)
+		}
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	_, same, err := s.Compare(ctx, remote, file, info.Size())
+	switch {
+	case err == nil && same:
+		fmt.Printf("%s: already uploaded\n", remote)
+		return nil
+
+	case err == nil:
+		result, err := s.UploadDelta(ctx, remote, file, info.Size())
+		if err == nil {
+			fmt.Printf("%s: sent %s of %s\n", remote, humanSize(result.Literal), humanSize(result.Size))
+			return nil
+		}
+
+		// Big files are uploaded again
+		var server_err *client.Error
+		if !errors.As(err, &server_err) || server_err.Message != DELTA_TOO_BIG_MESSAGE {
+			return err
+		}
+
+	case !errors.Is(err, client.ErrNotFound):
+		return err
+	}
+
+	bar := newProgressBar(remote)
+	_, err = s.Upload(ctx, remote, file, info.Size(), bar.Update)
+	bar.Done()
+	return err
+}
+
+/*
+Download file to part file near target, which is renamed after end. If part file exists,
+only chunks, which differ from server, are downloaded.
+*/
+func get(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, 2); err != nil {
+		return err
+	}
+
+	remote := remotePath(fs.Arg(0))
+	if strings.HasSuffix(remote, "/") {
+		return fmt.Errorf("%s: %w", remote, ErrIsDirectory)
+	}
+
+	local := path.Base(remote)
+	if fs.NArg() == 2 {
+		local = fs.Arg(1)
+		if info, err := os.Stat(local); err == nil && info.IsDir() {
+			local = filepath.Join(local, path.Base(remote))
+		}
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	part_path := local + PART_FILE_SUFFIX
+	part, err := os.OpenFile(part_path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = part.Close()
+	}()
+
+	info, err := part.Stat()
+	if err != nil {
+		return err
+	}
+
+	bar := newProgressBar(remote)
+	var conn client.Connection
+	if info.Size() > 0 {
+		conn, err = s.ResumeDownload(ctx, remote, part, bar.Update)
+	} else {
+		conn, err = s.DownloadTo(ctx, remote, part, bar.Update)
+	}
+	bar.Done()
+
+	switch {
+	case err != nil && info.Size() == 0 && errors.Is(err, client.ErrNotFound):
+		_ = os.Remove(part_path)
+		return err
+	case ctx.Err() != nil:
+		return fmt.Errorf("download interrupted, run the same command to resume: %w", ctx.Err())
+	case err != nil:
+		return err
+	}
+
+	// Resumed part file could be longer
+	if err := part.Truncate(int64(conn.Size)); err != nil {
+		return err
+	}
+
+	if err := part.Close(); err != nil {
+		return err
+	}
+
+	mod_time := time.Unix(int64(conn.ModTime), 0)
+	if err := os.Chtimes(part_path, mod_time, mod_time); err != nil {
+		return err
+	}
+	return os.Rename(part_path, local)
+}
+
+func mkdir(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mkdir", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	return s.Mkdir(ctx, dirPath(fs.Arg(0)))
+}
+
+func rm(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	recursive := fs.Bool("r", false, "remove directory with all files")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	target := remotePath(fs.Arg(0))
+	if strings.HasSuffix(target, "/") && !*recursive {
+		return fmt.Errorf("%s: %w, use -r", target, ErrIsDirectory)
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	if *recursive {
+		return s.Rmdir(ctx, dirPath(target))
+	}
+	return s.Remove(ctx, target)
+}
+
+func mv(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mv", flag.ContinueOnError)
+	force := fs.Bool("f", false, "replace existing file")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	from, to := remotePath(fs.Arg(0)), remotePath(fs.Arg(1))
+
+	// File is moved into directory, like with mv in shell
+	if !strings.HasSuffix(from, "/") && strings.HasSuffix(to, "/") {
+		to += path.Base(from)
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	return s.Move(ctx, from, to, *force)
+}
+
+func df(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("df", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	space, err := s.AvailableSpace(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Available: %s\n", humanSize(space))
+	return nil
+}
+
+func share(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("share", flag.ContinueOnError)
+	expire := fs.Duration("expire", 0, "link lifetime (default 7 days)")
+	list := fs.Bool("l", false, "list public links")
+	remove := fs.String("rm", "", "remove public link by token")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	// Path is needed only for new link
+	need_path := *remove == "" && !*list
+	if (need_path && fs.NArg() != 1) || (!need_path && fs.NArg() != 0) {
+		fmt.Fprint(os.Stderr, USAGE)
+		return ErrUsage
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	switch {
+	case *remove != "":
+		return s.RemoveShare(ctx, *remove)
+
+	case *list:
+		shares, err := s.Shares(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, link := range shares {
+			fmt.Printf("%s  %s  %s\n", time.Unix(link.Expires, 0).Format(time.DateTime), link.Path, s.ShareURL(link))
+		}
+		return nil
+	}
+
+	link, err := s.CreateShare(ctx, remotePath(fs.Arg(0)), *expire)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\nExpires: %s\n", s.ShareURL(link), time.Unix(link.Expires, 0).Format(time.DateTime))
+	return nil
+}
+
+// List login sessions of user or sign out one of them
+func sessions(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sessions", flag.ContinueOnError)
+	remove := fs.String("rm", "", "sign out session by id")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	if *remove != "" {
+		return s.RevokeSession(ctx, *remove)
+	}
+
+	list, err := s.Sessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range list {
+		current := ""
+		if session.Current {
+			current = "  (current)"
+		}
+		fmt.Printf("%s  %s  %s  %s  %s%s\n", session.ID, time.Unix(session.LastUsed, 0).Format(time.DateTime),
+			session.IP, session.Device, session.UserAgent, current)
+	}
+	return nil
+}
+
+// Change password. Server ends all sessions, so new one is opened with new password.
+func passwd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("passwd", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	current := os.Getenv(PASSWORD_ENV)
+	if current == "" {
+		if current, err = terminal.ReadPassword("Current password: "); err != nil {
+			return err
+		}
+	}
+
+	password, err := terminal.ReadNewPassword("New password: ")
+	if err != nil {
+		return err
+	}
+
+	if err := s.ChangePassword(ctx, current, password); err != nil {
+		return err
+	}
+
+	if _, err := loginWithCode(ctx, s.Client); err != nil {
+		return err
+	}
+
+	fmt.Println("Password changed, sessions on other devices are ended")
+	return nil
+}
+
+// Set new password with one-time token from server administrator
+func reset(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	insecure := fs.Bool("insecure", false, "don't verify server certificate")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	password, err := terminal.ReadNewPassword("New password: ")
+	if err != nil {
+		return err
+	}
+
+	c := client.New(client.Config{
+		URL:       strings.TrimSuffix(fs.Arg(0), "/"),
+		UserAgent: USER_AGENT,
+		Insecure:  *insecure,
+	})
+
+	if err := c.ResetPassword(ctx, fs.Arg(1), password); err != nil {
+		return err
+	}
+
+	fmt.Println("Password changed, log in with new password: mhctl login")
+	return nil
+}
+
+// Create invite link for new user, list invites or revoke unused one
+func invite(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("invite", flag.ContinueOnError)
+	username := fs.String("user", "", "invite works only for this username")
+	list := fs.Bool("l", false, "list invites")
+	remove := fs.String("rm", "", "revoke unused invite by key")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	switch {
+	case *remove != "":
+		return s.RevokeInvite(ctx, *remove)
+
+	case *list:
+		invites, err := s.Invites(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Available: %d of %d\n", invites.Available, invites.Allowance)
+		for _, unused := range invites.Unused {
+			fmt.Printf("%s  %s  %s\n", time.Unix(unused.Expires, 0).Format(time.DateTime), s.InviteURL(unused), unused.Username)
+		}
+
+		for _, name := range invites.Registered {
+			fmt.Printf("Registered: %s\n", name)
+		}
+		return nil
+	}
+
+	created, err := s.CreateInvite(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\nExpires: %s\nNew user registers with: mhctl register <link> <user>\n",
+		s.InviteURL(created), time.Unix(created.Expires, 0).Format(time.DateTime))
+	return nil
+}
+
+// Show, enable or disable two-factor authentication
+func totp(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("totp", flag.ContinueOnError)
+	enable := fs.Bool("enable", false, "enable two-factor authentication")
+	disable := fs.Bool("disable", false, "disable two-factor authentication")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	if *enable && *disable {
+		fmt.Fprint(os.Stderr, USAGE)
+		return ErrUsage
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	switch {
+	case *enable:
+		enrollment, err := s.EnrollTOTP(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Add account to authenticator app by link or secret:\n%s\nSecret: %s\n", enrollment.URI, enrollment.Secret)
+		code, err := terminal.ReadLine("Code from authenticator app: ")
+		if err != nil {
+			return err
+		}
+
+		codes, err := s.ConfirmTOTP(ctx, code)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Two-factor authentication enabled. Save recovery codes, each of them can be used once instead of code:")
+		for _, recovery_code := range codes {
+			fmt.Println(recovery_code)
+		}
+		return nil
+
+	case *disable:
+		password := os.Getenv(PASSWORD_ENV)
+		if password == "" {
+			if password, err = terminal.ReadPassword("Password: "); err != nil {
+				return err
+			}
+		}
+
+		code, err := terminal.ReadLine("Code from authenticator app or recovery code: ")
+		if err != nil {
+			return err
+		}
+
+		if err := s.DisableTOTP(ctx, password, code); err != nil {
+			return err
+		}
+
+		fmt.Println("Two-factor authentication disabled")
+		return nil
+	}
+
+	status, err := s.TOTPStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !status.Enabled {
+		fmt.Println("Two-factor authentication is disabled, enable it: mhctl totp -enable")
+		return nil
+	}
+	fmt.Printf("Two-factor authentication is enabled, recovery codes left: %d\n", status.RecoveryCodes)
+	return nil
+}
+
+// Create personal token for scripts, list tokens or revoke one
+func token(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	scopes := fs.String("scope", client.SCOPE_FILES_READ, "comma separated scopes: files:read, files:write, admin")
+	expire := fs.Duration("expire", 0, "token lifetime (default never expires)")
+	list := fs.Bool("l", false, "list personal tokens")
+	remove := fs.Int64("rm", 0, "revoke personal token by id")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	// Name is needed only for new token
+	need_name := *remove == 0 && !*list
+	if (need_name && fs.NArg() != 1) || (!need_name && fs.NArg() != 0) || *expire < 0 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return ErrUsage
+	}
+
+	s, err := openSession()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	switch {
+	case *remove != 0:
+		return s.RevokePersonalToken(ctx, *remove)
+
+	case *list:
+		tokens, err := s.PersonalTokens(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, personal_token := range tokens {
+			expires, last_used := "never expires", "never used"
+			if personal_token.Expires != 0 {
+				expires = "expires " + time.Unix(personal_token.Expires, 0).Format(time.DateTime)
+			}
+
+			if personal_token.LastUsed != 0 {
+				last_used = "used " + time.Unix(personal_token.LastUsed, 0).Format(time.DateTime)
+			}
+
+			fmt.Printf("%d  %s  %s  %s, %s\n", personal_token.ID, personal_token.Name,
+				strings.Join(personal_token.Scopes, ","), expires, last_used)
+		}
+		return nil
+	}
+
+	secret, _, err := s.CreatePersonalToken(ctx, fs.Arg(0), strings.Split(*scopes, ","), *expire)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(secret)
+	fmt.Fprintln(os.Stderr, "Token is shown only once. Send it in header: Authorization: Bearer <token>")
+	return nil
+}
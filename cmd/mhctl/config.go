@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	CONFIG_DIRNAME  string = "mhctl"
+	CONFIG_FILENAME string = "config.json"
+
+	// Config file path can be changed with environment variable
+	CONFIG_ENV string = "MHCTL_CONFIG"
+)
+
+var (
+	ErrNotLoggedIn = errors.New("not logged in, run: mhctl login <server> <user>")
+)
+
+// Saved session. Password isn't saved: tokens are renewed with refresh token, MHCTL_PASSWORD or by login again.
+type Config struct {
+	Server       string `json:"server"`
+	User         string `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Insecure     bool   `json:"insecure,omitempty"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv(CONFIG_ENV); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, CONFIG_DIRNAME, CONFIG_FILENAME), nil
+}
+
+func loadConfig() (Config, error) {
+	var cfg Config
+
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, ErrNotLoggedIn
+	} else if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Server == "" || cfg.User == "" {
+		return cfg, ErrNotLoggedIn
+	}
+	return cfg, nil
+}
+
+// Save config readable only by user, because it contains token
+func saveConfig(cfg Config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp_path := path + ".tmp"
+	if err := os.WriteFile(tmp_path, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp_path, path)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/braginantonev/mhserver/pkg/client"
+	"github.com/braginantonev/mhserver/version"
+)
+
+var USER_AGENT = "mhctl/" + version.Version
+
+const USAGE string = `Usage: mhctl <command> [flags] [args]
+
+Commands:
+  login [-insecure] <server> <user>  log in and save session
+  logout                             end session
+  sessions                           list sessions on all devices
+  sessions -rm <id>                  sign out session on other device
+  passwd                             change password and end other sessions
+  reset [-insecure] <server> <token> set new password with token from administrator
+  register [-insecure] <link> <user> register by invite link and log in
+  invite [-user name]                create invite link for new user
+  invite -l                          list invites and users registered by them
+  invite -rm <key>                   revoke unused invite
+  totp                               show two-factor authentication status
+  totp -enable                       enable two-factor authentication with authenticator app
+  totp -disable                      disable two-factor authentication
+  token [-scope files:read] [-expire 720h] <name>
+                                     create personal token for scripts. Scopes: files:read,
+                                     files:write (includes files:read), admin
+  token -l                           list personal tokens
+  token -rm <id>                     revoke personal token
+  ls [dir]                           list directory (default "/")
+  put <local file> [remote path]     upload file. Interrupted upload is resumed
+  get <remote file> [local path]     download file. Interrupted download is resumed
+  mkdir <dir>                        create directory with parents
+  rm [-r] <path>                     remove file, or directory with -r
+  mv [-f] <from> <to>                move or rename file or directory, -f replaces existing file
+  df                                 show available space
+  share [-expire 24h] <file>         create public link to file
+  share -l                           list public links
+  share -rm <token>                  remove public link
+  version                            show version
+
+Remote paths start from root of user files: "/docs/cv.pdf", directories end with "/".
+Session is saved in ~/.config/mhctl/config.json (MHCTL_CONFIG) and renewed automatically.
+If MHCTL_PASSWORD is set, it's used for login and when session is expired.
+`
+
+var (
+	// Wrong arguments. Usage is already printed.
+	ErrUsage = errors.New("bad usage")
+)
+
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"login":    login,
+	"logout":   logout,
+	"sessions": sessions,
+	"passwd":   passwd,
+	"reset":    reset,
+	"register": register,
+	"invite":   invite,
+	"totp":     totp,
+	"token":    token,
+	"ls":       ls,
+	"put":      put,
+	"get":      get,
+	"mkdir":    mkdir,
+	"rm":       rm,
+	"mv":       mv,
+	"df":       df,
+	"share":    share,
+	"version": func(context.Context, []string) error {
+		fmt.Println(version.Version)
+		return nil
+	},
+}
+
+// Parse flags of command and check count of arguments
+func parseFlags(fs *flag.FlagSet, args []string, min_args, max_args int) error {
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, USAGE)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	if fs.NArg() < min_args || fs.NArg() > max_args {
+		fs.Usage()
+		return ErrUsage
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, USAGE)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		switch os.Args[1] {
+		case "-h", "--help", "help":
+			fmt.Print(USAGE)
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "mhctl: unknown command %q\n\n%s", os.Args[1], USAGE)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := cmd(ctx, os.Args[2:])
+	stop()
+
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, ErrUsage):
+		os.Exit(2)
+	case errors.Is(err, client.ErrUnauthorized):
+		fmt.Fprintln(os.Stderr, "mhctl: session expired, run: mhctl login <server> <user>")
+	default:
+		fmt.Fprintln(os.Stderr, "mhctl:", err)
+	}
+	os.Exit(1)
+}
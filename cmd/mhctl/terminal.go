@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/terminal"
+)
+
+// Progress bar is redrawn not more often than this
+const PROGRESS_REDRAW_INTERVAL time.Duration = 100 * time.Millisecond
+
+func humanSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Transfer progress bar in stderr. Nothing is drawn, if stderr isn't terminal.
+type progressBar struct {
+	name    string
+	enabled bool
+
+	start     time.Time
+	last_draw time.Time
+}
+
+func newProgressBar(name string) *progressBar {
+	return &progressBar{
+		name:    name,
+		enabled: terminal.IsTerminal(os.Stderr),
+		start:   time.Now(),
+	}
+}
+
+func (p *progressBar) Update(done, total uint64) {
+	if !p.enabled || (done < total && time.Since(p.last_draw) < PROGRESS_REDRAW_INTERVAL) {
+		return
+	}
+	p.last_draw = time.Now()
+
+	const width = 30
+	filled := width
+	if total > 0 {
+		filled = int(done * width / total)
+	}
+
+	var speed uint64
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		speed = uint64(float64(done) / elapsed)
+	}
+
+	fmt.Fprintf(os.Stderr, "\r\033[K%s [%s%s] %s / %s %s/s",
+		p.name, strings.Repeat("#", filled), strings.Repeat(" ", width-filled), humanSize(done), humanSize(total), humanSize(speed))
+}
+
+// End line of progress bar
+func (p *progressBar) Done() {
+	if p.enabled && !p.last_draw.IsZero() {
+		fmt.Fprintln(os.Stderr)
+	}
+}
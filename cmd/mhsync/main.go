@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/mhsync"
+	"github.com/braginantonev/mhserver/pkg/client"
+	"github.com/braginantonev/mhserver/version"
+)
+
+func main() {
+	server_url := flag.String("server", "", "server address (https://example.com:8443)")
+	username := flag.String("user", "", "username")
+	local_path := flag.String("dir", ".", "local folder to sync")
+	state_path := flag.String("state", "", "state file (default <dir>/"+mhsync.STATE_FILENAME+")")
+	device := flag.String("device", "", "device name in conflict copies (default hostname)")
+	interval := flag.Duration("interval", mhsync.DEFAULT_INTERVAL, "sync interval")
+	once := flag.Bool("once", false, "sync once and exit")
+	insecure := flag.Bool("insecure", false, "don't verify server certificate")
+	verbose := flag.Bool("v", false, "verbose logs")
+	flag.Parse()
+
+	fmt.Printf("Mhsync (ver. %s)\n", version.Version)
+
+	if *verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	// Password isn't passed in arguments, because they are visible to other users
+	password := os.Getenv("MHSYNC_PASSWORD")
+	if *server_url == "" || *username == "" || password == "" {
+		fmt.Fprintln(os.Stderr, "server, user and MHSYNC_PASSWORD environment variable are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	device_name := *device
+	if device_name == "" {
+		device_name, _ = os.Hostname()
+	}
+
+	syncer, err := mhsync.New(mhsync.Config{
+		LocalPath: *local_path,
+		StatePath: *state_path,
+		Device:    *device,
+		Interval:  *interval,
+	}, mhsync.NewHTTPRemote(client.New(client.Config{
+		URL:       *server_url,
+		Username:  *username,
+		Password:  password,
+		Device:    device_name,
+		UserAgent: "mhsync/" + version.Version,
+		Insecure:  *insecure,
+	})))
+	if err != nil {
+		slog.Error("failed init sync", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		start := time.Now()
+		if err := syncer.Sync(ctx); err != nil {
+			slog.Error("Failed sync files", slog.Any("error", err))
+			os.Exit(1)
+		}
+		slog.Info("Files synced", slog.Duration("duration", time.Since(start)))
+		return
+	}
+
+	if err := syncer.Run(ctx); err != nil {
+		slog.Error("Failed run sync", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
@@ -17,7 +17,7 @@ require github.com/pelletier/go-toml/v2 v2.4.3
 
 require (
 	filippo.io/edwards25519 v1.2.0 // indirect
-	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/net v0.56.0
 	golang.org/x/text v0.40.0 // indirect
 	golang.org/x/time v0.15.0
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
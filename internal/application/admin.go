@@ -0,0 +1,82 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	appconfig "github.com/braginantonev/mhserver/internal/config/application"
+	"github.com/braginantonev/mhserver/internal/di"
+	"github.com/braginantonev/mhserver/internal/repository/database"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+)
+
+var (
+	ErrWorkspaceNotDir = errors.New("workspace path is not a directory")
+)
+
+// Auth service for administration commands (users and registration keys). Commands don't issue tokens, so keys aren't loaded.
+func (app *Application) AuthService() *auth.AuthService {
+	return di.SetupAuthService(app.cfg, app.db, nil)
+}
+
+// Apply database migrations. Return names of applied migrations.
+func (app *Application) Migrate() ([]string, error) {
+	return database.Migrate(app.db)
+}
+
+/*
+Check, that server can be started with config: workspace, TLS files and jwt keys exist, database is available
+and migrated. Config itself is checked by LoadConfig. Return all found problems.
+*/
+func CheckConfig(cfg appconfig.ApplicationConfig) []error {
+	problems := make([]error, 0)
+
+	if info, err := os.Stat(cfg.WorkspacePath); err != nil {
+		problems = append(problems, fmt.Errorf("workspace: %w", err))
+	} else if !info.IsDir() {
+		problems = append(problems, fmt.Errorf("%w: %s", ErrWorkspaceNotDir, cfg.WorkspacePath))
+	}
+
+	for _, file := range []string{TLS_CERT_FILE, TLS_KEY_FILE} {
+		if _, err := os.Stat(CONFIG_DIRECTORY + file); err != nil {
+			problems = append(problems, fmt.Errorf("tls: %w", err))
+		}
+	}
+
+	// First key is generated on start, if it doesn't exist
+	for i, path := range cfg.JWT.Keys {
+		pem_bytes, err := os.ReadFile(path)
+		if i == 0 && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err == nil {
+			var key auth.SigningKey
+			if key, err = auth.ParseSigningKey(pem_bytes); err == nil && i == 0 && key.Private == nil {
+				err = auth.ErrPublicSigningKey
+			}
+		}
+
+		if err != nil {
+			problems = append(problems, fmt.Errorf("jwt key %s: %w", path, err))
+		}
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return append(problems, fmt.Errorf("database: %w", err))
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	pending, err := database.PendingMigrations(db)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("database: %w", err))
+	} else if len(pending) > 0 {
+		problems = append(problems, fmt.Errorf("database: %w: %v, run: mhserver migrate", database.ErrNotMigrated, pending))
+	}
+
+	return problems
+}
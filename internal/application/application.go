@@ -3,6 +3,7 @@ package application
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -10,8 +11,10 @@ import (
 
 	appconfig "github.com/braginantonev/mhserver/internal/config/application"
 	"github.com/braginantonev/mhserver/internal/di"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
 	"github.com/braginantonev/mhserver/internal/repository/database"
 	"github.com/braginantonev/mhserver/internal/server"
+	"github.com/braginantonev/mhserver/internal/service/auth"
 	"github.com/go-sql-driver/mysql"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -26,6 +29,8 @@ const (
 
 	DATABASE_NAME    string = "mhserver"
 	CONFIG_DIRECTORY string = "/usr/share/mhserver/"
+	TLS_CERT_FILE    string = "ssl/org.crt"
+	TLS_KEY_FILE     string = "ssl/rootCA.key"
 )
 
 type Application struct {
@@ -33,13 +38,15 @@ type Application struct {
 	db  *sql.DB
 }
 
-func NewApplication() (*Application, error) {
+// Load and check application config from CONFIG_DIRECTORY
+func LoadConfig() (appconfig.ApplicationConfig, error) {
 	cfg := appconfig.NewApplicationConfig(true)
-	if err := cfg.Init(CONFIG_DIRECTORY, DATABASE_NAME); err != nil {
-		return nil, err
-	}
+	err := cfg.Init(CONFIG_DIRECTORY, DATABASE_NAME)
+	return cfg, err
+}
 
-	db, err := database.OpenDB(mysql.Config{
+func openDB(cfg appconfig.ApplicationConfig) (*sql.DB, error) {
+	return database.OpenDB(mysql.Config{
 		User:                 "mhserver",
 		Passwd:               cfg.DB_Pass,
 		Net:                  "tcp",
@@ -47,6 +54,15 @@ func NewApplication() (*Application, error) {
 		DBName:               "mhs_main",
 		AllowNativePasswords: true,
 	})
+}
+
+func NewApplication() (*Application, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +79,16 @@ func (app *Application) runMain(ctx context.Context) error {
 		return nil
 	}
 
+	// Main server works with tables of all migrations, so it isn't started with old database
+	pending, err := database.PendingMigrations(app.db)
+	if err != nil {
+		return fmt.Errorf("failed check database migrations: %w", err)
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %v, run: mhserver migrate", database.ErrNotMigrated, pending)
+	}
+
 	connections := make(map[string]*grpc.ClientConn)
 
 	//* Sub servers connections
@@ -86,10 +112,38 @@ func (app *Application) runMain(ctx context.Context) error {
 	}
 
 	srv := server.NewServer(app.cfg.Memory.WithAllocated(app.cfg.SubServers["main"].Extra.AllocatedMemory))
-	srv.AuthTransport = di.SetupAuthTransport(ctx, di.SetupAuthService(app.cfg, app.db))
-	srv.DataTransport = di.SetupDataTransport(ctx, di.GetDataServerClient(connections["files"]))
+	signing_keys, err := auth.LoadSigningKeys(app.cfg.JWT.Keys)
+	if err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+
+	if len(signing_keys) == 0 {
+		slog.Warn("JWT keys aren't configured, access tokens are signed by jwt_signature (HS256)")
+	}
 
-	return srv.Serve(fmt.Sprintf("%s:%d", app.cfg.SubServers["main"].Address, app.cfg.SubServers["main"].Port), CONFIG_DIRECTORY+"ssl/org.crt", CONFIG_DIRECTORY+"ssl/rootCA.key")
+	auth_service := di.SetupAuthService(app.cfg, app.db, signing_keys)
+	srv.AuthTransport = di.SetupAuthTransport(ctx, auth_service)
+	srv.DataTransport = di.SetupDataTransport(ctx, app.cfg, di.GetDataServerClient(connections["files"]), srv.Semaphore())
+
+	if app.cfg.WebDAV.Enabled {
+		slog.Info("WebDAV enabled", slog.String("endpoint", server.DAV_ENDPOINT+"/"))
+		srv.DavHandler = di.SetupDavHandler(server.DAV_ENDPOINT, app.cfg, auth_service)
+	}
+
+	if app.cfg.SFTP.Enabled {
+		sftp_srv, err := di.SetupSFTPServer(app.cfg, auth_service)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := sftp_srv.ListenAndServe(ctx); err != nil {
+				slog.Error("error serve sftp server", slog.String("err", err.Error()))
+			}
+		}()
+	}
+
+	return srv.Serve(fmt.Sprintf("%s:%d", app.cfg.SubServers["main"].Address, app.cfg.SubServers["main"].Port), CONFIG_DIRECTORY+TLS_CERT_FILE, CONFIG_DIRECTORY+TLS_KEY_FILE)
 }
 
 func (app *Application) runSubserver(ctx context.Context, wait bool) error {
@@ -145,6 +199,18 @@ func (app *Application) runSubserver(ctx context.Context, wait bool) error {
 	return nil
 }
 
+// Encrypt files, which were saved before encryption was enabled
+func (app *Application) EncryptFiles() error {
+	files_srv, ok := app.cfg.SubServers["files"]
+	if !ok {
+		return errors.New("files subserver not configured")
+	}
+
+	count, err := data.EncryptExistingFiles(context.Background(), di.GetDataServerConfig(app.cfg, *files_srv))
+	slog.Info("Files encryption finished", slog.Int("encrypted", count))
+	return err
+}
+
 func (app *Application) Run(mode ApplicationMode) error {
 	slog.Info("Run application with", slog.Int("mode", int(mode)))
 
@@ -19,6 +19,10 @@ const (
 	DEFAULT_CONFIG_FILENAME string = CONFIG_FILENAME + ".default"
 )
 
+var (
+	ErrMainServerNotConfigured = errors.New("main subserver is not configured")
+)
+
 type SubServer struct {
 	Enabled bool
 	Address string
@@ -34,8 +38,16 @@ type SubServerExtra struct {
 type ApplicationConfig struct {
 	WorkspacePath string `toml:"workspace_path"`
 	JWTSignature  string `toml:"jwt_signature"`
+	JWT           config.JWTConfig
 	DB_Pass       string `toml:"db_pass"`
 	Memory        config.MemoryConfig
+	Encryption    config.EncryptionConfig
+	WebDAV        config.WebDAVConfig
+	SFTP          config.SFTPConfig
+	Watcher       config.WatcherConfig
+	Invites       config.InvitesConfig
+	Lockout       config.LockoutConfig
+	Tus           config.TusConfig
 	SubServers    map[string]*SubServer
 
 	with_default bool
@@ -88,6 +100,10 @@ func (cfg *ApplicationConfig) Init(config_dir, db_name string) error {
 		return err
 	}
 
+	if _, ok := cfg.SubServers["main"]; !ok {
+		return ErrMainServerNotConfigured
+	}
+
 	slog.Info("Configuration loaded.")
 	slog.Info(fmt.Sprintf("Server allocated memory: %d bytes", cfg.Memory.Allocated))
 	slog.Info(fmt.Sprintf("Server will be started at %s:%d", cfg.SubServers["main"].Address, cfg.SubServers["main"].Port))
@@ -118,5 +134,9 @@ func (cfg *ApplicationConfig) Init(config_dir, db_name string) error {
 		return err
 	}
 
+	if err := cfg.checkEncryption(); err != nil {
+		return err
+	}
+
 	return nil
 }
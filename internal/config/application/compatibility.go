@@ -1,6 +1,10 @@
 package appconfig
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+)
 
 func (cfg *ApplicationConfig) checkMemoryIncompatibility() error {
 	min_allocated_memory := cfg.Memory.MaxChunkSize + 1024 // 1024 - http request meta
@@ -22,3 +26,15 @@ func (cfg *ApplicationConfig) checkMemoryIncompatibility() error {
 
 	return nil
 }
+
+func (cfg *ApplicationConfig) checkEncryption() error {
+	if !cfg.Encryption.Enabled {
+		return nil
+	}
+
+	if _, err := filecrypt.ParseMasterKey(cfg.Encryption.MasterKey); err != nil {
+		return fmt.Errorf("encryption enabled, but %w", err)
+	}
+
+	return nil
+}
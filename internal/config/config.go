@@ -18,6 +18,73 @@ type MemoryConfig struct {
 	MinChunkSize uint64 `toml:"min_chunk_size"`
 }
 
+type EncryptionConfig struct {
+	Enabled bool
+
+	// Hex string with 32 bytes key. User keys derived from him.
+	MasterKey string `toml:"master_key"`
+}
+
+type WebDAVConfig struct {
+	Enabled bool
+}
+
+type SFTPConfig struct {
+	Enabled bool
+	Address string
+	Port    int
+
+	// Path to ssh host key. Key is generated on first start.
+	HostKey string `toml:"host_key"`
+}
+
+type WatcherConfig struct {
+	Enabled bool
+
+	// Use only periodic rescans instead of inotify (for network file systems)
+	RescanOnly bool `toml:"rescan_only"`
+
+	// Seconds between rescans, when inotify is not used
+	RescanInterval int `toml:"rescan_interval"`
+}
+
+type InvitesConfig struct {
+	// Count of invites, which each user can have: unused invites and users registered by them. 0 disables invites.
+	PerUser int `toml:"per_user"`
+
+	// Seconds, while invite can be used
+	Lifetime int
+}
+
+type TusConfig struct {
+	// Seconds without requests, after which unfinished resumable upload is removed
+	Lifetime int
+}
+
+type JWTConfig struct {
+	// PEM files of Ed25519 or RSA keys. First key signs access tokens, others only verify tokens signed before rotation.
+	// Without keys tokens are signed by jwt_signature (HS256).
+	Keys []string
+
+	// Seconds, while access token is valid
+	Lifetime int
+
+	// Written to tokens and checked. Empty values aren't checked.
+	Issuer   string
+	Audience string
+}
+
+type LockoutConfig struct {
+	// Failed logins of username in a row, after which it's locked. 0 disables lockout and delays.
+	MaxFailures int `toml:"max_failures"`
+
+	// Seconds of delay after first failed login, it doubles after each next failure
+	BaseDelay int `toml:"base_delay"`
+
+	// Seconds of lockout. Failures are forgotten after the same time without them.
+	Duration int
+}
+
 func (m MemoryConfig) WithAllocated(value uint64) MemoryConfig {
 	m.Allocated = value
 	return m
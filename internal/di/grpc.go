@@ -10,10 +10,14 @@ import (
 )
 
 func regDataServer(ctx context.Context, grpc *grpc.Server, app_cfg appconfig.ApplicationConfig, server_cfg appconfig.SubServer) {
-	data_pb.RegisterDataServiceServer(grpc, data.NewDataServer(ctx, data.NewDataServerConfig(
+	data_pb.RegisterDataServiceServer(grpc, data.NewDataServer(ctx, GetDataServerConfig(app_cfg, server_cfg)))
+}
+
+func GetDataServerConfig(app_cfg appconfig.ApplicationConfig, server_cfg appconfig.SubServer) data.DataServiceConfig {
+	return data.NewDataServerConfig(
 		app_cfg.WorkspacePath,
 		app_cfg.Memory.WithAllocated(server_cfg.Extra.AllocatedMemory),
-	)))
+	).WithEncryption(app_cfg.Encryption).WithWatcher(app_cfg.Watcher)
 }
 
 func RegisterGrpcServer(ctx context.Context, server_name string, grpc *grpc.Server, app_cfg appconfig.ApplicationConfig) bool {
@@ -2,20 +2,34 @@ package di
 
 import (
 	"database/sql"
+	"time"
 
 	appconfig "github.com/braginantonev/mhserver/internal/config/application"
 	"github.com/braginantonev/mhserver/internal/service/auth"
 )
 
-func SetupAuthService(app_cfg appconfig.ApplicationConfig, db *sql.DB) *auth.AuthService {
+// Signing keys are loaded by caller, without them tokens are signed by jwt signature
+func SetupAuthService(app_cfg appconfig.ApplicationConfig, db *sql.DB, signing_keys []auth.SigningKey) *auth.AuthService {
 	available_services := make([]string, 0, len(app_cfg.SubServers))
 	for sub := range app_cfg.SubServers {
 		available_services = append(available_services, sub)
 	}
 
 	return auth.NewAuthService(auth.AuthConfig{
-		JWTSignature:  app_cfg.JWTSignature,
+		JWTSignature:        app_cfg.JWTSignature,
+		SigningKeys:         signing_keys,
+		AccessTokenLifetime: time.Duration(app_cfg.JWT.Lifetime) * time.Second,
+		Issuer:              app_cfg.JWT.Issuer,
+		Audience:            app_cfg.JWT.Audience,
+
 		WorkspacePath: app_cfg.WorkspacePath,
 		UserCatalogs:  available_services[1:],
+
+		InvitesPerUser: app_cfg.Invites.PerUser,
+		InviteLifetime: time.Duration(app_cfg.Invites.Lifetime) * time.Second,
+
+		MaxLoginFailures: app_cfg.Lockout.MaxFailures,
+		LoginBaseDelay:   time.Duration(app_cfg.Lockout.BaseDelay) * time.Second,
+		LockoutDuration:  time.Duration(app_cfg.Lockout.Duration) * time.Second,
 	}, db)
 }
@@ -5,9 +5,12 @@ import (
 	"time"
 
 	"github.com/braginantonev/mhserver/internal/config"
+	appconfig "github.com/braginantonev/mhserver/internal/config/application"
 	authhttp "github.com/braginantonev/mhserver/internal/http/auth"
 	datahttp "github.com/braginantonev/mhserver/internal/http/data"
+	davhttp "github.com/braginantonev/mhserver/internal/http/dav"
 	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/internal/sftp"
 	data_pb "github.com/braginantonev/mhserver/proto/data"
 )
 
@@ -21,12 +24,27 @@ func SetupAuthTransport(ctx context.Context, auth_service *auth.AuthService) *au
 	)
 }
 
-func SetupDataTransport(ctx context.Context, client data_pb.DataServiceClient) *datahttp.DataTransport {
+func SetupDataTransport(ctx context.Context, app_cfg appconfig.ApplicationConfig, client data_pb.DataServiceClient, sem chan any) *datahttp.DataTransport {
 	return datahttp.NewDataTransport(
-		datahttp.NewHandler(client),
+		datahttp.NewHandler(client).WithSemaphore(sem).WithTusLifetime(time.Duration(app_cfg.Tus.Lifetime)*time.Second),
 		datahttp.NewMiddleware(ctx, config.LimiterConfig{
 			Limit:    100,
 			Interval: time.Second * 5,
 		}),
 	)
 }
+
+func SetupDavHandler(prefix string, app_cfg appconfig.ApplicationConfig, auth_service *auth.AuthService) *davhttp.Handler {
+	return davhttp.NewHandler(prefix, app_cfg.WorkspacePath, auth_service, app_cfg.Encryption)
+}
+
+func SetupSFTPServer(app_cfg appconfig.ApplicationConfig, auth_service *auth.AuthService) (*sftp.Server, error) {
+	services := make([]config.ServiceName, 0, len(app_cfg.SubServers))
+	for name := range app_cfg.SubServers {
+		if name != "main" {
+			services = append(services, config.ServiceName(name))
+		}
+	}
+
+	return sftp.NewServer(app_cfg.SFTP, app_cfg.WorkspacePath, services, auth_service, app_cfg.Encryption)
+}
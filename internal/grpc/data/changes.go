@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+)
+
+// Journal and uploads are checked with this interval. Journal is shared with other processes, so it's polled.
+const WATCH_INTERVAL time.Duration = time.Second
+
+// Record changes in user journal. Journal errors don't fail request, because file is already changed.
+func (s *DataServer) record(ctx context.Context, user string, events ...journal.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	if err := s.journal.Record(user, events...); err != nil {
+		slog.WarnContext(ctx, "failed record change", slog.String("user", user), slog.Any("err", err))
+	}
+}
+
+func changeToPb(event journal.Event) *pb.Change {
+	return &pb.Change{
+		Cursor:  event.Cursor,
+		Time:    event.Time,
+		Op:      string(event.Op),
+		Path:    event.Path,
+		OldPath: event.OldPath,
+		IsDir:   event.IsDir,
+		Size:    event.Size,
+	}
+}
+
+/*
+Return changes of user files after cursor in order they were made. If cursor is not set, return current cursor,
+so client can list all files and then sync from it.
+*/
+func (s *DataServer) GetChanges(ctx context.Context, req *pb.ChangesRequest) (*pb.ChangesList, error) {
+	defer func() {
+		<-s.sem
+	}()
+
+	s.sem <- struct{}{}
+
+	if req.Since == nil {
+		cursor, err := s.journal.Cursor(req.Username)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed get changes cursor", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+		return &pb.ChangesList{Cursor: cursor}, nil
+	}
+
+	changes, err := s.journal.Since(req.Username, *req.Since, int(req.Limit))
+	if err != nil {
+		if errors.Is(err, journal.ErrBadCursor) || errors.Is(err, journal.ErrCursorExpired) {
+			return nil, err
+		}
+
+		slog.ErrorContext(ctx, "failed read changes", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	list := &pb.ChangesList{
+		Changes: make([]*pb.Change, len(changes.Events)),
+		Cursor:  changes.Cursor,
+		HasMore: changes.HasMore,
+	}
+
+	for i, event := range changes.Events {
+		list.Changes[i] = changeToPb(event)
+	}
+
+	return list, nil
+}
+
+// Read all changes after cursor
+func (s *DataServer) pollChanges(user string, cursor uint64) ([]journal.Event, error) {
+	defer func() {
+		<-s.sem
+	}()
+
+	s.sem <- struct{}{}
+
+	var events []journal.Event
+	for {
+		changes, err := s.journal.Since(user, cursor, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, changes.Events...)
+		cursor = changes.Cursor
+		if !changes.HasMore {
+			return events, nil
+		}
+	}
+}
+
+/*
+Stream changes of user files and progress of user uploads, while client is connected.
+First event has only start cursor, it's sent after cursor check. Stream ends with ErrCursorExpired,
+if journal was compacted faster than changes were sent.
+*/
+func (s *DataServer) WatchChanges(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.WatchEvent]) error {
+	ctx := stream.Context()
+
+	var cursor uint64
+	if req.Since != nil {
+		cursor = *req.Since
+	} else {
+		var err error
+		if cursor, err = s.journal.Cursor(req.Username); err != nil {
+			slog.ErrorContext(ctx, "failed get changes cursor", slog.Any("err", err))
+			return ErrInternal
+		}
+	}
+
+	ticker := time.NewTicker(WATCH_INTERVAL)
+	defer ticker.Stop()
+
+	// Last sent loaded bytes of uploads by path
+	sent_progress := make(map[string]uint64)
+	started := false
+	for {
+		events, err := s.pollChanges(req.Username, cursor)
+		if err != nil {
+			if errors.Is(err, journal.ErrBadCursor) || errors.Is(err, journal.ErrCursorExpired) {
+				return err
+			}
+
+			slog.ErrorContext(ctx, "failed read changes", slog.Any("err", err))
+			return ErrInternal
+		}
+
+		if !started {
+			if err := stream.Send(&pb.WatchEvent{Cursor: cursor}); err != nil {
+				return err
+			}
+			started = true
+		}
+
+		for _, event := range events {
+			if err := stream.Send(&pb.WatchEvent{Cursor: event.Cursor, Change: changeToPb(event)}); err != nil {
+				return err
+			}
+			cursor = event.Cursor
+		}
+
+		uploads := s.activeConnections.Uploads(req.Username)
+		active := make(map[string]uint64, len(uploads))
+		for _, progress := range uploads {
+			active[progress.Path] = progress.Loaded
+			if loaded, ok := sent_progress[progress.Path]; ok && loaded == progress.Loaded {
+				continue
+			}
+
+			if err := stream.Send(&pb.WatchEvent{Cursor: cursor, Progress: progress}); err != nil {
+				return err
+			}
+		}
+		sent_progress = active
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
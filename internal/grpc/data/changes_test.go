@@ -0,0 +1,209 @@
+package data_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestGetChanges(t *testing.T) {
+	workspace_path := WORKSPACE_PATH + "changes/"
+	if err := createWorkspaceFolders(workspace_path, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(workspace_path, config.MemoryConfig{
+		MaxChunkSize: 64,                 //byte
+		MinChunkSize: 16,                 //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8090")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+	defer grpc_server.Stop()
+
+	grpc_connection, err := grpc.NewClient("localhost:8090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	// Client starts sync from current cursor
+	start, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(start.Changes) != 0 {
+		t.Fatalf("expected only cursor, but got %d changes", len(start.Changes))
+	}
+
+	const dir string = "/changes_test/"
+	if _, err := data_client.CreateDir(t.Context(), &pb.Directory{User: TEST_USER, Value: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	file_body := strings.Repeat(TEST_FILE_BODY, 2)
+	for range 2 {
+		err := saveFile(t.Context(), data_client, &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDWR,
+			Directory: dir,
+			Filename:  "notes.txt",
+			Size:      uint64(len(file_body)),
+		}, strings.NewReader(file_body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := data_client.RemoveDir(t.Context(), &pb.Directory{User: TEST_USER, Value: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*pb.Change{
+		{Op: string(journal.OP_CREATE), Path: dir, IsDir: true},
+		{Op: string(journal.OP_CREATE), Path: dir + "notes.txt", Size: uint64(len(file_body))},
+		{Op: string(journal.OP_MODIFY), Path: dir + "notes.txt", Size: uint64(len(file_body))},
+		{Op: string(journal.OP_REMOVE), Path: dir, IsDir: true},
+	}
+
+	t.Run("changes after cursor", func(t *testing.T) {
+		list, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER, Since: &start.Cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list.Changes) != len(expected) || list.HasMore {
+			t.Fatalf("expected %d changes, but got %v", len(expected), list.Changes)
+		}
+
+		for i, change := range list.Changes {
+			if change.Op != expected[i].Op || change.Path != expected[i].Path || change.IsDir != expected[i].IsDir || change.Size != expected[i].Size {
+				t.Errorf("expected change %v, but got %v", expected[i], change)
+			}
+		}
+
+		if list.Cursor != list.Changes[len(list.Changes)-1].Cursor {
+			t.Errorf("expected cursor of last change %d, but got %d", list.Changes[len(list.Changes)-1].Cursor, list.Cursor)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		list, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER, Since: &start.Cursor, Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list.Changes) != 3 || !list.HasMore {
+			t.Fatalf("expected 3 changes and more, but got %d (has more: %t)", len(list.Changes), list.HasMore)
+		}
+
+		list, err = data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER, Since: &list.Cursor})
+		if err != nil || len(list.Changes) != 1 || list.Changes[0].Op != string(journal.OP_REMOVE) {
+			t.Errorf("bad last page: %v (%v)", list, err)
+		}
+	})
+
+	t.Run("bad cursor", func(t *testing.T) {
+		bad_cursor := start.Cursor + 1
+		_, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER, Since: &bad_cursor})
+		if !errorIs(err, journal.ErrBadCursor) {
+			t.Errorf("expected error %v, but got %v", journal.ErrBadCursor, err)
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		stream, err := data_client.WatchChanges(ctx, &pb.WatchRequest{Username: TEST_USER, Since: &start.Cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ready, err := stream.Recv()
+		if err != nil || ready.Cursor != start.Cursor || ready.Change != nil {
+			t.Fatalf("bad first event: %v (%v)", ready, err)
+		}
+
+		for i := range expected {
+			event, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if event.Change == nil || event.Change.Op != expected[i].Op || event.Change.Path != expected[i].Path || event.Cursor != event.Change.Cursor {
+				t.Errorf("expected change %v, but got %v", expected[i], event)
+			}
+		}
+
+		// Upload progress is sent before upload end
+		conn, err := data_client.CreateConnection(ctx, &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDWR,
+			Directory: "/",
+			Filename:  "upload.txt",
+			Size:      uint64(len(file_body)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = data_client.SaveData(ctx, &pb.SaveChunk{
+			UUID: conn.UUID,
+			Data: &pb.FilePart{Chunk: []byte(file_body[:conn.ChunkSize])},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if event.Progress == nil {
+				t.Fatalf("expected upload progress, but got %v", event)
+			}
+
+			if event.Progress.Loaded == conn.ChunkSize {
+				if event.Progress.Path != "/upload.txt" || event.Progress.Size != uint64(len(file_body)) {
+					t.Errorf("bad upload progress: %v", event.Progress)
+				}
+				break
+			}
+		}
+	})
+
+	t.Run("watch bad cursor", func(t *testing.T) {
+		bad_cursor := start.Cursor + 1000000
+		stream, err := data_client.WatchChanges(t.Context(), &pb.WatchRequest{Username: TEST_USER, Since: &bad_cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := stream.Recv(); !errorIs(err, journal.ErrBadCursor) {
+			t.Errorf("expected error %v, but got %v", journal.ErrBadCursor, err)
+		}
+	})
+}
@@ -11,6 +11,8 @@ type DataServiceConfig struct {
 	ServiceName   config.ServiceName
 	WorkspacePath string // User files path
 	Memory        config.MemoryConfig
+	Encryption    config.EncryptionConfig
+	Watcher       config.WatcherConfig
 }
 
 func NewDataServerConfig(workspace_path string, data_memory_cfg config.MemoryConfig) DataServiceConfig {
@@ -20,3 +22,13 @@ func NewDataServerConfig(workspace_path string, data_memory_cfg config.MemoryCon
 		Memory:        data_memory_cfg,
 	}
 }
+
+func (cfg DataServiceConfig) WithEncryption(enc_cfg config.EncryptionConfig) DataServiceConfig {
+	cfg.Encryption = enc_cfg
+	return cfg
+}
+
+func (cfg DataServiceConfig) WithWatcher(watcher_cfg config.WatcherConfig) DataServiceConfig {
+	cfg.Watcher = watcher_cfg
+	return cfg
+}
@@ -3,10 +3,14 @@ package data
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
 	pb "github.com/braginantonev/mhserver/proto/data"
 	"github.com/google/uuid"
 )
@@ -38,6 +42,9 @@ type File struct {
 
 	path   string
 	chunks ChunksInfo
+
+	// Not nil, if file is encrypted on disk
+	enc *filecrypt.File
 }
 
 func (f File) GetPath() string {
@@ -52,6 +59,32 @@ func (f File) IsLoaded() bool {
 	return f.chunks.Loaded >= f.chunks.Count
 }
 
+func (f File) IsEncrypted() bool {
+	return f.enc != nil
+}
+
+// Read plain chunk by id
+func (f File) ReadChunk(id uint32) ([]byte, error) {
+	if f.enc != nil {
+		chunk, err := f.enc.ReadChunk(id)
+		if errors.Is(err, filecrypt.ErrChunkOutOfFile) {
+			return nil, io.EOF
+		}
+		return chunk, err
+	}
+
+	chunk := make([]byte, f.chunks.ChunkSize)
+	n, err := f.File.ReadAt(chunk, int64(f.chunks.ChunkSize)*int64(id))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if n == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	return chunk[:n], nil
+}
+
 func NewFile(file *os.File, path string, chunks_info ChunksInfo) File {
 	return File{
 		File:   file,
@@ -60,26 +93,58 @@ func NewFile(file *os.File, path string, chunks_info ChunksInfo) File {
 	}
 }
 
+func NewEncryptedFile(file *filecrypt.File, path string, chunks_info ChunksInfo) File {
+	return File{
+		File:   file.File,
+		path:   path,
+		chunks: chunks_info,
+		enc:    file,
+	}
+}
+
 type Connection struct {
-	mode       pb.ConnectionMode
-	file       File
-	expiration int64
+	mode pb.ConnectionMode
+	file File
+
+	// Unix time. It is updated by concurrent requests of one connection.
+	expiration atomic.Int64
+	// Time without requests, after which connection is closed
+	lifetime time.Duration
+
+	// Change of RDWR connection, which is recorded in user journal after last chunk
+	user   string
+	change *journal.Event
 }
 
 func NewConnection(file File, mode pb.ConnectionMode) *Connection {
-	return &Connection{
-		file:       file,
-		mode:       mode,
-		expiration: time.Now().Add(FILE_LIFETIME).Unix(),
+	conn := &Connection{
+		file:     file,
+		mode:     mode,
+		lifetime: FILE_LIFETIME,
 	}
+	conn.updateExpiration()
+	return conn
+}
+
+// Set own lifetime of connection, which is requested rarely (resumable uploads)
+func (p *Connection) withLifetime(lifetime time.Duration) *Connection {
+	p.lifetime = lifetime
+	p.updateExpiration()
+	return p
+}
+
+func (p *Connection) withChange(user string, change journal.Event) *Connection {
+	p.user = user
+	p.change = &change
+	return p
 }
 
 func (p *Connection) isExpired() bool {
-	return time.Now().Unix() > p.expiration
+	return time.Now().Unix() > p.expiration.Load()
 }
 
 func (p *Connection) updateExpiration() {
-	p.expiration = time.Now().Add(FILE_LIFETIME).Unix()
+	p.expiration.Store(time.Now().Add(p.lifetime).Unix())
 }
 
 func (p *Connection) GetFile() File {
@@ -155,20 +220,35 @@ func (m *Connections) Get(uuid uuid.UUID) (*Connection, bool) {
 	return info, true
 }
 
-// Update loaded chunks counter from file. Return ErrFileNotFound if file by uuid is not found.
-func (m *Connections) UpdateLoadedFileChunks(uuid uuid.UUID) error {
+// Remove connection from map and return it
+func (m *Connections) Pop(uuid uuid.UUID) (*Connection, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	conn, ok := m.value[uuid]
+	if ok {
+		delete(m.value, uuid)
+	}
+	return conn, ok
+}
+
+/*
+Update loaded chunks counter from file. Return true, if the last chunk was loaded.
+Return ErrFileNotFound if file by uuid is not found.
+*/
+func (m *Connections) UpdateLoadedFileChunks(uuid uuid.UUID) (bool, error) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 
 	info, ok := m.value[uuid]
 	if !ok {
-		return ErrFileNotFound
+		return false, ErrFileNotFound
 	}
 
 	info.file.chunks.Loaded += 1
 	info.updateExpiration()
 
-	return nil
+	return info.file.chunks.Loaded == info.file.chunks.Count, nil
 }
 
 // Return count active files UUIDs. If count is 0, return 1 by default
@@ -193,8 +273,33 @@ func (m *Connections) ExpectedSavedSpace() uint64 {
 	var res uint64
 	for _, conn := range m.value {
 		if conn.mode != pb.ConnectionMode_RDONLY {
-			res += conn.file.chunks.ChunkSize * uint64(conn.file.chunks.Count-conn.file.chunks.Loaded)
+			chunk_size := conn.file.chunks.ChunkSize
+			if conn.file.IsEncrypted() {
+				chunk_size += filecrypt.CHUNK_OVERHEAD
+			}
+			res += chunk_size * uint64(conn.file.chunks.Count-conn.file.chunks.Loaded)
 		}
 	}
 	return res
 }
+
+// Progress of user uploads, which change files (RDWR connections)
+func (m *Connections) Uploads(user string) []*pb.UploadProgress {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	var res []*pb.UploadProgress
+	for _, conn := range m.value {
+		if conn.change == nil || conn.user != user {
+			continue
+		}
+
+		chunks := conn.file.chunks
+		res = append(res, &pb.UploadProgress{
+			Path:   conn.change.Path,
+			Loaded: min(chunks.ChunkSize*uint64(chunks.Loaded), conn.change.Size),
+			Size:   conn.change.Size,
+		})
+	}
+	return res
+}
@@ -0,0 +1,377 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	"github.com/braginantonev/mhserver/pkg/delta"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+)
+
+const (
+	MIN_DELTA_BLOCK_SIZE uint32 = 1024
+	MAX_DELTA_BLOCK_SIZE uint32 = 8 * 1024 * 1024
+
+	// Max blocks in one signature, so signature fits in one grpc message
+	MAX_SIGNATURE_BLOCKS uint64 = 32768
+)
+
+/*
+Block size of signature. Wanted size is used, if it's in limits, else block size is chosen by file size (square root, like rsync).
+Block size is increased for big files, so signature doesn't have more than MAX_SIGNATURE_BLOCKS blocks.
+*/
+func calcBlockSize(wanted uint32, file_size uint64) uint32 {
+	block_size := wanted
+	if block_size < MIN_DELTA_BLOCK_SIZE || block_size > MAX_DELTA_BLOCK_SIZE {
+		block_size = uint32(math.Sqrt(float64(file_size))) / MIN_DELTA_BLOCK_SIZE * MIN_DELTA_BLOCK_SIZE
+		block_size = max(MIN_DELTA_BLOCK_SIZE, min(block_size, MAX_DELTA_BLOCK_SIZE))
+	}
+
+	if blocks_limited := (file_size + MAX_SIGNATURE_BLOCKS - 1) / MAX_SIGNATURE_BLOCKS; blocks_limited > uint64(block_size) {
+		block_size = uint32(min(blocks_limited, uint64(MAX_DELTA_BLOCK_SIZE)))
+	}
+	return block_size
+}
+
+// Create temp file with unique name near path, so parallel writes of the same file don't mix
+func createTempNear(path string) (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"*"+TEMP_FILE_SUFFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	// Temp file is created only for owner, but saved files are available for group too
+	if err := tmp.Chmod(0660); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// Return plain size and modification time of file
+func (s *DataServer) deltaBase(user, path string) (uint64, uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, 0, ErrFileNotExist
+		}
+		return 0, 0, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return 0, 0, ErrFileNotExist
+	}
+	return s.plainSize(user, path, info), uint64(info.ModTime().Unix()), nil
+}
+
+/*
+Return rolling and strong (sha256) checksums of file blocks. Client compares them with new version of file
+and sends only changed data with ApplyDelta.
+*/
+func (s *DataServer) GetSignature(ctx context.Context, req *pb.SignatureRequest) (*pb.Signature, error) {
+	defer func() {
+		<-s.sem
+	}()
+
+	s.sem <- struct{}{}
+
+	file_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, req.Username, req.Directory, s.cfg.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !filenameRegexp.MatchString(req.Filename) {
+		return nil, ErrBadFilenameSyntax
+	}
+	file_path += req.Filename
+
+	size, mod_time, err := s.deltaBase(req.Username, file_path)
+	if err != nil {
+		if errors.Is(err, ErrFileNotExist) {
+			return nil, err
+		}
+
+		slog.ErrorContext(ctx, "failed stat delta base", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	if size > uint64(MAX_DELTA_BLOCK_SIZE)*MAX_SIGNATURE_BLOCKS {
+		return nil, ErrFileTooBigForDelta
+	}
+
+	src, close_src, err := s.openPlain(req.Username, file_path)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed open delta base", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer close_src()
+
+	signature := &pb.Signature{
+		BlockSize: calcBlockSize(req.BlockSize, size),
+		Size:      size,
+		ModTime:   mod_time,
+	}
+
+	err = delta.BlockSums(src, int(signature.BlockSize), func(block delta.Block) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		signature.Blocks = append(signature.Blocks, &pb.BlockSum{
+			Weak:   block.Weak,
+			Strong: bytes.Clone(block.Strong[:]),
+		})
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		slog.ErrorContext(ctx, "failed calculate signature", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	return signature, nil
+}
+
+// Check delta header and return path of base file
+func (s *DataServer) checkDeltaHeader(ctx context.Context, header *pb.DeltaHeader) (string, error) {
+	if header == nil {
+		return "", ErrBadDelta
+	}
+
+	file_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, header.Username, header.Directory, s.cfg.ServiceName)
+	if err != nil {
+		return "", err
+	}
+
+	if !filenameRegexp.MatchString(header.Filename) {
+		return "", ErrBadFilenameSyntax
+	}
+	file_path += header.Filename
+
+	if header.BlockSize < MIN_DELTA_BLOCK_SIZE || header.BlockSize > MAX_DELTA_BLOCK_SIZE || len(header.Sum) != sha256.Size {
+		return "", ErrBadDelta
+	}
+
+	size, mod_time, err := s.deltaBase(header.Username, file_path)
+	if err != nil {
+		if errors.Is(err, ErrFileNotExist) {
+			return "", err
+		}
+
+		slog.ErrorContext(ctx, "failed stat delta base", slog.Any("err", err))
+		return "", ErrInternal
+	}
+
+	if size != header.BaseSize || mod_time != header.BaseModTime {
+		return "", ErrUnexpectedFileChange
+	}
+
+	disk_space, err := freemem.GetAvailableDiskSpace(s.cfg.WorkspacePath)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed get available disk space", slog.Any("err", err))
+		return "", ErrInternal
+	}
+
+	if disk_space < s.expectedSavedSpace()+s.diskSize(header.Size) {
+		return "", ErrNotEnoughDiskSpace
+	}
+	return file_path, nil
+}
+
+// Write new version of file from base file and delta operations
+type deltaBuilder struct {
+	base       *io.SectionReader
+	block_size int64
+	dst        io.Writer
+	hash       io.Writer
+	buf        []byte
+	result     *pb.DeltaResult
+	limit      uint64
+}
+
+func (b *deltaBuilder) apply(op *pb.DeltaOp) error {
+	var src io.Reader
+	var length uint64
+	if len(op.Literal) != 0 {
+		src, length = bytes.NewReader(op.Literal), uint64(len(op.Literal))
+		b.result.Literal += length
+	} else {
+		offset := int64(op.BlockIndex) * b.block_size
+		if op.BlockCount == 0 || offset >= b.base.Size() || offset+int64(op.BlockCount-1)*b.block_size >= b.base.Size() {
+			return ErrBadDelta
+		}
+
+		length = uint64(min(int64(op.BlockCount)*b.block_size, b.base.Size()-offset))
+		src = io.NewSectionReader(b.base, offset, int64(length))
+		b.result.Copied += length
+	}
+
+	b.result.Size += length
+	if b.result.Size > b.limit {
+		return ErrDeltaSizeMismatch
+	}
+
+	if _, err := io.CopyBuffer(io.MultiWriter(b.dst, b.hash), src, b.buf); err != nil {
+		return fmt.Errorf("failed write delta: %w", err)
+	}
+	return nil
+}
+
+/*
+Rebuild file from base version and delta operations. First message must have header with values from signature.
+New version is written to temp file and replaces base file only after size and sum check,
+so base file stays untouched, if something went wrong.
+*/
+func (s *DataServer) ApplyDelta(stream grpc.ClientStreamingServer[pb.DeltaChunk, pb.DeltaResult]) error {
+	defer func() {
+		<-s.sem
+	}()
+
+	s.sem <- struct{}{}
+
+	ctx := stream.Context()
+
+	chunk, err := stream.Recv()
+	if err != nil {
+		if err == io.EOF {
+			return ErrBadDelta
+		}
+		return err
+	}
+
+	header := chunk.Header
+	file_path, err := s.checkDeltaHeader(ctx, header)
+	if err != nil {
+		return err
+	}
+
+	defer freemem.Reserve(s.diskSize(header.Size))()
+
+	base, close_base, err := s.openPlain(header.Username, file_path)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed open delta base", slog.Any("err", err))
+		return ErrInternal
+	}
+	defer close_base()
+
+	tmp, err := createTempNear(file_path)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed create delta temp file", slog.Any("err", err))
+		return ErrInternal
+	}
+	tmp_path := tmp.Name()
+
+	remove_tmp := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmp_path)
+		return err
+	}
+
+	var dst io.Writer = tmp
+	var enc_writer *filecrypt.Writer
+	if s.keyring != nil {
+		aead, err := s.keyring.UserCipher(header.Username)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed get user cipher", slog.Any("err", err))
+			return remove_tmp(ErrInternal)
+		}
+
+		enc_writer, err = filecrypt.NewWriter(tmp, aead, calcChunkSize(s.cfg.Memory, header.Size))
+		if err != nil {
+			slog.ErrorContext(ctx, "failed create encrypted writer", slog.Any("err", err))
+			return remove_tmp(ErrInternal)
+		}
+		dst = enc_writer
+	}
+
+	hash := sha256.New()
+	builder := deltaBuilder{
+		base:       base,
+		block_size: int64(header.BlockSize),
+		dst:        dst,
+		hash:       hash,
+		buf:        make([]byte, s.cfg.Memory.MaxChunkSize),
+		result:     &pb.DeltaResult{},
+		limit:      header.Size,
+	}
+
+	for {
+		for _, op := range chunk.Ops {
+			if err := builder.apply(op); err != nil {
+				if errors.Is(err, ErrBadDelta) || errors.Is(err, ErrDeltaSizeMismatch) {
+					return remove_tmp(err)
+				}
+
+				slog.ErrorContext(ctx, "failed apply delta", slog.Any("err", err))
+				return remove_tmp(ErrInternal)
+			}
+		}
+
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return remove_tmp(err)
+		}
+
+		if chunk.Header != nil {
+			return remove_tmp(ErrBadDelta)
+		}
+	}
+
+	if builder.result.Size != header.Size {
+		return remove_tmp(ErrDeltaSizeMismatch)
+	}
+
+	if !bytes.Equal(hash.Sum(nil), header.Sum) {
+		return remove_tmp(ErrDeltaSumMismatch)
+	}
+
+	if enc_writer != nil {
+		if err := enc_writer.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed close encrypted writer", slog.Any("err", err))
+			return remove_tmp(ErrInternal)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp_path)
+		slog.ErrorContext(ctx, "failed close delta temp file", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	// Base file can be changed while delta was received
+	if size, mod_time, err := s.deltaBase(header.Username, file_path); err != nil || size != header.BaseSize || mod_time != header.BaseModTime {
+		_ = os.Remove(tmp_path)
+		return ErrUnexpectedFileChange
+	}
+
+	if err := os.Rename(tmp_path, file_path); err != nil {
+		_ = os.Remove(tmp_path)
+		slog.ErrorContext(ctx, "failed replace file by delta", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	s.record(ctx, header.Username, journal.Event{Op: journal.OP_MODIFY, Path: header.Directory + header.Filename, Size: header.Size})
+
+	return stream.SendAndClose(builder.result)
+}
@@ -0,0 +1,337 @@
+package data_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/pkg/delta"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client simulation: send delta between base file and new body
+func sendDelta(t *testing.T, data_client pb.DataServiceClient, header *pb.DeltaHeader, ops []*pb.DeltaOp) (*pb.DeltaResult, error) {
+	stream, err := data_client.ApplyDelta(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.Send(&pb.DeltaChunk{Header: header}); err != nil {
+		return stream.CloseAndRecv()
+	}
+
+	for _, op := range ops {
+		if err := stream.Send(&pb.DeltaChunk{Ops: []*pb.DeltaOp{op}}); err != nil {
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func calcDelta(t *testing.T, signature *pb.Signature, body []byte) []*pb.DeltaOp {
+	blocks := make([]delta.Block, len(signature.Blocks))
+	for i, block := range signature.Blocks {
+		blocks[i].Weak = block.Weak
+		copy(blocks[i].Strong[:], block.Strong)
+	}
+
+	var ops []*pb.DeltaOp
+	err := delta.Diff(bytes.NewReader(body), int(signature.BlockSize), blocks, func(op delta.Op) error {
+		ops = append(ops, &pb.DeltaOp{
+			BlockIndex: op.BlockIndex,
+			BlockCount: op.BlockCount,
+			Literal:    bytes.Clone(op.Literal),
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ops
+}
+
+func testDelta(t *testing.T, workspace_path, address string, enc_cfg config.EncryptionConfig) {
+	if err := createWorkspaceFolders(workspace_path, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(workspace_path, config.MemoryConfig{
+		MaxChunkSize: 4096,               //byte
+		MinChunkSize: 512,                //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	}).WithEncryption(enc_cfg)))
+
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+	defer grpc_server.Stop()
+
+	grpc_connection, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	base := []byte(strings.Repeat(TEST_FILE_BODY, 40))
+	changed := bytes.Clone(base)
+	changed = append(changed[:len(changed)/2], append([]byte("- Сэр, тут строчка новая!"), changed[len(changed)/2:]...)...)
+	changed = append(changed, "\n- Конец."...)
+	changed_sum := sha256.Sum256(changed)
+
+	const filename string = "delta.txt"
+	file_path := fmt.Sprintf("%s%s/files/%s", workspace_path, TEST_USER, filename)
+
+	// Base file is saved through service, so it's encrypted if encryption is enabled
+	createBase := func(t *testing.T) *pb.Signature {
+		_ = os.Remove(file_path)
+		err := saveFile(t.Context(), data_client, &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDWR,
+			Directory: "/",
+			Filename:  filename,
+			Size:      uint64(len(base)),
+		}, bytes.NewReader(base))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature, err := data_client.GetSignature(t.Context(), &pb.SignatureRequest{
+			Username:  TEST_USER,
+			Directory: "/",
+			Filename:  filename,
+			BlockSize: data.MIN_DELTA_BLOCK_SIZE,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if signature.Size != uint64(len(base)) || len(signature.Blocks) != (len(base)+int(signature.BlockSize)-1)/int(signature.BlockSize) {
+			t.Fatalf("bad signature: size %d, blocks %d", signature.Size, len(signature.Blocks))
+		}
+		return signature
+	}
+
+	newHeader := func(signature *pb.Signature) *pb.DeltaHeader {
+		return &pb.DeltaHeader{
+			Username:    TEST_USER,
+			Directory:   "/",
+			Filename:    filename,
+			BlockSize:   signature.BlockSize,
+			BaseSize:    signature.Size,
+			BaseModTime: signature.ModTime,
+			Size:        uint64(len(changed)),
+			Sum:         changed_sum[:],
+		}
+	}
+
+	// Service must return the same file, as was sent by delta
+	checkFile := func(t *testing.T, expected []byte) {
+		signature, err := data_client.GetSignature(t.Context(), &pb.SignatureRequest{
+			Username:  TEST_USER,
+			Directory: "/",
+			Filename:  filename,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if signature.Size != uint64(len(expected)) {
+			t.Fatalf("expected file size %d, but got %d", len(expected), signature.Size)
+		}
+
+		// File is the same, if delta is one operation with all blocks
+		blocks := calcDelta(t, signature, expected)
+		if len(blocks) != 1 || len(blocks[0].Literal) != 0 || int(blocks[0].BlockCount) != len(signature.Blocks) {
+			t.Error("saved file is different from expected")
+		}
+	}
+
+	t.Run("file not exist", func(t *testing.T) {
+		_, err := data_client.GetSignature(t.Context(), &pb.SignatureRequest{
+			Username:  TEST_USER,
+			Directory: "/",
+			Filename:  "not_exist.txt",
+		})
+		if !errorIs(err, data.ErrFileNotExist) {
+			t.Errorf("expected error %v, but got %v", data.ErrFileNotExist, err)
+		}
+	})
+
+	t.Run("bad filename", func(t *testing.T) {
+		_, err := data_client.GetSignature(t.Context(), &pb.SignatureRequest{
+			Username:  TEST_USER,
+			Directory: "/",
+			Filename:  "../.passwd",
+		})
+		if !errorIs(err, data.ErrBadFilenameSyntax) {
+			t.Errorf("expected error %v, but got %v", data.ErrBadFilenameSyntax, err)
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		signature := createBase(t)
+
+		result, err := sendDelta(t, data_client, newHeader(signature), calcDelta(t, signature, changed))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Size != uint64(len(changed)) || result.Copied+result.Literal != result.Size {
+			t.Errorf("bad delta result: %v", result)
+		}
+
+		// Only changed blocks are sent
+		if result.Literal >= result.Size/4 {
+			t.Errorf("too many literal bytes: %d of %d", result.Literal, result.Size)
+		}
+
+		checkFile(t, changed)
+	})
+
+	t.Run("sum mismatch", func(t *testing.T) {
+		signature := createBase(t)
+
+		header := newHeader(signature)
+		header.Sum = bytes.Repeat([]byte{1}, sha256.Size)
+
+		_, err := sendDelta(t, data_client, header, calcDelta(t, signature, changed))
+		if !errorIs(err, data.ErrDeltaSumMismatch) {
+			t.Fatalf("expected error %v, but got %v", data.ErrDeltaSumMismatch, err)
+		}
+
+		checkFile(t, base)
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		signature := createBase(t)
+
+		header := newHeader(signature)
+		header.Size -= 1
+
+		_, err := sendDelta(t, data_client, header, calcDelta(t, signature, changed))
+		if !errorIs(err, data.ErrDeltaSizeMismatch) {
+			t.Fatalf("expected error %v, but got %v", data.ErrDeltaSizeMismatch, err)
+		}
+
+		checkFile(t, base)
+	})
+
+	t.Run("block out of file", func(t *testing.T) {
+		signature := createBase(t)
+
+		_, err := sendDelta(t, data_client, newHeader(signature), []*pb.DeltaOp{{BlockIndex: uint32(len(signature.Blocks)), BlockCount: 1}})
+		if !errorIs(err, data.ErrBadDelta) {
+			t.Fatalf("expected error %v, but got %v", data.ErrBadDelta, err)
+		}
+
+		checkFile(t, base)
+	})
+
+	t.Run("base changed after signature", func(t *testing.T) {
+		signature := createBase(t)
+
+		mod_time := time.Unix(int64(signature.ModTime), 0).Add(-time.Hour)
+		if err := os.Chtimes(file_path, mod_time, mod_time); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := sendDelta(t, data_client, newHeader(signature), calcDelta(t, signature, changed))
+		if !errorIs(err, data.ErrUnexpectedFileChange) {
+			t.Fatalf("expected error %v, but got %v", data.ErrUnexpectedFileChange, err)
+		}
+
+		checkFile(t, base)
+	})
+
+	t.Run("parallel apply", func(t *testing.T) {
+		signature := createBase(t)
+		ops := calcDelta(t, signature, changed)
+
+		countTemp := func() int {
+			entries, err := os.ReadDir(fmt.Sprintf("%s%s/files/", workspace_path, TEST_USER))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var count int
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), data.TEMP_FILE_SUFFIX) {
+					count += 1
+				}
+			}
+			return count
+		}
+
+		// Both deltas are started, but not finished
+		var streams []grpc.ClientStreamingClient[pb.DeltaChunk, pb.DeltaResult]
+		for range 2 {
+			stream, err := data_client.ApplyDelta(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := stream.Send(&pb.DeltaChunk{Header: newHeader(signature), Ops: ops[:1]}); err != nil {
+				t.Fatal(err)
+			}
+			streams = append(streams, stream)
+		}
+
+		// Every delta must write to own temp file
+		for deadline := time.Now().Add(time.Second); countTemp() < 2 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if count := countTemp(); count != 2 {
+			t.Errorf("expected 2 temp files, but got %d", count)
+		}
+
+		for _, stream := range streams {
+			// Error of stream is returned by CloseAndRecv
+			_ = stream.Send(&pb.DeltaChunk{Ops: ops[1:]})
+
+			// Base is changed by first delta, so second one is rejected
+			if _, err := stream.CloseAndRecv(); err != nil && !errorIs(err, data.ErrUnexpectedFileChange) {
+				t.Fatalf("expected error %v or nothing, but got %v", data.ErrUnexpectedFileChange, err)
+			}
+		}
+
+		checkFile(t, changed)
+	})
+
+	if entries, err := os.ReadDir(fmt.Sprintf("%s%s/files/", workspace_path, TEST_USER)); err == nil {
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), data.TEMP_FILE_SUFFIX) {
+				t.Errorf("temp file %s is not removed", entry.Name())
+			}
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	testDelta(t, WORKSPACE_PATH+"delta/", "localhost:8088", config.EncryptionConfig{})
+}
+
+func TestDeltaWithEncryption(t *testing.T) {
+	testDelta(t, WORKSPACE_PATH+"delta_encrypted/", "localhost:8089", config.EncryptionConfig{
+		Enabled:   true,
+		MasterKey: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+	})
+}
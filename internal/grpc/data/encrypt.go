@@ -0,0 +1,150 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+)
+
+const TEMP_FILE_SUFFIX string = ".mhs_tmp"
+
+/*
+Encrypt all plain files of the service in workspace. Already encrypted files are skipped.
+Every file is encrypted to temp file near him, and after that replaces original, so interrupted migration can be started again.
+Files, which can't be encrypted, are logged and skipped.
+
+Return count of encrypted files.
+*/
+func EncryptExistingFiles(ctx context.Context, cfg DataServiceConfig) (int, error) {
+	keyring := newKeyRing(cfg)
+	if keyring == nil {
+		return 0, ErrEncryptionDisabled
+	}
+
+	users, err := os.ReadDir(cfg.WorkspacePath)
+	if err != nil {
+		return 0, err
+	}
+
+	var encrypted int
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+
+		service_path := fmt.Sprintf("%s%s/%s", cfg.WorkspacePath, user.Name(), cfg.ServiceName)
+		err := filepath.WalkDir(service_path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if !d.Type().IsRegular() || strings.HasSuffix(path, TEMP_FILE_SUFFIX) {
+				return nil
+			}
+
+			// Bad file mustn't stop encryption of other files, so he is skipped
+			ok, err := encryptFile(cfg, keyring, user.Name(), path)
+			if err != nil {
+				slog.Error("Failed encrypt file, file is skipped", slog.String("path", path), slog.Any("err", err))
+				return nil
+			}
+
+			if ok {
+				encrypted += 1
+				slog.Info("File encrypted", slog.String("path", path))
+			}
+			return nil
+		})
+		if err != nil {
+			return encrypted, err
+		}
+	}
+
+	return encrypted, nil
+}
+
+// Return false, if file already encrypted
+func encryptFile(cfg DataServiceConfig, keyring *filecrypt.KeyRing, user, path string) (bool, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	aead, err := keyring.UserCipher(user)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok, err := filecrypt.ReadHeader(src, aead); err != nil || ok {
+		return false, err
+	}
+
+	info, err := src.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	tmp_path := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+TEMP_FILE_SUFFIX)
+	tmp, err := os.OpenFile(tmp_path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+
+	remove_tmp := func(err error) (bool, error) {
+		_ = tmp.Close()
+		_ = os.Remove(tmp_path)
+		return false, err
+	}
+
+	writer, err := filecrypt.NewWriter(tmp, aead, calcChunkSize(cfg.Memory, uint64(info.Size())))
+	if err != nil {
+		return remove_tmp(err)
+	}
+
+	if _, err := io.Copy(writer, src); err != nil {
+		return remove_tmp(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return remove_tmp(err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return remove_tmp(err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp_path)
+		return false, err
+	}
+
+	if err := os.Chtimes(tmp_path, info.ModTime(), info.ModTime()); err != nil {
+		_ = os.Remove(tmp_path)
+		return false, err
+	}
+
+	if err := os.Rename(tmp_path, path); err != nil {
+		_ = os.Remove(tmp_path)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -22,12 +22,30 @@ var (
 	ErrBadFilenameSyntax error = errors.New("filename have bad syntax")
 
 	// Connection errors
-	ErrNullSizeToSave     error = errors.New("null size to save")
 	ErrNotEnoughDiskSpace error = errors.New("not enough disk space")
 
 	// GetData errors
 	ErrFileNotExist  error = errors.New("file not exist")
 	ErrReadOutOfFile error = errors.New("reading outside of file")
 
+	// Extract errors
+	ErrUnsupportedArchive error = errors.New("unsupported archive type")
+	ErrBadArchive         error = errors.New("archive is damaged")
+	ErrBadArchiveEntry    error = errors.New("archive entry have bad name")
+	ErrFileAlreadyExist   error = errors.New("file already exist")
+
+	// Delta errors
+	ErrBadDelta           error = errors.New("bad delta")
+	ErrFileTooBigForDelta error = errors.New("file is too big for delta")
+	ErrDeltaSizeMismatch  error = errors.New("delta size mismatch")
+	ErrDeltaSumMismatch   error = errors.New("delta sum mismatch")
+
+	// Move errors
+	ErrMoveIntoItself   error = errors.New("directory can't be moved into itself")
+	ErrMoveTypeMismatch error = errors.New("source and target must be both files or both directories")
+
+	// Encryption errors
+	ErrEncryptionDisabled error = errors.New("files encryption is disabled")
+
 	ErrInternal error = errors.New("internal error")
 )
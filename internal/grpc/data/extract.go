@@ -0,0 +1,417 @@
+package data
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+)
+
+type archiveType int
+
+const (
+	ARCHIVE_ZIP archiveType = iota
+	ARCHIVE_TAR
+	ARCHIVE_TAR_GZ
+)
+
+// Metadata directories of archivers, which are skipped on extraction
+var skippedArchiveDirs = map[string]bool{
+	"__MACOSX": true,
+}
+
+func getArchiveType(filename string) (archiveType, error) {
+	filename = strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(filename, ".zip"):
+		return ARCHIVE_ZIP, nil
+	case strings.HasSuffix(filename, ".tar"):
+		return ARCHIVE_TAR, nil
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".tgz"):
+		return ARCHIVE_TAR_GZ, nil
+	}
+	return 0, ErrUnsupportedArchive
+}
+
+type archiveEntry struct {
+	name     string
+	is_dir   bool
+	size     uint64
+	mod_time time.Time
+}
+
+// Called for every regular file and directory of archive. Open returns entry body.
+type archiveWalkFunc func(entry archiveEntry, open func() (io.ReadCloser, error)) error
+
+// Walk archive entries. Symlinks, devices and other special entries are skipped.
+func walkArchive(src *io.SectionReader, arch_type archiveType, fn archiveWalkFunc) error {
+	if arch_type == ARCHIVE_ZIP {
+		zr, err := zip.NewReader(src, src.Size())
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrBadArchive, err)
+		}
+
+		for _, file := range zr.File {
+			mode := file.Mode()
+			if !mode.IsRegular() && !mode.IsDir() {
+				continue
+			}
+
+			err := fn(archiveEntry{
+				name:     file.Name,
+				is_dir:   mode.IsDir(),
+				size:     file.UncompressedSize64,
+				mod_time: file.Modified,
+			}, file.Open)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var reader io.Reader = src
+	if arch_type == ARCHIVE_TAR_GZ {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrBadArchive, err)
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		reader = gz
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrBadArchive, err)
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		err = fn(archiveEntry{
+			name:     header.Name,
+			is_dir:   header.Typeflag == tar.TypeDir,
+			size:     uint64(header.Size),
+			mod_time: header.ModTime,
+		}, func() (io.ReadCloser, error) {
+			return io.NopCloser(tr), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/*
+Return directory ("/photos/2025/") and filename of archive entry inside target directory.
+Filename is empty for directories. Both are checked with directory and filename rules,
+so entry can't be saved outside of target directory.
+
+Return empty directory, if entry must be skipped.
+*/
+func entryPath(target string, entry archiveEntry) (string, string, error) {
+	name := strings.TrimPrefix(entry.name, "./")
+	if name == "" || name == "." {
+		return "", "", nil
+	}
+
+	if skippedArchiveDirs[strings.SplitN(name, "/", 2)[0]] {
+		return "", "", nil
+	}
+
+	if entry.is_dir {
+		dir := target + strings.TrimSuffix(name, "/") + "/"
+		if err := dirs.CheckDirSyntax(dir); err != nil {
+			return "", "", fmt.Errorf("%w: %s", ErrBadArchiveEntry, entry.name)
+		}
+		return dir, "", nil
+	}
+
+	dir, filename := target, name
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		dir, filename = target+name[:i+1], name[i+1:]
+	}
+
+	if err := dirs.CheckDirSyntax(dir); err != nil || !filenameRegexp.MatchString(filename) {
+		return "", "", fmt.Errorf("%w: %s", ErrBadArchiveEntry, entry.name)
+	}
+	return dir, filename, nil
+}
+
+// Open file to read plain content. Encrypted files are decrypted on the fly.
+func (s *DataServer) openPlain(user, path string) (*io.SectionReader, func(), error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, ErrFileNotExist
+		}
+		return nil, nil, err
+	}
+
+	close_file := func() {
+		_ = file.Close()
+	}
+
+	enc_file, err := s.openEncrypted(user, file)
+	if err != nil {
+		close_file()
+		return nil, nil, err
+	}
+
+	if enc_file != nil {
+		return io.NewSectionReader(enc_file, 0, enc_file.Size()), close_file, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		close_file()
+		return nil, nil, err
+	}
+	return io.NewSectionReader(file, 0, info.Size()), close_file, nil
+}
+
+// Save file to temp file near target and replace target after that. File is encrypted, if encryption is enabled.
+func (s *DataServer) saveExtractedFile(user, path string, entry archiveEntry, src io.Reader, buf []byte) error {
+	tmp, err := createTempNear(path)
+	if err != nil {
+		return err
+	}
+	tmp_path := tmp.Name()
+
+	remove_tmp := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmp_path)
+		return err
+	}
+
+	var dst io.Writer = tmp
+	var enc_writer *filecrypt.Writer
+	if s.keyring != nil {
+		aead, err := s.keyring.UserCipher(user)
+		if err != nil {
+			return remove_tmp(err)
+		}
+
+		enc_writer, err = filecrypt.NewWriter(tmp, aead, calcChunkSize(s.cfg.Memory, entry.size))
+		if err != nil {
+			return remove_tmp(err)
+		}
+		dst = enc_writer
+	}
+
+	// Entry can't be bigger than declared size, because free space is checked by it
+	written, err := io.CopyBuffer(dst, io.LimitReader(src, int64(entry.size)+1), buf)
+	if err != nil {
+		return remove_tmp(fmt.Errorf("%w: %s: %w", ErrBadArchive, entry.name, err))
+	}
+
+	if uint64(written) != entry.size {
+		return remove_tmp(fmt.Errorf("%w: %s: wrong file size", ErrBadArchive, entry.name))
+	}
+
+	if enc_writer != nil {
+		if err := enc_writer.Close(); err != nil {
+			return remove_tmp(err)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp_path)
+		return err
+	}
+
+	if !entry.mod_time.IsZero() {
+		_ = os.Chtimes(tmp_path, entry.mod_time, entry.mod_time)
+	}
+
+	if err := os.Rename(tmp_path, path); err != nil {
+		_ = os.Remove(tmp_path)
+		return err
+	}
+	return nil
+}
+
+/*
+Extract zip, tar or tar.gz archive from user files to target directory.
+
+Archive is checked before extraction: every entry must have correct name, files must not exist (without overwrite)
+and must fit in free disk space. First progress message is sent after check, last one - after extraction.
+*/
+func (s *DataServer) Extract(req *pb.ExtractRequest, stream grpc.ServerStreamingServer[pb.ExtractProgress]) error {
+	defer func() {
+		<-s.sem
+	}()
+
+	s.sem <- struct{}{}
+
+	ctx := stream.Context()
+
+	archive_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, req.Username, req.Directory, s.cfg.ServiceName)
+	if err != nil {
+		return err
+	}
+
+	if !filenameRegexp.MatchString(req.Filename) {
+		return ErrBadFilenameSyntax
+	}
+
+	arch_type, err := getArchiveType(req.Filename)
+	if err != nil {
+		return err
+	}
+
+	target_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, req.Username, req.Target, s.cfg.ServiceName)
+	if err != nil {
+		return err
+	}
+
+	src, close_src, err := s.openPlain(req.Username, archive_path+req.Filename)
+	if err != nil {
+		if errors.Is(err, ErrFileNotExist) {
+			return err
+		}
+
+		slog.ErrorContext(ctx, "failed open archive", slog.Any("err", err))
+		return ErrInternal
+	}
+	defer close_src()
+
+	// Check archive before extraction
+	progress := &pb.ExtractProgress{}
+	var disk_size uint64
+	err = walkArchive(src, arch_type, func(entry archiveEntry, _ func() (io.ReadCloser, error)) error {
+		dir, filename, err := entryPath(req.Target, entry)
+		if err != nil || dir == "" || filename == "" {
+			return err
+		}
+
+		if !req.Overwrite {
+			if _, err := os.Lstat(target_path + strings.TrimPrefix(dir, req.Target) + filename); err == nil {
+				return fmt.Errorf("%w: %s", ErrFileAlreadyExist, entry.name)
+			}
+		}
+
+		progress.FilesCount += 1
+		progress.Size += entry.size
+		disk_size += s.diskSize(entry.size)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	disk_space, err := freemem.GetAvailableDiskSpace(s.cfg.WorkspacePath)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed get available disk space", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if disk_space < s.expectedSavedSpace()+disk_size {
+		return ErrNotEnoughDiskSpace
+	}
+
+	defer freemem.Reserve(disk_size)()
+
+	if err := stream.Send(progress); err != nil {
+		return err
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		slog.ErrorContext(ctx, "failed seek archive", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	// Watcher doesn't record extracted files, they are recorded after extraction
+	s.busy.add(req.Username)
+	defer s.busy.done(req.Username)
+
+	// Extracted files are recorded even if extraction failed
+	var changes []journal.Event
+	defer func() {
+		s.record(context.WithoutCancel(ctx), req.Username, changes...)
+	}()
+
+	buf := make([]byte, s.cfg.Memory.MaxChunkSize)
+	return walkArchive(src, arch_type, func(entry archiveEntry, open func() (io.ReadCloser, error)) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		dir, filename, err := entryPath(req.Target, entry)
+		if err != nil || dir == "" {
+			return err
+		}
+
+		dir_path := target_path + strings.TrimPrefix(dir, req.Target)
+		if _, err := os.Lstat(dir_path); err != nil {
+			changes = append(changes, journal.Event{Op: journal.OP_CREATE, Path: dir, IsDir: true})
+		}
+
+		if err := os.MkdirAll(dir_path, 0700); err != nil {
+			// File with the same name as directory
+			if errors.Is(err, syscall.ENOTDIR) {
+				return fmt.Errorf("%w: %s", ErrBadArchiveEntry, entry.name)
+			}
+
+			slog.ErrorContext(ctx, "failed create directory from archive", slog.Any("err", err))
+			return ErrInternal
+		}
+
+		if filename == "" {
+			return nil
+		}
+
+		body, err := open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrBadArchive, entry.name, err)
+		}
+		defer func() {
+			_ = body.Close()
+		}()
+
+		change := journal.Event{Op: journal.OP_CREATE, Path: dir + filename, Size: entry.size}
+		if _, err := os.Lstat(dir_path + filename); err == nil {
+			change.Op = journal.OP_MODIFY
+		}
+
+		if err := s.saveExtractedFile(req.Username, dir_path+filename, entry, body, buf); err != nil {
+			if errors.Is(err, ErrBadArchive) {
+				return err
+			}
+
+			slog.ErrorContext(ctx, "failed save file from archive", slog.String("path", dir_path+filename), slog.Any("err", err))
+			return ErrInternal
+		}
+
+		changes = append(changes, change)
+
+		progress.Current = dir + filename
+		progress.Files += 1
+		progress.Written += entry.size
+		return stream.Send(progress)
+	})
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Absolute path of user file ("/docs/cv.pdf") or directory ("/docs/"). Root directory isn't allowed.
+func (s *DataServer) movePath(user, req_path string) (string, bool, error) {
+	if strings.HasSuffix(req_path, "/") {
+		if req_path == "/" {
+			return "", true, dirs.ErrBadDirSyntax
+		}
+
+		dir_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, user, req_path, s.cfg.ServiceName)
+		return dir_path, true, err
+	}
+
+	i := strings.LastIndex(req_path, "/")
+	if i == -1 {
+		return "", false, dirs.ErrBadDirSyntax
+	}
+
+	dir_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, user, req_path[:i+1], s.cfg.ServiceName)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !filenameRegexp.MatchString(req_path[i+1:]) {
+		return "", false, ErrBadFilenameSyntax
+	}
+	return dir_path + req_path[i+1:], false, nil
+}
+
+/*
+Move or rename file or directory. Target directory must exist. Existing file is replaced only with overwrite,
+existing directory is never replaced. Shares of moved files are moved too.
+*/
+func (s *DataServer) Move(ctx context.Context, req *pb.MoveRequest) (*emptypb.Empty, error) {
+	defer func() {
+		<-s.sem
+	}()
+
+	s.sem <- struct{}{}
+
+	from, is_dir, err := s.movePath(req.Username, req.From)
+	if err != nil {
+		return nil, err
+	}
+
+	to, to_dir, err := s.movePath(req.Username, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	if is_dir != to_dir {
+		return nil, ErrMoveTypeMismatch
+	}
+
+	if is_dir && strings.HasPrefix(req.To, req.From) {
+		return nil, ErrMoveIntoItself
+	}
+
+	info, err := os.Lstat(from)
+	if is_dir && (err != nil || !info.IsDir()) {
+		return nil, ErrDirNotFound
+	}
+
+	if !is_dir && (err != nil || !info.Mode().IsRegular()) {
+		return nil, ErrFileNotExist
+	}
+
+	if _, err := os.Stat(to[:strings.LastIndex(strings.TrimSuffix(to, "/"), "/")+1]); err != nil {
+		return nil, ErrDirNotFound
+	}
+
+	if target, err := os.Lstat(to); err == nil {
+		switch {
+		case is_dir || target.IsDir():
+			return nil, ErrDirAlreadyExist
+		case !req.Overwrite:
+			return nil, ErrFileAlreadyExist
+		}
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		slog.ErrorContext(ctx, "failed move user file", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	if err := s.shares.Move(req.Username, req.From, req.To); err != nil {
+		slog.WarnContext(ctx, "failed move shares", slog.String("user", req.Username), slog.Any("err", err))
+	}
+
+	s.record(ctx, req.Username, journal.Event{Op: journal.OP_MOVE, Path: req.To, OldPath: req.From, IsDir: is_dir})
+	return nil, nil
+}
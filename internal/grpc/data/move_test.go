@@ -0,0 +1,202 @@
+package data_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestMove(t *testing.T) {
+	workspace_path := WORKSPACE_PATH + "move/"
+	if err := os.RemoveAll(workspace_path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createWorkspaceFolders(workspace_path, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(workspace_path, config.MemoryConfig{
+		MaxChunkSize: 64,                 //byte
+		MinChunkSize: 16,                 //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8094")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+	defer grpc_server.Stop()
+
+	grpc_connection, err := grpc.NewClient("localhost:8094", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	for _, dir := range []string{"/lab/", "/lab/gadgets/", "/archive/"} {
+		if _, err := data_client.CreateDir(t.Context(), &pb.Directory{User: TEST_USER, Value: dir}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, filename := range []string{"phone_microwave.txt", "upa.txt"} {
+		err := saveFile(t.Context(), data_client, &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDWR,
+			Directory: "/lab/gadgets/",
+			Filename:  filename,
+			Size:      uint64(len(TEST_FILE_BODY)),
+		}, strings.NewReader(TEST_FILE_BODY))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		from      string
+		to        string
+		overwrite bool
+		expected  error
+	}{
+		{
+			name:     "bad path",
+			from:     "/lab/gadgets/upa.txt",
+			to:       "/lab/../upa.txt",
+			expected: dirs.ErrBadDirSyntax,
+		},
+		{
+			name:     "bad filename",
+			from:     "/lab/gadgets/upa.txt",
+			to:       "/lab/gadgets/upa?.txt",
+			expected: data.ErrBadFilenameSyntax,
+		},
+		{
+			name:     "root",
+			from:     "/",
+			to:       "/archive/root/",
+			expected: dirs.ErrBadDirSyntax,
+		},
+		{
+			name:     "file to directory path",
+			from:     "/lab/gadgets/upa.txt",
+			to:       "/archive/",
+			expected: data.ErrMoveTypeMismatch,
+		},
+		{
+			name:     "not existing file",
+			from:     "/lab/ibn5100.txt",
+			to:       "/archive/ibn5100.txt",
+			expected: data.ErrFileNotExist,
+		},
+		{
+			name:     "not existing target directory",
+			from:     "/lab/gadgets/upa.txt",
+			to:       "/future/upa.txt",
+			expected: data.ErrDirNotFound,
+		},
+		{
+			name:     "existing file",
+			from:     "/lab/gadgets/upa.txt",
+			to:       "/lab/gadgets/phone_microwave.txt",
+			expected: data.ErrFileAlreadyExist,
+		},
+		{
+			name:     "rename file",
+			from:     "/lab/gadgets/upa.txt",
+			to:       "/lab/gadgets/metal_upa.txt",
+			expected: nil,
+		},
+		{
+			name:      "overwrite file",
+			from:      "/lab/gadgets/metal_upa.txt",
+			to:        "/lab/gadgets/phone_microwave.txt",
+			overwrite: true,
+			expected:  nil,
+		},
+		{
+			name:     "directory into itself",
+			from:     "/lab/",
+			to:       "/lab/gadgets/lab/",
+			expected: data.ErrMoveIntoItself,
+		},
+		{
+			name:      "existing directory",
+			from:      "/lab/gadgets/",
+			to:        "/archive/",
+			overwrite: true,
+			expected:  data.ErrDirAlreadyExist,
+		},
+		{
+			name:     "move directory",
+			from:     "/lab/",
+			to:       "/archive/lab/",
+			expected: nil,
+		},
+		{
+			name:     "moved directory",
+			from:     "/lab/",
+			to:       "/lab_2010/",
+			expected: data.ErrDirNotFound,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := data_client.Move(t.Context(), &pb.MoveRequest{
+				Username:  TEST_USER,
+				From:      test.from,
+				To:        test.to,
+				Overwrite: test.overwrite,
+			})
+
+			if !errorIs(err, test.expected) {
+				t.Errorf("expected %v, but got %v", test.expected, err)
+			}
+		})
+	}
+
+	moved := fmt.Sprintf("%s%s/files/archive/lab/gadgets/", workspace_path, TEST_USER)
+	if entries, err := os.ReadDir(moved); err != nil || len(entries) != 1 || entries[0].Name() != "phone_microwave.txt" {
+		t.Errorf("expected only overwritten file in moved directory, but got %v (%v)", entries, err)
+	}
+
+	changes, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER, Since: &start.Cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0, len(changes.Changes))
+	for _, change := range changes.Changes {
+		got = append(got, fmt.Sprintf("%s %s -> %s", change.Op, change.OldPath, change.Path))
+	}
+
+	expected := "move /lab/gadgets/upa.txt -> /lab/gadgets/metal_upa.txt, " +
+		"move /lab/gadgets/metal_upa.txt -> /lab/gadgets/phone_microwave.txt, move /lab/ -> /archive/lab/"
+	if strings.Join(got, ", ") != expected {
+		t.Errorf("expected changes %s, but got %s", expected, strings.Join(got, ", "))
+	}
+}
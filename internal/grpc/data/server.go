@@ -9,9 +9,14 @@ import (
 	"math"
 	"os"
 	"regexp"
+	"time"
 
+	"github.com/braginantonev/mhserver/internal/config"
 	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
 	"github.com/braginantonev/mhserver/internal/repository/freemem"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	"github.com/braginantonev/mhserver/internal/repository/shares"
 	pb "github.com/braginantonev/mhserver/proto/data"
 	"github.com/google/uuid"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -31,22 +36,86 @@ var (
 	filenameRegexp = regexp.MustCompile(`^\.?[\p{L}\p{N}]+([ _-]+[\p{L}\p{N}]+)*(\.[a-zA-Z0-9]+)*$`)
 )
 
+// Check filename with the same rules as data service
+func IsValidFilename(filename string) bool {
+	return filenameRegexp.MatchString(filename)
+}
+
 type DataServer struct {
 	pb.DataServiceServer
 	cfg               DataServiceConfig
 	activeConnections *Connections
 	sem               chan any
+
+	// Nil, if encryption is disabled
+	keyring *filecrypt.KeyRing
+
+	// Changes of user files for sync clients
+	journal *journal.Journal
+
+	// Public links to user files
+	shares *shares.Shares
+
+	// Users, whose changes are recorded after operation end
+	busy busyUsers
 }
 
 func NewDataServer(ctx context.Context, cfg DataServiceConfig) *DataServer {
 	sem_size := (cfg.Memory.Allocated * 985 / 1000) / cfg.Memory.MaxChunkSize
 	slog.Info("Set semaphore size", slog.String("subserver", string(cfg.ServiceName)), slog.Int("value", int(sem_size)))
 
-	return &DataServer{
+	s := &DataServer{
 		cfg:               cfg,
 		activeConnections: NewConnectionsMap(ctx),
 		sem:               make(chan any, sem_size),
+		keyring:           newKeyRing(cfg),
+		journal:           journal.New(cfg.WorkspacePath, cfg.ServiceName),
+		shares:            shares.New(cfg.WorkspacePath, cfg.ServiceName),
+		busy:              newBusyUsers(),
+	}
+
+	// Other services (WebDAV, SFTP) see space of unfinished uploads
+	freemem.AddReservation(ctx, s.activeConnections.ExpectedSavedSpace)
+
+	if cfg.Watcher.Enabled {
+		s.startWatcher(ctx)
+	}
+	return s
+}
+
+func newKeyRing(cfg DataServiceConfig) *filecrypt.KeyRing {
+	if !cfg.Encryption.Enabled {
+		return nil
+	}
+
+	master_key, err := filecrypt.ParseMasterKey(cfg.Encryption.MasterKey)
+	if err != nil {
+		// Config is checked on load, so that's shouldn't happen
+		slog.Error("failed parse encryption master key. Encryption disabled!", slog.String("subserver", string(cfg.ServiceName)), slog.Any("err", err))
+		return nil
 	}
+
+	slog.Info("Files encryption enabled", slog.String("subserver", string(cfg.ServiceName)))
+	return filecrypt.NewKeyRing(cfg.WorkspacePath, master_key)
+}
+
+// Chunk size depends on file size: the bigger file - the bigger chunk (between min and max chunk size from config)
+func calcChunkSize(memory config.MemoryConfig, file_size uint64) uint64 {
+	var chunk_size uint64
+	if file_size <= memory.MinChunkSize {
+		chunk_size = file_size
+	} else {
+		file_based := uint64(float64(BASE_CHUNK_SIZE) * math.Log2(float64(file_size)/float64(BASE_CHUNK_SIZE)+1))
+		chunk_size = max(memory.MinChunkSize, min(file_based, memory.MaxChunkSize))
+	}
+
+	// Round to RAM page
+	if chunk_size > 4096 {
+		chunk_size = (chunk_size / 4096) * 4096
+	}
+
+	// Empty files can't have zero chunk size
+	return max(chunk_size, 1)
 }
 
 func (s *DataServer) CreateConnection(ctx context.Context, req *pb.ConnectionRequest) (*pb.Connection, error) {
@@ -67,8 +136,10 @@ func (s *DataServer) CreateConnection(ctx context.Context, req *pb.ConnectionReq
 
 	file_path += req.Filename
 
-	var file_size uint64
+	var file_size, chunk_size, mod_time uint64
 	var file *os.File
+	var enc_file *filecrypt.File
+	change_op := journal.OP_MODIFY
 
 	switch req.Mode {
 	case pb.ConnectionMode_RDONLY:
@@ -89,22 +160,40 @@ func (s *DataServer) CreateConnection(ctx context.Context, req *pb.ConnectionReq
 		}
 
 		file_size = uint64(file_stat.Size())
+		chunk_size = calcChunkSize(s.cfg.Memory, file_size)
+		mod_time = uint64(file_stat.ModTime().Unix())
 
-	case pb.ConnectionMode_RDWR:
-		if req.Size == 0 {
-			return nil, ErrNullSizeToSave
+		// Encrypted files have chunk size, with which they were saved
+		enc_file, err = s.openEncrypted(req.Username, file)
+		if err != nil {
+			_ = file.Close()
+			slog.ErrorContext(ctx, "failed open encrypted file", slog.String("path", file_path), slog.Any("err", err))
+			return nil, ErrInternal
 		}
 
+		if enc_file != nil {
+			file_size = enc_file.Header().Size
+			chunk_size = enc_file.Header().ChunkSize
+		}
+
+	case pb.ConnectionMode_RDWR:
 		disk_space, err := freemem.GetAvailableDiskSpace(s.cfg.WorkspacePath)
 		if err != nil {
 			slog.ErrorContext(ctx, "failed get available disk space", slog.Any("err", err))
 			return nil, ErrInternal
 		}
 
-		if disk_space-s.activeConnections.ExpectedSavedSpace() < req.Size {
+		file_size = req.Size
+		chunk_size = calcChunkSize(s.cfg.Memory, file_size)
+
+		if disk_space < s.expectedSavedSpace()+s.diskSize(file_size) {
 			return nil, ErrNotEnoughDiskSpace
 		}
 
+		if _, err := os.Lstat(file_path); err != nil {
+			change_op = journal.OP_CREATE
+		}
+
 		file, err = os.OpenFile(file_path, os.O_CREATE|os.O_RDWR, 0660)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
@@ -115,29 +204,67 @@ func (s *DataServer) CreateConnection(ctx context.Context, req *pb.ConnectionReq
 			return nil, ErrInternal
 		}
 
-		file_size = req.Size
+		// Old plain file can be bigger, than new one. Encrypted file is truncated on create.
+		if s.keyring == nil {
+			err = file.Truncate(int64(file_size))
+		}
+
+		if err != nil {
+			_ = file.Close()
+			slog.ErrorContext(ctx, "failed truncate file to save", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+
+		if s.keyring != nil {
+			aead, err := s.keyring.UserCipher(req.Username)
+			if err == nil {
+				enc_file, err = filecrypt.Create(file, aead, chunk_size, file_size)
+			}
+
+			if err != nil {
+				_ = file.Close()
+				slog.ErrorContext(ctx, "failed create encrypted file", slog.Any("err", err))
+				return nil, ErrInternal
+			}
+		}
 	}
 
-	var chunk_size uint64
-	if file_size <= s.cfg.Memory.MinChunkSize {
-		chunk_size = file_size
+	// Empty file is saved at once, so connection isn't created and UUID is empty
+	if req.Mode == pb.ConnectionMode_RDWR && file_size == 0 {
+		if err := file.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed close empty file", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+
+		s.record(ctx, req.Username, journal.Event{Op: change_op, Path: req.Directory + req.Filename})
+		return &pb.Connection{ChunkSize: chunk_size}, nil
+	}
+
+	chunks_count := uint32(math.Ceil(float64(file_size) / float64(chunk_size)))
+
+	var conn_file File
+	if enc_file != nil {
+		conn_file = NewEncryptedFile(enc_file, file_path, NewChunksInfo(chunk_size, chunks_count))
 	} else {
-		file_based := uint64(float64(BASE_CHUNK_SIZE) * math.Log2(float64(file_size)/float64(BASE_CHUNK_SIZE)+1))
-		chunk_size = max(s.cfg.Memory.MinChunkSize, min(file_based, s.cfg.Memory.MaxChunkSize))
+		conn_file = NewFile(file, file_path, NewChunksInfo(chunk_size, chunks_count))
 	}
 
-	// Round to RAM page
-	if chunk_size > 4096 {
-		chunk_size = (chunk_size / 4096) * 4096
+	conn := NewConnection(conn_file, req.Mode)
+	if req.Lifetime > 0 {
+		conn.withLifetime(time.Duration(req.Lifetime) * time.Second)
+	}
+	if req.Mode == pb.ConnectionMode_RDWR {
+		conn.withChange(req.Username, journal.Event{Op: change_op, Path: req.Directory + req.Filename, Size: file_size})
 	}
 
-	chunks_count := uint32(math.Ceil(float64(file_size) / float64(chunk_size)))
-	uuid := s.activeConnections.Push(NewConnection(NewFile(file, file_path, NewChunksInfo(chunk_size, chunks_count)), req.Mode))
+	uuid := s.activeConnections.Push(conn)
 
 	return &pb.Connection{
 		UUID:        uuid.String(),
 		ChunkSize:   chunk_size,
 		ChunksCount: chunks_count,
+		Size:        file_size,
+		ModTime:     mod_time,
 	}, nil
 }
 
@@ -158,24 +285,19 @@ func (s *DataServer) GetData(ctx context.Context, chunk *pb.GetChunk) (*pb.FileP
 		return nil, ErrConnectionNotFound
 	}
 
-	file_info := conn.GetFile().GetChunksInfo()
-
-	offset := file_info.ChunkSize * uint64(chunk.ChunkId)
+	read_data, err := conn.GetFile().ReadChunk(chunk.ChunkId)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrReadOutOfFile
+		}
 
-	read_data := make([]byte, file_info.ChunkSize)
-	n, err := conn.file.ReadAt(read_data, int64(offset))
-	if err != nil && err != io.EOF {
 		slog.ErrorContext(ctx, "failed read file chunk", slog.Any("err", err))
 		return nil, ErrInternal
 	}
 
-	if n == 0 && err == io.EOF {
-		return nil, ErrReadOutOfFile
-	}
-
 	return &pb.FilePart{
-		Chunk:  read_data[:n],
-		Offset: offset,
+		Chunk:  read_data,
+		Offset: conn.GetFile().GetChunksInfo().ChunkSize * uint64(chunk.ChunkId),
 	}, nil
 }
 
@@ -210,13 +332,28 @@ func (s *DataServer) SaveData(ctx context.Context, chunk *pb.SaveChunk) (*emptyp
 		return nil, ErrIncorrectChunkSize
 	}
 
-	_, err = file.WriteAt(chunk.Data.Chunk, int64(chunk.Data.Offset))
+	if file.IsEncrypted() {
+		// Encrypted chunks can be saved only at chunk borders
+		if chunk.Data.Offset%file.GetChunksInfo().ChunkSize != 0 {
+			return nil, ErrIncorrectChunkSize
+		}
+
+		err = file.enc.WriteChunk(uint32(chunk.Data.Offset/file.GetChunksInfo().ChunkSize), chunk.Data.Chunk)
+		if errors.Is(err, filecrypt.ErrBadChunkSize) {
+			return nil, ErrIncorrectChunkSize
+		}
+	} else {
+		_, err = file.WriteAt(chunk.Data.Chunk, int64(chunk.Data.Offset))
+	}
+
 	if err != nil {
 		slog.ErrorContext(ctx, "failed write chunk to file", slog.Any("err", err))
 		return nil, ErrInternal
 	}
 
-	_ = s.activeConnections.UpdateLoadedFileChunks(uuid)
+	if loaded, _ := s.activeConnections.UpdateLoadedFileChunks(uuid); loaded && conn.change != nil {
+		s.record(ctx, conn.user, *conn.change)
+	}
 
 	return nil, nil
 }
@@ -238,21 +375,49 @@ func (s *DataServer) GetSum(ctx context.Context, chunk *pb.GetChunk) (*pb.SHASum
 		return nil, ErrConnectionNotFound
 	}
 
-	file_info := conn.GetFile().GetChunksInfo()
+	body, err := conn.GetFile().ReadChunk(chunk.ChunkId)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrReadOutOfFile
+		}
 
-	body := make([]byte, file_info.ChunkSize)
-	n, err := conn.file.ReadAt(body, int64(file_info.ChunkSize)*int64(chunk.ChunkId))
-	if err != nil && err != io.EOF {
 		slog.ErrorContext(ctx, "failed read file chunk", slog.Any("err", err))
 		return nil, ErrInternal
 	}
 
-	if n == 0 && err == io.EOF {
-		return nil, ErrReadOutOfFile
+	sha := sha256.Sum256(body)
+	return &pb.SHASum{Value: sha[:]}, nil
+}
+
+// Close connection before expiration. Unfinished file of RDWR connection can be removed.
+func (s *DataServer) CloseConnection(ctx context.Context, req *pb.CloseConnectionRequest) (*emptypb.Empty, error) {
+	uuid, err := uuid.Parse(req.UUID)
+	if err != nil {
+		return nil, ErrBadUUID
 	}
 
-	sha := sha256.Sum256(body[:n])
-	return &pb.SHASum{Value: sha[:]}, nil
+	conn, ok := s.activeConnections.Pop(uuid)
+	if !ok {
+		return nil, ErrConnectionNotFound
+	}
+
+	file := conn.GetFile()
+	_ = file.Close()
+
+	if !req.Remove {
+		return nil, nil
+	}
+
+	if conn.mode != pb.ConnectionMode_RDWR || file.IsLoaded() {
+		return nil, ErrUnexpectedFileChange
+	}
+
+	if err := os.Remove(file.GetPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.ErrorContext(ctx, "failed remove unfinished file", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	return nil, nil
 }
 
 func (s *DataServer) GetAvailableDiskSpace(ctx context.Context, dir *pb.Directory) (*pb.Size, error) {
@@ -272,7 +437,7 @@ func (s *DataServer) GetAvailableDiskSpace(ctx context.Context, dir *pb.Director
 		return nil, ErrDirNotFound
 	}
 
-	return &pb.Size{Value: space - s.activeConnections.ExpectedSavedSpace()}, nil
+	return &pb.Size{Value: space - min(space, s.expectedSavedSpace())}, nil
 }
 
 func (s *DataServer) GetFiles(ctx context.Context, dir *pb.Directory) (*pb.FilesList, error) {
@@ -307,7 +472,7 @@ func (s *DataServer) GetFiles(ctx context.Context, dir *pb.Directory) (*pb.Files
 			continue
 		}
 
-		list.Value[i].Size = uint64(info.Size())
+		list.Value[i].Size = s.plainSize(dir.User, dir_path+file.Name(), info)
 		list.Value[i].ModTime = uint64(info.ModTime().Unix())
 	}
 
@@ -326,6 +491,7 @@ func (s *DataServer) CreateDir(ctx context.Context, dir *pb.Directory) (*emptypb
 		return nil, err
 	}
 
+	_, stat_err := os.Lstat(dir_path)
 	if err := os.MkdirAll(dir_path, 0700); err != nil {
 		if errors.Is(err, os.ErrExist) {
 			return nil, ErrDirAlreadyExist
@@ -335,6 +501,10 @@ func (s *DataServer) CreateDir(ctx context.Context, dir *pb.Directory) (*emptypb
 		return nil, ErrInternal
 	}
 
+	// Directory is new, if it wasn't found before
+	if stat_err != nil {
+		s.record(ctx, dir.User, journal.Event{Op: journal.OP_CREATE, Path: dir.Value, IsDir: true})
+	}
 	return nil, nil
 }
 
@@ -350,10 +520,103 @@ func (s *DataServer) RemoveDir(ctx context.Context, dir *pb.Directory) (*emptypb
 		return nil, err
 	}
 
+	_, stat_err := os.Lstat(dir_path)
 	if err := os.RemoveAll(dir_path); err != nil {
 		slog.ErrorContext(ctx, "failed remove user direction", slog.Any("err", err))
 		return nil, ErrInternal
 	}
 
+	// Nothing is removed, if directory wasn't found
+	if stat_err == nil {
+		s.record(ctx, dir.User, journal.Event{Op: journal.OP_REMOVE, Path: dir.Value, IsDir: true})
+	}
+
 	return nil, nil
 }
+
+func (s *DataServer) RemoveFile(ctx context.Context, req *pb.FilePath) (*emptypb.Empty, error) {
+	defer func() {
+		<-s.sem
+	}()
+
+	s.sem <- struct{}{}
+
+	file_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, req.Username, req.Directory, s.cfg.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !filenameRegexp.MatchString(req.Filename) {
+		return nil, ErrBadFilenameSyntax
+	}
+	file_path += req.Filename
+
+	// Directories are removed with RemoveDir
+	if info, err := os.Lstat(file_path); err != nil || info.IsDir() {
+		return nil, ErrFileNotExist
+	}
+
+	if err := os.Remove(file_path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrFileNotExist
+		}
+
+		slog.ErrorContext(ctx, "failed remove user file", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	s.record(ctx, req.Username, journal.Event{Op: journal.OP_REMOVE, Path: req.Directory + req.Filename})
+	return nil, nil
+}
+
+// Size of disk space, which will be used by saving files, extracting archives, applying deltas and other services
+func (s *DataServer) expectedSavedSpace() uint64 {
+	return freemem.Reserved()
+}
+
+// Size of file on disk. Encrypted file takes more space: header and overhead of every chunk.
+func (s *DataServer) diskSize(file_size uint64) uint64 {
+	if s.keyring == nil {
+		return file_size
+	}
+	return filecrypt.Header{ChunkSize: calcChunkSize(s.cfg.Memory, file_size), Size: file_size}.DiskSize()
+}
+
+// Open file as encrypted. Return nil file, if encryption is disabled or file is plain.
+func (s *DataServer) openEncrypted(user string, file *os.File) (*filecrypt.File, error) {
+	if s.keyring == nil {
+		return nil, nil
+	}
+
+	aead, err := s.keyring.UserCipher(user)
+	if err != nil {
+		return nil, err
+	}
+
+	enc_file, ok, err := filecrypt.Open(file, aead)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return enc_file, nil
+}
+
+// Size of file without encryption overhead
+func (s *DataServer) plainSize(user, path string, info os.FileInfo) uint64 {
+	if s.keyring == nil || info.IsDir() {
+		return uint64(info.Size())
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return uint64(info.Size())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	enc_file, err := s.openEncrypted(user, file)
+	if err != nil || enc_file == nil {
+		return uint64(info.Size())
+	}
+	return enc_file.Header().Size
+}
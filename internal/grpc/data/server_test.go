@@ -1,6 +1,10 @@
 package data_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"errors"
@@ -17,6 +21,7 @@ import (
 	"github.com/braginantonev/mhserver/internal/config"
 	"github.com/braginantonev/mhserver/internal/grpc/data"
 	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
 	pb "github.com/braginantonev/mhserver/proto/data"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
@@ -936,3 +941,585 @@ func TestGetFiles(t *testing.T) {
 		t.Errorf("failed cleanup: %v", err)
 	}
 }
+
+func TestEncryptedData(t *testing.T) {
+	// Separate workspace, because all workspace files will be encrypted
+	workspace_path := WORKSPACE_PATH + "encrypted/"
+	if err := createWorkspaceFolders(workspace_path, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	server_cfg := data.NewDataServerConfig(workspace_path, config.MemoryConfig{
+		MaxChunkSize: 64,                 //byte
+		MinChunkSize: 16,                 //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	}).WithEncryption(config.EncryptionConfig{
+		Enabled:   true,
+		MasterKey: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+	})
+
+	// Create data grpc client
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), server_cfg))
+
+	lis, err := net.Listen("tcp", "localhost:8086")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8086", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	// Check that service return plain file, which was saved on disk encrypted
+	checkFile := func(t *testing.T, filename, expected string) {
+		disk_body, err := os.ReadFile(fmt.Sprintf("%s%s/files/%s", workspace_path, TEST_USER, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(disk_body), expected[:32]) {
+			t.Error("file saved on disk without encryption")
+		}
+
+		conn, err := data_client.CreateConnection(t.Context(), &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDONLY,
+			Directory: "/",
+			Filename:  filename,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got strings.Builder
+		for i := range conn.ChunksCount {
+			part, err := data_client.GetData(t.Context(), &pb.GetChunk{UUID: conn.UUID, ChunkId: i})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sum, err := data_client.GetSum(t.Context(), &pb.GetChunk{UUID: conn.UUID, ChunkId: i})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected_sum := sha256.Sum256(part.Chunk)
+			if string(sum.Value) != string(expected_sum[:]) {
+				t.Errorf("chunk %d: sum of encrypted chunk is not equal to plain chunk sum", i)
+			}
+
+			got.Write(part.Chunk)
+		}
+
+		if got.String() != expected {
+			t.Errorf("expected file body: `%s`\nbut got: `%s`", expected, got.String())
+		}
+
+		files, err := data_client.GetFiles(t.Context(), &pb.Directory{User: TEST_USER, Value: "/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, file := range files.Value {
+			if file.Name == filename && file.Size != uint64(len(expected)) {
+				t.Errorf("expected plain file size %d, but got %d", len(expected), file.Size)
+			}
+		}
+	}
+
+	t.Run("save and read", func(t *testing.T) {
+		filename := "encrypted_save.txt"
+		err := saveFile(t.Context(), data_client, &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDWR,
+			Directory: "/",
+			Filename:  filename,
+			Size:      uint64(len(TEST_FILE_BODY)),
+		}, strings.NewReader(TEST_FILE_BODY))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkFile(t, filename, TEST_FILE_BODY)
+	})
+
+	t.Run("save not by chunk borders", func(t *testing.T) {
+		conn, err := data_client.CreateConnection(t.Context(), &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDWR,
+			Directory: "/",
+			Filename:  "encrypted_bad_offset.txt",
+			Size:      uint64(len(TEST_FILE_BODY)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = data_client.SaveData(t.Context(), &pb.SaveChunk{
+			UUID: conn.UUID,
+			Data: &pb.FilePart{Chunk: []byte("abc"), Offset: 3},
+		})
+
+		if !errorIs(err, data.ErrIncorrectChunkSize) {
+			t.Errorf("expected error %v, but got %v", data.ErrIncorrectChunkSize, err)
+		}
+	})
+
+	t.Run("encrypt existing files", func(t *testing.T) {
+		filename := "encrypted_migration.txt"
+		if err := os.WriteFile(fmt.Sprintf("%s%s/files/%s", workspace_path, TEST_USER, filename), []byte(TEST_FILE_BODY), 0660); err != nil {
+			t.Fatal(err)
+		}
+
+		// Plain file with magic of encrypted files and unknown version mustn't stop migration
+		magic_filename := "encrypted_migration_magic.txt"
+		magic_body := filecrypt.FORMAT_MAGIC + "\x02" + TEST_FILE_BODY
+		if err := os.WriteFile(fmt.Sprintf("%s%s/files/%s", workspace_path, TEST_USER, magic_filename), []byte(magic_body), 0660); err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := data.EncryptExistingFiles(t.Context(), server_cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count == 0 {
+			t.Fatal("expected encrypted files, but nothing was encrypted")
+		}
+
+		checkFile(t, filename, TEST_FILE_BODY)
+		checkFile(t, magic_filename, magic_body)
+
+		// Second run mustn't encrypt files again
+		if _, err := data.EncryptExistingFiles(t.Context(), server_cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		checkFile(t, filename, TEST_FILE_BODY)
+	})
+}
+
+type archiveFile struct {
+	name string
+	body string
+}
+
+func createZip(files []archiveFile) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write([]byte(file.body)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func createTarGz(files []archiveFile) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:     file.name,
+			Mode:     0660,
+			Size:     int64(len(file.body)),
+			Typeflag: tar.TypeReg,
+		}
+
+		if strings.HasSuffix(file.name, "/") {
+			header.Typeflag = tar.TypeDir
+			header.Size = 0
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+
+		if _, err := tw.Write([]byte(file.body)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Symlinks must be skipped
+	if err := tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestExtract(t *testing.T) {
+	if err := createWorkspaceFolders(WORKSPACE_PATH, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	files_path := WORKSPACE_PATH + TEST_USER + "/files"
+	test_dir := "/extract_test/"
+	if err := os.MkdirAll(files_path+test_dir, 0770); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(files_path + test_dir)
+	}()
+
+	// Create data grpc client
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 1024,               //byte
+		MinChunkSize: 5,                  //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8087")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8087", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	good_files := []archiveFile{
+		{name: "photos/"},
+		{name: "photos/cat.jpg", body: TEST_FILE_BODY},
+		{name: "photos/2025/dog.png", body: strings.Repeat(TEST_FILE_BODY, 10)},
+		{name: "notes.txt", body: "Hello"},
+		{name: "__MACOSX/photos/._cat.jpg", body: "mac metadata"},
+	}
+
+	archives := map[string][]archiveFile{
+		"good.zip":    good_files,
+		"good.tar.gz": good_files,
+		"escape.zip":  {{name: "notes.txt", body: "ok"}, {name: "../escape.txt", body: "evil"}},
+		"abs.tar.gz":  {{name: "/etc/cron.d/evil", body: "evil"}},
+	}
+
+	for name, files := range archives {
+		var body []byte
+		if strings.HasSuffix(name, ".zip") {
+			body, err = createZip(files)
+		} else {
+			body, err = createTarGz(files)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(files_path+test_dir+name, body, 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(files_path+test_dir+"damaged.zip", []byte(TEST_FILE_BODY), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	// ! Кейсы должны выполняться строго последовательно
+	cases := [...]struct {
+		name           string
+		req            *pb.ExtractRequest
+		expected_err   error
+		expected_files []archiveFile // Files in target dir after extraction
+		not_created    bool          // Target dir must not be created
+	}{
+		{
+			name: "unsupported archive",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "file.rar",
+				Target:    test_dir,
+			},
+			expected_err: data.ErrUnsupportedArchive,
+		},
+		{
+			name: "archive not exist",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "not_exist.zip",
+				Target:    test_dir,
+			},
+			expected_err: data.ErrFileNotExist,
+		},
+		{
+			name: "bad target",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "good.zip",
+				Target:    "/../",
+			},
+			expected_err: dirs.ErrBadDirSyntax,
+		},
+		{
+			name: "damaged archive",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "damaged.zip",
+				Target:    test_dir,
+			},
+			expected_err: data.ErrBadArchive,
+		},
+		{
+			name: "escape from target",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "escape.zip",
+				Target:    test_dir + "escape/",
+			},
+			expected_err: data.ErrBadArchiveEntry,
+			not_created:  true,
+		},
+		{
+			name: "absolute path",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "abs.tar.gz",
+				Target:    test_dir + "abs/",
+			},
+			expected_err: data.ErrBadArchiveEntry,
+			not_created:  true,
+		},
+		{
+			name: "zip",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "good.zip",
+				Target:    test_dir + "zip/",
+			},
+			expected_files: good_files[1:4],
+		},
+		{
+			name: "tar.gz",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "good.tar.gz",
+				Target:    test_dir + "tar/",
+			},
+			expected_files: good_files[1:4],
+		},
+		{
+			name: "files already exist",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "good.tar.gz",
+				Target:    test_dir + "zip/",
+			},
+			expected_err: data.ErrFileAlreadyExist,
+		},
+		{
+			name: "overwrite",
+			req: &pb.ExtractRequest{
+				Directory: test_dir,
+				Filename:  "good.tar.gz",
+				Target:    test_dir + "zip/",
+				Overwrite: true,
+			},
+			expected_files: good_files[1:4],
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			test.req.Username = TEST_USER
+			stream, err := data_client.Extract(t.Context(), test.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var last *pb.ExtractProgress
+			for {
+				progress, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					if test.expected_err == nil || !strings.HasPrefix(status.Convert(err).Message(), test.expected_err.Error()) {
+						t.Fatalf("expected error %v, but got %v", test.expected_err, err)
+					}
+					break
+				}
+				last = progress
+			}
+
+			if test.expected_err != nil {
+				if last != nil {
+					t.Errorf("expected error %v, but extraction started", test.expected_err)
+				}
+
+				// Nothing must be extracted
+				if _, err := os.Stat(files_path + test.req.Target); test.not_created && err == nil {
+					t.Error("files extracted from bad archive")
+				}
+				return
+			}
+
+			if last == nil || last.Files != last.FilesCount || last.Files != uint32(len(test.expected_files)) {
+				t.Fatalf("bad last progress: %v", last)
+			}
+
+			for _, file := range test.expected_files {
+				body, err := os.ReadFile(files_path + test.req.Target + file.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(body) != file.body {
+					t.Errorf("file %s: expected body `%s`, but got `%s`", file.name, file.body, body)
+				}
+			}
+
+			if _, err := os.Stat(files_path + test.req.Target + "__MACOSX"); err == nil {
+				t.Error("archiver metadata extracted")
+			}
+		})
+	}
+}
+
+func TestRemoveFile(t *testing.T) {
+	workspace_path := WORKSPACE_PATH + "remove/"
+	if err := createWorkspaceFolders(workspace_path, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(workspace_path, config.MemoryConfig{
+		MaxChunkSize: 64,                 //byte
+		MinChunkSize: 16,                 //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8092")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+	defer grpc_server.Stop()
+
+	grpc_connection, err := grpc.NewClient("localhost:8092", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	const dir string = "/remove_test/"
+	if _, err := data_client.CreateDir(t.Context(), &pb.Directory{User: TEST_USER, Value: dir}); err != nil && !errorIs(err, data.ErrDirAlreadyExist) {
+		t.Fatal(err)
+	}
+
+	file_path := fmt.Sprintf("%s%s/files%snotes.txt", workspace_path, TEST_USER, dir)
+
+	// Overwritten file is truncated to new size
+	for _, body := range []string{TEST_FILE_BODY, TEST_FILE_BODY[:64]} {
+		err := saveFile(t.Context(), data_client, &pb.ConnectionRequest{
+			Username:  TEST_USER,
+			Mode:      pb.ConnectionMode_RDWR,
+			Directory: dir,
+			Filename:  "notes.txt",
+			Size:      uint64(len(body)),
+		}, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := os.ReadFile(file_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(saved) != TEST_FILE_BODY[:64] {
+		t.Fatalf("expected overwritten file %q, but got %q", TEST_FILE_BODY[:64], saved)
+	}
+
+	cases := []struct {
+		name      string
+		directory string
+		filename  string
+		expected  error
+	}{
+		{
+			name:      "bad filename",
+			directory: dir,
+			filename:  "../notes.txt",
+			expected:  data.ErrBadFilenameSyntax,
+		},
+		{
+			name:      "directory",
+			directory: "/",
+			filename:  "remove_test",
+			expected:  data.ErrFileNotExist,
+		},
+		{
+			name:      "remove",
+			directory: dir,
+			filename:  "notes.txt",
+			expected:  nil,
+		},
+		{
+			name:      "already removed",
+			directory: dir,
+			filename:  "notes.txt",
+			expected:  data.ErrFileNotExist,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := data_client.RemoveFile(t.Context(), &pb.FilePath{
+				Username:  TEST_USER,
+				Directory: test.directory,
+				Filename:  test.filename,
+			})
+
+			if !errorIs(err, test.expected) {
+				t.Errorf("expected error %v, but got %v", test.expected, err)
+			}
+		})
+	}
+
+	if _, err := os.Stat(file_path); !os.IsNotExist(err) {
+		t.Errorf("expected removed file, but got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/shares"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func shareToPb(share shares.Share) *pb.Share {
+	return &pb.Share{
+		Token:    share.Token,
+		Username: share.User,
+		Path:     share.Path,
+		Created:  share.Created,
+		Expires:  share.Expires,
+	}
+}
+
+// Shares errors are returned as is, other errors are internal
+func sharesError(ctx context.Context, err error) error {
+	if errors.Is(err, shares.ErrShareNotFound) || errors.Is(err, shares.ErrBadShareLifetime) {
+		return err
+	}
+
+	slog.ErrorContext(ctx, "failed access shares", slog.Any("err", err))
+	return ErrInternal
+}
+
+// Create public link to user file. Only files can be shared.
+func (s *DataServer) CreateShare(ctx context.Context, req *pb.ShareRequest) (*pb.Share, error) {
+	file_path, err := dirs.GetDataPath(s.cfg.WorkspacePath, req.Username, req.Directory, s.cfg.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !filenameRegexp.MatchString(req.Filename) {
+		return nil, ErrBadFilenameSyntax
+	}
+
+	if info, err := os.Stat(file_path + req.Filename); err != nil || !info.Mode().IsRegular() {
+		return nil, ErrFileNotExist
+	}
+
+	share, err := s.shares.Create(req.Username, req.Directory+req.Filename, time.Duration(req.Lifetime)*time.Second)
+	if err != nil {
+		return nil, sharesError(ctx, err)
+	}
+	return shareToPb(share), nil
+}
+
+// Find share by token. If username is set, shares of other users are not found.
+func (s *DataServer) GetShare(ctx context.Context, req *pb.ShareToken) (*pb.Share, error) {
+	share, err := s.shares.Get(req.Token)
+	if err != nil {
+		return nil, sharesError(ctx, err)
+	}
+
+	if req.Username != "" && share.User != req.Username {
+		return nil, shares.ErrShareNotFound
+	}
+	return shareToPb(share), nil
+}
+
+func (s *DataServer) GetShares(ctx context.Context, req *pb.SharesRequest) (*pb.SharesList, error) {
+	list, err := s.shares.List(req.Username)
+	if err != nil {
+		return nil, sharesError(ctx, err)
+	}
+
+	resp := &pb.SharesList{Value: make([]*pb.Share, len(list))}
+	for i, share := range list {
+		resp.Value[i] = shareToPb(share)
+	}
+	return resp, nil
+}
+
+func (s *DataServer) RemoveShare(ctx context.Context, req *pb.ShareToken) (*emptypb.Empty, error) {
+	if err := s.shares.Remove(req.Username, req.Token); err != nil {
+		return nil, sharesError(ctx, err)
+	}
+	return nil, nil
+}
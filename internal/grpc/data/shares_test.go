@@ -0,0 +1,165 @@
+package data_test
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/shares"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestShares(t *testing.T) {
+	workspace_path := WORKSPACE_PATH + "shares/"
+	if err := os.RemoveAll(workspace_path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createWorkspaceFolders(workspace_path, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(workspace_path, config.MemoryConfig{
+		MaxChunkSize: 64,                 //byte
+		MinChunkSize: 16,                 //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8095")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+	defer grpc_server.Stop()
+
+	grpc_connection, err := grpc.NewClient("localhost:8095", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	if _, err := data_client.CreateDir(t.Context(), &pb.Directory{User: TEST_USER, Value: "/shared/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = saveFile(t.Context(), data_client, &pb.ConnectionRequest{
+		Username:  TEST_USER,
+		Mode:      pb.ConnectionMode_RDWR,
+		Directory: "/shared/",
+		Filename:  "notes.txt",
+		Size:      uint64(len(TEST_FILE_BODY)),
+	}, strings.NewReader(TEST_FILE_BODY))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create_cases := []struct {
+		name      string
+		directory string
+		filename  string
+		lifetime  int64
+		expected  error
+	}{
+		{
+			name:      "directory",
+			directory: "/",
+			filename:  "shared",
+			expected:  data.ErrFileNotExist,
+		},
+		{
+			name:      "not existing file",
+			directory: "/shared/",
+			filename:  "ibn5100.txt",
+			expected:  data.ErrFileNotExist,
+		},
+		{
+			name:      "bad lifetime",
+			directory: "/shared/",
+			filename:  "notes.txt",
+			lifetime:  -1,
+			expected:  shares.ErrBadShareLifetime,
+		},
+		{
+			name:      "share",
+			directory: "/shared/",
+			filename:  "notes.txt",
+			lifetime:  3600,
+			expected:  nil,
+		},
+	}
+
+	for _, test := range create_cases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := data_client.CreateShare(t.Context(), &pb.ShareRequest{
+				Username:  TEST_USER,
+				Directory: test.directory,
+				Filename:  test.filename,
+				Lifetime:  test.lifetime,
+			})
+
+			if !errorIs(err, test.expected) {
+				t.Errorf("expected %v, but got %v", test.expected, err)
+			}
+		})
+	}
+
+	list, err := data_client.GetShares(t.Context(), &pb.SharesRequest{Username: TEST_USER})
+	if err != nil || len(list.Value) != 1 {
+		t.Fatalf("expected one share, but got %v (%v)", list, err)
+	}
+
+	share := list.Value[0]
+	if share.Path != "/shared/notes.txt" || share.Expires-share.Created != 3600 {
+		t.Errorf("expected share of /shared/notes.txt for hour, but got %v", share)
+	}
+
+	t.Run("public access", func(t *testing.T) {
+		got, err := data_client.GetShare(t.Context(), &pb.ShareToken{Token: share.Token})
+		if err != nil || got.Username != TEST_USER || got.Path != share.Path {
+			t.Errorf("expected share %v, but got %v (%v)", share, got, err)
+		}
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		if _, err := data_client.GetShare(t.Context(), &pb.ShareToken{Username: "daru", Token: share.Token}); !errorIs(err, shares.ErrShareNotFound) {
+			t.Errorf("expected %v, but got %v", shares.ErrShareNotFound, err)
+		}
+
+		if _, err := data_client.RemoveShare(t.Context(), &pb.ShareToken{Username: "daru", Token: share.Token}); !errorIs(err, shares.ErrShareNotFound) {
+			t.Errorf("expected %v, but got %v", shares.ErrShareNotFound, err)
+		}
+	})
+
+	t.Run("moved file", func(t *testing.T) {
+		if _, err := data_client.Move(t.Context(), &pb.MoveRequest{Username: TEST_USER, From: "/shared/", To: "/public/"}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := data_client.GetShare(t.Context(), &pb.ShareToken{Token: share.Token})
+		if err != nil || got.Path != "/public/notes.txt" {
+			t.Errorf("expected moved share, but got %v (%v)", got, err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if _, err := data_client.RemoveShare(t.Context(), &pb.ShareToken{Username: TEST_USER, Token: share.Token}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := data_client.GetShare(t.Context(), &pb.ShareToken{Token: share.Token}); !errorIs(err, shares.ErrShareNotFound) {
+			t.Errorf("expected %v, but got %v", shares.ErrShareNotFound, err)
+		}
+	})
+}
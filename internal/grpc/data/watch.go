@@ -0,0 +1,228 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/repository/fswatch"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+)
+
+// Counter of running operations of users, which record changes after end (extraction)
+type busyUsers struct {
+	value map[string]int
+	mux   *sync.Mutex
+}
+
+func newBusyUsers() busyUsers {
+	return busyUsers{
+		value: make(map[string]int),
+		mux:   &sync.Mutex{},
+	}
+}
+
+func (b busyUsers) add(user string) {
+	b.mux.Lock()
+	b.value[user]++
+	b.mux.Unlock()
+}
+
+func (b busyUsers) done(user string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.value[user]--; b.value[user] <= 0 {
+		delete(b.value, user)
+	}
+}
+
+func (b busyUsers) has(user string) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.value[user] > 0
+}
+
+// Recorded changes are compared with changes found by watcher for this time
+const RECENT_CHANGES_DURATION time.Duration = time.Minute
+
+/*
+Changes found by watcher, which were recorded in journal by server (API, WebDAV or SFTP) or will be recorded soon.
+Journal is read from last read cursor of user.
+*/
+type outsideChanges struct {
+	// Last read journal cursors of users
+	cursors map[string]uint64
+
+	// Changes recorded for last RECENT_CHANGES_DURATION
+	recent map[string][]journal.Event
+}
+
+// Watch workspace for files changed bypassing server and record them in journal
+func (s *DataServer) startWatcher(ctx context.Context) {
+	changes := outsideChanges{
+		cursors: make(map[string]uint64),
+		recent:  make(map[string][]journal.Event),
+	}
+
+	// Journal of existing users is read from current cursor, new users don't have journal yet
+	users, err := os.ReadDir(s.cfg.WorkspacePath)
+	if err != nil {
+		slog.Error("failed read workspace. Watcher disabled!", slog.String("subserver", string(s.cfg.ServiceName)), slog.Any("err", err))
+		return
+	}
+
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+
+		cursor, err := s.journal.Cursor(user.Name())
+		if err != nil {
+			slog.Warn("failed get changes cursor", slog.String("user", user.Name()), slog.Any("err", err))
+			continue
+		}
+		changes.cursors[user.Name()] = cursor
+	}
+
+	watcher := fswatch.New(fswatch.Config{
+		WorkspacePath:  s.cfg.WorkspacePath,
+		Service:        s.cfg.ServiceName,
+		RescanOnly:     s.cfg.Watcher.RescanOnly,
+		RescanInterval: time.Duration(s.cfg.Watcher.RescanInterval) * time.Second,
+		Ignore: func(name string) bool {
+			return strings.HasSuffix(name, TEMP_FILE_SUFFIX)
+		},
+	}, func(events []fswatch.Event) []fswatch.Event {
+		return s.recordOutsideChanges(ctx, &changes, events)
+	})
+
+	go watcher.Run(ctx)
+}
+
+// Recorded change is the same change as found by watcher
+func sameChange(recorded journal.Event, found fswatch.Event) bool {
+	// Journal time is in seconds
+	if recorded.Time < found.Time-1 {
+		return false
+	}
+
+	found_path := path.Clean(found.Path)
+	for _, recorded_path := range []string{recorded.Path, recorded.OldPath} {
+		if recorded_path == "" {
+			continue
+		}
+
+		recorded_path = path.Clean(recorded_path)
+		if recorded_path == found_path {
+			return true
+		}
+
+		// Files in removed or moved folder
+		if recorded.Op != journal.OP_CREATE && recorded.Op != journal.OP_MODIFY && strings.HasPrefix(found_path, recorded_path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Return changes of user recorded for last RECENT_CHANGES_DURATION
+func (s *DataServer) recordedChanges(user string, changes *outsideChanges) []journal.Event {
+	events, err := s.pollChanges(user, changes.cursors[user])
+	switch {
+	case errors.Is(err, journal.ErrCursorExpired) || errors.Is(err, journal.ErrBadCursor):
+		// Journal was compacted or removed, so new recorded changes can't be checked
+		if cursor, err := s.journal.Cursor(user); err == nil {
+			changes.cursors[user] = cursor
+		}
+	case err != nil:
+		slog.Warn("failed read changes", slog.String("user", user), slog.Any("err", err))
+	case len(events) != 0:
+		changes.cursors[user] = events[len(events)-1].Cursor
+	}
+
+	min_time := time.Now().Add(-RECENT_CHANGES_DURATION).Unix()
+	recent := slices.DeleteFunc(append(changes.recent[user], events...), func(event journal.Event) bool {
+		return event.Time < min_time
+	})
+
+	if len(recent) == 0 {
+		delete(changes.recent, user)
+	} else {
+		changes.recent[user] = recent
+	}
+	return recent
+}
+
+/*
+Record changes found by watcher, which are not in journal. Changes of uploading files and
+changes of users, who extract archives now, are postponed: they are recorded by server after end.
+*/
+func (s *DataServer) recordOutsideChanges(ctx context.Context, changes *outsideChanges, found []fswatch.Event) []fswatch.Event {
+	var postponed []fswatch.Event
+	by_user := make(map[string][]fswatch.Event)
+	for _, event := range found {
+		by_user[event.User] = append(by_user[event.User], event)
+	}
+
+	for user, events := range by_user {
+		if s.busy.has(user) {
+			postponed = append(postponed, events...)
+			continue
+		}
+
+		uploading := make(map[string]bool)
+		for _, upload := range s.activeConnections.Uploads(user) {
+			uploading[path.Clean(upload.Path)] = true
+		}
+
+		recorded := s.recordedChanges(user, changes)
+
+		var outside []journal.Event
+	next_event:
+		for _, event := range events {
+			if uploading[path.Clean(event.Path)] {
+				postponed = append(postponed, event)
+				continue
+			}
+
+			for _, r := range recorded {
+				if sameChange(r, event) {
+					continue next_event
+				}
+			}
+
+			if event.Op == journal.OP_REMOVE || event.IsDir {
+				outside = append(outside, event.Event)
+				continue
+			}
+
+			// Files copied bypassing server can have names, which are not allowed by API, so path isn't checked
+			file_path := fmt.Sprintf("%s%s/%s%s", s.cfg.WorkspacePath, user, s.cfg.ServiceName, event.Path)
+
+			// File was removed after change, remove is recorded next
+			info, err := os.Stat(file_path)
+			if err != nil {
+				continue
+			}
+
+			event.Size = s.plainSize(user, file_path, info)
+			outside = append(outside, event.Event)
+		}
+
+		if len(outside) != 0 {
+			slog.InfoContext(ctx, "Record changes made outside server", slog.String("user", user), slog.Int("count", len(outside)))
+			s.record(ctx, user, outside...)
+		}
+	}
+
+	return postponed
+}
@@ -0,0 +1,93 @@
+package data_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/fswatch"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestWatcher(t *testing.T) {
+	workspace_path := WORKSPACE_PATH + "watch/"
+	if err := os.RemoveAll(workspace_path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createWorkspaceFolders(workspace_path, TEST_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(workspace_path, config.MemoryConfig{
+		MaxChunkSize: 64,                 //byte
+		MinChunkSize: 16,                 //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	}).WithWatcher(config.WatcherConfig{Enabled: true})))
+
+	lis, err := net.Listen("tcp", "localhost:8091")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+	defer grpc_server.Stop()
+
+	grpc_connection, err := grpc.NewClient("localhost:8091", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+
+	// Wait for watcher start
+	time.Sleep(200 * time.Millisecond)
+
+	start, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// File copied bypassing server
+	if err := os.WriteFile(workspace_path+TEST_USER+"/files/copied.txt", []byte(TEST_FILE_BODY), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Change made through server is recorded once
+	if _, err := data_client.CreateDir(t.Context(), &pb.Directory{User: TEST_USER, Value: "/api_dir/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(fswatch.DEBOUNCE_DURATION + 2*fswatch.FLUSH_INTERVAL)
+
+	list, err := data_client.GetChanges(t.Context(), &pb.ChangesRequest{Username: TEST_USER, Since: &start.Cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*pb.Change{
+		{Op: string(journal.OP_CREATE), Path: "/api_dir/", IsDir: true},
+		{Op: string(journal.OP_CREATE), Path: "/copied.txt", Size: uint64(len(TEST_FILE_BODY))},
+	}
+
+	if len(list.Changes) != len(expected) {
+		t.Fatalf("expected %d changes, but got %v", len(expected), list.Changes)
+	}
+
+	for i, change := range list.Changes {
+		if change.Op != expected[i].Op || change.Path != expected[i].Path || change.IsDir != expected[i].IsDir || change.Size != expected[i].Size {
+			t.Errorf("expected change %v, but got %v", expected[i], change)
+		}
+	}
+}
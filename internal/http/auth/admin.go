@@ -0,0 +1,339 @@
+package authhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httperror"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+)
+
+const (
+	DEFAULT_REGISTER_KEYS_COUNT int = 1
+	MAX_REGISTER_KEYS_COUNT     int = 100
+	MAX_LOGIN_ATTEMPTS_LIMIT    int = 1000
+)
+
+type CreateUserRequest struct {
+	auth.User
+	Role auth.Role `json:"role"`
+}
+
+type GenerateRegisterKeysRequest struct {
+	// Count of keys, one by default
+	Count int `json:"count"`
+
+	// Key lifetime in seconds. Zero means key never expires.
+	ExpiresIn int64 `json:"expires_in"`
+
+	MaxUses  int       `json:"max_uses"`
+	Username string    `json:"username"`
+	Role     auth.Role `json:"role"`
+}
+
+// User, which is managed by administrator, is addressed by "username" url parameter
+func targetUser(w http.ResponseWriter, r *http.Request, func_name string) (string, bool) {
+	admin, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName(func_name).Write(w)
+		return "", false
+	}
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		ErrUsernameEmpty.Write(w)
+		return "", false
+	}
+
+	// Server must always have administrator
+	if username == admin {
+		ErrSelfModification.Write(w)
+		return "", false
+	}
+	return username, true
+}
+
+// Unknown user or key is "not found" for administrator, but "bad request" or "forbidden" for login and registration
+func handleAdminError(w http.ResponseWriter, err error, func_name string) {
+	if errors.Is(err, auth.ErrUserNotExist) || errors.Is(err, auth.ErrRegSecretKeyNotFound) {
+		httperror.NewExternalHttpError(err.Error(), http.StatusNotFound).Write(w)
+		return
+	}
+	handleServiceError(w, err, func_name)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		slog.Error("failed write response", slog.Any("err", err))
+	}
+}
+
+func (handler Handler) AdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin get users request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	users, err := handler.service.GetUsers()
+	if err != nil {
+		handleServiceError(w, err, "auth.GetUsers")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, users)
+}
+
+// Create user without registration key. Role is "user" by default.
+func (handler Handler) AdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin create user request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	var req CreateUserRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.AdminCreateUser"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if req.Name == "" {
+		ErrUsernameEmpty.Write(w)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = auth.ROLE_USER
+	}
+
+	if err := handler.service.AddUser(req.User, req.Role); err != nil {
+		handleServiceError(w, err, "auth.AddUser")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, auth.UserInfo{Name: req.Name, Role: req.Role})
+}
+
+// Delete user. With "files=true" user files are removed too.
+func (handler Handler) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin delete user request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := targetUser(w, r, "Handlers.AdminDeleteUser")
+	if !ok {
+		return
+	}
+
+	remove_files := false
+	if files := r.URL.Query().Get("files"); files != "" {
+		var err error
+		if remove_files, err = strconv.ParseBool(files); err != nil {
+			ErrBadFilesFlag.Write(w)
+			return
+		}
+	}
+
+	if err := handler.service.DeleteUser(username, remove_files); err != nil {
+		handleAdminError(w, err, "auth.DeleteUser")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Disable or enable user
+func (handler Handler) adminSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	slog.Info("Admin set user state request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr), slog.Bool("disabled", disabled))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := targetUser(w, r, "Handlers.AdminSetDisabled")
+	if !ok {
+		return
+	}
+
+	if err := handler.service.SetDisabled(username, disabled); err != nil {
+		handleAdminError(w, err, "auth.SetDisabled")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+func (handler Handler) AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	handler.adminSetDisabled(w, r, true)
+}
+
+func (handler Handler) AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	handler.adminSetDisabled(w, r, false)
+}
+
+func (handler Handler) AdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin set user role request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := targetUser(w, r, "Handlers.AdminSetUserRole")
+	if !ok {
+		return
+	}
+
+	if err := handler.service.SetRole(username, auth.Role(r.URL.Query().Get("role"))); err != nil {
+		handleAdminError(w, err, "auth.SetRole")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+func (handler Handler) AdminGetStorage(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin get storage request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	usage, err := handler.service.GetStorageUsage()
+	if err != nil {
+		handleServiceError(w, err, "auth.GetStorageUsage")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, usage)
+}
+
+func (handler Handler) AdminGetRegisterKeys(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin get registration keys request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	keys, err := handler.service.GetRegisterKeys()
+	if err != nil {
+		handleServiceError(w, err, "auth.GetRegisterKeys")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// Generate registration keys. All fields of request are optional.
+func (handler Handler) AdminGenerateRegisterKeys(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin generate registration keys request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	admin, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.AdminGenerateRegisterKeys").Write(w)
+		return
+	}
+
+	var req GenerateRegisterKeysRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.AdminGenerateRegisterKeys"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if req.Count == 0 {
+		req.Count = DEFAULT_REGISTER_KEYS_COUNT
+	} else if req.Count < 0 || req.Count > MAX_REGISTER_KEYS_COUNT {
+		ErrBadKeysCount.Write(w)
+		return
+	}
+
+	keys, err := handler.service.GenerateRegisterKeys(req.Count, auth.RegisterKeyOptions{
+		Lifetime:  time.Duration(req.ExpiresIn) * time.Second,
+		MaxUses:   req.MaxUses,
+		Username:  req.Username,
+		Role:      req.Role,
+		CreatedBy: admin,
+	})
+	if err != nil {
+		handleServiceError(w, err, "auth.GenerateRegisterKeys")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, keys)
+}
+
+func (handler Handler) AdminRevokeRegisterKey(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin revoke registration key request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		ErrRegisterKeyEmpty.Write(w)
+		return
+	}
+
+	if err := handler.service.RevokeRegisterKey(key); err != nil {
+		handleAdminError(w, err, "auth.RevokeRegisterKey")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Usernames with recent failed logins or active lockout
+func (handler Handler) AdminGetLockouts(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin get lockouts request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	lockouts, err := handler.service.GetLockouts()
+	if err != nil {
+		handleServiceError(w, err, "auth.GetLockouts")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lockouts)
+}
+
+// Unlock username and forget its failed logins
+func (handler Handler) AdminClearLockout(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin clear lockout request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		ErrUsernameEmpty.Write(w)
+		return
+	}
+
+	if err := handler.service.ClearLockout(username); err != nil {
+		handleServiceError(w, err, "auth.ClearLockout")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Audit log of logins, newest first. Optional parameters: "username" and "limit" (100 by default).
+func (handler Handler) AdminGetLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Admin get login attempts request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	limit := auth.DEFAULT_LOGIN_ATTEMPTS_LIMIT
+	if param := r.URL.Query().Get("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit <= 0 || limit > MAX_LOGIN_ATTEMPTS_LIMIT {
+			ErrBadAttemptsLimit.Write(w)
+			return
+		}
+	}
+
+	attempts, err := handler.service.GetLoginAttempts(r.URL.Query().Get("username"), limit)
+	if err != nil {
+		handleServiceError(w, err, "auth.GetLoginAttempts")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, attempts)
+}
@@ -3,6 +3,7 @@ package authhttp
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/braginantonev/mhserver/internal/service/auth"
 	"github.com/braginantonev/mhserver/pkg/httperror"
@@ -11,8 +12,26 @@ import (
 var (
 	// by default errors have 400 status code
 	authSpecialCodes = map[error]int{
-		auth.ErrUserAlreadyExists:    http.StatusConflict,
-		auth.ErrRegSecretKeyNotFound: http.StatusForbidden,
+		auth.ErrUserAlreadyExists:      http.StatusConflict,
+		auth.ErrRegSecretKeyNotFound:   http.StatusForbidden,
+		auth.ErrRegSecretKeyExpired:    http.StatusForbidden,
+		auth.ErrRegSecretKeyBound:      http.StatusForbidden,
+		auth.ErrPublicKeyAlreadyExists: http.StatusConflict,
+		auth.ErrPublicKeyNotFound:      http.StatusNotFound,
+		auth.ErrBadRefreshToken:        http.StatusUnauthorized,
+		auth.ErrSessionNotFound:        http.StatusNotFound,
+		auth.ErrBadResetToken:          http.StatusForbidden,
+		auth.ErrUserDisabled:           http.StatusForbidden,
+		auth.ErrInviteLimit:            http.StatusForbidden,
+		auth.ErrInviteNotFound:         http.StatusNotFound,
+		auth.ErrTOTPRequired:           http.StatusUnauthorized,
+		auth.ErrWrongTOTPCode:          http.StatusUnauthorized,
+		auth.ErrBadLoginChallenge:      http.StatusUnauthorized,
+		auth.ErrTOTPAlreadyEnabled:     http.StatusConflict,
+		auth.ErrPersonalTokenExists:    http.StatusConflict,
+		auth.ErrPersonalTokenNotFound:  http.StatusNotFound,
+		auth.ErrLoginLocked:            http.StatusTooManyRequests,
+		auth.ErrLockoutNotFound:        http.StatusNotFound,
 	}
 
 	// Handler
@@ -22,6 +41,22 @@ var (
 	ErrFailedReadBody    = httperror.NewInternalHttpError("failed read request body", "") // Use WithDesc() and WithFuncName() to write response
 	ErrUsernameEmpty     = httperror.NewExternalHttpError("username is empty", http.StatusBadRequest)
 	ErrRegSecretKeyEmpty = httperror.NewExternalHttpError("register secret key is empty", http.StatusBadRequest)
+	ErrFingerprintEmpty  = httperror.NewExternalHttpError("public key fingerprint is empty", http.StatusBadRequest)
+	ErrRefreshTokenEmpty = httperror.NewExternalHttpError("refresh token is empty", http.StatusBadRequest)
+	ErrSessionIdEmpty    = httperror.NewExternalHttpError("session id is empty", http.StatusBadRequest)
+	ErrResetTokenEmpty   = httperror.NewExternalHttpError("password reset token is empty", http.StatusBadRequest)
+	ErrRegisterKeyEmpty  = httperror.NewExternalHttpError("registration key is empty", http.StatusBadRequest)
+	ErrInviteKeyEmpty    = httperror.NewExternalHttpError("invite key is empty", http.StatusBadRequest)
+	ErrChallengeEmpty    = httperror.NewExternalHttpError("challenge token is empty", http.StatusBadRequest)
+	ErrTOTPCodeEmpty     = httperror.NewExternalHttpError("two-factor authentication code is empty", http.StatusBadRequest)
+	ErrBadTokenId        = httperror.NewExternalHttpError("personal token id must be number", http.StatusBadRequest)
+	ErrBadKeysCount      = httperror.NewExternalHttpError("count of keys must be number from 1 to 100", http.StatusBadRequest)
+	ErrBadAttemptsLimit  = httperror.NewExternalHttpError("limit of attempts must be number from 1 to 1000", http.StatusBadRequest)
+	ErrBadFilesFlag      = httperror.NewExternalHttpError("files parameter must be boolean", http.StatusBadRequest)
+	ErrSelfModification  = httperror.NewExternalHttpError("administrator can't disable, delete or change role of himself", http.StatusConflict)
+
+	ErrWrongContextUsername = httperror.NewInternalHttpError("context username from jwt is not string", "")
+	ErrWrongContextClaims   = httperror.NewInternalHttpError("context claims from jwt have wrong type", "")
 
 	// Middleware
 	ErrToManyRequests       = httperror.NewExternalHttpError("to many requests", http.StatusTooManyRequests)
@@ -29,9 +64,21 @@ var (
 	ErrJwtSignatureInvalid  = httperror.NewExternalHttpError("jwt signature is invalid", http.StatusBadRequest)
 	ErrAuthorizationExpired = httperror.NewExternalHttpError("authorization expired", http.StatusUnauthorized)
 	ErrUserNotAuthorized    = httperror.NewExternalHttpError("user not authorized", http.StatusUnauthorized)
+	ErrAuthorizationRevoked = httperror.NewExternalHttpError("authorization revoked", http.StatusUnauthorized)
+	ErrForeignToken         = httperror.NewExternalHttpError("token is issued by unknown key, issuer or for another audience", http.StatusUnauthorized)
+	ErrNotEnoughRights      = httperror.NewExternalHttpError("not enough rights", http.StatusForbidden)
+	ErrInsufficientScope    = httperror.NewExternalHttpError("token scope is insufficient", http.StatusForbidden)
+	ErrBadPersonalToken     = httperror.NewExternalHttpError("personal token is invalid, expired or revoked", http.StatusUnauthorized)
 )
 
 func handleServiceError(w http.ResponseWriter, err error, func_name string) {
+	// Client must wait before next login attempt
+	var locked *auth.LoginLockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.FormatInt(locked.RetryAfter, 10))
+		err = auth.ErrLoginLocked
+	}
+
 	if errors.Is(err, auth.ErrInternal) {
 		ErrInternal.WithFuncName(func_name).Write(w)
 	} else {
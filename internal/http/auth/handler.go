@@ -1,8 +1,12 @@
 package authhttp
 
 import (
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/braginantonev/mhserver/internal/service/auth"
 	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
@@ -18,30 +22,91 @@ func NewHandler(service *auth.AuthService) Handler {
 	}
 }
 
+type LoginRequest struct {
+	auth.User
+
+	// Name of device, which is shown in sessions list
+	Device string `json:"device"`
+}
+
 func (handler Handler) Login(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Login request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
 
 	w.Header().Add("Content-Type", "text/plain")
 
-	var user auth.User
-	if err := httpjsonutils.ConvertJsonToStruct(&user, r.Body, "Handlers.Login"); err != nil {
+	var req LoginRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.Login"); err != nil {
 		err.Write(w)
 		return
 	}
 
-	if user.Name == "" {
+	if req.Name == "" {
 		ErrUsernameEmpty.Write(w)
 		return
 	}
 
-	token, err := handler.service.Login(user)
+	// Clients without refresh tokens support receive only access token as plain text
+	if !acceptsJSON(r) {
+		token, err := handler.service.LoginAccessOnly(req.User, clientIP(r))
+		if err != nil {
+			handleServiceError(w, err, "auth.LoginAccessOnly")
+		} else {
+			_, _ = w.Write([]byte(token))
+		}
+
+		w.Header().Del("Content-Type")
+		return
+	}
+
+	tokens, err := handler.service.Login(req.User, auth.Device{
+		Name:      req.Device,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	})
 	if err != nil {
+		// Password is right, but code of second factor is required
+		var challenge *auth.TOTPRequiredError
+		if errors.As(err, &challenge) {
+			w.Header().Set("Cache-Control", "no-store")
+			writeJSON(w, http.StatusUnauthorized, TOTPChallengeResponse{
+				ChallengeToken: challenge.Challenge,
+				ExpiresIn:      challenge.ExpiresIn,
+			})
+			return
+		}
+
 		handleServiceError(w, err, "auth.Login")
-	} else {
-		_, _ = w.Write([]byte(token))
+		return
 	}
 
-	w.Header().Del("Content-Type")
+	writeTokens(w, tokens)
+}
+
+// Ip address of client. Server can work behind reverse proxy, so X-Forwarded-For is preferred.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ip, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(ip)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func acceptsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writeTokens(w http.ResponseWriter, tokens auth.Tokens) {
+	// Tokens must not be saved by proxies
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		slog.Error("failed write tokens", slog.Any("err", err))
+	}
 }
 
 func (handler Handler) Register(w http.ResponseWriter, r *http.Request) {
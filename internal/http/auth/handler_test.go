@@ -10,7 +10,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/braginantonev/mhserver/internal/config"
 	authhttp "github.com/braginantonev/mhserver/internal/http/auth"
 	"github.com/braginantonev/mhserver/internal/repository/database"
 	"github.com/braginantonev/mhserver/internal/server"
@@ -300,3 +302,98 @@ func TestRegister(t *testing.T) {
 		}
 	}
 }
+
+func TestRefreshAndLogout(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  TEST_JWT_SIG,
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	handler := authhttp.NewHandler(service)
+	middleware := authhttp.NewMiddleware(t.Context(), service, config.LimiterConfig{
+		Limit:    5,
+		Interval: time.Second,
+	})
+
+	user := auth.NewUser("refresh_handler_test1", "123")
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if _, err := db.Exec("delete from users where user=?", user.Name); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	body, err := json.Marshal(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, server.LOGIN_ENDPOINT, bytes.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.Login(w, req)
+
+	var tokens auth.Tokens
+	if err := json.NewDecoder(w.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.TokenType != auth.TOKEN_TYPE {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(authhttp.RefreshRequest{RefreshToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		handler.Refresh(w, httptest.NewRequest(http.MethodPost, server.REFRESH_ENDPOINT, bytes.NewReader(body)))
+		return w
+	}
+
+	w = refresh(tokens.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, server.LOGOUT_ENDPOINT, nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w = httptest.NewRecorder()
+	middleware.WithAuth(handler.Logout).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Access token and session are revoked
+	w = httptest.NewRecorder()
+	middleware.WithAuth(handler.Logout).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Body.String() != authhttp.ErrAuthorizationRevoked.Description() {
+		t.Errorf("expected revoked authorization, but got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w = refresh(tokens.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package authhttp
+
+import (
+	"log/slog"
+	"net/http"
+	"path"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+)
+
+type CreateInviteRequest struct {
+	// Optional name, for which invite is created
+	Username string `json:"username"`
+}
+
+// Write unused invites of user, users registered by them and count of invites, which can be created
+func (handler Handler) GetInvites(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get invites request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.GetInvites").Write(w)
+		return
+	}
+
+	invites, err := handler.service.GetInvites(username)
+	if err != nil {
+		handleServiceError(w, err, "auth.GetInvites")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, invites)
+}
+
+func (handler Handler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Create invite request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.CreateInvite").Write(w)
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.CreateInvite"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	invite, err := handler.service.CreateInvite(username, req.Username)
+	if err != nil {
+		handleServiceError(w, err, "auth.CreateInvite")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, invite)
+}
+
+func (handler Handler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Revoke invite request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.RevokeInvite").Write(w)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		ErrInviteKeyEmpty.Write(w)
+		return
+	}
+
+	if err := handler.service.RevokeInvite(username, key); err != nil {
+		handleServiceError(w, err, "auth.RevokeInvite")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Write public information about invite from link "/api/v1/invites/{key}". Doesn't require authorization.
+func (handler Handler) CheckInvite(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Check invite request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	info, err := handler.service.CheckInvite(path.Base(r.URL.Path))
+	if err != nil {
+		handleServiceError(w, err, "auth.CheckInvite")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,93 @@
+package authhttp
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+)
+
+type AddPublicKeyRequest struct {
+	// Key in authorized_keys format ("ssh-ed25519 AAAA... comment")
+	Key string `json:"key"`
+}
+
+func (handler Handler) GetPublicKeys(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get public keys request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.GetPublicKeys").Write(w)
+		return
+	}
+
+	keys, err := handler.service.GetPublicKeys(username)
+	if err != nil {
+		handleServiceError(w, err, "auth.GetPublicKeys")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		ErrInternal.Append(err).WithFuncName("Handler.GetPublicKeys.Marshal").Write(w)
+	}
+}
+
+func (handler Handler) AddPublicKey(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Add public key request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	var req AddPublicKeyRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.AddPublicKey"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.AddPublicKey").Write(w)
+		return
+	}
+
+	key, err := handler.service.AddPublicKey(username, req.Key)
+	if err != nil {
+		handleServiceError(w, err, "auth.AddPublicKey")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(key); err != nil {
+		slog.Error("failed write public key", slog.Any("err", err))
+	}
+}
+
+func (handler Handler) RemovePublicKey(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Remove public key request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.RemovePublicKey").Write(w)
+		return
+	}
+
+	fingerprint := r.URL.Query().Get("fingerprint")
+	if fingerprint == "" {
+		ErrFingerprintEmpty.Write(w)
+		return
+	}
+
+	if err := handler.service.RemovePublicKey(username, fingerprint); err != nil {
+		handleServiceError(w, err, "auth.RemovePublicKey")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
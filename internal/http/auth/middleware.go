@@ -42,7 +42,7 @@ func (mid Middleware) WithRateLimit(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// Extract username from jwt and put him in request context
+// Extract username from jwt or personal token and put him in request context
 func (mid Middleware) WithAuth(handler http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("Authorization")
@@ -55,25 +55,66 @@ func (mid Middleware) WithAuth(handler http.HandlerFunc) http.HandlerFunc {
 			token = token[7:]
 		}
 
-		parsed, err := mid.service.ParseToJWT(token)
+		claims, err := mid.service.ParseAccessToken(token)
 		if err != nil {
-			if errors.Is(err, jwt.ErrTokenExpired) {
+			switch {
+			case errors.Is(err, jwt.ErrTokenExpired):
 				ErrAuthorizationExpired.Write(w)
-			} else if errors.Is(err, jwt.ErrSignatureInvalid) {
+			case errors.Is(err, jwt.ErrSignatureInvalid):
 				ErrJwtSignatureInvalid.Write(w)
-			} else {
+			// Key was rotated or settings of server were changed, client must get new token
+			case errors.Is(err, auth.ErrUnknownSigningKey), errors.Is(err, jwt.ErrTokenInvalidIssuer), errors.Is(err, jwt.ErrTokenInvalidAudience):
+				ErrForeignToken.Write(w)
+			case errors.Is(err, auth.ErrTokenRevoked):
+				ErrAuthorizationRevoked.Write(w)
+			case errors.Is(err, auth.ErrBadPersonalToken):
+				ErrBadPersonalToken.Write(w)
+			case errors.Is(err, auth.ErrInternal):
+				ErrInternal.WithFuncName("Middleware.WithAuth").Write(w)
+			default:
 				ErrBadJWTToken.Write(w)
 			}
 			return
 		}
 
-		claims, ok := parsed.Claims.(jwt.MapClaims)
+		ctx := context.WithValue(r.Context(), httpcontextkeys.USERNAME, claims.Name)
+		r = r.WithContext(context.WithValue(ctx, httpcontextkeys.ACCESS_CLAIMS, claims))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Allow request only to users, whose role has rights of required role. Must be used inside WithAuth.
+func (mid Middleware) WithRole(role auth.Role, handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(httpcontextkeys.ACCESS_CLAIMS).(auth.AccessClaims)
+		if !ok {
+			ErrWrongContextClaims.WithFuncName("Middleware.WithRole").Write(w)
+			return
+		}
+
+		if !claims.Role.Allows(role) {
+			ErrNotEnoughRights.Write(w)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Allow request only to tokens with required scope. Login sessions have all scopes. Must be used inside WithAuth.
+func (mid Middleware) WithScope(scope auth.Scope, handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(httpcontextkeys.ACCESS_CLAIMS).(auth.AccessClaims)
 		if !ok {
-			ErrInternal.Write(w)
+			ErrWrongContextClaims.WithFuncName("Middleware.WithScope").Write(w)
+			return
+		}
+
+		if !claims.HasScope(scope) {
+			ErrInsufficientScope.Write(w)
 			return
 		}
 
-		r = r.WithContext(context.WithValue(r.Context(), httpcontextkeys.USERNAME, claims["name"].(string)))
 		handler.ServeHTTP(w, r)
 	})
 }
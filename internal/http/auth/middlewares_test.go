@@ -1,6 +1,7 @@
 package authhttp_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -156,7 +157,7 @@ func TestWithAuth(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			if !test.token.IsWrong {
 				var err error
-				test.token.string, err = service.Login(test.user.User)
+				test.token.string, err = service.LoginAccessOnly(test.user.User, "")
 				if errors.Is(err, auth.ErrInternal) {
 					t.Fatal(err)
 				}
@@ -198,3 +199,146 @@ func TestWithAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestWithRole(t *testing.T) {
+	middleware := authhttp.NewMiddleware(t.Context(), nil, config.LimiterConfig{
+		Limit:    5,
+		Interval: time.Second,
+	})
+
+	cases := [...]struct {
+		name          string
+		role          auth.Role
+		no_claims     bool
+		expected_code int
+		expected_body string
+	}{
+		{
+			name:          "admin",
+			role:          auth.ROLE_ADMIN,
+			expected_code: http.StatusOK,
+		},
+		{
+			name:          "user",
+			role:          auth.ROLE_USER,
+			expected_code: http.StatusForbidden,
+			expected_body: authhttp.ErrNotEnoughRights.Description(),
+		},
+		{
+			name:          "guest",
+			role:          auth.ROLE_GUEST,
+			expected_code: http.StatusForbidden,
+			expected_body: authhttp.ErrNotEnoughRights.Description(),
+		},
+		{
+			name:          "without claims",
+			no_claims:     true,
+			expected_code: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !test.no_claims {
+				req = req.WithContext(context.WithValue(req.Context(), httpcontextkeys.ACCESS_CLAIMS, auth.AccessClaims{Name: "okabe", Role: test.role}))
+			}
+
+			w := httptest.NewRecorder()
+			middleware.WithRole(auth.ROLE_ADMIN, func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, req)
+
+			res := w.Result()
+			defer func() { _ = res.Body.Close() }()
+
+			if res.StatusCode != test.expected_code {
+				t.Errorf("expected status code %d, but got %d", test.expected_code, res.StatusCode)
+			}
+
+			resp_body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expected_body != "" && string(resp_body) != test.expected_body {
+				t.Errorf("expected body \"%s\"\nbut got \"%s\"", test.expected_body, string(resp_body))
+			}
+		})
+	}
+}
+
+func TestWithScope(t *testing.T) {
+	middleware := authhttp.NewMiddleware(t.Context(), nil, config.LimiterConfig{
+		Limit:    5,
+		Interval: time.Second,
+	})
+
+	cases := [...]struct {
+		name          string
+		scopes        []auth.Scope
+		required      auth.Scope
+		expected_code int
+	}{
+		{
+			name:          "login session",
+			scopes:        nil,
+			required:      auth.SCOPE_ACCOUNT,
+			expected_code: http.StatusOK,
+		},
+		{
+			name:          "same scope",
+			scopes:        []auth.Scope{auth.SCOPE_FILES_READ},
+			required:      auth.SCOPE_FILES_READ,
+			expected_code: http.StatusOK,
+		},
+		{
+			name:          "implied scope",
+			scopes:        []auth.Scope{auth.SCOPE_FILES_WRITE},
+			required:      auth.SCOPE_FILES_READ,
+			expected_code: http.StatusOK,
+		},
+		{
+			name:          "read only token",
+			scopes:        []auth.Scope{auth.SCOPE_FILES_READ},
+			required:      auth.SCOPE_FILES_WRITE,
+			expected_code: http.StatusForbidden,
+		},
+		{
+			name:          "account of personal token",
+			scopes:        []auth.Scope{auth.SCOPE_FILES_WRITE, auth.SCOPE_ADMIN},
+			required:      auth.SCOPE_ACCOUNT,
+			expected_code: http.StatusForbidden,
+		},
+		{
+			name:          "token without scopes",
+			scopes:        []auth.Scope{},
+			required:      auth.SCOPE_FILES_READ,
+			expected_code: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), httpcontextkeys.ACCESS_CLAIMS, auth.AccessClaims{Name: "okabe", Role: auth.ROLE_USER, Scopes: test.scopes}))
+
+			w := httptest.NewRecorder()
+			middleware.WithScope(test.required, func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, req)
+
+			res := w.Result()
+			defer func() { _ = res.Body.Close() }()
+
+			if res.StatusCode != test.expected_code {
+				t.Errorf("expected status code %d, but got %d", test.expected_code, res.StatusCode)
+			}
+
+			resp_body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expected_code == http.StatusForbidden && string(resp_body) != authhttp.ErrInsufficientScope.Description() {
+				t.Errorf("expected body \"%s\"\nbut got \"%s\"", authhttp.ErrInsufficientScope.Description(), string(resp_body))
+			}
+		})
+	}
+}
@@ -1,14 +1,63 @@
 package authhttp
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/braginantonev/mhserver/internal/service/auth"
+)
 
 type AuthHandler interface {
 	Login(w http.ResponseWriter, r *http.Request)
 	Register(w http.ResponseWriter, r *http.Request)
+	Refresh(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	JWKS(w http.ResponseWriter, r *http.Request)
+
+	GetSessions(w http.ResponseWriter, r *http.Request)
+	RevokeSession(w http.ResponseWriter, r *http.Request)
+
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
+
+	GetInvites(w http.ResponseWriter, r *http.Request)
+	CreateInvite(w http.ResponseWriter, r *http.Request)
+	RevokeInvite(w http.ResponseWriter, r *http.Request)
+	CheckInvite(w http.ResponseWriter, r *http.Request)
+
+	LoginTOTP(w http.ResponseWriter, r *http.Request)
+	GetTOTPStatus(w http.ResponseWriter, r *http.Request)
+	EnrollTOTP(w http.ResponseWriter, r *http.Request)
+	ConfirmTOTP(w http.ResponseWriter, r *http.Request)
+	DisableTOTP(w http.ResponseWriter, r *http.Request)
+
+	GetPersonalTokens(w http.ResponseWriter, r *http.Request)
+	CreatePersonalToken(w http.ResponseWriter, r *http.Request)
+	RevokePersonalToken(w http.ResponseWriter, r *http.Request)
+
+	GetPublicKeys(w http.ResponseWriter, r *http.Request)
+	AddPublicKey(w http.ResponseWriter, r *http.Request)
+	RemovePublicKey(w http.ResponseWriter, r *http.Request)
+
+	// Administration
+	AdminGetUsers(w http.ResponseWriter, r *http.Request)
+	AdminCreateUser(w http.ResponseWriter, r *http.Request)
+	AdminDeleteUser(w http.ResponseWriter, r *http.Request)
+	AdminDisableUser(w http.ResponseWriter, r *http.Request)
+	AdminEnableUser(w http.ResponseWriter, r *http.Request)
+	AdminSetUserRole(w http.ResponseWriter, r *http.Request)
+	AdminGetStorage(w http.ResponseWriter, r *http.Request)
+	AdminGetRegisterKeys(w http.ResponseWriter, r *http.Request)
+	AdminGenerateRegisterKeys(w http.ResponseWriter, r *http.Request)
+	AdminRevokeRegisterKey(w http.ResponseWriter, r *http.Request)
+	AdminGetLockouts(w http.ResponseWriter, r *http.Request)
+	AdminClearLockout(w http.ResponseWriter, r *http.Request)
+	AdminGetLoginAttempts(w http.ResponseWriter, r *http.Request)
 }
 
 type AuthMiddleware interface {
 	WithAuth(handler http.HandlerFunc) http.HandlerFunc
+	WithRole(role auth.Role, handler http.HandlerFunc) http.HandlerFunc
+	WithScope(scope auth.Scope, handler http.HandlerFunc) http.HandlerFunc
 	WithRateLimit(http.HandlerFunc) http.HandlerFunc
 }
 
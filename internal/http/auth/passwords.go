@@ -0,0 +1,70 @@
+package authhttp
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// Change password of authorized user. All sessions of user are ended.
+func (handler Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Change password request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.ChangePassword").Write(w)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.ChangePassword"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if err := handler.service.ChangePassword(username, req.CurrentPassword, req.NewPassword, clientIP(r)); err != nil {
+		handleServiceError(w, err, "auth.ChangePassword")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Set new password by one-time token, given by server administrator
+func (handler Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Reset password request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	var req ResetPasswordRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.ResetPassword"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if req.Token == "" {
+		ErrResetTokenEmpty.Write(w)
+		return
+	}
+
+	if err := handler.service.ResetPassword(req.Token, req.NewPassword); err != nil {
+		handleServiceError(w, err, "auth.ResetPassword")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
@@ -0,0 +1,103 @@
+package authhttp
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+)
+
+type CreatePersonalTokenRequest struct {
+	Name   string       `json:"name"`
+	Scopes []auth.Scope `json:"scopes"`
+
+	// Token lifetime in seconds. Zero means token never expires.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// Created token. Secret token is shown only once.
+type CreatePersonalTokenResponse struct {
+	auth.PersonalToken
+
+	Token string `json:"token"`
+}
+
+func (handler Handler) GetPersonalTokens(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get personal tokens request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.GetPersonalTokens").Write(w)
+		return
+	}
+
+	tokens, err := handler.service.GetPersonalTokens(username)
+	if err != nil {
+		handleServiceError(w, err, "auth.GetPersonalTokens")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func (handler Handler) CreatePersonalToken(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Create personal token request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.CreatePersonalToken").Write(w)
+		return
+	}
+
+	var req CreatePersonalTokenRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.CreatePersonalToken"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	token, info, err := handler.service.CreatePersonalToken(username, auth.PersonalTokenOptions{
+		Name:     req.Name,
+		Scopes:   req.Scopes,
+		Lifetime: time.Duration(req.ExpiresIn) * time.Second,
+	})
+	if err != nil {
+		handleServiceError(w, err, "auth.CreatePersonalToken")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, CreatePersonalTokenResponse{PersonalToken: info, Token: token})
+}
+
+func (handler Handler) RevokePersonalToken(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Revoke personal token request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.RevokePersonalToken").Write(w)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		ErrBadTokenId.Write(w)
+		return
+	}
+
+	if err := handler.service.RevokePersonalToken(username, id); err != nil {
+		handleServiceError(w, err, "auth.RevokePersonalToken")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
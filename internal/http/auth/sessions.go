@@ -0,0 +1,63 @@
+package authhttp
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+)
+
+// Write active sessions of user. Session of request token is marked as current.
+func (handler Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get sessions request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	claims, ok := r.Context().Value(httpcontextkeys.ACCESS_CLAIMS).(auth.AccessClaims)
+	if !ok {
+		ErrWrongContextClaims.WithFuncName("Handlers.GetSessions").Write(w)
+		return
+	}
+
+	sessions, err := handler.service.GetSessions(claims.Name)
+	if err != nil {
+		handleServiceError(w, err, "auth.GetSessions")
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.Session
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		slog.Error("failed write sessions", slog.Any("err", err))
+	}
+}
+
+func (handler Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Revoke session request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.RevokeSession").Write(w)
+		return
+	}
+
+	session_id := r.URL.Query().Get("id")
+	if session_id == "" {
+		ErrSessionIdEmpty.Write(w)
+		return
+	}
+
+	if err := handler.service.RevokeUserSession(username, session_id); err != nil {
+		handleServiceError(w, err, "auth.RevokeUserSession")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
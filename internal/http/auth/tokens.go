@@ -0,0 +1,69 @@
+package authhttp
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Exchange refresh token to new access and refresh tokens
+func (handler Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Refresh request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	var req RefreshRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.Refresh"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		ErrRefreshTokenEmpty.Write(w)
+		return
+	}
+
+	tokens, err := handler.service.Refresh(req.RefreshToken, clientIP(r))
+	if err != nil {
+		handleServiceError(w, err, "auth.Refresh")
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+// Revoke session of access token and token itself
+func (handler Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Logout request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	claims, ok := r.Context().Value(httpcontextkeys.ACCESS_CLAIMS).(auth.AccessClaims)
+	if !ok {
+		ErrWrongContextClaims.WithFuncName("Handlers.Logout").Write(w)
+		return
+	}
+
+	if err := handler.service.Logout(claims); err != nil {
+		handleServiceError(w, err, "auth.Logout")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Public keys of access tokens in JWK Set format. Doesn't require authorization.
+func (handler Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	slog.Info("JWKS request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	// Keys change only on rotation, which keeps old keys until their tokens expire
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, handler.service.JWKS())
+}
@@ -0,0 +1,175 @@
+package authhttp
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+)
+
+// Response of login with right password for user with two-factor authentication
+type TOTPChallengeResponse struct {
+	ChallengeToken string `json:"challenge_token"`
+
+	// Challenge lifetime in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type LoginTOTPRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+
+	// Code from authenticator app or recovery code
+	Code string `json:"code"`
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code"`
+}
+
+type ConfirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password"`
+
+	// Code from authenticator app or recovery code
+	Code string `json:"code"`
+}
+
+// Second login step: exchange challenge token and code to tokens of new session
+func (handler Handler) LoginTOTP(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Login TOTP request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	var req LoginTOTPRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.LoginTOTP"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if req.ChallengeToken == "" {
+		ErrChallengeEmpty.Write(w)
+		return
+	}
+
+	if req.Code == "" {
+		ErrTOTPCodeEmpty.Write(w)
+		return
+	}
+
+	tokens, err := handler.service.LoginTOTP(req.ChallengeToken, req.Code, clientIP(r))
+	if err != nil {
+		handleServiceError(w, err, "auth.LoginTOTP")
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+func (handler Handler) GetTOTPStatus(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get TOTP status request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.GetTOTPStatus").Write(w)
+		return
+	}
+
+	status, err := handler.service.GetTOTPStatus(username)
+	if err != nil {
+		handleServiceError(w, err, "auth.GetTOTPStatus")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// Generate secret of authenticator app. Two-factor authentication is enabled after confirmation.
+func (handler Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Enroll TOTP request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.EnrollTOTP").Write(w)
+		return
+	}
+
+	enrollment, err := handler.service.EnrollTOTP(username)
+	if err != nil {
+		handleServiceError(w, err, "auth.EnrollTOTP")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, enrollment)
+}
+
+// Enable two-factor authentication by code from authenticator app. Write one-time recovery codes.
+func (handler Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Confirm TOTP request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.ConfirmTOTP").Write(w)
+		return
+	}
+
+	var req ConfirmTOTPRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.ConfirmTOTP"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if req.Code == "" {
+		ErrTOTPCodeEmpty.Write(w)
+		return
+	}
+
+	codes, err := handler.service.ConfirmTOTP(username, req.Code)
+	if err != nil {
+		handleServiceError(w, err, "auth.ConfirmTOTP")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, ConfirmTOTPResponse{RecoveryCodes: codes})
+}
+
+func (handler Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Disable TOTP request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.DisableTOTP").Write(w)
+		return
+	}
+
+	var req DisableTOTPRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.DisableTOTP"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	if req.Code == "" {
+		ErrTOTPCodeEmpty.Write(w)
+		return
+	}
+
+	if err := handler.service.DisableTOTP(username, req.Password, req.Code, clientIP(r)); err != nil {
+		handleServiceError(w, err, "auth.DisableTOTP")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
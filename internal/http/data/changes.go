@@ -0,0 +1,69 @@
+package datahttp
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	pb "github.com/braginantonev/mhserver/proto/data"
+)
+
+/*
+Return changes of user files after cursor ("since" query param) and cursor to continue.
+Without "since" only current cursor is returned: client saves it, lists all files and then syncs from it.
+*/
+func (h Handler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get changes request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.GetChanges").Write(w)
+		return
+	}
+
+	req := &pb.ChangesRequest{Username: username}
+
+	query := r.URL.Query()
+	if query.Has("since") {
+		since, err := strconv.ParseUint(query.Get("since"), 10, 64)
+		if err != nil {
+			ErrBadCursor.Write(w)
+			return
+		}
+		req.Since = &since
+	}
+
+	if query.Has("limit") {
+		limit, err := strconv.ParseUint(query.Get("limit"), 10, 32)
+		if err != nil {
+			ErrBadLimit.Write(w)
+			return
+		}
+		req.Limit = uint32(limit)
+	}
+
+	changes, err := h.dataServiceClient.GetChanges(r.Context(), req)
+	if err != nil {
+		handleServiceError(err, w, "data.GetChanges")
+		return
+	}
+
+	// Empty list is returned as [], not null
+	if changes.Changes == nil {
+		changes.Changes = []*pb.Change{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		ErrInternal.WithFuncName("Handlers.GetChanges").Write(w)
+	}
+}
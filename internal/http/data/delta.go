@@ -0,0 +1,222 @@
+package datahttp
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/pkg/delta"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc/status"
+)
+
+// Max block operations in one message to data service
+const MAX_DELTA_OPS_IN_MESSAGE int = 1024
+
+/*
+Return rolling and strong checksums of file blocks (file path in "path" query param).
+Wanted block size can be set by "blockSize" query param, server can choose other.
+*/
+func (h Handler) GetSignature(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get signature request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.GetSignature").Write(w)
+		return
+	}
+
+	dir, filename := splitFilePath(r.URL.Query().Get("path"))
+	if dir == "" || filename == "" {
+		ErrBadPath.Write(w)
+		return
+	}
+
+	var block_size uint64
+	if r.URL.Query().Has("blockSize") {
+		var err error
+		if block_size, err = strconv.ParseUint(r.URL.Query().Get("blockSize"), 10, 32); err != nil {
+			ErrBadDeltaParams.Write(w)
+			return
+		}
+	}
+
+	signature, err := h.dataServiceClient.GetSignature(r.Context(), &pb.SignatureRequest{
+		Username:  username,
+		Directory: dir,
+		Filename:  filename,
+		BlockSize: uint32(block_size),
+	})
+	if err != nil {
+		if status.Convert(err).Message() == data.ErrFileNotExist.Error() {
+			ErrFileNotFound.Write(w)
+			return
+		}
+
+		handleServiceError(err, w, "data.GetSignature")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(signature); err != nil {
+		ErrInternal.WithFuncName("Handlers.GetSignature").Write(w)
+	}
+}
+
+// Parse delta header from query params
+func parseDeltaHeader(query url.Values) (*pb.DeltaHeader, error) {
+	dir, filename := splitFilePath(query.Get("path"))
+	if dir == "" || filename == "" {
+		return nil, ErrBadPath
+	}
+
+	header := &pb.DeltaHeader{
+		Directory: dir,
+		Filename:  filename,
+	}
+
+	block_size, err := strconv.ParseUint(query.Get("blockSize"), 10, 32)
+	if err != nil {
+		return nil, ErrBadDeltaParams
+	}
+	header.BlockSize = uint32(block_size)
+
+	for param, value := range map[string]*uint64{
+		"baseSize":    &header.BaseSize,
+		"baseModTime": &header.BaseModTime,
+		"size":        &header.Size,
+	} {
+		if *value, err = strconv.ParseUint(query.Get(param), 10, 64); err != nil {
+			return nil, ErrBadDeltaParams
+		}
+	}
+
+	if header.Sum, err = hex.DecodeString(query.Get("sum")); err != nil {
+		return nil, ErrBadDeltaParams
+	}
+	return header, nil
+}
+
+/*
+Rebuild file from base version and delta. Base file values from signature and size with sha256 sum (hex) of new file
+are set in query params, delta operations - in body (binary format of pkg/delta). Literals are split to small parts,
+so memory usage doesn't depend on delta.
+*/
+func (h Handler) ApplyDelta(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Apply delta request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.ApplyDelta").Write(w)
+		return
+	}
+
+	header, err := parseDeltaHeader(r.URL.Query())
+	if err != nil {
+		handleServiceError(err, w, "Handlers.ApplyDelta")
+		return
+	}
+	header.Username = username
+
+	// Big deltas can be received longer than server timeouts
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Stream is canceled on bad body, so data service doesn't save partial file
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err := h.dataServiceClient.ApplyDelta(ctx)
+	if err != nil {
+		handleServiceError(err, w, "data.ApplyDelta")
+		return
+	}
+
+	chunk := &pb.DeltaChunk{Header: header}
+	send := func() error {
+		if chunk.Header == nil && len(chunk.Ops) == 0 {
+			return nil
+		}
+
+		err := stream.Send(chunk)
+		chunk = &pb.DeltaChunk{}
+		return err
+	}
+
+	// Error of stream is returned by CloseAndRecv, so reading stops after first send error
+	var send_err error
+	for send_err == nil {
+		op, err := delta.ReadOp(r.Body)
+		if err == io.EOF {
+			send_err = send()
+			break
+		}
+
+		if err != nil {
+			cancel()
+			if errors.Is(err, delta.ErrBadOp) || errors.Is(err, delta.ErrLiteralTooLong) {
+				ErrBadDeltaBody.Write(w)
+				return
+			}
+
+			ErrBodyNotReceived.Write(w)
+			return
+		}
+
+		if len(op.Literal) == 0 {
+			chunk.Ops = append(chunk.Ops, &pb.DeltaOp{BlockIndex: op.BlockIndex, BlockCount: op.BlockCount})
+			if len(chunk.Ops) >= MAX_DELTA_OPS_IN_MESSAGE {
+				send_err = send()
+			}
+			continue
+		}
+
+		// Literal is sent in separate messages, so they are not bigger than data service can receive
+		send_err = send()
+		for literal := op.Literal; len(literal) > 0 && send_err == nil; {
+			n := min(len(literal), int(data.BASE_CHUNK_SIZE))
+			chunk.Ops = append(chunk.Ops, &pb.DeltaOp{Literal: literal[:n]})
+			literal = literal[n:]
+			send_err = send()
+		}
+	}
+
+	result, err := stream.CloseAndRecv()
+	if err != nil {
+		if status.Convert(err).Message() == data.ErrFileNotExist.Error() {
+			ErrFileNotFound.Write(w)
+			return
+		}
+
+		handleServiceError(err, w, "data.ApplyDelta")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		ErrInternal.WithFuncName("Handlers.ApplyDelta").Write(w)
+	}
+}
@@ -0,0 +1,157 @@
+package datahttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc/status"
+)
+
+// Reader of file from data service. Only one chunk is kept in memory.
+type chunkReader struct {
+	ctx    context.Context
+	client pb.DataServiceClient
+	conn   *pb.Connection
+	offset int64
+
+	chunk    []byte
+	chunk_id int64
+}
+
+func newChunkReader(ctx context.Context, client pb.DataServiceClient, conn *pb.Connection) *chunkReader {
+	return &chunkReader{
+		ctx:      ctx,
+		client:   client,
+		conn:     conn,
+		chunk_id: -1,
+	}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.offset >= int64(r.conn.Size) {
+		return 0, io.EOF
+	}
+
+	id := r.offset / int64(r.conn.ChunkSize)
+	if id != r.chunk_id {
+		part, err := r.client.GetData(r.ctx, &pb.GetChunk{
+			UUID:    r.conn.UUID,
+			ChunkId: uint32(id),
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		r.chunk = part.Chunk
+		r.chunk_id = id
+	}
+
+	in_chunk := r.offset % int64(r.conn.ChunkSize)
+	if in_chunk >= int64(len(r.chunk)) {
+		// File was changed after connection
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	n := copy(p, r.chunk[in_chunk:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += int64(r.conn.Size)
+	}
+
+	if offset < 0 {
+		return 0, ErrSeekBeforeStart
+	}
+
+	r.offset = offset
+	return offset, nil
+}
+
+// Close read connection to free file before connection expiration
+func (h Handler) closeConnection(ctx context.Context, conn_uuid string) {
+	_, err := h.dataServiceClient.CloseConnection(context.WithoutCancel(ctx), &pb.CloseConnectionRequest{UUID: conn_uuid})
+	if err != nil {
+		slog.WarnContext(ctx, "failed close connection", slog.Any("err", err))
+	}
+}
+
+/*
+Download file by path ("/docs/cv.pdf") with plain GET request. Supports Range, ETag and conditional requests,
+so file can be opened in browser or video player. File is read by chunks through data service.
+*/
+func (h Handler) Download(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Download request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.Download").Write(w)
+		return
+	}
+
+	h.serveFile(w, r, username, r.URL.Query().Get("path"))
+}
+
+// Serve user file ("/docs/cv.pdf") with Range and conditional requests support
+func (h Handler) serveFile(w http.ResponseWriter, r *http.Request, username, file_path string) {
+	dir, filename := splitFilePath(file_path)
+	if dir == "" || filename == "" {
+		ErrBadPath.Write(w)
+		return
+	}
+
+	conn, err := h.dataServiceClient.CreateConnection(r.Context(), &pb.ConnectionRequest{
+		Username:  username,
+		Mode:      pb.ConnectionMode_RDONLY,
+		Directory: dir,
+		Filename:  filename,
+	})
+	if err != nil {
+		if status.Convert(err).Message() == data.ErrFileNotExist.Error() {
+			ErrFileNotFound.Write(w)
+			return
+		}
+
+		handleServiceError(err, w, "data.CreateConnection")
+		return
+	}
+
+	defer h.closeConnection(r.Context(), conn.UUID)
+
+	// Big files can be downloaded longer than server write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	disposition := "inline"
+	if r.URL.Query().Has("attachment") {
+		disposition = "attachment"
+	}
+
+	mod_time := time.Unix(int64(conn.ModTime), 0)
+
+	// Content-Type is set by ServeContent from file extension or content
+	w.Header().Del("Content-Type")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, conn.ModTime, conn.Size))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+
+	http.ServeContent(w, r, filename, mod_time, newChunkReader(r.Context(), h.dataServiceClient, conn))
+}
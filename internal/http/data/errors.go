@@ -1,9 +1,12 @@
 package datahttp
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	"github.com/braginantonev/mhserver/internal/repository/shares"
 	"github.com/braginantonev/mhserver/pkg/httperror"
 	"google.golang.org/grpc/status"
 )
@@ -17,22 +20,67 @@ var (
 	SpecialCodes = map[string]int{
 		data.ErrNotEnoughDiskSpace.Error():   http.StatusRequestEntityTooLarge,
 		data.ErrUnexpectedFileChange.Error(): http.StatusForbidden,
+		data.ErrDeltaSumMismatch.Error():     http.StatusConflict,
+		data.ErrFileTooBigForDelta.Error():   http.StatusRequestEntityTooLarge,
+		journal.ErrCursorExpired.Error():     http.StatusGone,
+		shares.ErrShareNotFound.Error():      http.StatusNotFound,
 	}
 
 	// Handler errors
 	ErrWrongContextUsername     = httperror.NewInternalHttpError("context username from jwt is not string", "")
+	ErrWrongContextClaims       = httperror.NewInternalHttpError("context claims from jwt have wrong type", "")
+	ErrNotEnoughRights          = httperror.NewExternalHttpError("not enough rights", http.StatusForbidden)
+	ErrInsufficientScope        = httperror.NewExternalHttpError("token scope is insufficient", http.StatusForbidden)
 	ErrBadUuidFormat            = httperror.NewExternalHttpError("bad uuid format", http.StatusBadRequest)
 	ErrUnexpectedConnectionMode = httperror.NewExternalHttpError("unexpected connection mode", http.StatusBadRequest)
 
 	// Data info errors
 	ErrNullFileSize = httperror.NewExternalHttpError("file size is null", http.StatusBadRequest)
 
+	// Path errors
+	ErrBadPath        = httperror.NewExternalHttpError("path have bad syntax", http.StatusBadRequest)
+	ErrEmptyPathsList = httperror.NewExternalHttpError("paths list is empty", http.StatusBadRequest)
+	ErrFileNotFound   = httperror.NewExternalHttpError("file not found", http.StatusNotFound)
+
+	// Tus errors
+	ErrTusUnsupportedVersion   = httperror.NewExternalHttpError("unsupported tus version", http.StatusPreconditionFailed)
+	ErrTusBadUploadLength      = httperror.NewExternalHttpError("bad upload length", http.StatusBadRequest)
+	ErrTusBadMetadata          = httperror.NewExternalHttpError("bad upload metadata", http.StatusBadRequest)
+	ErrTusUploadNotFound       = httperror.NewExternalHttpError("upload not found or expired", http.StatusNotFound)
+	ErrTusBadContentType       = httperror.NewExternalHttpError("content type must be "+TUS_CONTENT_TYPE, http.StatusUnsupportedMediaType)
+	ErrTusOffsetMismatch       = httperror.NewExternalHttpError("upload offset mismatch", http.StatusConflict)
+	ErrTusUnsupportedChecksum  = httperror.NewExternalHttpError("unsupported checksum algorithm", http.StatusBadRequest)
+	ErrTusChecksumMismatch     = httperror.NewExternalHttpError("checksum mismatch", 460)
+	ErrTusChecksumBodyTooLarge = httperror.NewExternalHttpError("request with checksum is too large", http.StatusRequestEntityTooLarge)
+	ErrTusBodyNotReceived      = httperror.NewExternalHttpError("request body is not received", http.StatusBadRequest)
+
+	// Delta errors
+	ErrBadDeltaParams  = httperror.NewExternalHttpError("bad delta params", http.StatusBadRequest)
+	ErrBadDeltaBody    = httperror.NewExternalHttpError("bad delta operations", http.StatusBadRequest)
+	ErrBodyNotReceived = httperror.NewExternalHttpError("request body is not received", http.StatusBadRequest)
+
+	// Changes errors
+	ErrBadCursor = httperror.NewExternalHttpError("bad changes cursor", http.StatusBadRequest)
+	ErrBadLimit  = httperror.NewExternalHttpError("bad changes limit", http.StatusBadRequest)
+
+	// Shares errors
+	ErrBadShareLifetime = httperror.NewExternalHttpError("bad share lifetime", http.StatusBadRequest)
+
+	// File reader errors
+	ErrSeekBeforeStart = errors.New("seek before file start")
+
 	ErrToManyRequests = httperror.NewExternalHttpError("to many requests", http.StatusTooManyRequests)
 )
 
 func handleServiceError(err error, w http.ResponseWriter, func_name string) {
 	st, ok := status.FromError(err)
 	if !ok {
+		var http_err httperror.HttpError
+		if errors.As(err, &http_err) {
+			http_err.Write(w)
+		} else {
+			ErrInternal.WithFuncName(func_name).Write(w)
+		}
 		return
 	}
 
@@ -0,0 +1,158 @@
+package datahttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc/status"
+)
+
+// Comment is sent with this interval, so proxies don't close idle stream
+const EVENTS_PING_INTERVAL time.Duration = 30 * time.Second
+
+// First event of stream with start cursor
+type ReadyEvent struct {
+	Cursor uint64 `json:"cursor"`
+}
+
+// Last event of stream, if it failed after start
+type ErrorEvent struct {
+	Error string `json:"error"`
+}
+
+// Write one server-sent event. Id is empty for events without cursor.
+func writeEvent(w io.Writer, id, event string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body)
+	return err
+}
+
+/*
+Stream changes of user files and upload progress as server-sent events (text/event-stream).
+Start cursor is taken from "since" query param or Last-Event-ID header (browser reconnection),
+without them only new changes are sent. Errors found after stream start are sent as "error" event.
+*/
+func (h Handler) Events(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Events request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.Events").Write(w)
+		return
+	}
+
+	req := &pb.WatchRequest{Username: username}
+
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
+
+	if since != "" {
+		cursor, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			ErrBadCursor.Write(w)
+			return
+		}
+		req.Since = &cursor
+	}
+
+	stream, err := h.dataServiceClient.WatchChanges(r.Context(), req)
+	if err != nil {
+		handleServiceError(err, w, "data.WatchChanges")
+		return
+	}
+
+	// First message is sent after cursor check
+	event, err := stream.Recv()
+	if err != nil {
+		handleServiceError(err, w, "data.WatchChanges")
+		return
+	}
+
+	// Stream lives while client is connected
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	events := make(chan *pb.WatchEvent)
+	stream_err := make(chan error, 1)
+	go func() {
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				stream_err <- err
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(EVENTS_PING_INTERVAL)
+	defer ping.Stop()
+
+	for {
+		var err error
+		switch {
+		case event == nil:
+			_, err = io.WriteString(w, ": ping\n\n")
+		case event.Change != nil:
+			err = writeEvent(w, strconv.FormatUint(event.Cursor, 10), "change", event.Change)
+		case event.Progress != nil:
+			err = writeEvent(w, "", "progress", event.Progress)
+		default:
+			err = writeEvent(w, strconv.FormatUint(event.Cursor, 10), "ready", ReadyEvent{Cursor: event.Cursor})
+		}
+
+		if err != nil {
+			return
+		}
+		_ = http.NewResponseController(w).Flush()
+
+		select {
+		case event = <-events:
+		case <-ping.C:
+			event = nil
+		case err := <-stream_err:
+			if err != io.EOF && r.Context().Err() == nil {
+				slog.ErrorContext(r.Context(), "events stream failed", slog.Any("err", err))
+				_ = writeEvent(w, "", "error", ErrorEvent{Error: status.Convert(err).Message()})
+			}
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
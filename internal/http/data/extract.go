@@ -0,0 +1,85 @@
+package datahttp
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc/status"
+)
+
+// Last line of extraction progress, if extraction failed after start
+type ExtractError struct {
+	Error string `json:"error"`
+}
+
+/*
+Extract archive from user files. Progress is streamed as json lines (ndjson), one line per extracted file.
+Errors found while archive checking are returned as usual, errors after that - as last line with "error" field.
+*/
+func (h Handler) Extract(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Extract request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	var req pb.ExtractRequest
+	if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.Extract"); err != nil {
+		err.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.Extract").Write(w)
+		return
+	}
+	req.Username = username
+
+	stream, err := h.dataServiceClient.Extract(r.Context(), &req)
+	if err != nil {
+		handleServiceError(err, w, "data.Extract")
+		return
+	}
+
+	// First message is sent after archive check
+	progress, err := stream.Recv()
+	if err != nil {
+		handleServiceError(err, w, "data.Extract")
+		return
+	}
+
+	// Extraction can be longer than server write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	for {
+		if err := encoder.Encode(progress); err != nil {
+			return
+		}
+		_ = http.NewResponseController(w).Flush()
+
+		progress, err = stream.Recv()
+		if err == io.EOF {
+			return
+		}
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "extraction failed", slog.Any("err", err))
+			_ = encoder.Encode(ExtractError{Error: status.Convert(err).Message()})
+			return
+		}
+	}
+}
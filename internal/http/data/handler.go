@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/braginantonev/mhserver/internal/service/auth"
 	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
 	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
 	pb "github.com/braginantonev/mhserver/proto/data"
@@ -14,14 +16,36 @@ import (
 
 type Handler struct {
 	dataServiceClient pb.DataServiceClient
+	tusUploads        *tusUploads
+
+	// Semaphore of main server. Nil, if memory kept between requests isn't limited.
+	sem chan any
+	// Time without requests, after which unfinished tus upload is removed
+	tusLifetime time.Duration
 }
 
 func NewHandler(grpc_client pb.DataServiceClient) Handler {
 	return Handler{
 		dataServiceClient: grpc_client,
+		tusUploads:        newTusUploads(),
+		tusLifetime:       DEFAULT_TUS_LIFETIME,
 	}
 }
 
+// Count memory, which is kept between requests (unsaved parts of tus uploads), by slots of main server semaphore
+func (h Handler) WithSemaphore(sem chan any) Handler {
+	h.sem = sem
+	return h
+}
+
+// Set lifetime of unfinished tus uploads. Default lifetime is used, if it isn't positive.
+func (h Handler) WithTusLifetime(lifetime time.Duration) Handler {
+	if lifetime > 0 {
+		h.tusLifetime = lifetime
+	}
+	return h
+}
+
 func (h Handler) CreateConnection(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Create connection request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
 
@@ -46,6 +70,25 @@ func (h Handler) CreateConnection(w http.ResponseWriter, r *http.Request) {
 
 	req_info.Mode = pb.ConnectionMode(conn_mode)
 
+	// RDWR connection rewrites file, so it requires the same scope and role as other write endpoints
+	if req_info.Mode == pb.ConnectionMode_RDWR {
+		claims, ok := r.Context().Value(httpcontextkeys.ACCESS_CLAIMS).(auth.AccessClaims)
+		if !ok {
+			ErrWrongContextClaims.WithFuncName("Handlers.CreateConnection").Write(w)
+			return
+		}
+
+		if !claims.HasScope(auth.SCOPE_FILES_WRITE) {
+			ErrInsufficientScope.Write(w)
+			return
+		}
+
+		if !claims.Role.Allows(auth.ROLE_USER) {
+			ErrNotEnoughRights.Write(w)
+			return
+		}
+	}
+
 	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
 	if !ok {
 		ErrWrongContextUsername.WithFuncName("Handlers.CreateConnection").Write(w)
@@ -56,6 +99,7 @@ func (h Handler) CreateConnection(w http.ResponseWriter, r *http.Request) {
 	conn, err := h.dataServiceClient.CreateConnection(r.Context(), &req_info)
 	if err != nil {
 		handleServiceError(err, w, "data.CreateConnection")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -262,3 +306,70 @@ func (h Handler) RemoveDir(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Del("Content-Type")
 }
+
+func (h Handler) RemoveFile(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Remove file request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.RemoveFile").Write(w)
+		return
+	}
+
+	dir, filename := splitFilePath(r.URL.Query().Get("path"))
+	if dir == "" || filename == "" {
+		ErrBadPath.Write(w)
+		return
+	}
+
+	_, err := h.dataServiceClient.RemoveFile(r.Context(), &pb.FilePath{
+		Username:  username,
+		Directory: dir,
+		Filename:  filename,
+	})
+	if err != nil {
+		handleServiceError(err, w, "data.RemoveFile")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Move or rename file ("/docs/cv.pdf") or directory ("/docs/") from "from" to "to" path
+func (h Handler) Move(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Move request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.Move").Write(w)
+		return
+	}
+
+	query := r.URL.Query()
+	_, err := h.dataServiceClient.Move(r.Context(), &pb.MoveRequest{
+		Username:  username,
+		From:      query.Get("from"),
+		To:        query.Get("to"),
+		Overwrite: query.Has("overwrite"),
+	})
+	if err != nil {
+		handleServiceError(err, w, "data.Move")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
@@ -1,8 +1,14 @@
 package datahttp_test
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,13 +17,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/braginantonev/mhserver/internal/config"
 	"github.com/braginantonev/mhserver/internal/grpc/data"
 	datahttp "github.com/braginantonev/mhserver/internal/http/data"
 	"github.com/braginantonev/mhserver/internal/server"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/pkg/delta"
 	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
 	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
 	pb "github.com/braginantonev/mhserver/proto/data"
@@ -68,6 +78,107 @@ func testEmptyConnection(ctx context.Context, handler_func http.HandlerFunc, met
 	return nil
 }
 
+func TestCreateConnectionHandler(t *testing.T) {
+	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(TEST_WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 1024,
+		MinChunkSize: 4,
+		Allocated:    1024 * 1024 * 1024,
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8108")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8108", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := datahttp.NewHandler(pb.NewDataServiceClient(grpc_connection))
+
+	filename := "connection_rights.txt"
+	file_path := fmt.Sprintf("%s%s/files/%s", TEST_WORKSPACE_PATH, TEST_USERNAME, filename)
+	if err := os.WriteFile(file_path, []byte(TEST_FILE_BODY), 0660); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(file_path)
+	}()
+
+	cases := [...]struct {
+		name          string
+		mode          string
+		claims        auth.AccessClaims
+		expected_code int
+	}{
+		{
+			name:          "read token reads file",
+			mode:          pb.ConnectionMode_RDONLY.String(),
+			claims:        auth.AccessClaims{Name: TEST_USERNAME, Role: auth.ROLE_USER, Scopes: []auth.Scope{auth.SCOPE_FILES_READ}},
+			expected_code: http.StatusOK,
+		},
+		{
+			name:          "read token rewrites file",
+			mode:          pb.ConnectionMode_RDWR.String(),
+			claims:        auth.AccessClaims{Name: TEST_USERNAME, Role: auth.ROLE_USER, Scopes: []auth.Scope{auth.SCOPE_FILES_READ}},
+			expected_code: datahttp.ErrInsufficientScope.Status(),
+		},
+		{
+			name:          "guest reads file",
+			mode:          pb.ConnectionMode_RDONLY.String(),
+			claims:        auth.AccessClaims{Name: TEST_USERNAME, Role: auth.ROLE_GUEST},
+			expected_code: http.StatusOK,
+		},
+		{
+			name:          "guest rewrites file",
+			mode:          pb.ConnectionMode_RDWR.String(),
+			claims:        auth.AccessClaims{Name: TEST_USERNAME, Role: auth.ROLE_GUEST},
+			expected_code: datahttp.ErrNotEnoughRights.Status(),
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"directory": "/", "filename": "%s", "size": 1}`, filename)
+			req := httptest.NewRequest(http.MethodPost, server.CREATE_CONNECTION_ENDPOINT+"?mode="+test.mode, strings.NewReader(body))
+			ctx := context.WithValue(t.Context(), httpcontextkeys.USERNAME, TEST_USERNAME)
+			req = req.WithContext(context.WithValue(ctx, httpcontextkeys.ACCESS_CLAIMS, test.claims))
+			w := httptest.NewRecorder()
+
+			handler.CreateConnection(w, req)
+			res := w.Result()
+			defer func() { _ = res.Body.Close() }()
+
+			if res.StatusCode != test.expected_code {
+				got_body, _ := io.ReadAll(res.Body)
+				t.Fatalf("expected code %d, but got %d: %s", test.expected_code, res.StatusCode, got_body)
+			}
+
+			saved, err := os.ReadFile(file_path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(saved) != TEST_FILE_BODY {
+				t.Errorf("file is changed: `%s`", saved)
+			}
+		})
+	}
+}
+
 func TestSaveDataHandler(t *testing.T) {
 	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
 	if err != nil {
@@ -320,3 +431,1031 @@ func TestGetDataHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadZipHandler(t *testing.T) {
+	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(TEST_WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 8 * 1024,
+		MinChunkSize: 4,
+		Allocated:    1024 * 1024 * 1024,
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8102")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8102", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("service unavailable", func(t *testing.T) {
+		err = testEmptyConnection(t.Context(), datahttp.NewHandler(nil).DownloadZip, http.MethodGet, server.DOWNLOAD_ZIP_ENDPOINT)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	handler := datahttp.NewHandler(pb.NewDataServiceClient(grpc_connection))
+
+	// Create test tree
+	files_path := fmt.Sprintf("%s%s/files", TEST_WORKSPACE_PATH, TEST_USERNAME)
+	test_files := map[string]string{
+		"/zip_test/notes.txt":         strings.Repeat(TEST_FILE_BODY, 1000),
+		"/zip_test/photos/cat.jpg":    "not a real jpeg",
+		"/zip_test/photos/old/dog.md": TEST_FILE_BODY,
+	}
+
+	if err := os.MkdirAll(files_path+"/zip_test/empty", 0770); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(files_path + "/zip_test")
+	}()
+
+	for name, body := range test_files {
+		if err := os.MkdirAll(files_path+name[:strings.LastIndex(name, "/")], 0770); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(files_path+name, []byte(body), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := [...]struct {
+		TestCase
+		target        string
+		json_paths    []string
+		expected_zip  map[string]string // zip name -> body. Directories have empty body
+		stored_in_zip []string
+	}{
+		{
+			TestCase: TestCase{
+				name:                  "bad dir",
+				method:                http.MethodGet,
+				expected_code:         http.StatusBadRequest,
+				expected_content_type: "text/plain",
+				expected_body:         datahttp.ErrBadPath.Description(),
+			},
+			target: "/zip_test",
+		},
+		{
+			TestCase: TestCase{
+				name:                  "dir not found",
+				method:                http.MethodGet,
+				expected_code:         http.StatusBadRequest,
+				expected_content_type: "text/plain",
+				expected_body:         data.ErrDirNotFound.Error(),
+			},
+			target: "/zip_not_exist/",
+		},
+		{
+			TestCase: TestCase{
+				name:                  "directory",
+				method:                http.MethodGet,
+				expected_code:         http.StatusOK,
+				expected_content_type: "application/zip",
+			},
+			target: "/zip_test/",
+			expected_zip: map[string]string{
+				"zip_test/":                  "",
+				"zip_test/empty/":            "",
+				"zip_test/notes.txt":         test_files["/zip_test/notes.txt"],
+				"zip_test/photos/":           "",
+				"zip_test/photos/cat.jpg":    test_files["/zip_test/photos/cat.jpg"],
+				"zip_test/photos/old/":       "",
+				"zip_test/photos/old/dog.md": test_files["/zip_test/photos/old/dog.md"],
+			},
+			stored_in_zip: []string{"zip_test/photos/cat.jpg"},
+		},
+		{
+			TestCase: TestCase{
+				name:                  "selection",
+				method:                http.MethodPost,
+				expected_code:         http.StatusOK,
+				expected_content_type: "application/zip",
+			},
+			json_paths: []string{"/zip_test/notes.txt", "/zip_test/photos/old/"},
+			expected_zip: map[string]string{
+				"notes.txt":  test_files["/zip_test/notes.txt"],
+				"old/":       "",
+				"old/dog.md": test_files["/zip_test/photos/old/dog.md"],
+			},
+		},
+		{
+			TestCase: TestCase{
+				name:                  "selected file not found",
+				method:                http.MethodPost,
+				expected_code:         http.StatusNotFound,
+				expected_content_type: "text/plain",
+				expected_body:         datahttp.ErrFileNotFound.Description(),
+			},
+			json_paths: []string{"/zip_test/unknown.txt"},
+		},
+		{
+			TestCase: TestCase{
+				name:                  "empty selection",
+				method:                http.MethodPost,
+				expected_code:         http.StatusBadRequest,
+				expected_content_type: "text/plain",
+				expected_body:         datahttp.ErrEmptyPathsList.Description(),
+			},
+			json_paths: []string{},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			var req *http.Request
+			if test.method == http.MethodPost {
+				body, err := json.Marshal(datahttp.ZipRequest{Paths: test.json_paths})
+				if err != nil {
+					t.Fatal(err)
+				}
+				req = httptest.NewRequest(test.method, server.DOWNLOAD_ZIP_ENDPOINT, bytes.NewReader(body))
+			} else {
+				req = httptest.NewRequest(test.method, fmt.Sprintf("%s?dir=%s", server.DOWNLOAD_ZIP_ENDPOINT, test.target), nil)
+			}
+			req = req.WithContext(context.WithValue(t.Context(), httpcontextkeys.USERNAME, TEST_USERNAME))
+			w := httptest.NewRecorder()
+
+			handler.DownloadZip(w, req)
+			res := w.Result()
+			defer func() { _ = res.Body.Close() }()
+
+			if res.StatusCode != test.expected_code {
+				t.Errorf("expected code %d, but got %d", test.expected_code, res.StatusCode)
+			}
+
+			content_type := res.Header.Get("Content-Type")
+			if !strings.Contains(content_type, test.expected_content_type) {
+				t.Errorf("expected content-type `%s`, but got `%s`", test.expected_content_type, content_type)
+			}
+
+			got_body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expected_zip == nil {
+				if string(got_body) != test.expected_body {
+					t.Errorf("expected body: `%s`\nbut got: `%s`", test.expected_body, string(got_body))
+				}
+				return
+			}
+
+			archive, err := zip.NewReader(bytes.NewReader(got_body), int64(len(got_body)))
+			if err != nil {
+				t.Fatalf("bad zip archive: %v", err)
+			}
+
+			if len(archive.File) != len(test.expected_zip) {
+				t.Errorf("expected %d files in archive, but got %d", len(test.expected_zip), len(archive.File))
+			}
+
+			for _, file := range archive.File {
+				expected, ok := test.expected_zip[file.Name]
+				if !ok {
+					t.Errorf("unexpected file in archive: %s", file.Name)
+					continue
+				}
+
+				if slices.Contains(test.stored_in_zip, file.Name) && file.Method != zip.Store {
+					t.Errorf("expected STORE method for %s", file.Name)
+				}
+
+				rc, err := file.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := io.ReadAll(rc)
+				_ = rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(got) != expected {
+					t.Errorf("file %s: expected body len %d, but got %d", file.Name, len(expected), len(got))
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadHandler(t *testing.T) {
+	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(TEST_WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 16,
+		MinChunkSize: 4,
+		Allocated:    1024 * 1024 * 1024,
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8103")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8103", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("service unavailable", func(t *testing.T) {
+		err = testEmptyConnection(t.Context(), datahttp.NewHandler(nil).Download, http.MethodGet, server.DOWNLOAD_ENDPOINT)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	handler := datahttp.NewHandler(pb.NewDataServiceClient(grpc_connection))
+
+	// Body bigger than several chunks
+	file_body := strings.Repeat(TEST_FILE_BODY, 10)
+	file_path := fmt.Sprintf("%s%s/files/download_test.txt", TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err := os.WriteFile(file_path, []byte(file_body), 0660); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(file_path)
+	}()
+
+	mod_time := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(file_path, mod_time, mod_time); err != nil {
+		t.Fatal(err)
+	}
+
+	etag := fmt.Sprintf(`"%x-%x"`, mod_time.Unix(), len(file_body))
+
+	cases := [...]struct {
+		TestCase
+		path            string
+		headers         map[string]string
+		expected_header map[string]string
+	}{
+		{
+			TestCase: TestCase{
+				name:                  "bad path",
+				method:                http.MethodGet,
+				expected_code:         http.StatusBadRequest,
+				expected_content_type: "text/plain",
+				expected_body:         datahttp.ErrBadPath.Description(),
+			},
+			path: "/",
+		},
+		{
+			TestCase: TestCase{
+				name:                  "file not found",
+				method:                http.MethodGet,
+				expected_code:         http.StatusNotFound,
+				expected_content_type: "text/plain",
+				expected_body:         datahttp.ErrFileNotFound.Description(),
+			},
+			path: "/not_exist.txt",
+		},
+		{
+			TestCase: TestCase{
+				name:                  "full file",
+				method:                http.MethodGet,
+				expected_code:         http.StatusOK,
+				expected_content_type: "text/plain; charset=utf-8",
+				expected_body:         file_body,
+			},
+			path: "/download_test.txt",
+			expected_header: map[string]string{
+				"ETag":                etag,
+				"Accept-Ranges":       "bytes",
+				"Content-Disposition": "inline; filename=download_test.txt",
+			},
+		},
+		{
+			TestCase: TestCase{
+				name:                  "attachment",
+				method:                http.MethodHead,
+				expected_code:         http.StatusOK,
+				expected_content_type: "text/plain; charset=utf-8",
+			},
+			path: "/download_test.txt&attachment",
+			expected_header: map[string]string{
+				"Content-Disposition": "attachment; filename=download_test.txt",
+				"Content-Length":      fmt.Sprint(len(file_body)),
+			},
+		},
+		{
+			TestCase: TestCase{
+				name:                  "range between chunks",
+				method:                http.MethodGet,
+				expected_code:         http.StatusPartialContent,
+				expected_content_type: "text/plain; charset=utf-8",
+				expected_body:         file_body[10:40],
+			},
+			path:    "/download_test.txt",
+			headers: map[string]string{"Range": "bytes=10-39"},
+			expected_header: map[string]string{
+				"Content-Range": fmt.Sprintf("bytes 10-39/%d", len(file_body)),
+			},
+		},
+		{
+			TestCase: TestCase{
+				name:          "range out of file",
+				method:        http.MethodGet,
+				expected_code: http.StatusRequestedRangeNotSatisfiable,
+			},
+			path:    "/download_test.txt",
+			headers: map[string]string{"Range": fmt.Sprintf("bytes=%d-", len(file_body)+10)},
+		},
+		{
+			TestCase: TestCase{
+				name:          "if none match",
+				method:        http.MethodGet,
+				expected_code: http.StatusNotModified,
+			},
+			path:    "/download_test.txt",
+			headers: map[string]string{"If-None-Match": etag},
+		},
+		{
+			TestCase: TestCase{
+				name:          "if modified since",
+				method:        http.MethodGet,
+				expected_code: http.StatusNotModified,
+			},
+			path:    "/download_test.txt",
+			headers: map[string]string{"If-Modified-Since": mod_time.UTC().Format(http.TimeFormat)},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, fmt.Sprintf("%s?path=%s", server.DOWNLOAD_ENDPOINT, test.path), nil)
+			req = req.WithContext(context.WithValue(t.Context(), httpcontextkeys.USERNAME, TEST_USERNAME))
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			handler.Download(w, req)
+			res := w.Result()
+			defer func() { _ = res.Body.Close() }()
+
+			if res.StatusCode != test.expected_code {
+				t.Errorf("expected code %d, but got %d", test.expected_code, res.StatusCode)
+			}
+
+			if content_type := res.Header.Get("Content-Type"); test.expected_content_type != "" && content_type != test.expected_content_type {
+				t.Errorf("expected content-type `%s`, but got `%s`", test.expected_content_type, content_type)
+			}
+
+			for key, expected := range test.expected_header {
+				if got := res.Header.Get(key); got != expected {
+					t.Errorf("expected header %s: `%s`, but got `%s`", key, expected, got)
+				}
+			}
+
+			got_body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expected_body != "" && string(got_body) != test.expected_body {
+				t.Errorf("expected body: `%s`\nbut got: `%s`", test.expected_body, string(got_body))
+			}
+		})
+	}
+}
+
+func TestTusHandlers(t *testing.T) {
+	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(TEST_WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 16,
+		MinChunkSize: 4,
+		Allocated:    1024 * 1024 * 1024,
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8104")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8104", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := datahttp.NewHandler(pb.NewDataServiceClient(grpc_connection))
+
+	file_body := strings.Repeat(TEST_FILE_BODY, 10)
+	files_path := fmt.Sprintf("%s%s/files/", TEST_WORKSPACE_PATH, TEST_USERNAME)
+
+	tusRequest := func(t *testing.T, handler_func http.HandlerFunc, method, target string, headers map[string]string, body string) *http.Response {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(t.Context(), httpcontextkeys.USERNAME, TEST_USERNAME))
+		req.Header.Set("Tus-Resumable", datahttp.TUS_VERSION)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+
+		handler_func(w, req)
+		return w.Result()
+	}
+
+	createUpload := func(t *testing.T, handler datahttp.Handler, filename string, size int) string {
+		res := tusRequest(t, handler.TusCreate, http.MethodPost, server.TUS_ENDPOINT, map[string]string{
+			"Upload-Length":   fmt.Sprint(size),
+			"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(filename)) + ",directory " + base64.StdEncoding.EncodeToString([]byte("/")),
+		}, "")
+		defer func() { _ = res.Body.Close() }()
+
+		if res.StatusCode != http.StatusCreated {
+			body, _ := io.ReadAll(res.Body)
+			t.Fatalf("expected code %d, but got %d: %s", http.StatusCreated, res.StatusCode, body)
+		}
+
+		location := res.Header.Get("Location")
+		if !strings.HasPrefix(location, server.TUS_ENDPOINT+"/") {
+			t.Fatalf("bad upload location: %s", location)
+		}
+		return location
+	}
+
+	t.Run("options", func(t *testing.T) {
+		res := tusRequest(t, handler.TusOptions, http.MethodOptions, server.TUS_ENDPOINT, nil, "")
+		defer func() { _ = res.Body.Close() }()
+
+		if res.StatusCode != http.StatusNoContent || res.Header.Get("Tus-Extension") != datahttp.TUS_EXTENSIONS {
+			t.Errorf("bad options response: code %d, extensions `%s`", res.StatusCode, res.Header.Get("Tus-Extension"))
+		}
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		res := tusRequest(t, handler.TusCreate, http.MethodPost, server.TUS_ENDPOINT, map[string]string{"Tus-Resumable": "0.2.2"}, "")
+		defer func() { _ = res.Body.Close() }()
+
+		if res.StatusCode != datahttp.ErrTusUnsupportedVersion.Status() {
+			t.Errorf("expected code %d, but got %d", datahttp.ErrTusUnsupportedVersion.Status(), res.StatusCode)
+		}
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		location := createUpload(t, handler, "tus_test.txt", len(file_body))
+		defer func() {
+			_ = os.Remove(files_path + "tus_test.txt")
+		}()
+
+		cases := [...]struct {
+			name            string
+			offset          int
+			body            string
+			checksum        string
+			expected_code   int
+			expected_offset int
+		}{
+			{
+				name:            "part smaller than chunk",
+				offset:          0,
+				body:            file_body[:10],
+				expected_code:   http.StatusNoContent,
+				expected_offset: 10,
+			},
+			{
+				name:          "offset mismatch",
+				offset:        0,
+				body:          file_body[:10],
+				expected_code: datahttp.ErrTusOffsetMismatch.Status(),
+			},
+			{
+				name:          "checksum mismatch",
+				offset:        10,
+				body:          file_body[10:20],
+				checksum:      "sha1 " + base64.StdEncoding.EncodeToString(make([]byte, sha1.Size)),
+				expected_code: datahttp.ErrTusChecksumMismatch.Status(),
+			},
+			{
+				name:          "checksum body larger than chunk",
+				offset:        10,
+				body:          file_body[10:45],
+				checksum:      "sha1 " + tusSha1(file_body[10:45]),
+				expected_code: datahttp.ErrTusChecksumBodyTooLarge.Status(),
+			},
+			{
+				name:            "part between chunks with checksum",
+				offset:          10,
+				body:            file_body[10:20],
+				checksum:        "sha1 " + tusSha1(file_body[10:20]),
+				expected_code:   http.StatusNoContent,
+				expected_offset: 20,
+			},
+			{
+				name:            "last part",
+				offset:          20,
+				body:            file_body[20:],
+				expected_code:   http.StatusNoContent,
+				expected_offset: len(file_body),
+			},
+		}
+
+		for _, test := range cases {
+			t.Run(test.name, func(t *testing.T) {
+				headers := map[string]string{
+					"Content-Type":  datahttp.TUS_CONTENT_TYPE,
+					"Upload-Offset": fmt.Sprint(test.offset),
+				}
+				if test.checksum != "" {
+					headers["Upload-Checksum"] = test.checksum
+				}
+
+				res := tusRequest(t, handler.TusPatch, http.MethodPatch, location, headers, test.body)
+				defer func() { _ = res.Body.Close() }()
+
+				if res.StatusCode != test.expected_code {
+					t.Fatalf("expected code %d, but got %d", test.expected_code, res.StatusCode)
+				}
+
+				if test.expected_code != http.StatusNoContent {
+					return
+				}
+
+				if got := res.Header.Get("Upload-Offset"); got != fmt.Sprint(test.expected_offset) {
+					t.Errorf("expected offset %d, but got %s", test.expected_offset, got)
+				}
+			})
+		}
+
+		res := tusRequest(t, handler.TusHead, http.MethodHead, location, nil, "")
+		defer func() { _ = res.Body.Close() }()
+
+		if res.Header.Get("Upload-Offset") != fmt.Sprint(len(file_body)) || res.Header.Get("Upload-Length") != fmt.Sprint(len(file_body)) {
+			t.Errorf("bad head response: offset %s, length %s", res.Header.Get("Upload-Offset"), res.Header.Get("Upload-Length"))
+		}
+
+		saved, err := os.ReadFile(files_path + "tus_test.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(saved) != file_body {
+			t.Errorf("expected file body: `%s`\nbut got: `%s`", file_body, saved)
+		}
+	})
+
+	t.Run("termination", func(t *testing.T) {
+		location := createUpload(t, handler, "tus_terminated.txt", len(file_body))
+
+		res := tusRequest(t, handler.TusPatch, http.MethodPatch, location, map[string]string{
+			"Content-Type":  datahttp.TUS_CONTENT_TYPE,
+			"Upload-Offset": "0",
+		}, file_body[:20])
+		_ = res.Body.Close()
+
+		res = tusRequest(t, handler.TusDelete, http.MethodDelete, location, nil, "")
+		_ = res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			t.Errorf("expected code %d, but got %d", http.StatusNoContent, res.StatusCode)
+		}
+
+		if _, err := os.Stat(files_path + "tus_terminated.txt"); err == nil {
+			t.Error("unfinished file is not removed")
+		}
+
+		res = tusRequest(t, handler.TusHead, http.MethodHead, location, nil, "")
+		_ = res.Body.Close()
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("expected code %d, but got %d", http.StatusNotFound, res.StatusCode)
+		}
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		location := createUpload(t, handler, "tus_empty.txt", 0)
+		defer func() {
+			_ = os.Remove(files_path + "tus_empty.txt")
+		}()
+
+		res := tusRequest(t, handler.TusHead, http.MethodHead, location, nil, "")
+		_ = res.Body.Close()
+
+		if res.Header.Get("Upload-Offset") != "0" || res.Header.Get("Upload-Length") != "0" {
+			t.Errorf("bad head response: offset %s, length %s", res.Header.Get("Upload-Offset"), res.Header.Get("Upload-Length"))
+		}
+
+		res = tusRequest(t, handler.TusPatch, http.MethodPatch, location, map[string]string{
+			"Content-Type":  datahttp.TUS_CONTENT_TYPE,
+			"Upload-Offset": "0",
+		}, "")
+		_ = res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			t.Errorf("expected code %d, but got %d", http.StatusNoContent, res.StatusCode)
+		}
+
+		info, err := os.Stat(files_path + "tus_empty.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size() != 0 {
+			t.Errorf("expected empty file, but got %d bytes", info.Size())
+		}
+
+		res = tusRequest(t, handler.TusDelete, http.MethodDelete, location, nil, "")
+		_ = res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			t.Errorf("expected code %d, but got %d", http.StatusNoContent, res.StatusCode)
+		}
+
+		if _, err := os.Stat(files_path + "tus_empty.txt"); err != nil {
+			t.Error("finished empty file is removed")
+		}
+	})
+
+	t.Run("lifetime", func(t *testing.T) {
+		long_lived := handler.WithTusLifetime(time.Hour)
+
+		location := createUpload(t, long_lived, "tus_lifetime.txt", len(file_body))
+		defer func() {
+			res := tusRequest(t, long_lived.TusDelete, http.MethodDelete, location, nil, "")
+			_ = res.Body.Close()
+		}()
+
+		res := tusRequest(t, long_lived.TusHead, http.MethodHead, location, nil, "")
+		_ = res.Body.Close()
+
+		expires, err := http.ParseTime(res.Header.Get("Upload-Expires"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Upload lives much longer than data connection of other requests
+		if until := time.Until(expires); until < time.Hour-time.Minute || until > time.Hour {
+			t.Errorf("expected upload lifetime about %v, but upload expires in %v", time.Hour, until)
+		}
+	})
+
+	t.Run("kept buffers limit", func(t *testing.T) {
+		sem := make(chan any, 2)
+		limited := handler.WithSemaphore(sem)
+
+		first := createUpload(t, limited, "tus_first.txt", len(file_body))
+		second := createUpload(t, limited, "tus_second.txt", len(file_body))
+		defer func() {
+			_ = os.Remove(files_path + "tus_first.txt")
+			_ = os.Remove(files_path + "tus_second.txt")
+		}()
+
+		patch := func(location string, offset int, body string) string {
+			res := tusRequest(t, limited.TusPatch, http.MethodPatch, location, map[string]string{
+				"Content-Type":  datahttp.TUS_CONTENT_TYPE,
+				"Upload-Offset": fmt.Sprint(offset),
+			}, body)
+			_ = res.Body.Close()
+
+			if res.StatusCode != http.StatusNoContent {
+				t.Fatalf("expected code %d, but got %d", http.StatusNoContent, res.StatusCode)
+			}
+			return res.Header.Get("Upload-Offset")
+		}
+
+		if got := patch(first, 0, file_body[:10]); got != "10" {
+			t.Errorf("expected offset 10, but got %s", got)
+		}
+
+		if len(sem) != 1 {
+			t.Fatalf("expected 1 taken semaphore slot, but got %d", len(sem))
+		}
+
+		// Half of semaphore is already taken, so unsaved bytes are dropped
+		if got := patch(second, 0, file_body[:10]); got != "0" {
+			t.Errorf("expected offset 0, but got %s", got)
+		}
+
+		if got := patch(first, 10, file_body[10:]); got != fmt.Sprint(len(file_body)) {
+			t.Errorf("expected offset %d, but got %s", len(file_body), got)
+		}
+
+		if len(sem) != 0 {
+			t.Errorf("semaphore slot isn't released after upload, taken %d", len(sem))
+		}
+	})
+}
+
+func tusSha1(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestDeltaHandlers(t *testing.T) {
+	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(TEST_WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 64 * 1024,
+		MinChunkSize: 4,
+		Allocated:    1024 * 1024 * 1024,
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8105")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8105", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("service unavailable", func(t *testing.T) {
+		err = testEmptyConnection(t.Context(), datahttp.NewHandler(nil).GetSignature, http.MethodGet, server.SIGNATURE_ENDPOINT)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	handler := datahttp.NewHandler(pb.NewDataServiceClient(grpc_connection))
+
+	// Literal is bigger than one message to data service
+	base := strings.Repeat(TEST_FILE_BODY, 10000)
+	changed := base[:50000] + strings.Repeat("new data", 8000) + base[50000:]
+	file_path := fmt.Sprintf("%s%s/files/delta_test.txt", TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err := os.WriteFile(file_path, []byte(base), 0660); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(file_path)
+	}()
+
+	deltaRequest := func(t *testing.T, handler_func http.HandlerFunc, method, target string, body io.Reader) *http.Response {
+		req := httptest.NewRequest(method, target, body)
+		req = req.WithContext(context.WithValue(t.Context(), httpcontextkeys.USERNAME, TEST_USERNAME))
+		w := httptest.NewRecorder()
+
+		handler_func(w, req)
+		return w.Result()
+	}
+
+	getSignature := func(t *testing.T) *pb.Signature {
+		res := deltaRequest(t, handler.GetSignature, http.MethodGet, server.SIGNATURE_ENDPOINT+"?path=/delta_test.txt&blockSize=2048", nil)
+		defer func() { _ = res.Body.Close() }()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected code %d, but got %d", http.StatusOK, res.StatusCode)
+		}
+
+		var signature pb.Signature
+		if err := json.NewDecoder(res.Body).Decode(&signature); err != nil {
+			t.Fatal(err)
+		}
+
+		if signature.BlockSize != 2048 || signature.Size != uint64(len(base)) {
+			t.Fatalf("bad signature: block size %d, size %d", signature.BlockSize, signature.Size)
+		}
+		return &signature
+	}
+
+	// Query params and body of delta request
+	createDelta := func(t *testing.T, signature *pb.Signature, sum string) (string, *bytes.Buffer) {
+		blocks := make([]delta.Block, len(signature.Blocks))
+		for i, block := range signature.Blocks {
+			blocks[i].Weak = block.Weak
+			copy(blocks[i].Strong[:], block.Strong)
+		}
+
+		var body bytes.Buffer
+		err := delta.Diff(strings.NewReader(changed), int(signature.BlockSize), blocks, func(op delta.Op) error {
+			return delta.WriteOp(&body, op)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return fmt.Sprintf("%s?path=/delta_test.txt&blockSize=%d&baseSize=%d&baseModTime=%d&size=%d&sum=%s",
+			server.DELTA_ENDPOINT, signature.BlockSize, signature.Size, signature.ModTime, len(changed), sum), &body
+	}
+
+	changed_sum := sha256.Sum256([]byte(changed))
+
+	t.Run("signature of not exist file", func(t *testing.T) {
+		res := deltaRequest(t, handler.GetSignature, http.MethodGet, server.SIGNATURE_ENDPOINT+"?path=/not_exist.txt", nil)
+		_ = res.Body.Close()
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("expected code %d, but got %d", http.StatusNotFound, res.StatusCode)
+		}
+	})
+
+	t.Run("bad params", func(t *testing.T) {
+		res := deltaRequest(t, handler.ApplyDelta, http.MethodPost, server.DELTA_ENDPOINT+"?path=/delta_test.txt&blockSize=abc", nil)
+		_ = res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected code %d, but got %d", http.StatusBadRequest, res.StatusCode)
+		}
+	})
+
+	t.Run("bad body", func(t *testing.T) {
+		target, _ := createDelta(t, getSignature(t), hex.EncodeToString(changed_sum[:]))
+		res := deltaRequest(t, handler.ApplyDelta, http.MethodPost, target, strings.NewReader("\x07bad"))
+		defer func() { _ = res.Body.Close() }()
+
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusBadRequest || string(body) != datahttp.ErrBadDeltaBody.Description() {
+			t.Errorf("expected code %d, but got %d: %s", http.StatusBadRequest, res.StatusCode, body)
+		}
+	})
+
+	t.Run("sum mismatch", func(t *testing.T) {
+		target, body := createDelta(t, getSignature(t), strings.Repeat("00", sha256.Size))
+		res := deltaRequest(t, handler.ApplyDelta, http.MethodPost, target, body)
+		_ = res.Body.Close()
+
+		if res.StatusCode != http.StatusConflict {
+			t.Errorf("expected code %d, but got %d", http.StatusConflict, res.StatusCode)
+		}
+
+		if file_body, _ := os.ReadFile(file_path); string(file_body) != base {
+			t.Error("file changed by bad delta")
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		target, body := createDelta(t, getSignature(t), hex.EncodeToString(changed_sum[:]))
+		res := deltaRequest(t, handler.ApplyDelta, http.MethodPost, target, body)
+		defer func() { _ = res.Body.Close() }()
+
+		if res.StatusCode != http.StatusOK {
+			resp_body, _ := io.ReadAll(res.Body)
+			t.Fatalf("expected code %d, but got %d: %s", http.StatusOK, res.StatusCode, resp_body)
+		}
+
+		var result pb.DeltaResult
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Size != uint64(len(changed)) || result.Literal >= result.Size/2 {
+			t.Errorf("bad delta result: %v", &result)
+		}
+
+		if file_body, _ := os.ReadFile(file_path); string(file_body) != changed {
+			t.Error("file is not changed by delta")
+		}
+	})
+}
+
+func TestEventsHandler(t *testing.T) {
+	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(TEST_WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 64 * 1024,
+		MinChunkSize: 4,
+		Allocated:    1024 * 1024 * 1024,
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8106")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8106", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("service unavailable", func(t *testing.T) {
+		err = testEmptyConnection(t.Context(), datahttp.NewHandler(nil).Events, http.MethodGet, server.EVENTS_ENDPOINT)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	data_client := pb.NewDataServiceClient(grpc_connection)
+	handler := datahttp.NewHandler(data_client)
+
+	// Stream is read by real http client, so handler is served with username in context
+	http_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Events(w, r.WithContext(context.WithValue(r.Context(), httpcontextkeys.USERNAME, TEST_USERNAME)))
+	}))
+	defer http_server.Close()
+
+	t.Run("bad cursor", func(t *testing.T) {
+		res, err := http.Get(http_server.URL + server.EVENTS_ENDPOINT + "?since=abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = res.Body.Close() }()
+
+		if res.StatusCode != datahttp.ErrBadCursor.Status() {
+			t.Errorf("expected code %d, but got %d", datahttp.ErrBadCursor.Status(), res.StatusCode)
+		}
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		res, err := http.Get(http_server.URL + server.EVENTS_ENDPOINT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = res.Body.Close() }()
+
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("expected event stream, but got %d (%s)", res.StatusCode, res.Header.Get("Content-Type"))
+		}
+
+		// Read event name and data
+		reader := bufio.NewReader(res.Body)
+		readEvent := func() (string, string) {
+			var name, data string
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				line = strings.TrimSuffix(line, "\n")
+				switch {
+				case line == "" && name != "":
+					return name, data
+				case strings.HasPrefix(line, "event: "):
+					name = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}
+
+		if name, _ := readEvent(); name != "ready" {
+			t.Fatalf("expected ready event, but got %s", name)
+		}
+
+		if _, err := data_client.CreateDir(t.Context(), &pb.Directory{User: TEST_USERNAME, Value: "/events_test/"}); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_, _ = data_client.RemoveDir(context.Background(), &pb.Directory{User: TEST_USERNAME, Value: "/events_test/"})
+		}()
+
+		name, body := readEvent()
+		var change pb.Change
+		if err := json.Unmarshal([]byte(body), &change); err != nil || name != "change" {
+			t.Fatalf("expected change event, but got %s: %s (%v)", name, body, err)
+		}
+
+		if change.Op != "create" || change.Path != "/events_test/" || !change.IsDir {
+			t.Errorf("bad change: %s", body)
+		}
+	})
+}
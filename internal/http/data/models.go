@@ -11,6 +11,32 @@ type DataHandler interface {
 	GetAvailableDiskSpace(http.ResponseWriter, *http.Request)
 	CreateDir(http.ResponseWriter, *http.Request)
 	RemoveDir(http.ResponseWriter, *http.Request)
+	RemoveFile(http.ResponseWriter, *http.Request)
+	Move(http.ResponseWriter, *http.Request)
+	DownloadZip(http.ResponseWriter, *http.Request)
+	Extract(http.ResponseWriter, *http.Request)
+	Download(http.ResponseWriter, *http.Request)
+
+	// Delta sync
+	GetSignature(http.ResponseWriter, *http.Request)
+	ApplyDelta(http.ResponseWriter, *http.Request)
+
+	// Sync
+	GetChanges(http.ResponseWriter, *http.Request)
+	Events(http.ResponseWriter, *http.Request)
+
+	// Public links
+	CreateShare(http.ResponseWriter, *http.Request)
+	GetShares(http.ResponseWriter, *http.Request)
+	RemoveShare(http.ResponseWriter, *http.Request)
+	DownloadShare(http.ResponseWriter, *http.Request)
+
+	// tus.io protocol
+	TusOptions(http.ResponseWriter, *http.Request)
+	TusCreate(http.ResponseWriter, *http.Request)
+	TusHead(http.ResponseWriter, *http.Request)
+	TusPatch(http.ResponseWriter, *http.Request)
+	TusDelete(http.ResponseWriter, *http.Request)
 }
 
 type DataMiddleware interface {
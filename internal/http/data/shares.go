@@ -0,0 +1,146 @@
+package datahttp
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	pb "github.com/braginantonev/mhserver/proto/data"
+)
+
+// Create public link to file ("path" query param) for "lifetime" seconds. Server default lifetime is used without it.
+func (h Handler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Create share request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.CreateShare").Write(w)
+		return
+	}
+
+	query := r.URL.Query()
+	dir, filename := splitFilePath(query.Get("path"))
+	if dir == "" || filename == "" {
+		ErrBadPath.Write(w)
+		return
+	}
+
+	req := &pb.ShareRequest{
+		Username:  username,
+		Directory: dir,
+		Filename:  filename,
+	}
+
+	if query.Has("lifetime") {
+		lifetime, err := strconv.ParseInt(query.Get("lifetime"), 10, 64)
+		if err != nil || lifetime <= 0 {
+			ErrBadShareLifetime.Write(w)
+			return
+		}
+		req.Lifetime = lifetime
+	}
+
+	share, err := h.dataServiceClient.CreateShare(r.Context(), req)
+	if err != nil {
+		handleServiceError(err, w, "data.CreateShare")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(share); err != nil {
+		slog.Error("failed write share", slog.Any("err", err))
+	}
+}
+
+func (h Handler) GetShares(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Get shares request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.GetShares").Write(w)
+		return
+	}
+
+	list, err := h.dataServiceClient.GetShares(r.Context(), &pb.SharesRequest{Username: username})
+	if err != nil {
+		handleServiceError(err, w, "data.GetShares")
+		return
+	}
+
+	// Empty list is returned as [], not null
+	if list.Value == nil {
+		list.Value = []*pb.Share{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list.Value); err != nil {
+		ErrInternal.Append(err).WithFuncName("Handler.GetShares.Marshal").Write(w)
+	}
+}
+
+// Remove public link by "token" query param
+func (h Handler) RemoveShare(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Remove share request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.RemoveShare").Write(w)
+		return
+	}
+
+	_, err := h.dataServiceClient.RemoveShare(r.Context(), &pb.ShareToken{
+		Username: username,
+		Token:    r.URL.Query().Get("token"),
+	})
+	if err != nil {
+		handleServiceError(err, w, "data.RemoveShare")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+}
+
+// Download shared file without authorization. Token is the last part of path: "/api/v1/share/{token}".
+func (h Handler) DownloadShare(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Download share request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	share, err := h.dataServiceClient.GetShare(r.Context(), &pb.ShareToken{Token: path.Base(r.URL.Path)})
+	if err != nil {
+		handleServiceError(err, w, "data.GetShare")
+		return
+	}
+
+	h.serveFile(w, r, share.Username, share.Path)
+}
@@ -0,0 +1,148 @@
+package datahttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	datahttp "github.com/braginantonev/mhserver/internal/http/data"
+	"github.com/braginantonev/mhserver/internal/repository/shares"
+	"github.com/braginantonev/mhserver/internal/server"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestSharesHandlers(t *testing.T) {
+	err := createWorkdir(TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(TEST_WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 16,
+		MinChunkSize: 4,
+		Allocated:    1024 * 1024 * 1024,
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8107")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	grpc_connection, err := grpc.NewClient("localhost:8107", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("service unavailable", func(t *testing.T) {
+		err = testEmptyConnection(t.Context(), datahttp.NewHandler(nil).CreateShare, http.MethodPost, server.SHARES_ENDPOINT)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	handler := datahttp.NewHandler(pb.NewDataServiceClient(grpc_connection))
+
+	file_path := fmt.Sprintf("%s%s/files/share_test.txt", TEST_WORKSPACE_PATH, TEST_USERNAME)
+	if err := os.WriteFile(file_path, []byte(TEST_FILE_BODY), 0660); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(file_path)
+	}()
+
+	request := func(handler_func http.HandlerFunc, method, target string, with_user bool) *http.Response {
+		req := httptest.NewRequest(method, target, nil)
+		if with_user {
+			req = req.WithContext(context.WithValue(t.Context(), httpcontextkeys.USERNAME, TEST_USERNAME))
+		}
+		w := httptest.NewRecorder()
+
+		handler_func(w, req)
+		return w.Result()
+	}
+
+	expectError := func(t *testing.T, res *http.Response, code int, message string) {
+		defer func() { _ = res.Body.Close() }()
+
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != code || string(body) != message {
+			t.Errorf("expected %d `%s`, but got %d `%s`", code, message, res.StatusCode, body)
+		}
+	}
+
+	t.Run("bad lifetime", func(t *testing.T) {
+		res := request(handler.CreateShare, http.MethodPost, server.SHARES_ENDPOINT+"?path=/share_test.txt&lifetime=week", true)
+		expectError(t, res, http.StatusBadRequest, datahttp.ErrBadShareLifetime.Description())
+	})
+
+	t.Run("not existing file", func(t *testing.T) {
+		res := request(handler.CreateShare, http.MethodPost, server.SHARES_ENDPOINT+"?path=/not_exist.txt", true)
+		expectError(t, res, http.StatusBadRequest, data.ErrFileNotExist.Error())
+	})
+
+	res := request(handler.CreateShare, http.MethodPost, server.SHARES_ENDPOINT+"?path=/share_test.txt&lifetime=60", true)
+	defer func() { _ = res.Body.Close() }()
+
+	var share pb.Share
+	if err := json.NewDecoder(res.Body).Decode(&share); err != nil || res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected created share, but got %d (%v)", res.StatusCode, err)
+	}
+
+	if share.Path != "/share_test.txt" || share.Expires-share.Created != 60 {
+		t.Errorf("expected share of /share_test.txt for minute, but got %v", &share)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		res := request(handler.GetShares, http.MethodGet, server.SHARES_ENDPOINT, true)
+		defer func() { _ = res.Body.Close() }()
+
+		var list []*pb.Share
+		if err := json.NewDecoder(res.Body).Decode(&list); err != nil || len(list) != 1 || list[0].Token != share.Token {
+			t.Errorf("expected created share in list, but got %v (%v)", list, err)
+		}
+	})
+
+	t.Run("public download", func(t *testing.T) {
+		res := request(handler.DownloadShare, http.MethodGet, server.SHARE_ENDPOINT+"/"+share.Token, false)
+		defer func() { _ = res.Body.Close() }()
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil || res.StatusCode != http.StatusOK || string(body) != TEST_FILE_BODY {
+			t.Errorf("expected shared file, but got %d `%s` (%v)", res.StatusCode, body, err)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		res := request(handler.DownloadShare, http.MethodGet, server.SHARE_ENDPOINT+"/tuturu", false)
+		expectError(t, res, http.StatusNotFound, shares.ErrShareNotFound.Error())
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		res := request(handler.RemoveShare, http.MethodDelete, server.SHARES_ENDPOINT+"?token="+share.Token, true)
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected code %d, but got %d", http.StatusOK, res.StatusCode)
+		}
+
+		res = request(handler.DownloadShare, http.MethodGet, server.SHARE_ENDPOINT+"/"+share.Token, false)
+		expectError(t, res, http.StatusNotFound, shares.ErrShareNotFound.Error())
+	})
+}
@@ -0,0 +1,587 @@
+package datahttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httperror"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/status"
+)
+
+// tus.io resumable upload protocol: https://tus.io/protocols/resumable-upload
+const (
+	TUS_VERSION    string = "1.0.0"
+	TUS_EXTENSIONS string = "creation,termination,checksum"
+	TUS_CHECKSUMS  string = "sha1,sha256,md5"
+
+	TUS_CONTENT_TYPE string = "application/offset+octet-stream"
+
+	// Upload can be continued after long network outage, so it lives much longer than data connection of other requests
+	DEFAULT_TUS_LIFETIME time.Duration = 24 * time.Hour
+)
+
+var tusChecksums = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+type tusUpload struct {
+	mux sync.Mutex
+
+	username string
+	conn     *pb.Connection
+
+	// Saved to data service bytes. Always at chunk border.
+	saved uint64
+	// Received bytes, which are not saved yet (less than chunk)
+	buf []byte
+	// Release semaphore slot, which counts buffer kept between requests. Nil, if slot isn't taken.
+	release func()
+	// Frees kept buffer of expired upload, even if upload isn't requested anymore
+	timer *time.Timer
+
+	expires time.Time
+}
+
+func (u *tusUpload) offset() uint64 {
+	return u.saved + uint64(len(u.buf))
+}
+
+// Free buffer and his semaphore slot. Upload must be locked.
+func (u *tusUpload) freeBuffer() {
+	u.buf = nil
+	if u.release != nil {
+		u.release()
+		u.release = nil
+	}
+	if u.timer != nil {
+		u.timer.Stop()
+		u.timer = nil
+	}
+}
+
+// Tus upload is alive while data service connection is alive, so it's updated only with saving to connection
+func (u *tusUpload) updateExpiration(lifetime time.Duration) {
+	u.expires = time.Now().Add(lifetime)
+}
+
+type tusUploads struct {
+	value map[string]*tusUpload
+	mux   sync.Mutex
+
+	// Count of buffers kept between requests
+	kept atomic.Int64
+}
+
+func newTusUploads() *tusUploads {
+	return &tusUploads{
+		value: make(map[string]*tusUpload),
+	}
+}
+
+func (m *tusUploads) push(upload *tusUpload) string {
+	id := uuid.NewString()
+
+	var expired []*tusUpload
+
+	m.mux.Lock()
+	// Remove expired uploads
+	for old_id, old_upload := range m.value {
+		if time.Now().After(old_upload.expires) {
+			delete(m.value, old_id)
+			expired = append(expired, old_upload)
+		}
+	}
+
+	m.value[id] = upload
+	m.mux.Unlock()
+
+	// Uploads are locked without map lock, because PATCH removes upload from map under upload lock
+	for _, old_upload := range expired {
+		old_upload.mux.Lock()
+		old_upload.freeBuffer()
+		old_upload.mux.Unlock()
+	}
+
+	return id
+}
+
+// Return upload of user. Uploads of other users are not found.
+func (m *tusUploads) get(id, username string) (*tusUpload, bool) {
+	m.mux.Lock()
+	upload, ok := m.value[id]
+	if !ok || upload.username != username {
+		m.mux.Unlock()
+		return nil, false
+	}
+
+	expired := time.Now().After(upload.expires)
+	if expired {
+		delete(m.value, id)
+	}
+	m.mux.Unlock()
+
+	if expired {
+		upload.mux.Lock()
+		upload.freeBuffer()
+		upload.mux.Unlock()
+		return nil, false
+	}
+
+	return upload, true
+}
+
+func (m *tusUploads) remove(id string) {
+	m.mux.Lock()
+	delete(m.value, id)
+	m.mux.Unlock()
+}
+
+// Parse Upload-Metadata header: "key base64,key2 base64". Values can be empty.
+func parseTusMetadata(header string) (map[string]string, bool) {
+	meta := make(map[string]string)
+	if header == "" {
+		return meta, true
+	}
+
+	for pair := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, false
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, false
+		}
+		meta[key] = string(decoded)
+	}
+
+	return meta, true
+}
+
+// Check Tus-Resumable header and set tus headers to response. Return false, if version is not supported.
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", TUS_VERSION)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Header.Get("Tus-Resumable") != TUS_VERSION {
+		w.Header().Set("Tus-Version", TUS_VERSION)
+		ErrTusUnsupportedVersion.Write(w)
+		return false
+	}
+	return true
+}
+
+func (h Handler) tusUpload(w http.ResponseWriter, r *http.Request, func_name string) (string, *tusUpload, bool) {
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName(func_name).Write(w)
+		return "", nil, false
+	}
+
+	id := path.Base(r.URL.Path)
+	upload, ok := h.tusUploads.get(id, username)
+	if !ok {
+		ErrTusUploadNotFound.Write(w)
+		return "", nil, false
+	}
+
+	return id, upload, true
+}
+
+/*
+Keep unsaved bytes of upload until next request with own semaphore slot. Slot isn't waited,
+because request already holds one. Kept buffers take no more than half of semaphore, so they can't block other requests.
+If there is no free slot, unsaved bytes are dropped and client sends them again from returned offset.
+Buffer is kept only for data.FILE_LIFETIME after last request, even if upload lives longer.
+Upload must be locked.
+*/
+func (h Handler) keepTusBuffer(upload *tusUpload) {
+	if len(upload.buf) == 0 {
+		upload.freeBuffer()
+		return
+	}
+
+	if upload.timer != nil {
+		upload.timer.Reset(data.FILE_LIFETIME)
+	}
+
+	if upload.release != nil || h.sem == nil {
+		return
+	}
+
+	if h.tusUploads.kept.Add(1) > int64(cap(h.sem)/2) {
+		h.tusUploads.kept.Add(-1)
+		upload.freeBuffer()
+		return
+	}
+
+	select {
+	case h.sem <- struct{}{}:
+	default:
+		h.tusUploads.kept.Add(-1)
+		upload.freeBuffer()
+		return
+	}
+
+	upload.release = func() {
+		<-h.sem
+		h.tusUploads.kept.Add(-1)
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(data.FILE_LIFETIME, func() {
+		upload.mux.Lock()
+		defer upload.mux.Unlock()
+
+		// Buffer is already freed or kept again with other timer
+		if upload.timer != timer {
+			return
+		}
+		upload.freeBuffer()
+	})
+	upload.timer = timer
+}
+
+// Send full chunks from buffer to data service. Last chunk of file is sent, when all file is received.
+func (h Handler) flushTusUpload(ctx context.Context, upload *tusUpload) error {
+	chunk_size := upload.conn.ChunkSize
+	for len(upload.buf) > 0 && (uint64(len(upload.buf)) >= chunk_size || upload.offset() == upload.conn.Size) {
+		n := min(uint64(len(upload.buf)), chunk_size)
+		_, err := h.dataServiceClient.SaveData(ctx, &pb.SaveChunk{
+			UUID: upload.conn.UUID,
+			Data: &pb.FilePart{
+				Chunk:  upload.buf[:n],
+				Offset: upload.saved,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		// Buffer is reused for next chunk
+		upload.saved += n
+		upload.buf = upload.buf[:copy(upload.buf, upload.buf[n:])]
+	}
+	return nil
+}
+
+/*
+Read PATCH body with Upload-Checksum header and check it before saving. Body is kept in memory
+of request semaphore slot, so it can't be larger than chunk.
+*/
+func readTusChecksumBody(r *http.Request, body io.Reader, chunk_size uint64) ([]byte, error) {
+	checksum := r.Header.Get("Upload-Checksum")
+
+	algorithm, expected, _ := strings.Cut(checksum, " ")
+	new_hash, ok := tusChecksums[algorithm]
+	if !ok {
+		return nil, ErrTusUnsupportedChecksum
+	}
+
+	expected_sum, err := base64.StdEncoding.DecodeString(expected)
+	if err != nil {
+		return nil, ErrTusUnsupportedChecksum
+	}
+
+	if r.ContentLength > int64(chunk_size) {
+		return nil, ErrTusChecksumBodyTooLarge
+	}
+
+	buf := make([]byte, chunk_size)
+	n, err := io.ReadFull(body, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	// Content-Length can be unknown, so body is checked for extra bytes
+	if uint64(n) == chunk_size {
+		if extra, _ := io.ReadFull(body, make([]byte, 1)); extra > 0 {
+			return nil, ErrTusChecksumBodyTooLarge
+		}
+	}
+	buf = buf[:n]
+
+	sum := new_hash()
+	sum.Write(buf)
+	if !bytes.Equal(sum.Sum(nil), expected_sum) {
+		return nil, ErrTusChecksumMismatch
+	}
+
+	return buf, nil
+}
+
+// OPTIONS. Return server tus capabilities.
+func (h Handler) TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", TUS_VERSION)
+	w.Header().Set("Tus-Version", TUS_VERSION)
+	w.Header().Set("Tus-Extension", TUS_EXTENSIONS)
+	w.Header().Set("Tus-Checksum-Algorithm", TUS_CHECKSUMS)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+POST. Create new upload with Upload-Length and Upload-Metadata headers.
+Metadata "filename" (or "name") is required, "directory" is "/" by default.
+*/
+func (h Handler) TusCreate(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Tus create request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.TusCreate").Write(w)
+		return
+	}
+
+	size, err := strconv.ParseUint(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		ErrTusBadUploadLength.Write(w)
+		return
+	}
+
+	meta, ok := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if !ok {
+		ErrTusBadMetadata.Write(w)
+		return
+	}
+
+	filename := meta["filename"]
+	if filename == "" {
+		filename = meta["name"]
+	}
+
+	directory := meta["directory"]
+	if directory == "" {
+		directory = "/"
+	}
+
+	conn, err := h.dataServiceClient.CreateConnection(r.Context(), &pb.ConnectionRequest{
+		Username:  username,
+		Mode:      pb.ConnectionMode_RDWR,
+		Directory: directory,
+		Filename:  filename,
+		Size:      size,
+		Lifetime:  uint64(h.tusLifetime / time.Second),
+	})
+	if err != nil {
+		handleServiceError(err, w, "data.CreateConnection")
+		return
+	}
+
+	// Empty file is already saved by data service, so upload is finished at once
+	upload := &tusUpload{
+		username: username,
+		conn:     conn,
+	}
+	upload.updateExpiration(h.tusLifetime)
+
+	id := h.tusUploads.push(upload)
+
+	w.Header().Del("Content-Type")
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+	w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HEAD. Return upload offset.
+func (h Handler) TusHead(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	_, upload, ok := h.tusUpload(w, r, "Handlers.TusHead")
+	if !ok {
+		return
+	}
+
+	upload.mux.Lock()
+	defer upload.mux.Unlock()
+
+	w.Header().Set("Upload-Offset", fmt.Sprint(upload.offset()))
+	w.Header().Set("Upload-Length", fmt.Sprint(upload.conn.Size))
+	w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// PATCH. Save file part from Upload-Offset.
+func (h Handler) TusPatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/plain")
+
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != TUS_CONTENT_TYPE {
+		ErrTusBadContentType.Write(w)
+		return
+	}
+
+	id, upload, ok := h.tusUpload(w, r, "Handlers.TusPatch")
+	if !ok {
+		return
+	}
+
+	upload.mux.Lock()
+	defer upload.mux.Unlock()
+
+	offset, err := strconv.ParseUint(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.offset() {
+		ErrTusOffsetMismatch.Write(w)
+		return
+	}
+
+	// File part can be uploaded longer than server read timeout
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	var body io.Reader = io.LimitReader(r.Body, int64(upload.conn.Size-offset))
+	if r.Header.Get("Upload-Checksum") != "" {
+		checked, err := readTusChecksumBody(r, body, upload.conn.ChunkSize)
+		if err != nil {
+			var http_err httperror.HttpError
+			if errors.As(err, &http_err) {
+				http_err.Write(w)
+			} else {
+				ErrTusBodyNotReceived.Write(w)
+			}
+			return
+		}
+
+		// Checked body has chunk capacity, so it's used as buffer, if there are no unsaved bytes
+		if upload.buf == nil {
+			upload.buf = checked
+			checked = nil
+		}
+		body = bytes.NewReader(checked)
+	}
+
+	// Buffer of request is counted by main semaphore slot of request
+	if upload.buf == nil {
+		upload.buf = make([]byte, 0, upload.conn.ChunkSize)
+	}
+
+	// Received bytes are saved even if client is disconnected
+	saved := upload.saved
+	var read_err error
+	for read_err == nil {
+		var n int
+		n, read_err = body.Read(upload.buf[len(upload.buf):cap(upload.buf)])
+		upload.buf = upload.buf[:len(upload.buf)+n]
+
+		if err := h.flushTusUpload(r.Context(), upload); err != nil {
+			if status.Convert(err).Message() == data.ErrConnectionNotFound.Error() {
+				upload.freeBuffer()
+				h.tusUploads.remove(id)
+				ErrTusUploadNotFound.Write(w)
+				return
+			}
+
+			h.keepTusBuffer(upload)
+			if upload.saved > saved {
+				upload.updateExpiration(h.tusLifetime)
+			}
+			handleServiceError(err, w, "data.SaveData")
+			return
+		}
+	}
+
+	h.keepTusBuffer(upload)
+	if upload.saved > saved {
+		upload.updateExpiration(h.tusLifetime)
+	}
+
+	w.Header().Del("Content-Type")
+	w.Header().Set("Upload-Offset", fmt.Sprint(upload.offset()))
+	w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+
+	if read_err != io.EOF {
+		slog.Warn("tus upload interrupted", slog.String("id", id), slog.Any("err", read_err))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE. Stop upload and remove unfinished file.
+func (h Handler) TusDelete(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Tus delete request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	id, upload, ok := h.tusUpload(w, r, "Handlers.TusDelete")
+	if !ok {
+		return
+	}
+
+	upload.mux.Lock()
+	defer upload.mux.Unlock()
+
+	h.tusUploads.remove(id)
+	upload.freeBuffer()
+
+	// Empty files don't have connection
+	if upload.conn.UUID == "" {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Finished files are not removed
+	_, err := h.dataServiceClient.CloseConnection(r.Context(), &pb.CloseConnectionRequest{
+		UUID:   upload.conn.UUID,
+		Remove: upload.offset() < upload.conn.Size,
+	})
+	if err != nil && status.Convert(err).Message() != data.ErrConnectionNotFound.Error() {
+		handleServiceError(err, w, "data.CloseConnection")
+		return
+	}
+
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,261 @@
+package datahttp
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	"github.com/braginantonev/mhserver/pkg/httpjsonutils"
+	pb "github.com/braginantonev/mhserver/proto/data"
+)
+
+var (
+	// Extensions of already compressed files. They are saved to zip with STORE method,
+	// because deflate wastes cpu on them without any result.
+	compressedExtensions = map[string]bool{
+		// Images
+		".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".heif": true, ".avif": true,
+		// Audio
+		".mp3": true, ".aac": true, ".ogg": true, ".opus": true, ".flac": true, ".m4a": true,
+		// Video
+		".mp4": true, ".mkv": true, ".webm": true, ".mov": true, ".avi": true,
+		// Archives and packages
+		".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".7z": true, ".rar": true, ".zst": true, ".apk": true, ".jar": true,
+		// Documents (zip inside)
+		".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".ods": true, ".epub": true,
+	}
+)
+
+type ZipRequest struct {
+	// Files ("/docs/cv.pdf") and directories ("/photos/") to save in archive
+	Paths []string `json:"paths"`
+}
+
+type zipEntry struct {
+	dir, name string // file location on server
+	zip_name  string // file name in archive
+	is_dir    bool
+	mod_time  uint64
+}
+
+func zipMethod(filename string) uint16 {
+	if compressedExtensions[strings.ToLower(path.Ext(filename))] {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// Split "/dir/file.txt" to "/dir/" and "file.txt". Directories ("/dir/") have empty name.
+func splitFilePath(file_path string) (string, string) {
+	i := strings.LastIndex(file_path, "/")
+	return file_path[:i+1], file_path[i+1:]
+}
+
+// Recursive walk of directory with GetFiles
+func (h Handler) walkDir(ctx context.Context, username, dir, zip_prefix string, entries []zipEntry) ([]zipEntry, error) {
+	files, err := h.dataServiceClient.GetFiles(ctx, &pb.Directory{
+		User:  username,
+		Value: dir,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files.Value {
+		entry := zipEntry{
+			dir:      dir,
+			name:     file.Name,
+			zip_name: zip_prefix + file.Name,
+			is_dir:   file.IsDir,
+			mod_time: file.ModTime,
+		}
+
+		if !file.IsDir {
+			entries = append(entries, entry)
+			continue
+		}
+
+		// Directory entry saves empty directories in archive
+		entry.zip_name += "/"
+		entries = append(entries, entry)
+
+		entries, err = h.walkDir(ctx, username, dir+file.Name+"/", entry.zip_name, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// Collect files to archive. Errors are returned before response is started.
+func (h Handler) collectZipEntries(ctx context.Context, username string, paths []string) ([]zipEntry, error) {
+	entries := make([]zipEntry, 0, len(paths))
+	for _, file_path := range paths {
+		dir, name := splitFilePath(file_path)
+
+		// Directory
+		if name == "" {
+			var prefix string
+			if dir != "/" {
+				prefix = path.Base(dir) + "/"
+				entries = append(entries, zipEntry{zip_name: prefix, is_dir: true})
+			}
+
+			var err error
+			entries, err = h.walkDir(ctx, username, dir, prefix, entries)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// File. Check that file exists with list of his directory.
+		files, err := h.dataServiceClient.GetFiles(ctx, &pb.Directory{
+			User:  username,
+			Value: dir,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, file := range files.Value {
+			if file.Name == name && !file.IsDir {
+				entries = append(entries, zipEntry{
+					dir:      dir,
+					name:     name,
+					zip_name: name,
+					mod_time: file.ModTime,
+				})
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, ErrFileNotFound
+		}
+	}
+
+	return entries, nil
+}
+
+// Read file from data service by chunks and write him to w
+func (h Handler) copyFile(ctx context.Context, w io.Writer, username, dir, filename string) error {
+	conn, err := h.dataServiceClient.CreateConnection(ctx, &pb.ConnectionRequest{
+		Username:  username,
+		Mode:      pb.ConnectionMode_RDONLY,
+		Directory: dir,
+		Filename:  filename,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer h.closeConnection(ctx, conn.UUID)
+
+	_, err = io.Copy(w, newChunkReader(ctx, h.dataServiceClient, conn))
+	return err
+}
+
+/*
+Stream zip archive of directory (GET, "dir" param) or list of paths (POST, json body) directly to response.
+Files are read by chunks through data service, so semaphore memory limits still work.
+*/
+func (h Handler) DownloadZip(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Download zip request", slog.String("method", r.Method), slog.String("ip", r.RemoteAddr))
+
+	w.Header().Add("Content-Type", "text/plain")
+
+	if h.dataServiceClient == nil {
+		ErrUnavailable.Write(w)
+		return
+	}
+
+	username, ok := r.Context().Value(httpcontextkeys.USERNAME).(string)
+	if !ok {
+		ErrWrongContextUsername.WithFuncName("Handlers.DownloadZip").Write(w)
+		return
+	}
+
+	var paths []string
+	if r.Method == http.MethodPost {
+		var req ZipRequest
+		if err := httpjsonutils.ConvertJsonToStruct(&req, r.Body, "Handlers.DownloadZip"); err != nil {
+			err.Write(w)
+			return
+		}
+		paths = req.Paths
+	} else {
+		paths = []string{r.URL.Query().Get("dir")}
+		if !strings.HasSuffix(paths[0], "/") {
+			ErrBadPath.Write(w)
+			return
+		}
+	}
+
+	if len(paths) == 0 {
+		ErrEmptyPathsList.Write(w)
+		return
+	}
+
+	entries, err := h.collectZipEntries(r.Context(), username, paths)
+	if err != nil {
+		handleServiceError(err, w, "data.GetFiles")
+		return
+	}
+
+	archive_name := "files.zip"
+	if len(paths) == 1 && paths[0] != "/" {
+		archive_name = path.Base(paths[0]) + ".zip"
+	}
+
+	// Archive can be streamed longer than server write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archive_name}))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:     entry.zip_name,
+			Method:   zipMethod(entry.name),
+			Modified: time.Unix(int64(entry.mod_time), 0),
+		}
+
+		if entry.is_dir {
+			header.Method = zip.Store
+		}
+
+		file_writer, err := zw.CreateHeader(header)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed create zip header", slog.Any("err", err))
+			return
+		}
+
+		if entry.is_dir {
+			continue
+		}
+
+		// Response already started, so error can be only logged. Client gets broken archive.
+		if err := h.copyFile(r.Context(), file_writer, username, entry.dir, entry.name); err != nil {
+			slog.ErrorContext(r.Context(), "failed write file to zip", slog.String("file", fmt.Sprint(entry.dir, entry.name)), slog.Any("err", err))
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "failed close zip", slog.Any("err", err))
+	}
+}
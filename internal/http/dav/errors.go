@@ -0,0 +1,16 @@
+package davhttp
+
+import (
+	"net/http"
+
+	"github.com/braginantonev/mhserver/pkg/httperror"
+)
+
+var (
+	ErrInternal          = httperror.NewInternalHttpError("", "")
+	ErrUserNotAuthorized = httperror.NewExternalHttpError("user not authorized", http.StatusUnauthorized)
+	ErrWrongCredentials  = httperror.NewExternalHttpError("wrong username or password", http.StatusUnauthorized)
+	ErrNotEnoughRights   = httperror.NewExternalHttpError("not enough rights", http.StatusForbidden)
+	ErrLoginLocked       = httperror.NewExternalHttpError("too many failed login attempts, try later", http.StatusTooManyRequests)
+	ErrNotEnoughSpace    = httperror.NewExternalHttpError("not enough disk space", http.StatusInsufficientStorage)
+)
@@ -0,0 +1,305 @@
+// Пакет для доступа к файлам пользователей по WebDAV.
+package davhttp
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	"github.com/braginantonev/mhserver/internal/repository/userfs"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	REALM string = "MHServer"
+
+	// WebDAV clients send password with every request, so checked passwords are cached.
+	// Cache is used only while password of user isn't changed, role and state are read on every request.
+	CREDENTIALS_LIFETIME time.Duration = 5 * time.Minute
+)
+
+// Implemented by auth.AuthService
+type PasswordChecker interface {
+	CheckPassword(user auth.User, source auth.LoginSource) error
+	UserAccess(name string) (auth.Role, int64, error)
+	CheckLockout(name string) error
+}
+
+type cachedCredentials struct {
+	password [sha256.Size]byte
+	expires  time.Time
+
+	// Time of last password change, when password was checked
+	tokensAfter int64
+}
+
+// Methods, which don't change files. Guests can use only them.
+var readMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+}
+
+type Handler struct {
+	prefix        string
+	workspacePath string
+	checker       PasswordChecker
+
+	// Nil, if encryption is disabled
+	keyring *filecrypt.KeyRing
+
+	// Changes journal of files service
+	journal *journal.Journal
+
+	// Every user has his own locks, because paths are relative to user root
+	locks       map[string]webdav.LockSystem
+	credentials map[string]cachedCredentials
+	mux         *sync.Mutex
+}
+
+func NewHandler(prefix, workspace_path string, checker PasswordChecker, enc_cfg config.EncryptionConfig) *Handler {
+	h := &Handler{
+		prefix:        prefix,
+		workspacePath: workspace_path,
+		checker:       checker,
+		journal:       journal.New(workspace_path, data.SERVICE_NAME),
+		locks:         make(map[string]webdav.LockSystem),
+		credentials:   make(map[string]cachedCredentials),
+		mux:           &sync.Mutex{},
+	}
+
+	if enc_cfg.Enabled {
+		master_key, err := filecrypt.ParseMasterKey(enc_cfg.MasterKey)
+		if err != nil {
+			// Config is checked on load, so that's shouldn't happen
+			slog.Error("failed parse encryption master key. WebDAV encryption disabled!", slog.Any("err", err))
+		} else {
+			h.keyring = filecrypt.NewKeyRing(workspace_path, master_key)
+		}
+	}
+
+	return h
+}
+
+// Check password and return role of user. Ip address is saved to audit log of logins.
+func (h *Handler) checkCredentials(username, password, ip string) (auth.Role, error) {
+	password_hash := sha256.Sum256([]byte(password))
+
+	// Account is read before password check, so password changed during check isn't cached.
+	// Disabled and deleted users aren't taken from cache, they get error of password check.
+	role, tokens_after, access_err := h.checker.UserAccess(username)
+	if errors.Is(access_err, auth.ErrInternal) {
+		return "", access_err
+	}
+
+	h.mux.Lock()
+	cached, ok := h.credentials[username]
+	h.mux.Unlock()
+
+	if access_err == nil && ok && time.Now().Before(cached.expires) && cached.tokensAfter == tokens_after &&
+		subtle.ConstantTimeCompare(cached.password[:], password_hash[:]) == 1 {
+		// Cached password is refused too, while username is locked
+		if err := h.checker.CheckLockout(username); err != nil {
+			return "", err
+		}
+		return role, nil
+	}
+
+	if err := h.checker.CheckPassword(auth.NewUser(username, password), auth.LoginSource{Method: auth.LOGIN_METHOD_WEBDAV, IP: ip}); err != nil {
+		return "", err
+	}
+
+	// User was created or enabled during password check
+	if access_err != nil {
+		return "", access_err
+	}
+
+	h.mux.Lock()
+	h.credentials[username] = cachedCredentials{
+		password:    password_hash,
+		expires:     time.Now().Add(CREDENTIALS_LIFETIME),
+		tokensAfter: tokens_after,
+	}
+	h.mux.Unlock()
+
+	return role, nil
+}
+
+// Request body, which counts read bytes, so reserved space is released during upload
+type countingBody struct {
+	io.ReadCloser
+	read atomic.Uint64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read.Add(uint64(n))
+	return n, err
+}
+
+/*
+Check, that disk has space for uploaded file besides space of other uploads,
+and reserve it until ctx is done, so other writes don't take it. Return false, if space isn't enough.
+*/
+func (h *Handler) reserveSpace(ctx context.Context, r *http.Request) (bool, error) {
+	size := uint64(r.ContentLength)
+	if h.keyring != nil {
+		size = filecrypt.Header{ChunkSize: userfs.ENCRYPTED_CHUNK_SIZE, Size: size}.DiskSize()
+	}
+
+	has_space, err := freemem.HasSpace(h.workspacePath, size)
+	if err != nil || !has_space {
+		return false, err
+	}
+
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
+	freemem.AddReservation(ctx, func() uint64 {
+		return size - min(size, body.read.Load())
+	})
+	return true, nil
+}
+
+func (h *Handler) lockSystem(username string) webdav.LockSystem {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	ls, ok := h.locks[username]
+	if !ok {
+		ls = webdav.NewMemLS()
+		h.locks[username] = ls
+	}
+	return ls
+}
+
+func (h *Handler) fileSystem(username, root string) (webdav.FileSystem, error) {
+	var aead cipher.AEAD
+	if h.keyring != nil {
+		var err error
+		if aead, err = h.keyring.UserCipher(username); err != nil {
+			return nil, err
+		}
+	}
+
+	return userfs.WithJournal(userfs.New(root, aead), h.journal, username), nil
+}
+
+// Ip address of client. Server can work behind reverse proxy, so X-Forwarded-For is preferred.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ip, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(ip)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username == "" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, REALM))
+		ErrUserNotAuthorized.Write(w)
+		return
+	}
+
+	role, err := h.checkCredentials(username, password, clientIP(r))
+	if err != nil {
+		if errors.Is(err, auth.ErrInternal) {
+			ErrInternal.WithFuncName("auth.CheckPassword").Write(w)
+			return
+		}
+
+		var locked *auth.LoginLockedError
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", strconv.FormatInt(locked.RetryAfter, 10))
+			ErrLoginLocked.Write(w)
+			return
+		}
+
+		slog.Info("WebDAV wrong credentials", slog.String("user", username), slog.String("ip", r.RemoteAddr))
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, REALM))
+		ErrWrongCredentials.Write(w)
+		return
+	}
+
+	root, err := dirs.GetDataPath(h.workspacePath, username, "/", data.SERVICE_NAME)
+	if err != nil {
+		ErrInternal.WithFuncName("dirs.GetDataPath").Write(w)
+		return
+	}
+
+	read_only := !role.Allows(auth.ROLE_USER)
+	if read_only && !readMethods[r.Method] {
+		ErrNotEnoughRights.Write(w)
+		return
+	}
+
+	fs, err := h.fileSystem(username, root)
+	if err != nil {
+		ErrInternal.WithFuncName("Handler.fileSystem").Write(w)
+		return
+	}
+
+	if read_only {
+		fs = userfs.ReadOnly(fs)
+	} else {
+		fs = userfs.WithSpaceCheck(fs, h.workspacePath)
+	}
+
+	// Clients usually send size of file, so upload without space is refused before it starts
+	if r.Method == http.MethodPut && r.ContentLength > 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		has_space, err := h.reserveSpace(ctx, r)
+		if err != nil {
+			ErrInternal.WithFuncName("Handler.reserveSpace").Write(w)
+			return
+		}
+
+		if !has_space {
+			ErrNotEnoughSpace.Write(w)
+			return
+		}
+	}
+
+	// Files can be transferred longer than server timeouts
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	dav := &webdav.Handler{
+		Prefix:     h.prefix,
+		FileSystem: fs,
+		LockSystem: h.lockSystem(username),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				slog.Debug("WebDAV request failed", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Any("err", err))
+			}
+		},
+	}
+	dav.ServeHTTP(w, r)
+}
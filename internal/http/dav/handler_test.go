@@ -0,0 +1,488 @@
+package davhttp_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	davhttp "github.com/braginantonev/mhserver/internal/http/dav"
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+	"github.com/braginantonev/mhserver/internal/server"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+)
+
+const (
+	TEST_WORKSPACE_PATH string = "/tmp/mhserver_tests/dav/"
+	TEST_USERNAME       string = "mayuri"
+	TEST_GUEST          string = "faris"
+	TEST_PASSWORD       string = "tuturu"
+	TEST_FILE_BODY      string = "hello world!"
+	TEST_MASTER_KEY     string = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+type passwordChecker struct {
+	calls       int
+	tokensAfter int64
+
+	// Users, whose role was changed by administrator
+	roles    map[string]auth.Role
+	disabled bool
+
+	// Seconds until lockout ends, 0 if user isn't locked
+	lockedFor int64
+}
+
+func (c *passwordChecker) CheckPassword(user auth.User, source auth.LoginSource) error {
+	c.calls += 1
+	if user.Name != TEST_USERNAME && user.Name != TEST_GUEST {
+		return auth.ErrUserNotExist
+	}
+
+	if user.Password != TEST_PASSWORD {
+		return auth.ErrWrongPassword
+	}
+
+	if c.disabled {
+		return auth.ErrUserDisabled
+	}
+	return nil
+}
+
+func (c *passwordChecker) CheckLockout(name string) error {
+	if c.lockedFor > 0 {
+		return &auth.LoginLockedError{RetryAfter: c.lockedFor}
+	}
+	return nil
+}
+
+func (c *passwordChecker) UserAccess(name string) (auth.Role, int64, error) {
+	if name != TEST_USERNAME && name != TEST_GUEST {
+		return "", 0, auth.ErrUserNotExist
+	}
+
+	if c.disabled {
+		return "", 0, auth.ErrUserDisabled
+	}
+
+	if role, ok := c.roles[name]; ok {
+		return role, c.tokensAfter, nil
+	}
+
+	if name == TEST_GUEST {
+		return auth.ROLE_GUEST, c.tokensAfter, nil
+	}
+	return auth.ROLE_USER, c.tokensAfter, nil
+}
+
+type TestCase struct {
+	name          string
+	method        string
+	path          string
+	username      string
+	password      string
+	headers       map[string]string
+	body          string
+	expected_code int
+	expected_body string
+}
+
+func doRequest(t *testing.T, handler http.Handler, test TestCase) (int, string) {
+	req := httptest.NewRequest(test.method, server.DAV_ENDPOINT+test.path, strings.NewReader(test.body))
+	if test.username != "" {
+		req.SetBasicAuth(test.username, test.password)
+	}
+
+	for key, value := range test.headers {
+		req.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func testHandler(t *testing.T, enc_cfg config.EncryptionConfig) {
+	if err := os.RemoveAll(TEST_WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_USERNAME+"/files", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := &passwordChecker{}
+	handler := davhttp.NewHandler(server.DAV_ENDPOINT, TEST_WORKSPACE_PATH, checker, enc_cfg)
+
+	cases := []TestCase{
+		{
+			name:          "without auth",
+			method:        "PROPFIND",
+			path:          "/",
+			expected_code: http.StatusUnauthorized,
+			expected_body: davhttp.ErrUserNotAuthorized.Description(),
+		},
+		{
+			name:          "wrong password",
+			method:        "PROPFIND",
+			path:          "/",
+			username:      TEST_USERNAME,
+			password:      "el psy kongroo",
+			expected_code: http.StatusUnauthorized,
+			expected_body: davhttp.ErrWrongCredentials.Description(),
+		},
+		{
+			name:          "create dir",
+			method:        "MKCOL",
+			path:          "/lab",
+			expected_code: http.StatusCreated,
+		},
+		{
+			name:          "create dir with bad name",
+			method:        "MKCOL",
+			path:          "/lab!",
+			expected_code: http.StatusMethodNotAllowed,
+		},
+		{
+			name:          "put file",
+			method:        http.MethodPut,
+			path:          "/lab/gadget.txt",
+			body:          TEST_FILE_BODY,
+			expected_code: http.StatusCreated,
+		},
+		{
+			name:          "put file with bad name",
+			method:        http.MethodPut,
+			path:          "/lab/gadget!.txt",
+			body:          TEST_FILE_BODY,
+			expected_code: http.StatusNotFound,
+		},
+		{
+			name:          "get file",
+			method:        http.MethodGet,
+			path:          "/lab/gadget.txt",
+			expected_code: http.StatusOK,
+			expected_body: TEST_FILE_BODY,
+		},
+		{
+			name:          "get file range",
+			method:        http.MethodGet,
+			path:          "/lab/gadget.txt",
+			headers:       map[string]string{"Range": "bytes=6-"},
+			expected_code: http.StatusPartialContent,
+			expected_body: TEST_FILE_BODY[6:],
+		},
+		{
+			name:          "list dir",
+			method:        "PROPFIND",
+			path:          "/lab/",
+			headers:       map[string]string{"Depth": "1"},
+			expected_code: http.StatusMultiStatus,
+			expected_body: fmt.Sprintf("<D:getcontentlength>%d</D:getcontentlength>", len(TEST_FILE_BODY)),
+		},
+		{
+			name:          "move file with bad name",
+			method:        "MOVE",
+			path:          "/lab/gadget.txt",
+			headers:       map[string]string{"Destination": server.DAV_ENDPOINT + "/lab/gadget!.txt"},
+			expected_code: http.StatusForbidden,
+		},
+		{
+			name:          "move file",
+			method:        "MOVE",
+			path:          "/lab/gadget.txt",
+			headers:       map[string]string{"Destination": server.DAV_ENDPOINT + "/lab/phone microwave.txt"},
+			expected_code: http.StatusCreated,
+		},
+		{
+			name:          "get moved file",
+			method:        http.MethodGet,
+			path:          "/lab/phone%20microwave.txt",
+			expected_code: http.StatusOK,
+			expected_body: TEST_FILE_BODY,
+		},
+		{
+			name:          "delete dir",
+			method:        http.MethodDelete,
+			path:          "/lab/",
+			expected_code: http.StatusNoContent,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if test.username == "" && test.expected_code != http.StatusUnauthorized {
+				test.username, test.password = TEST_USERNAME, TEST_PASSWORD
+			}
+
+			code, body := doRequest(t, handler, test)
+			if code != test.expected_code {
+				t.Fatalf("expected code %d, but got %d; body: %s", test.expected_code, code, body)
+			}
+
+			if !strings.Contains(body, test.expected_body) {
+				t.Fatalf("expected body contains: `%s`\nbut got: `%s`", test.expected_body, body)
+			}
+		})
+	}
+
+	// Password must be checked once, other requests use cache
+	if checker.calls != 2 {
+		t.Errorf("expected 2 password checks, but got %d", checker.calls)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	testHandler(t, config.EncryptionConfig{})
+}
+
+func TestHandlerWithEncryption(t *testing.T) {
+	testHandler(t, config.EncryptionConfig{
+		Enabled:   true,
+		MasterKey: TEST_MASTER_KEY,
+	})
+
+	t.Run("file is encrypted on disk", func(t *testing.T) {
+		if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_USERNAME+"/files", 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		handler := davhttp.NewHandler(server.DAV_ENDPOINT, TEST_WORKSPACE_PATH, &passwordChecker{}, config.EncryptionConfig{
+			Enabled:   true,
+			MasterKey: TEST_MASTER_KEY,
+		})
+
+		code, body := doRequest(t, handler, TestCase{
+			method:   http.MethodPut,
+			path:     "/secret.txt",
+			username: TEST_USERNAME,
+			password: TEST_PASSWORD,
+			body:     TEST_FILE_BODY,
+		})
+		if code != http.StatusCreated {
+			t.Fatalf("expected code %d, but got %d; body: %s", http.StatusCreated, code, body)
+		}
+
+		on_disk, err := os.ReadFile(TEST_WORKSPACE_PATH + TEST_USERNAME + "/files/secret.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes.Contains(on_disk, []byte(TEST_FILE_BODY)) {
+			t.Fatal("file saved without encryption")
+		}
+	})
+}
+
+func TestGuest(t *testing.T) {
+	if err := os.RemoveAll(TEST_WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_GUEST+"/files/lab", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(TEST_WORKSPACE_PATH+TEST_GUEST+"/files/lab/gadget.txt", []byte(TEST_FILE_BODY), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := davhttp.NewHandler(server.DAV_ENDPOINT, TEST_WORKSPACE_PATH, &passwordChecker{}, config.EncryptionConfig{})
+
+	cases := []TestCase{
+		{
+			name:          "get file",
+			method:        http.MethodGet,
+			path:          "/lab/gadget.txt",
+			expected_code: http.StatusOK,
+			expected_body: TEST_FILE_BODY,
+		},
+		{
+			name:          "list dir",
+			method:        "PROPFIND",
+			path:          "/lab/",
+			headers:       map[string]string{"Depth": "1"},
+			expected_code: http.StatusMultiStatus,
+		},
+		{
+			name:          "put file",
+			method:        http.MethodPut,
+			path:          "/lab/new.txt",
+			body:          TEST_FILE_BODY,
+			expected_code: http.StatusForbidden,
+			expected_body: davhttp.ErrNotEnoughRights.Description(),
+		},
+		{
+			name:          "create dir",
+			method:        "MKCOL",
+			path:          "/lab2",
+			expected_code: http.StatusForbidden,
+		},
+		{
+			name:          "delete file",
+			method:        http.MethodDelete,
+			path:          "/lab/gadget.txt",
+			expected_code: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			test.username, test.password = TEST_GUEST, TEST_PASSWORD
+
+			code, body := doRequest(t, handler, test)
+			if code != test.expected_code {
+				t.Fatalf("expected code %d, but got %d; body: %s", test.expected_code, code, body)
+			}
+
+			if !strings.Contains(body, test.expected_body) {
+				t.Fatalf("expected body contains: `%s`\nbut got: `%s`", test.expected_body, body)
+			}
+		})
+	}
+
+	if _, err := os.Stat(TEST_WORKSPACE_PATH + TEST_GUEST + "/files/lab/gadget.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCredentialsCache(t *testing.T) {
+	if err := os.RemoveAll(TEST_WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_USERNAME+"/files", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := &passwordChecker{}
+	handler := davhttp.NewHandler(server.DAV_ENDPOINT, TEST_WORKSPACE_PATH, checker, config.EncryptionConfig{})
+
+	request := TestCase{
+		method:   "PROPFIND",
+		path:     "/",
+		username: TEST_USERNAME,
+		password: TEST_PASSWORD,
+	}
+
+	expectCode := func(t *testing.T, expected_code int) {
+		t.Helper()
+		if code, body := doRequest(t, handler, request); code != expected_code {
+			t.Fatalf("expected code %d, but got %d; body: %s", expected_code, code, body)
+		}
+	}
+
+	expectCode(t, http.StatusMultiStatus)
+	expectCode(t, http.StatusMultiStatus)
+	if checker.calls != 1 {
+		t.Fatalf("expected 1 password check, but got %d", checker.calls)
+	}
+
+	t.Run("password change", func(t *testing.T) {
+		checker.tokensAfter = 1760000000000
+
+		expectCode(t, http.StatusMultiStatus)
+		if checker.calls != 2 {
+			t.Errorf("cached password is used after password change")
+		}
+	})
+
+	t.Run("role change", func(t *testing.T) {
+		checker.roles = map[string]auth.Role{TEST_USERNAME: auth.ROLE_GUEST}
+		defer func() { checker.roles = nil }()
+
+		code, body := doRequest(t, handler, TestCase{
+			method:   "MKCOL",
+			path:     "/lab",
+			username: TEST_USERNAME,
+			password: TEST_PASSWORD,
+		})
+		if code != http.StatusForbidden {
+			t.Errorf("expected code %d for user with guest role, but got %d; body: %s", http.StatusForbidden, code, body)
+		}
+	})
+
+	t.Run("locked user", func(t *testing.T) {
+		checker.lockedFor = 60
+		defer func() { checker.lockedFor = 0 }()
+
+		req := httptest.NewRequest("PROPFIND", server.DAV_ENDPOINT+"/", nil)
+		req.SetBasicAuth(TEST_USERNAME, TEST_PASSWORD)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected code %d with Retry-After, but got %d: %v", http.StatusTooManyRequests, w.Code, w.Header())
+		}
+	})
+
+	t.Run("disabled user", func(t *testing.T) {
+		checker.disabled = true
+		defer func() { checker.disabled = false }()
+
+		expectCode(t, http.StatusUnauthorized)
+	})
+}
+
+func TestNotEnoughSpace(t *testing.T) {
+	if err := os.RemoveAll(TEST_WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_USERNAME+"/files", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := davhttp.NewHandler(server.DAV_ENDPOINT, TEST_WORKSPACE_PATH, &passwordChecker{}, config.EncryptionConfig{})
+
+	// Size of file is larger than any disk
+	req := httptest.NewRequest(http.MethodPut, server.DAV_ENDPOINT+"/huge.bin", strings.NewReader(TEST_FILE_BODY))
+	req.ContentLength = 1 << 60
+	req.SetBasicAuth(TEST_USERNAME, TEST_PASSWORD)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected code %d, but got %d; body: %s", http.StatusInsufficientStorage, w.Code, w.Body.String())
+	}
+
+	if _, err := os.Stat(TEST_WORKSPACE_PATH + TEST_USERNAME + "/files/huge.bin"); !os.IsNotExist(err) {
+		t.Errorf("expected file isn't created, but got: %v", err)
+	}
+
+	t.Run("space taken during upload", func(t *testing.T) {
+		release := freemem.Reserve(1 << 60)
+		defer release()
+
+		// Size is unknown, so space is checked on write
+		req := httptest.NewRequest(http.MethodPut, server.DAV_ENDPOINT+"/chunked.bin", strings.NewReader(TEST_FILE_BODY))
+		req.ContentLength = -1
+		req.SetBasicAuth(TEST_USERNAME, TEST_PASSWORD)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code < 400 {
+			t.Fatalf("expected failed upload, but got %d", w.Code)
+		}
+
+		if _, err := os.Stat(TEST_WORKSPACE_PATH + TEST_USERNAME + "/files/chunked.bin"); !os.IsNotExist(err) {
+			t.Errorf("expected incomplete file is removed, but got: %v", err)
+		}
+	})
+}
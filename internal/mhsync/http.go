@@ -0,0 +1,105 @@
+package mhsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/braginantonev/mhserver/pkg/client"
+)
+
+// Remote, which works with server through HTTP API
+type HTTPRemote struct {
+	client *client.Client
+}
+
+func NewHTTPRemote(c *client.Client) *HTTPRemote {
+	return &HTTPRemote{client: c}
+}
+
+// Server errors "file not exist" and "directory not found" are returned as ErrNotExist
+func notExist(err error) error {
+	if errors.Is(err, client.ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotExist, err)
+	}
+	return err
+}
+
+func (h *HTTPRemote) Cursor(ctx context.Context) (uint64, error) {
+	changes, err := h.client.Changes(ctx, nil, 0)
+	return changes.Cursor, err
+}
+
+func (h *HTTPRemote) List(ctx context.Context, dir string) ([]Entry, error) {
+	files, err := h.client.List(ctx, dir)
+	if err != nil {
+		return nil, notExist(err)
+	}
+
+	entries := make([]Entry, 0, len(files))
+	for _, file := range files {
+		entry := Entry{
+			Path:    dir + file.Name,
+			IsDir:   file.IsDir,
+			Size:    file.Size,
+			ModTime: file.ModTime,
+		}
+
+		if entry.IsDir {
+			entry.Path += "/"
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (h *HTTPRemote) Same(ctx context.Context, file_path string, file *os.File) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	_, same, err := h.client.Compare(ctx, file_path, file, info.Size())
+	return same, notExist(err)
+}
+
+func (h *HTTPRemote) Upload(ctx context.Context, file_path string, file *os.File) (Entry, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	conn, err := h.client.Upload(ctx, file_path, file, info.Size(), nil)
+	if errors.Is(err, client.ErrSumMismatch) {
+		return Entry{}, ErrSumMismatch
+	} else if err != nil {
+		return Entry{}, notExist(err)
+	}
+	return Entry{Path: file_path, Size: conn.Size, ModTime: conn.ModTime}, nil
+}
+
+func (h *HTTPRemote) Download(ctx context.Context, file_path string, file *os.File) (Entry, error) {
+	conn, err := h.client.DownloadTo(ctx, file_path, file, nil)
+	if errors.Is(err, client.ErrSumMismatch) {
+		return Entry{}, ErrSumMismatch
+	} else if err != nil {
+		return Entry{}, notExist(err)
+	}
+	return Entry{Path: file_path, Size: conn.Size, ModTime: conn.ModTime}, nil
+}
+
+func (h *HTTPRemote) Mkdir(ctx context.Context, dir string) error {
+	if err := h.client.Mkdir(ctx, dir); !errors.Is(err, client.ErrAlreadyExist) {
+		return err
+	}
+	return nil
+}
+
+func (h *HTTPRemote) Rmdir(ctx context.Context, dir string) error {
+	return notExist(h.client.Rmdir(ctx, dir))
+}
+
+func (h *HTTPRemote) Remove(ctx context.Context, file_path string) error {
+	return notExist(h.client.Remove(ctx, file_path))
+}
@@ -0,0 +1,44 @@
+package mhsync
+
+import (
+	"context"
+	"os"
+)
+
+// File or directory on server or on local disk
+type Entry struct {
+	// Path from root of files workspace ("/docs/cv.pdf"). Directories end with "/".
+	Path  string
+	IsDir bool
+	Size  uint64
+
+	// Unix time in seconds for remote files and in nanoseconds for local ones
+	ModTime uint64
+}
+
+// User files on server
+type Remote interface {
+	// Current journal cursor. It is changed after each change of user files.
+	Cursor(ctx context.Context) (uint64, error)
+
+	// Files and directories in directory (not recursive)
+	List(ctx context.Context, dir string) ([]Entry, error)
+
+	// Save local file to server and verify saved chunks. Return saved file info.
+	Upload(ctx context.Context, file_path string, file *os.File) (Entry, error)
+
+	// Write remote file to local file and verify received chunks. Return downloaded file info.
+	Download(ctx context.Context, file_path string, file *os.File) (Entry, error)
+
+	// Check, that remote file has the same content as local file
+	Same(ctx context.Context, file_path string, file *os.File) (bool, error)
+
+	// Create directory. Existing directory isn't an error.
+	Mkdir(ctx context.Context, dir string) error
+
+	// Remove directory with all files. ErrNotExist is returned, if directory doesn't exist.
+	Rmdir(ctx context.Context, dir string) error
+
+	// Remove file. ErrNotExist is returned, if file doesn't exist.
+	Remove(ctx context.Context, file_path string) error
+}
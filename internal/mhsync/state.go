@@ -0,0 +1,110 @@
+package mhsync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+State of file after last sync. Modification times of local and remote files differ, so both sides are saved:
+change on each side is found by comparing with its own state.
+Local modification time is in nanoseconds, remote - in seconds, like server returns.
+*/
+type FileState struct {
+	IsDir         bool   `json:"isDir,omitempty"`
+	LocalSize     uint64 `json:"localSize,omitempty"`
+	LocalModTime  uint64 `json:"localModTime,omitempty"`
+	RemoteSize    uint64 `json:"remoteSize,omitempty"`
+	RemoteModTime uint64 `json:"remoteModTime,omitempty"`
+}
+
+// Local state database. Saved as json file.
+type State struct {
+	// Journal cursor of server after last full sync. Remote files aren't listed, while cursor isn't changed.
+	Cursor uint64 `json:"cursor"`
+
+	// Time of last sync. Zero for new state.
+	Time int64 `json:"time"`
+
+	// Synced files and directories by path ("/docs/cv.pdf", "/docs/")
+	Files map[string]FileState `json:"files"`
+
+	path string
+}
+
+// Load state from file. If file doesn't exist, new state is returned.
+func LoadState(state_path string) (*State, error) {
+	state := &State{
+		Files: make(map[string]FileState),
+		path:  state_path,
+	}
+
+	data, err := os.ReadFile(state_path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.Join(ErrBadState, err)
+	}
+
+	if state.Files == nil {
+		state.Files = make(map[string]FileState)
+	}
+	return state, nil
+}
+
+// Save state to temp file and replace old one, so state isn't lost on crash
+func (s *State) Save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+"*"+TEMP_FILE_SUFFIX)
+	if err != nil {
+		return err
+	}
+
+	_, err = temp.Write(data)
+	if close_err := temp.Close(); err == nil {
+		err = close_err
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), s.path)
+	}
+
+	if err != nil {
+		_ = os.Remove(temp.Name())
+	}
+	return err
+}
+
+// Remove files and directory itself from state
+func (s *State) removeTree(dir string) {
+	for file_path := range s.Files {
+		if strings.HasPrefix(file_path, dir) {
+			delete(s.Files, file_path)
+		}
+	}
+}
+
+// Remote files known after last sync
+func (s *State) remoteEntries() map[string]Entry {
+	entries := make(map[string]Entry, len(s.Files))
+	for file_path, file := range s.Files {
+		entries[file_path] = Entry{
+			Path:    file_path,
+			IsDir:   file.IsDir,
+			Size:    file.RemoteSize,
+			ModTime: file.RemoteModTime,
+		}
+	}
+	return entries
+}
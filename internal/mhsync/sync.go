@@ -0,0 +1,686 @@
+// Пакет с двусторонней синхронизацией локальной папки с файлами пользователя на сервере (клиент mhsync).
+package mhsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+)
+
+const (
+	DEFAULT_INTERVAL time.Duration = 30 * time.Second
+
+	// State is saved in root of local folder by default
+	STATE_FILENAME string = ".mhsync.json"
+
+	// Downloaded files and state are written to temp files first. Such files aren't synced.
+	TEMP_FILE_SUFFIX string = ".mhsync-tmp"
+)
+
+var (
+	ErrNotExist     = errors.New("file not exist")
+	ErrNotDir       = errors.New("local path is not a directory")
+	ErrBadState     = errors.New("state file is damaged")
+	ErrSumMismatch  = errors.New("chunk sum mismatch")
+	ErrLocalChanged = errors.New("local file was changed while syncing")
+	ErrTypeMismatch = errors.New("file and directory have the same path")
+	ErrSyncFailed   = errors.New("some files weren't synced")
+)
+
+// Symbols, which are removed from device name in conflict copy name
+var deviceRegexp = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+type Config struct {
+	// Local folder, which is synced with root of files workspace
+	LocalPath string
+
+	// Path of state file. Default is STATE_FILENAME in local folder.
+	StatePath string
+
+	// Device name in conflict copies names. Default is hostname.
+	Device string
+
+	// Sync interval of continuous mode
+	Interval time.Duration
+}
+
+type Syncer struct {
+	cfg    Config
+	remote Remote
+	state  *State
+
+	// Path of state file, if it is in local folder
+	state_file string
+}
+
+func New(cfg Config, remote Remote) (*Syncer, error) {
+	local_path, err := filepath.Abs(cfg.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(local_path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, ErrNotDir
+	}
+	cfg.LocalPath = local_path
+
+	if cfg.StatePath == "" {
+		cfg.StatePath = filepath.Join(local_path, STATE_FILENAME)
+	}
+
+	if cfg.StatePath, err = filepath.Abs(cfg.StatePath); err != nil {
+		return nil, err
+	}
+
+	if cfg.Device == "" {
+		cfg.Device, _ = os.Hostname()
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = DEFAULT_INTERVAL
+	}
+
+	state, err := LoadState(cfg.StatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Syncer{
+		cfg:    cfg,
+		remote: remote,
+		state:  state,
+	}
+
+	if rel, err := filepath.Rel(local_path, cfg.StatePath); err == nil && !strings.HasPrefix(rel, "..") {
+		s.state_file = "/" + filepath.ToSlash(rel)
+	}
+	return s, nil
+}
+
+// Sync files every interval, until context is done
+func (s *Syncer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sync(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Error("failed sync files", slog.Any("err", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+Sync local folder with server once. Each file is compared with its state after last sync:
+changed side is copied to other side, removed file is removed on other side.
+If file was changed on both sides, both copies are kept.
+*/
+func (s *Syncer) Sync(ctx context.Context) error {
+	cursor, err := s.remote.Cursor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Server files weren't changed after last sync
+	var remote map[string]Entry
+	if s.state.Time != 0 && s.state.Cursor == cursor {
+		remote = s.state.remoteEntries()
+	} else if remote, err = s.listRemote(ctx); err != nil {
+		return err
+	}
+
+	local, err := s.scanLocal()
+	if err != nil {
+		return err
+	}
+
+	failed := s.apply(ctx, local, remote)
+
+	// Not synced server changes are found by listing server files on next sync
+	s.state.Cursor = cursor
+	s.state.Time = time.Now().Unix()
+	if failed != 0 {
+		s.state.Time = 0
+	}
+
+	if err := s.state.Save(); err != nil {
+		return err
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%w: %d", ErrSyncFailed, failed)
+	}
+	return nil
+}
+
+func (s *Syncer) localPath(file_path string) string {
+	return filepath.Join(s.cfg.LocalPath, filepath.FromSlash(file_path))
+}
+
+func (s *Syncer) base(file_path string) *FileState {
+	file, ok := s.state.Files[file_path]
+	if !ok {
+		return nil
+	}
+	return &file
+}
+
+// File can be synced with server
+func (s *Syncer) syncable(file_path string) bool {
+	name := path.Base(file_path)
+	return file_path != s.state_file && !strings.HasSuffix(name, TEMP_FILE_SUFFIX) && data.IsValidFilename(name)
+}
+
+// All files and directories on server
+func (s *Syncer) listRemote(ctx context.Context) (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+	dirs := []string{"/"}
+
+	for len(dirs) != 0 {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+
+		list, err := s.remote.List(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range list {
+			if !s.syncable(strings.TrimSuffix(entry.Path, "/")) {
+				continue
+			}
+
+			entries[entry.Path] = entry
+			if entry.IsDir {
+				dirs = append(dirs, entry.Path)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// All files and directories in local folder. Files with names, which aren't allowed by server, are skipped.
+func (s *Syncer) scanLocal() (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+	err := filepath.WalkDir(s.cfg.LocalPath, func(local_path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if local_path == s.cfg.LocalPath {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.cfg.LocalPath, local_path)
+		if err != nil {
+			return err
+		}
+
+		entry := Entry{Path: "/" + filepath.ToSlash(rel), IsDir: d.IsDir()}
+		if !s.syncable(entry.Path) {
+			slog.Debug("skip local file", slog.String("path", entry.Path))
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Symlinks, sockets and other special files
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if entry.IsDir {
+			entry.Path += "/"
+		} else {
+			entry.Size = uint64(info.Size())
+			entry.ModTime = uint64(info.ModTime().UnixNano())
+		}
+
+		entries[entry.Path] = entry
+		return nil
+	})
+	return entries, err
+}
+
+func localChanged(entry *Entry, base *FileState) bool {
+	if entry == nil {
+		return false
+	}
+	return base == nil || base.IsDir != entry.IsDir || !entry.IsDir && (base.LocalSize != entry.Size || base.LocalModTime != entry.ModTime)
+}
+
+func remoteChanged(entry *Entry, base *FileState) bool {
+	if entry == nil {
+		return false
+	}
+	return base == nil || base.IsDir != entry.IsDir || !entry.IsDir && (base.RemoteSize != entry.Size || base.RemoteModTime != entry.ModTime)
+}
+
+func entryOf(entries map[string]Entry, file_path string) *Entry {
+	entry, ok := entries[file_path]
+	if !ok {
+		return nil
+	}
+	return &entry
+}
+
+// Path is in one of directories
+func inDirs(dirs []string, file_path string) bool {
+	return slices.ContainsFunc(dirs, func(dir string) bool {
+		return strings.HasPrefix(file_path, dir)
+	})
+}
+
+// Sync all files. Return count of not synced files.
+func (s *Syncer) apply(ctx context.Context, local, remote map[string]Entry) (failed int) {
+	paths := make([]string, 0, len(local)+len(remote)+len(s.state.Files))
+	for _, entries := range []map[string]Entry{local, remote} {
+		for file_path := range entries {
+			paths = append(paths, file_path)
+		}
+	}
+
+	// Files removed on both sides
+	for file_path := range s.state.Files {
+		paths = append(paths, file_path)
+	}
+
+	// Parent directories are synced before their files
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	removed := s.removedDirs(paths, local, remote)
+
+	for _, file_path := range paths {
+		if ctx.Err() != nil {
+			return failed + 1
+		}
+
+		if inDirs(removed, file_path) {
+			continue
+		}
+
+		if err := s.syncPath(ctx, file_path, entryOf(local, file_path), entryOf(remote, file_path)); err != nil {
+			slog.Warn("failed sync file", slog.String("path", file_path), slog.Any("err", err))
+			failed++
+		}
+	}
+
+	for _, dir := range removed {
+		if err := s.removeDir(ctx, dir, entryOf(local, dir) == nil); err != nil {
+			slog.Warn("failed remove directory", slog.String("path", dir), slog.Any("err", err))
+			failed++
+		}
+	}
+	return failed
+}
+
+/*
+Directories removed on one side, which are removed on other side after files sync.
+If files in directory were changed on other side, directory is created again.
+*/
+func (s *Syncer) removedDirs(paths []string, local, remote map[string]Entry) []string {
+	var removed []string
+	for _, dir := range paths {
+		base := s.base(dir)
+		if base == nil || !base.IsDir || inDirs(removed, dir) {
+			continue
+		}
+
+		l, r := entryOf(local, dir), entryOf(remote, dir)
+
+		var other map[string]Entry
+		var changed func(*Entry, *FileState) bool
+		switch {
+		case l == nil && r != nil && r.IsDir:
+			other, changed = remote, remoteChanged
+		case r == nil && l != nil && l.IsDir:
+			other, changed = local, localChanged
+		default:
+			continue
+		}
+
+		clean := true
+		for file_path, entry := range other {
+			if strings.HasPrefix(file_path, dir) && changed(&entry, s.base(file_path)) {
+				clean = false
+				break
+			}
+		}
+
+		if clean {
+			removed = append(removed, dir)
+		}
+	}
+	return removed
+}
+
+func (s *Syncer) syncPath(ctx context.Context, file_path string, l, r *Entry) error {
+	if l == nil && r == nil {
+		delete(s.state.Files, file_path)
+		return nil
+	}
+
+	if l != nil && r != nil && l.IsDir != r.IsDir {
+		return ErrTypeMismatch
+	}
+
+	if l != nil && l.IsDir || r != nil && r.IsDir {
+		return s.syncDir(ctx, file_path, l, r)
+	}
+
+	base := s.base(file_path)
+	local_changed, remote_changed := localChanged(l, base), remoteChanged(r, base)
+
+	switch {
+	case l != nil && r != nil:
+		switch {
+		case local_changed && remote_changed:
+			return s.resolve(ctx, file_path, *l, *r)
+		case local_changed:
+			return s.upload(ctx, file_path)
+		case remote_changed:
+			return s.download(ctx, file_path, l)
+		}
+		return nil
+
+	// Removed on server
+	case l != nil:
+		if local_changed {
+			return s.upload(ctx, file_path)
+		}
+		return s.removeLocal(file_path)
+
+	// Removed locally
+	default:
+		if remote_changed {
+			return s.download(ctx, file_path, nil)
+		}
+		return s.removeRemote(ctx, file_path)
+	}
+}
+
+func (s *Syncer) syncDir(ctx context.Context, dir string, l, r *Entry) error {
+	switch {
+	case l != nil && r != nil:
+	case l != nil:
+		if err := s.remote.Mkdir(ctx, dir); err != nil {
+			return err
+		}
+	default:
+		if err := os.MkdirAll(s.localPath(dir), 0700); err != nil {
+			return err
+		}
+	}
+
+	s.state.Files[dir] = FileState{IsDir: true}
+	return nil
+}
+
+// Save state of synced file
+func (s *Syncer) saveState(file_path string, info fs.FileInfo, remote Entry) {
+	s.state.Files[file_path] = FileState{
+		LocalSize:     uint64(info.Size()),
+		LocalModTime:  uint64(info.ModTime().UnixNano()),
+		RemoteSize:    remote.Size,
+		RemoteModTime: remote.ModTime,
+	}
+}
+
+// Check, that local file wasn't changed after scan. Nil entry means, that file didn't exist.
+func (s *Syncer) checkLocal(file_path string, expected *Entry) error {
+	info, err := os.Stat(s.localPath(file_path))
+	if errors.Is(err, os.ErrNotExist) && expected == nil {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if expected == nil || uint64(info.Size()) != expected.Size || uint64(info.ModTime().UnixNano()) != expected.ModTime {
+		return ErrLocalChanged
+	}
+	return nil
+}
+
+func (s *Syncer) upload(ctx context.Context, file_path string) error {
+	file, err := os.Open(s.localPath(file_path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	before, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Server doesn't save empty files
+	if before.Size() == 0 {
+		slog.Debug("skip empty file", slog.String("path", file_path))
+		return nil
+	}
+
+	slog.Info("upload file", slog.String("path", file_path), slog.Int64("size", before.Size()))
+
+	remote, err := s.remote.Upload(ctx, file_path, file)
+	if err != nil {
+		return err
+	}
+
+	// File changed while uploading is uploaded again on next sync
+	after, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		return ErrLocalChanged
+	}
+
+	s.saveState(file_path, after, remote)
+	return nil
+}
+
+// Download file to temp file and replace local file. Expected is local file found by scan.
+func (s *Syncer) download(ctx context.Context, file_path string, expected *Entry) error {
+	local_path := s.localPath(file_path)
+	if err := os.MkdirAll(filepath.Dir(local_path), 0700); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(local_path), "."+filepath.Base(local_path)+"*"+TEMP_FILE_SUFFIX)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("download file", slog.String("path", file_path))
+
+	remote, err := s.remote.Download(ctx, file_path, temp)
+	if close_err := temp.Close(); err == nil {
+		err = close_err
+	}
+
+	if err == nil {
+		err = os.Chtimes(temp.Name(), time.Now(), time.Unix(int64(remote.ModTime), 0))
+	}
+
+	if err == nil {
+		err = s.checkLocal(file_path, expected)
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), local_path)
+	}
+
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return err
+	}
+
+	info, err := os.Stat(local_path)
+	if err != nil {
+		return err
+	}
+
+	s.saveState(file_path, info, remote)
+	return nil
+}
+
+// Path of conflict copy: "/docs/cv.pdf" -> "/docs/cv_conflict_laptop_20261019-150405.pdf". Name is allowed by server.
+func conflictPath(file_path, device string, now time.Time) string {
+	dir, name := path.Split(file_path)
+
+	// Leading dot is a part of name (".bashrc"), all extensions are kept (".tar.gz")
+	stem, ext := name, ""
+	if i := strings.Index(name[1:], "."); i != -1 {
+		stem, ext = name[:i+1], name[i+1:]
+	}
+
+	suffix := "_conflict"
+	if device = deviceRegexp.ReplaceAllString(device, ""); device != "" {
+		suffix += "_" + device
+	}
+
+	return dir + stem + suffix + now.Format("_20060102-150405") + ext
+}
+
+/*
+File was changed on both sides. If content is the same, only state is saved. Otherwise local file is
+renamed to conflict copy, which is uploaded, and server file is downloaded.
+*/
+func (s *Syncer) resolve(ctx context.Context, file_path string, l, r Entry) error {
+	local_path := s.localPath(file_path)
+
+	file, err := os.Open(local_path)
+	if err != nil {
+		return err
+	}
+
+	same, err := s.remote.Same(ctx, file_path, file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkLocal(file_path, &l); err != nil {
+		return err
+	}
+
+	if same {
+		info, err := os.Stat(local_path)
+		if err != nil {
+			return err
+		}
+
+		s.saveState(file_path, info, r)
+		return nil
+	}
+
+	conflict_path := conflictPath(file_path, s.cfg.Device, time.Now())
+	slog.Warn("file was changed on both sides, keep both copies", slog.String("path", file_path), slog.String("copy", conflict_path))
+
+	if err := os.Rename(local_path, s.localPath(conflict_path)); err != nil {
+		return err
+	}
+
+	if err := s.download(ctx, file_path, nil); err != nil {
+		return err
+	}
+	return s.upload(ctx, conflict_path)
+}
+
+func (s *Syncer) removeLocal(file_path string) error {
+	slog.Info("remove local file", slog.String("path", file_path))
+
+	if err := os.Remove(s.localPath(file_path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	delete(s.state.Files, file_path)
+	return nil
+}
+
+func (s *Syncer) removeRemote(ctx context.Context, file_path string) error {
+	slog.Info("remove file on server", slog.String("path", file_path))
+
+	if err := s.remote.Remove(ctx, file_path); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	delete(s.state.Files, file_path)
+	return nil
+}
+
+/*
+Remove directory on server (removed locally) or local directory (removed on server).
+Only synced local files are removed: directory with other files is kept and created on server again on next sync.
+*/
+func (s *Syncer) removeDir(ctx context.Context, dir string, on_server bool) error {
+	if on_server {
+		slog.Info("remove directory on server", slog.String("path", dir))
+
+		if err := s.remote.Rmdir(ctx, dir); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+
+		s.state.removeTree(dir)
+		return nil
+	}
+
+	slog.Info("remove local directory", slog.String("path", dir))
+
+	var synced []string
+	for file_path := range s.state.Files {
+		if strings.HasPrefix(file_path, dir) {
+			synced = append(synced, file_path)
+		}
+	}
+
+	// Files are removed before their directories
+	slices.Sort(synced)
+	slices.Reverse(synced)
+
+	for _, file_path := range synced {
+		err := os.Remove(s.localPath(file_path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed remove local file", slog.String("path", file_path), slog.Any("err", err))
+		}
+	}
+
+	s.state.removeTree(dir)
+	return nil
+}
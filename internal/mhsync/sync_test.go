@@ -0,0 +1,296 @@
+package mhsync_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/mhsync"
+)
+
+const TEST_PATH string = "/tmp/mhserver_tests/mhsync/"
+
+// Server simulation: files are stored in local folder, cursor is changed after each change
+type dirRemote struct {
+	root   string
+	cursor atomic.Uint64
+	lists  atomic.Int64
+}
+
+func (r *dirRemote) path(file_path string) string {
+	return filepath.Join(r.root, filepath.FromSlash(file_path))
+}
+
+func (r *dirRemote) entry(file_path string) (mhsync.Entry, error) {
+	info, err := os.Stat(r.path(file_path))
+	if err != nil {
+		return mhsync.Entry{}, err
+	}
+
+	// Nanoseconds are used instead of seconds, so changes in one second are found
+	return mhsync.Entry{Path: file_path, Size: uint64(info.Size()), ModTime: uint64(info.ModTime().UnixNano())}, nil
+}
+
+func (r *dirRemote) Cursor(ctx context.Context) (uint64, error) {
+	return r.cursor.Load(), nil
+}
+
+func (r *dirRemote) List(ctx context.Context, dir string) ([]mhsync.Entry, error) {
+	r.lists.Add(1)
+
+	files, err := os.ReadDir(r.path(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []mhsync.Entry
+	for _, file := range files {
+		if file.IsDir() {
+			entries = append(entries, mhsync.Entry{Path: dir + file.Name() + "/", IsDir: true})
+			continue
+		}
+
+		entry, err := r.entry(dir + file.Name())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *dirRemote) Upload(ctx context.Context, file_path string, file *os.File) (mhsync.Entry, error) {
+	remote, err := os.Create(r.path(file_path))
+	if err != nil {
+		return mhsync.Entry{}, err
+	}
+
+	_, err = io.Copy(remote, file)
+	_ = remote.Close()
+	if err != nil {
+		return mhsync.Entry{}, err
+	}
+
+	r.cursor.Add(1)
+	return r.entry(file_path)
+}
+
+func (r *dirRemote) Download(ctx context.Context, file_path string, file *os.File) (mhsync.Entry, error) {
+	remote, err := os.Open(r.path(file_path))
+	if err != nil {
+		return mhsync.Entry{}, err
+	}
+	defer func() {
+		_ = remote.Close()
+	}()
+
+	if _, err := io.Copy(file, remote); err != nil {
+		return mhsync.Entry{}, err
+	}
+	return r.entry(file_path)
+}
+
+func (r *dirRemote) Same(ctx context.Context, file_path string, file *os.File) (bool, error) {
+	local, err := io.ReadAll(file)
+	if err != nil {
+		return false, err
+	}
+
+	remote, err := os.ReadFile(r.path(file_path))
+	return string(local) == string(remote), err
+}
+
+func (r *dirRemote) Mkdir(ctx context.Context, dir string) error {
+	r.cursor.Add(1)
+	return os.MkdirAll(r.path(dir), 0700)
+}
+
+func (r *dirRemote) Rmdir(ctx context.Context, dir string) error {
+	r.cursor.Add(1)
+	return os.RemoveAll(r.path(dir))
+}
+
+func (r *dirRemote) Remove(ctx context.Context, file_path string) error {
+	r.cursor.Add(1)
+	err := os.Remove(r.path(file_path))
+	if errors.Is(err, os.ErrNotExist) {
+		return mhsync.ErrNotExist
+	}
+	return err
+}
+
+// Change file bypassing syncer
+func writeFile(t *testing.T, root, file_path, body string) {
+	t.Helper()
+
+	full_path := filepath.Join(root, filepath.FromSlash(file_path))
+	if err := os.MkdirAll(filepath.Dir(full_path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(full_path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Check files bodies. Empty body means, that file doesn't exist.
+func checkFiles(t *testing.T, root string, expected map[string]string) {
+	t.Helper()
+
+	for file_path, body := range expected {
+		got, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(file_path)))
+		if body == "" {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected removed %s in %s, but got %v", file_path, root, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected %s in %s, but got %v", file_path, root, err)
+		} else if string(got) != body {
+			t.Errorf("expected %s body %q, but got %q", file_path, body, got)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	local := TEST_PATH + "local"
+	remote := &dirRemote{root: TEST_PATH + "remote"}
+
+	if err := os.RemoveAll(TEST_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, local, "/notes.txt", "local notes")
+	writeFile(t, local, "/docs/cv.pdf", "cv")
+	writeFile(t, local, "/bad name!.txt", "not synced")
+	writeFile(t, remote.root, "/music/song.mp3", "song")
+	writeFile(t, remote.root, "/todo.txt", "todo")
+
+	syncer, err := mhsync.New(mhsync.Config{LocalPath: local, Device: "test-laptop"}, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sync := func(t *testing.T) {
+		t.Helper()
+		if err := syncer.Sync(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("first sync", func(t *testing.T) {
+		sync(t)
+
+		expected := map[string]string{
+			"/notes.txt":      "local notes",
+			"/docs/cv.pdf":    "cv",
+			"/music/song.mp3": "song",
+			"/todo.txt":       "todo",
+		}
+		checkFiles(t, local, expected)
+		checkFiles(t, remote.root, expected)
+		checkFiles(t, remote.root, map[string]string{"/bad name!.txt": "", "/" + mhsync.STATE_FILENAME: ""})
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		// Server files are listed after own changes, then state is used
+		sync(t)
+
+		lists := remote.lists.Load()
+		sync(t)
+
+		if got := remote.lists.Load() - lists; got != 0 {
+			t.Errorf("expected sync without list requests, but got %d", got)
+		}
+	})
+
+	t.Run("local changes", func(t *testing.T) {
+		writeFile(t, local, "/notes.txt", "new local notes")
+		if err := os.Remove(filepath.Join(local, "todo.txt")); err != nil {
+			t.Fatal(err)
+		}
+		sync(t)
+
+		checkFiles(t, remote.root, map[string]string{"/notes.txt": "new local notes", "/todo.txt": ""})
+	})
+
+	t.Run("server changes", func(t *testing.T) {
+		writeFile(t, remote.root, "/music/song.mp3", "new song")
+		if err := os.Remove(filepath.Join(remote.root, "notes.txt")); err != nil {
+			t.Fatal(err)
+		}
+		remote.cursor.Add(1)
+		sync(t)
+
+		checkFiles(t, local, map[string]string{"/music/song.mp3": "new song", "/notes.txt": ""})
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		writeFile(t, local, "/docs/cv.pdf", "local cv")
+		writeFile(t, remote.root, "/docs/cv.pdf", "server cv")
+		remote.cursor.Add(1)
+		sync(t)
+
+		for _, root := range []string{local, remote.root} {
+			checkFiles(t, root, map[string]string{"/docs/cv.pdf": "server cv"})
+
+			files, err := os.ReadDir(filepath.Join(root, "docs"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(files) != 2 || !strings.HasPrefix(files[1].Name(), "cv_conflict_testlaptop_") || !strings.HasSuffix(files[1].Name(), ".pdf") {
+				t.Fatalf("expected cv.pdf and conflict copy in %s, but got %v", root, files)
+			}
+			checkFiles(t, root, map[string]string{"/docs/" + files[1].Name(): "local cv"})
+		}
+	})
+
+	t.Run("removed directory", func(t *testing.T) {
+		if err := os.RemoveAll(filepath.Join(remote.root, "music")); err != nil {
+			t.Fatal(err)
+		}
+		remote.cursor.Add(1)
+		sync(t)
+
+		if _, err := os.Stat(filepath.Join(local, "music")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected removed local directory, but got %v", err)
+		}
+
+		// Directory with new file on other side is kept
+		writeFile(t, local, "/docs/new.txt", "new")
+		if err := os.RemoveAll(filepath.Join(remote.root, "docs")); err != nil {
+			t.Fatal(err)
+		}
+		remote.cursor.Add(1)
+		sync(t)
+
+		checkFiles(t, remote.root, map[string]string{"/docs/new.txt": "new"})
+		checkFiles(t, local, map[string]string{"/docs/new.txt": "new", "/docs/cv.pdf": ""})
+	})
+
+	t.Run("state is saved", func(t *testing.T) {
+		sync(t)
+		lists := remote.lists.Load()
+
+		syncer, err := mhsync.New(mhsync.Config{LocalPath: local}, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := syncer.Sync(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := remote.lists.Load() - lists; got != 0 {
+			t.Errorf("expected synced state without list requests, but got %d", got)
+		}
+	})
+}
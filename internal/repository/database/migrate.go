@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNotMigrated = errors.New("database has not applied migrations")
+)
+
+const (
+	MIGRATIONS_DIR string = "migrations"
+
+	CREATE_MIGRATIONS_TABLE string = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version VARCHAR(128) PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+	MIGRATIONS_TABLE_EXISTS string = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'"
+	SELECT_MIGRATIONS       string = "SELECT version FROM schema_migrations"
+	INSERT_MIGRATION        string = "INSERT INTO schema_migrations (version) VALUES (?)"
+)
+
+// Schema changes. Files are applied in name order, each only once.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Split sql file into separate statements, because driver doesn't run several statements in one query
+func splitStatements(script string) []string {
+	statements := make([]string, 0)
+	for statement := range strings.SplitSeq(script, ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// Return versions of applied migrations. Migrations table isn't created, so database isn't changed.
+func appliedMigrations(db *sql.DB) (map[string]bool, error) {
+	done := make(map[string]bool)
+
+	var tables int
+	if err := db.QueryRow(MIGRATIONS_TABLE_EXISTS).Scan(&tables); err != nil {
+		return nil, err
+	}
+
+	// No migrations are applied yet
+	if tables == 0 {
+		return done, nil
+	}
+
+	rows, err := db.Query(SELECT_MIGRATIONS)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		done[version] = true
+	}
+
+	return done, rows.Err()
+}
+
+// Return names of migrations, which aren't applied yet. Database isn't changed.
+func PendingMigrations(db *sql.DB) ([]string, error) {
+	done, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := fs.Glob(migrations, MIGRATIONS_DIR+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	pending := make([]string, 0)
+	for _, file := range files {
+		if version := strings.TrimSuffix(path.Base(file), ".sql"); !done[version] {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
+
+// Apply not applied migrations. Return names of applied migrations.
+func Migrate(db *sql.DB) ([]string, error) {
+	if _, err := db.Exec(CREATE_MIGRATIONS_TABLE); err != nil {
+		return nil, err
+	}
+
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]string, 0, len(pending))
+	for _, version := range pending {
+		script, err := migrations.ReadFile(MIGRATIONS_DIR + "/" + version + ".sql")
+		if err != nil {
+			return applied, err
+		}
+
+		// MariaDB commits DDL statements implicitly, so migrations must be safe to run again
+		for _, statement := range splitStatements(string(script)) {
+			if _, err := db.Exec(statement); err != nil {
+				return applied, fmt.Errorf("migration %s: %w", version, err)
+			}
+		}
+
+		if _, err := db.Exec(INSERT_MIGRATION, version); err != nil {
+			return applied, err
+		}
+
+		slog.Info("Migration applied", slog.String("version", version))
+		applied = append(applied, version)
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,44 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/repository/database"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestMigrate(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := database.PendingMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Errorf("migrations not applied: %v", pending)
+	}
+
+	applied, err := database.Migrate(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("migrations applied twice: %v", applied)
+	}
+}
@@ -7,4 +7,12 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE TABLE IF NOT EXISTS register_secret_keys (
     id INT AUTO_INCREMENT PRIMARY KEY,
     secret_key VARCHAR(64) NOT NULL
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS user_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    public_key VARCHAR(1024) NOT NULL,
+    comment VARCHAR(256) NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id CHAR(36) PRIMARY KEY,
+    user_id INT NOT NULL,
+    device VARCHAR(128) NOT NULL DEFAULT '',
+    user_agent VARCHAR(256) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    last_used BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Refresh tokens issued before sessions have no session record
+DELETE FROM refresh_tokens WHERE session_id NOT IN (SELECT id FROM sessions);
+
+ALTER TABLE refresh_tokens ADD FOREIGN KEY IF NOT EXISTS fk_refresh_tokens_session (session_id) REFERENCES sessions(id) ON DELETE CASCADE;
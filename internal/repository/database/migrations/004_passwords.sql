@@ -0,0 +1,11 @@
+-- Access tokens issued before this time are rejected (password change). Time is saved in
+-- milliseconds, so tokens issued in the same second as password change are rejected too
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_after BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
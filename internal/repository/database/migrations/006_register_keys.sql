@@ -0,0 +1,9 @@
+-- Registration key lifecycle. Old keys stay one-time, never expire and create users with "user" role.
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS created_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS expires_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS max_uses INT NOT NULL DEFAULT 1;
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS uses INT NOT NULL DEFAULT 0;
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS username VARCHAR(30) NOT NULL DEFAULT '';
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS created_by VARCHAR(30) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS register_secret_keys_secret_key ON register_secret_keys (secret_key);
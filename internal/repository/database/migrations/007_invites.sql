@@ -0,0 +1,5 @@
+-- Invites are registration keys, which are created by users
+ALTER TABLE register_secret_keys ADD COLUMN IF NOT EXISTS invite BOOL NOT NULL DEFAULT FALSE;
+
+-- Name of user, whose invite was used for registration
+ALTER TABLE users ADD COLUMN IF NOT EXISTS invited_by VARCHAR(30) NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+-- Audit log of password and two-factor authentication checks. Username isn't a foreign key:
+-- attempts with unknown names are recorded too.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(64) NOT NULL,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    method VARCHAR(16) NOT NULL,
+    success BOOL NOT NULL,
+    reason VARCHAR(128) NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    INDEX (username),
+    INDEX (created_at)
+);
+
+-- Failed logins of username in a row, regardless of ip address. Each next lockout in a row
+-- is twice as long
+CREATE TABLE IF NOT EXISTS login_failures (
+    username VARCHAR(64) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure BIGINT NOT NULL DEFAULT 0,
+    locked_until BIGINT NOT NULL DEFAULT 0,
+    lockouts INT NOT NULL DEFAULT 0
+);
@@ -25,9 +25,17 @@ directoryRegexp check:
 */
 var directoryRegexp = regexp.MustCompile(`^\/(\.?[\p{L}\p{N}]+([ _-]+[\p{L}\p{N}]+)*\/)*$`)
 
+// Check directory with directory rules. Return ErrBadDirSyntax, if directory is bad.
+func CheckDirSyntax(dir string) error {
+	if !directoryRegexp.MatchString(dir) {
+		return ErrBadDirSyntax
+	}
+	return nil
+}
+
 func GetDataPath(workspace_path, user, req_dir string, service config.ServiceName) (string, error) {
-	if !directoryRegexp.MatchString(req_dir) {
-		return "", ErrBadDirSyntax
+	if err := CheckDirSyntax(req_dir); err != nil {
+		return "", err
 	}
 
 	// "%s%s/%s%s" -> "/home/srv/.mhserver/" + username + file type (File, Image, Music etc) + directory
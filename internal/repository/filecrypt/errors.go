@@ -0,0 +1,15 @@
+package filecrypt
+
+import "errors"
+
+var (
+	// Keys
+	ErrBadMasterKey error = errors.New("master key must be 32 bytes hex string")
+	ErrBadSalt      error = errors.New("user salt is damaged")
+
+	// Format
+	ErrBadChunkSize       error = errors.New("bad encrypted chunk size")
+	ErrChunkOutOfFile     error = errors.New("chunk is out of file")
+	ErrDamagedChunk       error = errors.New("encrypted chunk is damaged or key is wrong")
+	ErrNotSequentialWrite error = errors.New("encrypted file can be written only sequentially")
+)
@@ -0,0 +1,203 @@
+// Пакет для шифрования пользовательских файлов на диске (AES-GCM по чанкам).
+package filecrypt
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"os"
+)
+
+// Encrypted file. Every chunk is encrypted separately, so file can be read and written by chunks in any order.
+type File struct {
+	*os.File
+	aead   cipher.AEAD
+	header Header
+}
+
+// Open encrypted file. Return false, if file is not encrypted (plain file).
+func Open(file *os.File, aead cipher.AEAD) (*File, bool, error) {
+	header, ok, err := ReadHeader(file, aead)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return &File{
+		File:   file,
+		aead:   aead,
+		header: header,
+	}, true, nil
+}
+
+// Clear file and write new header. Chunks must be written with WriteChunk after that.
+func Create(file *os.File, aead cipher.AEAD, chunk_size, size uint64) (*File, error) {
+	header, err := NewHeader(chunk_size, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return nil, err
+	}
+
+	if err := header.WriteTo(file, aead); err != nil {
+		return nil, err
+	}
+
+	return &File{
+		File:   file,
+		aead:   aead,
+		header: header,
+	}, nil
+}
+
+func (f *File) Header() Header {
+	return f.header
+}
+
+// Plain file size
+func (f *File) Size() int64 {
+	return int64(f.header.Size)
+}
+
+func (f *File) ReadChunk(id uint32) ([]byte, error) {
+	plain_size := f.header.PlainChunkSize(id)
+	if plain_size == 0 {
+		return nil, ErrChunkOutOfFile
+	}
+
+	sealed := make([]byte, plain_size+CHUNK_OVERHEAD)
+	n, err := f.File.ReadAt(sealed, f.header.ChunkOffset(id))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if uint64(n) != plain_size+CHUNK_OVERHEAD {
+		return nil, ErrDamagedChunk
+	}
+
+	plain, err := f.aead.Open(sealed[NONCE_SIZE:NONCE_SIZE], sealed[:NONCE_SIZE], sealed[NONCE_SIZE:], f.header.chunkAD(id))
+	if err != nil {
+		return nil, ErrDamagedChunk
+	}
+	return plain, nil
+}
+
+// Encrypt and write chunk. Chunk size must be the same as in header (last chunk can be smaller).
+func (f *File) WriteChunk(id uint32, plain []byte) error {
+	if f.header.PlainChunkSize(id) != uint64(len(plain)) {
+		return ErrBadChunkSize
+	}
+
+	_, err := f.File.WriteAt(sealChunk(f.aead, f.header, id, plain), f.header.ChunkOffset(id))
+	return err
+}
+
+// Read plain data from any offset. Implements io.ReaderAt.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.Size() {
+		return 0, io.EOF
+	}
+
+	var read int
+	for read < len(p) && off < f.Size() {
+		id := uint32(uint64(off) / f.header.ChunkSize)
+		chunk, err := f.ReadChunk(id)
+		if err != nil {
+			return read, err
+		}
+
+		n := copy(p[read:], chunk[uint64(off)%f.header.ChunkSize:])
+		read += n
+		off += int64(n)
+	}
+
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func sealChunk(aead cipher.AEAD, header Header, id uint32, plain []byte) []byte {
+	sealed := make([]byte, NONCE_SIZE, uint64(len(plain))+CHUNK_OVERHEAD)
+	// Random nonce can't fail on linux, so error is ignored
+	_, _ = rand.Read(sealed)
+	return aead.Seal(sealed, sealed[:NONCE_SIZE], plain, header.chunkAD(id))
+}
+
+// Sequential writer of encrypted file, when file size is unknown. File size will be written in header on Close().
+type Writer struct {
+	file   *os.File
+	aead   cipher.AEAD
+	header Header
+
+	buf     []byte
+	chunkID uint32
+}
+
+func NewWriter(file *os.File, aead cipher.AEAD, chunk_size uint64) (*Writer, error) {
+	header, err := NewHeader(chunk_size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return nil, err
+	}
+
+	if err := header.WriteTo(file, aead); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		file:   file,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, chunk_size),
+	}, nil
+}
+
+func (w *Writer) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	if _, err := w.file.WriteAt(sealChunk(w.aead, w.header, w.chunkID, w.buf), w.header.ChunkOffset(w.chunkID)); err != nil {
+		return err
+	}
+
+	w.header.Size += uint64(len(w.buf))
+	w.chunkID += 1
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := min(len(p), int(w.header.ChunkSize)-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if uint64(len(w.buf)) == w.header.ChunkSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Written plain bytes count
+func (w *Writer) Size() uint64 {
+	return w.header.Size + uint64(len(w.buf))
+}
+
+// Write last chunk and final header. Underlying file is not closed.
+func (w *Writer) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.header.WriteTo(w.file, w.aead)
+}
@@ -0,0 +1,275 @@
+package filecrypt_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+)
+
+const (
+	TEST_WORKSPACE_PATH string = "/tmp/mhserver_tests/"
+	TEST_USER           string = "filecrypt_user"
+	TEST_MASTER_KEY     string = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+func newKeyRing(t *testing.T) *filecrypt.KeyRing {
+	if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_USER, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := filecrypt.ParseMasterKey(TEST_MASTER_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filecrypt.NewKeyRing(TEST_WORKSPACE_PATH, key)
+}
+
+func TestParseMasterKey(t *testing.T) {
+	cases := [...]struct {
+		name         string
+		key          string
+		expected_err error
+	}{
+		{
+			name: "normal key",
+			key:  TEST_MASTER_KEY,
+		},
+		{
+			name:         "empty key",
+			key:          "",
+			expected_err: filecrypt.ErrBadMasterKey,
+		},
+		{
+			name:         "short key",
+			key:          TEST_MASTER_KEY[:32],
+			expected_err: filecrypt.ErrBadMasterKey,
+		},
+		{
+			name:         "not hex",
+			key:          "zz" + TEST_MASTER_KEY[2:],
+			expected_err: filecrypt.ErrBadMasterKey,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := filecrypt.ParseMasterKey(test.key); !errors.Is(err, test.expected_err) {
+				t.Errorf("expected error %v, but got %v", test.expected_err, err)
+			}
+		})
+	}
+}
+
+func TestWriterAndReadAt(t *testing.T) {
+	aead, err := newKeyRing(t).UserCipher(TEST_USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [...]struct {
+		name       string
+		size       int
+		chunk_size uint64
+	}{
+		{name: "empty file", size: 0, chunk_size: 16},
+		{name: "smaller than chunk", size: 10, chunk_size: 16},
+		{name: "exact chunks", size: 64, chunk_size: 16},
+		{name: "last chunk smaller", size: 1000, chunk_size: 64},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			plain := make([]byte, test.size)
+			_, _ = rand.Read(plain)
+
+			file, err := os.CreateTemp(TEST_WORKSPACE_PATH, "filecrypt-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = file.Close()
+				_ = os.Remove(file.Name())
+			}()
+
+			writer, err := filecrypt.NewWriter(file, aead, test.chunk_size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Write with parts, which are not equal to chunk size
+			for part := range slices.Chunk(plain, 7) {
+				if _, err := writer.Write(part); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			enc_file, ok, err := filecrypt.Open(file, aead)
+			if err != nil || !ok {
+				t.Fatalf("failed open encrypted file: ok=%t, err=%v", ok, err)
+			}
+
+			if enc_file.Size() != int64(test.size) {
+				t.Fatalf("expected size %d, but got %d", test.size, enc_file.Size())
+			}
+
+			got, err := io.ReadAll(io.NewSectionReader(enc_file, 0, enc_file.Size()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, plain) {
+				t.Error("decrypted data not equal to plain")
+			}
+
+			if test.size > 0 {
+				disk, err := os.ReadFile(file.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if bytes.Contains(disk, plain) {
+					t.Error("plain data found in encrypted file")
+				}
+			}
+		})
+	}
+}
+
+func TestChunks(t *testing.T) {
+	aead, err := newKeyRing(t).UserCipher(TEST_USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.CreateTemp(TEST_WORKSPACE_PATH, "filecrypt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	plain := []byte("Who controls the past controls the future.")
+	const chunk_size = 8
+
+	enc_file, err := filecrypt.Create(file, aead, chunk_size, uint64(len(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Save chunks in reverse order, like parallel client do
+	for id := int(enc_file.Header().ChunksCount()) - 1; id >= 0; id-- {
+		end := min((id+1)*chunk_size, len(plain))
+		if err := enc_file.WriteChunk(uint32(id), plain[id*chunk_size:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("bad chunk size", func(t *testing.T) {
+		if err := enc_file.WriteChunk(0, plain[:chunk_size-1]); !errors.Is(err, filecrypt.ErrBadChunkSize) {
+			t.Errorf("expected error %v, but got %v", filecrypt.ErrBadChunkSize, err)
+		}
+	})
+
+	t.Run("read chunks", func(t *testing.T) {
+		for id := range enc_file.Header().ChunksCount() {
+			chunk, err := enc_file.ReadChunk(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			end := min((int(id)+1)*chunk_size, len(plain))
+			if !bytes.Equal(chunk, plain[int(id)*chunk_size:end]) {
+				t.Errorf("chunk %d: expected `%s`, but got `%s`", id, plain[int(id)*chunk_size:end], chunk)
+			}
+		}
+	})
+
+	t.Run("chunk out of file", func(t *testing.T) {
+		if _, err := enc_file.ReadChunk(enc_file.Header().ChunksCount()); !errors.Is(err, filecrypt.ErrChunkOutOfFile) {
+			t.Errorf("expected error %v, but got %v", filecrypt.ErrChunkOutOfFile, err)
+		}
+	})
+
+	t.Run("damaged chunk", func(t *testing.T) {
+		offset := enc_file.Header().ChunkOffset(1) + int64(filecrypt.NONCE_SIZE)
+		if _, err := file.WriteAt([]byte{0xff, 0xff}, offset); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := enc_file.ReadChunk(1); !errors.Is(err, filecrypt.ErrDamagedChunk) {
+			t.Errorf("expected error %v, but got %v", filecrypt.ErrDamagedChunk, err)
+		}
+	})
+
+	t.Run("plain file", func(t *testing.T) {
+		plain_file, err := os.CreateTemp(TEST_WORKSPACE_PATH, "filecrypt-plain-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = plain_file.Close()
+			_ = os.Remove(plain_file.Name())
+		}()
+
+		if _, err := plain_file.Write(plain); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok, err := filecrypt.Open(plain_file, aead); ok || err != nil {
+			t.Errorf("expected plain file, but got ok=%t, err=%v", ok, err)
+		}
+	})
+
+	t.Run("plain file with header fields", func(t *testing.T) {
+		plain_file, err := os.CreateTemp(TEST_WORKSPACE_PATH, "filecrypt-plain-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = plain_file.Close()
+			_ = os.Remove(plain_file.Name())
+		}()
+
+		// Magic, version and fields are correct, but header tag isn't
+		header := make([]byte, filecrypt.HEADER_SIZE)
+		if _, err := file.ReadAt(header[:filecrypt.HEADER_FIELDS_SIZE], 0); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := plain_file.Write(append(header, plain...)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok, err := filecrypt.Open(plain_file, aead); ok || err != nil {
+			t.Errorf("expected plain file, but got ok=%t, err=%v", ok, err)
+		}
+	})
+
+	t.Run("key of other user", func(t *testing.T) {
+		if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_USER+"_other", 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		other_aead, err := newKeyRing(t).UserCipher(TEST_USER + "_other")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok, err := filecrypt.Open(file, other_aead); ok || err != nil {
+			t.Errorf("expected plain file, but got ok=%t, err=%v", ok, err)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	HEADER_SIZE  int64  = 68
+	FORMAT_MAGIC string = "MHSE"
+	FORMAT_VER   byte   = 1
+
+	NONCE_SIZE int = 12
+	TAG_SIZE   int = 16
+
+	// Header fields, which are authenticated by header tag
+	HEADER_FIELDS_SIZE int = 40
+
+	// Extra bytes stored on disk for every chunk (nonce + GCM tag)
+	CHUNK_OVERHEAD uint64 = uint64(NONCE_SIZE + TAG_SIZE)
+)
+
+/*
+Header of the encrypted file. Layout on disk (big endian):
+
+	0..4   - magic "MHSE"
+	4      - format version
+	5..8   - reserved
+	8..24  - random file id (used as additional data, so chunks can't be moved between files)
+	24..32 - plain chunk size
+	32..40 - plain file size
+	40..52 - nonce of header tag
+	52..68 - GCM tag of empty data with fields 0..40 as additional data
+
+Header is authenticated by user key, so plain file, which starts with magic, isn't taken as encrypted.
+*/
+type Header struct {
+	FileID    [16]byte
+	ChunkSize uint64
+	Size      uint64
+}
+
+func NewHeader(chunk_size, size uint64) (Header, error) {
+	if chunk_size == 0 {
+		return Header{}, ErrBadChunkSize
+	}
+
+	h := Header{
+		ChunkSize: chunk_size,
+		Size:      size,
+	}
+
+	if _, err := rand.Read(h.FileID[:]); err != nil {
+		return Header{}, err
+	}
+	return h, nil
+}
+
+/*
+Read header from the start of file. Return false, if file is not encrypted.
+File is encrypted only if header tag is correct for the user key, so plain file with the same start
+(or with unknown format version) is taken as plain.
+*/
+func ReadHeader(r io.ReaderAt, aead cipher.AEAD) (Header, bool, error) {
+	buf := make([]byte, HEADER_SIZE)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Header{}, false, err
+	}
+
+	if int64(n) < HEADER_SIZE || !bytes.Equal(buf[:4], []byte(FORMAT_MAGIC)) || buf[4] != FORMAT_VER {
+		return Header{}, false, nil
+	}
+
+	fields := buf[:HEADER_FIELDS_SIZE]
+	nonce := buf[HEADER_FIELDS_SIZE : HEADER_FIELDS_SIZE+NONCE_SIZE]
+	if _, err := aead.Open(nil, nonce, buf[HEADER_FIELDS_SIZE+NONCE_SIZE:], fields); err != nil {
+		return Header{}, false, nil
+	}
+
+	h := Header{
+		ChunkSize: binary.BigEndian.Uint64(buf[24:32]),
+		Size:      binary.BigEndian.Uint64(buf[32:40]),
+	}
+	copy(h.FileID[:], buf[8:24])
+
+	if h.ChunkSize == 0 {
+		return Header{}, false, ErrBadChunkSize
+	}
+	return h, true, nil
+}
+
+// Header with tag of the user key
+func (h Header) Bytes(aead cipher.AEAD) []byte {
+	buf := make([]byte, HEADER_FIELDS_SIZE+NONCE_SIZE, HEADER_SIZE)
+	copy(buf[:4], FORMAT_MAGIC)
+	buf[4] = FORMAT_VER
+	copy(buf[8:24], h.FileID[:])
+	binary.BigEndian.PutUint64(buf[24:32], h.ChunkSize)
+	binary.BigEndian.PutUint64(buf[32:40], h.Size)
+
+	// Random nonce can't fail on linux, so error is ignored
+	nonce := buf[HEADER_FIELDS_SIZE:]
+	_, _ = rand.Read(nonce)
+	return aead.Seal(buf, nonce, nil, buf[:HEADER_FIELDS_SIZE])
+}
+
+func (h Header) WriteTo(w io.WriterAt, aead cipher.AEAD) error {
+	_, err := w.WriteAt(h.Bytes(aead), 0)
+	return err
+}
+
+func (h Header) ChunksCount() uint32 {
+	return uint32(math.Ceil(float64(h.Size) / float64(h.ChunkSize)))
+}
+
+// Offset of the encrypted chunk in file
+func (h Header) ChunkOffset(id uint32) int64 {
+	return HEADER_SIZE + int64(id)*int64(h.ChunkSize+CHUNK_OVERHEAD)
+}
+
+// Size of the plain chunk by id. Last chunk can be smaller than others.
+func (h Header) PlainChunkSize(id uint32) uint64 {
+	start := uint64(id) * h.ChunkSize
+	if start >= h.Size {
+		return 0
+	}
+	return min(h.ChunkSize, h.Size-start)
+}
+
+// Size of the encrypted file on disk
+func (h Header) DiskSize() uint64 {
+	return uint64(HEADER_SIZE) + h.Size + uint64(h.ChunksCount())*CHUNK_OVERHEAD
+}
+
+// Additional data of the chunk: file id + chunk id
+func (h Header) chunkAD(id uint32) []byte {
+	ad := make([]byte, 20)
+	copy(ad, h.FileID[:])
+	binary.BigEndian.PutUint32(ad[16:], id)
+	return ad
+}
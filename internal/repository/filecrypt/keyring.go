@@ -0,0 +1,123 @@
+package filecrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	MASTER_KEY_SIZE int    = 32
+	SALT_SIZE       int    = 32
+	SALT_FILENAME   string = ".mhs_salt"
+	KEY_INFO        string = "mhserver user files"
+)
+
+// Decode master key from config (hex string, 32 bytes)
+func ParseMasterKey(hex_key string) ([]byte, error) {
+	key, err := hex.DecodeString(hex_key)
+	if err != nil || len(key) != MASTER_KEY_SIZE {
+		return nil, ErrBadMasterKey
+	}
+	return key, nil
+}
+
+// Stores per-user ciphers. User key = HKDF-SHA256(master key, user salt).
+// Salt is random and saved in user workspace root, so it isn't secret.
+type KeyRing struct {
+	workspacePath string
+	master        []byte
+
+	ciphers map[string]cipher.AEAD
+	mux     *sync.Mutex
+}
+
+func NewKeyRing(workspace_path string, master_key []byte) *KeyRing {
+	return &KeyRing{
+		workspacePath: workspace_path,
+		master:        master_key,
+		ciphers:       make(map[string]cipher.AEAD),
+		mux:           &sync.Mutex{},
+	}
+}
+
+func (k *KeyRing) saltPath(user string) string {
+	// "%s%s/%s" -> "/home/srv/.mhserver/" + username + salt filename
+	return fmt.Sprintf("%s%s/%s", k.workspacePath, user, SALT_FILENAME)
+}
+
+func (k *KeyRing) loadSalt(user string) ([]byte, error) {
+	salt, err := os.ReadFile(k.saltPath(user))
+	if err == nil {
+		if len(salt) != SALT_SIZE {
+			return nil, ErrBadSalt
+		}
+		return salt, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	salt = make([]byte, SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// O_EXCL - don't rewrite salt, if it was created in parallel
+	file, err := os.OpenFile(k.saltPath(user), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return k.loadSalt(user)
+		}
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if _, err := file.Write(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Return AES-256-GCM cipher of the user. Salt will be created, if it not exist.
+func (k *KeyRing) UserCipher(user string) (cipher.AEAD, error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+
+	if aead, ok := k.ciphers[user]; ok {
+		return aead, nil
+	}
+
+	salt, err := k.loadSalt(user)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hkdf.Key(sha256.New, k.master, salt, KEY_INFO, MASTER_KEY_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	k.ciphers[user] = aead
+	return aead, nil
+}
@@ -0,0 +1,71 @@
+package freemem
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Disk space, which is promised to running writes of all services in process: uploads, extracting archives,
+applying deltas, WebDAV and SFTP writes. Each write checks free space besides this space,
+so one service doesn't take space, which another one expects.
+*/
+var reservations = struct {
+	mux     sync.Mutex
+	next    int
+	sources map[int]func() uint64
+
+	// Space of writes with known size
+	fixed atomic.Uint64
+}{
+	sources: make(map[int]func() uint64),
+}
+
+// Register function, which returns space to be used by running writes of service. It's removed, when ctx is done.
+func AddReservation(ctx context.Context, reserved func() uint64) {
+	reservations.mux.Lock()
+	id := reservations.next
+	reservations.next += 1
+	reservations.sources[id] = reserved
+	reservations.mux.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		reservations.mux.Lock()
+		delete(reservations.sources, id)
+		reservations.mux.Unlock()
+	})
+}
+
+// Reserve space for write of known size. Returned function releases it.
+func Reserve(size uint64) (release func()) {
+	reservations.fixed.Add(size)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			reservations.fixed.Add(-size)
+		})
+	}
+}
+
+// Space, which will be used by running writes of all services
+func Reserved() uint64 {
+	reservations.mux.Lock()
+	defer reservations.mux.Unlock()
+
+	res := reservations.fixed.Load()
+	for _, reserved := range reservations.sources {
+		res += reserved()
+	}
+	return res
+}
+
+// Check, that disk of dir has size bytes besides space reserved by running writes
+func HasSpace(dir string, size uint64) (bool, error) {
+	disk_space, err := GetAvailableDiskSpace(dir)
+	if err != nil {
+		return false, err
+	}
+	return disk_space >= Reserved()+size, nil
+}
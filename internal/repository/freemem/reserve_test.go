@@ -0,0 +1,48 @@
+package freemem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+)
+
+func TestReserved(t *testing.T) {
+	before := freemem.Reserved()
+
+	release := freemem.Reserve(100)
+	ctx, cancel := context.WithCancel(context.Background())
+	freemem.AddReservation(ctx, func() uint64 { return 50 })
+
+	if got := freemem.Reserved() - before; got != 150 {
+		t.Errorf("expected 150 reserved bytes, but got %d", got)
+	}
+
+	// Second release is ignored
+	release()
+	release()
+	if got := freemem.Reserved() - before; got != 50 {
+		t.Errorf("expected 50 reserved bytes after release, but got %d", got)
+	}
+
+	// Source is removed in goroutine after cancel
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for freemem.Reserved() != before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := freemem.Reserved() - before; got != 0 {
+		t.Errorf("expected released space after cancel, but got %d", got)
+	}
+
+	has_space, err := freemem.HasSpace("/tmp", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !has_space {
+		t.Error("expected free space in /tmp")
+	}
+}
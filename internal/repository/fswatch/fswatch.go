@@ -0,0 +1,566 @@
+// Пакет с отслеживанием изменений файлов пользователей, сделанных в обход сервера (cp, Samba), через inotify.
+package fswatch
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Change is sent to handler, when file wasn't changed for this time (file copying is finished)
+	DEBOUNCE_DURATION time.Duration = 2 * time.Second
+
+	// Interval of pending changes check. Also inotify poll timeout.
+	FLUSH_INTERVAL time.Duration = 500 * time.Millisecond
+
+	DEFAULT_RESCAN_INTERVAL time.Duration = 5 * time.Minute
+
+	// Workspace and user folders are watched only for new users and services folders
+	ROOT_WATCH_MASK uint32 = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+	TREE_WATCH_MASK uint32 = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+		unix.IN_DELETE | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+)
+
+var (
+	ErrWatchLimit = errors.New("inotify watch limit reached")
+)
+
+/*
+Change of user file found by watcher. Path is relative to service folder, like in journal.
+Time is the time, when change was found first. Size isn't set, because plain size depends on encryption.
+*/
+type Event struct {
+	User string
+	journal.Event
+}
+
+// Handler of found changes. Returned events are sent again with the next changes (for example, file is still uploading).
+type Handler func(events []Event) (postponed []Event)
+
+type Config struct {
+	WorkspacePath string
+	Service       config.ServiceName
+
+	// Don't use inotify, only rescan workspace. For network file systems, where inotify doesn't work.
+	RescanOnly     bool
+	RescanInterval time.Duration
+
+	// Files, which are not watched (temp files of server)
+	Ignore func(name string) bool
+}
+
+// Not sent change of file
+type change struct {
+	op       journal.Op
+	old_path string // only for move
+	is_dir   bool
+	modified bool // file was modified after move
+
+	seq     uint64 // order of changes
+	found   time.Time
+	updated time.Time
+}
+
+// Moved file, which isn't paired with new name yet
+type movedFrom struct {
+	path   string
+	is_dir bool
+	time   time.Time
+}
+
+// State of file for rescan
+type entry struct {
+	size     int64
+	mod_time time.Time
+	is_dir   bool
+}
+
+/*
+Watcher of services folders of all users in workspace. Kernel events are merged and sent to handler
+after DEBOUNCE_DURATION, so copied file is sent once. If inotify watch limit is reached (fs.inotify.max_user_watches),
+watcher falls back to periodic rescans of workspace.
+*/
+type Watcher struct {
+	cfg     Config
+	root    string
+	handler Handler
+
+	// Inotify descriptor. -1 in rescan mode.
+	fd      int
+	watches map[int]string // watch descriptor -> folder path
+	moves   map[uint32]movedFrom
+
+	pending   map[string]*change // by absolute path
+	postponed []Event
+	seq       uint64
+
+	snapshot    map[string]entry
+	last_rescan time.Time
+}
+
+func New(cfg Config, handler Handler) *Watcher {
+	if cfg.RescanInterval <= 0 {
+		cfg.RescanInterval = DEFAULT_RESCAN_INTERVAL
+	}
+
+	if cfg.Ignore == nil {
+		cfg.Ignore = func(string) bool { return false }
+	}
+
+	return &Watcher{
+		cfg:     cfg,
+		root:    filepath.Clean(cfg.WorkspacePath),
+		handler: handler,
+		fd:      -1,
+		watches: make(map[int]string),
+		moves:   make(map[uint32]movedFrom),
+		pending: make(map[string]*change),
+	}
+}
+
+// Return user and path in service folder. Ok is false, if path is not in service folder.
+func (w *Watcher) split(abs_path string, is_dir bool) (string, string, bool) {
+	rel, err := filepath.Rel(w.root, abs_path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(rel, string(filepath.Separator), 3)
+	if len(parts) < 3 || parts[1] != string(w.cfg.Service) {
+		return "", "", false
+	}
+
+	path := "/" + filepath.ToSlash(parts[2])
+	if is_dir {
+		path += "/"
+	}
+	return parts[0], path, true
+}
+
+// Depth of folder: 0 - workspace, 1 - user folder, 2 and more - service folder and subfolders
+func (w *Watcher) depth(abs_path string) int {
+	rel, err := filepath.Rel(w.root, abs_path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+func (w *Watcher) serviceDir(user_dir string) string {
+	return filepath.Join(user_dir, string(w.cfg.Service))
+}
+
+/*
+Watch workspace, while context is not done. Changes made before start are not found,
+because journal has changes made through the server.
+*/
+func (w *Watcher) Run(ctx context.Context) {
+	if w.cfg.RescanOnly {
+		w.startRescan()
+	} else if err := w.startInotify(); err != nil {
+		if !errors.Is(err, ErrWatchLimit) {
+			slog.Error("failed start inotify. Use rescan", slog.String("service", string(w.cfg.Service)), slog.Any("err", err))
+		}
+		w.startRescan()
+	}
+
+	ticker := time.NewTicker(FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		if w.fd >= 0 {
+			if err := w.readEvents(); err != nil {
+				if !errors.Is(err, ErrWatchLimit) {
+					slog.Error("failed read inotify events. Use rescan", slog.String("service", string(w.cfg.Service)), slog.Any("err", err))
+				}
+				w.startRescan()
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+
+			if time.Since(w.last_rescan) >= w.cfg.RescanInterval {
+				w.rescan()
+			}
+		}
+
+		if ctx.Err() != nil {
+			w.closeInotify()
+			return
+		}
+
+		w.flush(time.Now())
+	}
+}
+
+func (w *Watcher) startInotify() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	w.fd = fd
+
+	if err := w.addWatch(w.root, ROOT_WATCH_MASK); err != nil {
+		w.closeInotify()
+		return err
+	}
+
+	users, err := os.ReadDir(w.root)
+	if err != nil {
+		w.closeInotify()
+		return err
+	}
+
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+
+		if err := w.addUser(filepath.Join(w.root, user.Name()), false); err != nil {
+			w.closeInotify()
+			return err
+		}
+	}
+
+	slog.Info("Watch workspace with inotify", slog.String("service", string(w.cfg.Service)), slog.Int("watches", len(w.watches)))
+	return nil
+}
+
+func (w *Watcher) closeInotify() {
+	if w.fd >= 0 {
+		_ = unix.Close(w.fd)
+		w.fd = -1
+	}
+	clear(w.watches)
+	clear(w.moves)
+}
+
+func (w *Watcher) addWatch(path string, mask uint32) error {
+	wd, err := unix.InotifyAddWatch(w.fd, path, mask)
+	if err != nil {
+		if errors.Is(err, unix.ENOSPC) {
+			slog.Warn("inotify watch limit reached (fs.inotify.max_user_watches). Use rescan", slog.String("service", string(w.cfg.Service)))
+			return ErrWatchLimit
+		}
+
+		// Folder was removed before watch
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+			return nil
+		}
+		return err
+	}
+
+	w.watches[wd] = path
+	return nil
+}
+
+// Remove watches of folder and subfolders, when folder is moved out of workspace
+func (w *Watcher) removeWatches(dir string) {
+	for wd, path := range w.watches {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+}
+
+// Update watched folders paths after folder move
+func (w *Watcher) moveWatches(old_dir, new_dir string) {
+	for wd, path := range w.watches {
+		if path == old_dir {
+			w.watches[wd] = new_dir
+		} else if rest, ok := strings.CutPrefix(path, old_dir+string(filepath.Separator)); ok {
+			w.watches[wd] = filepath.Join(new_dir, rest)
+		}
+	}
+}
+
+func (w *Watcher) addUser(user_dir string, found bool) error {
+	if err := w.addWatch(user_dir, ROOT_WATCH_MASK); err != nil {
+		return err
+	}
+
+	service_dir := w.serviceDir(user_dir)
+	if info, err := os.Stat(service_dir); err == nil && info.IsDir() {
+		return w.addTree(service_dir, found)
+	}
+	return nil
+}
+
+// Watch folder with subfolders. If found is true, files in folder are sent as created (they were created before watch).
+func (w *Watcher) addTree(dir string, found bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// File was removed while walking
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if w.cfg.Ignore(d.Name()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if err := w.addWatch(path, TREE_WATCH_MASK); err != nil {
+				return err
+			}
+		}
+
+		if found && path != dir {
+			w.push(path, journal.OP_CREATE, d.IsDir())
+		}
+		return nil
+	})
+}
+
+// Read and handle available inotify events. Wait for events no more than FLUSH_INTERVAL.
+func (w *Watcher) readEvents() error {
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	if _, err := unix.Poll(fds, int(FLUSH_INTERVAL.Milliseconds())); err != nil && !errors.Is(err, unix.EINTR) {
+		return err
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				return nil
+			}
+			return err
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name_bytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(raw.Len)]
+			name := strings.TrimRight(string(name_bytes), "\x00")
+			offset += unix.SizeofInotifyEvent + int(raw.Len)
+
+			if err := w.handleEvent(int(raw.Wd), raw.Mask, raw.Cookie, name); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *Watcher) handleEvent(wd int, mask, cookie uint32, name string) error {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		slog.Warn("inotify events queue overflow, some changes are lost", slog.String("service", string(w.cfg.Service)))
+		return nil
+	}
+
+	dir, ok := w.watches[wd]
+	if !ok {
+		return nil
+	}
+
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.watches, wd)
+		return nil
+	}
+
+	if name == "" || w.cfg.Ignore(name) {
+		return nil
+	}
+
+	path := filepath.Join(dir, name)
+	is_dir := mask&unix.IN_ISDIR != 0
+
+	switch w.depth(dir) {
+	case 0:
+		// New user
+		if is_dir && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			return w.addUser(path, true)
+		}
+		return nil
+	case 1:
+		// New service folder of user
+		if is_dir && name == string(w.cfg.Service) && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			return w.addTree(path, true)
+		}
+		return nil
+	}
+
+	switch {
+	case mask&unix.IN_CREATE != 0:
+		w.push(path, journal.OP_CREATE, is_dir)
+		if is_dir {
+			return w.addTree(path, true)
+		}
+	case mask&(unix.IN_MODIFY|unix.IN_CLOSE_WRITE) != 0:
+		w.push(path, journal.OP_MODIFY, is_dir)
+	case mask&unix.IN_DELETE != 0:
+		w.push(path, journal.OP_REMOVE, is_dir)
+	case mask&unix.IN_MOVED_FROM != 0:
+		w.moves[cookie] = movedFrom{path: path, is_dir: is_dir, time: time.Now()}
+	case mask&unix.IN_MOVED_TO != 0:
+		from, ok := w.moves[cookie]
+		if !ok {
+			// Moved from folder, which is not watched
+			w.push(path, journal.OP_CREATE, is_dir)
+			if is_dir {
+				return w.addTree(path, true)
+			}
+			return nil
+		}
+
+		delete(w.moves, cookie)
+		w.pushMove(from.path, path, is_dir)
+		if is_dir {
+			w.moveWatches(from.path, path)
+		}
+	}
+	return nil
+}
+
+// Add change to pending changes and merge it with previous change of file
+func (w *Watcher) push(path string, op journal.Op, is_dir bool) {
+	now := time.Now()
+
+	prev, ok := w.pending[path]
+	if !ok {
+		w.seq++
+		w.pending[path] = &change{op: op, is_dir: is_dir, seq: w.seq, found: now, updated: now}
+		return
+	}
+
+	prev.updated = now
+	prev.is_dir = is_dir
+	switch {
+	case prev.op == journal.OP_CREATE && op == journal.OP_MODIFY:
+	case prev.op == journal.OP_CREATE && op == journal.OP_REMOVE:
+		// File was created and removed before it was sent
+		delete(w.pending, path)
+	case prev.op == journal.OP_REMOVE && op == journal.OP_CREATE && !is_dir:
+		prev.op = journal.OP_MODIFY
+	case prev.op == journal.OP_MOVE && op == journal.OP_MODIFY:
+		prev.modified = true
+	case prev.op == journal.OP_MOVE && op == journal.OP_REMOVE:
+		// Moved file was removed, so old file is removed
+		delete(w.pending, path)
+		w.push(prev.old_path, journal.OP_REMOVE, is_dir)
+	default:
+		prev.op = op
+	}
+}
+
+func (w *Watcher) pushMove(old_path, new_path string, is_dir bool) {
+	now := time.Now()
+
+	next := &change{op: journal.OP_MOVE, old_path: old_path, is_dir: is_dir, found: now, updated: now}
+	if prev, ok := w.pending[old_path]; ok {
+		delete(w.pending, old_path)
+		next.seq = prev.seq
+
+		switch prev.op {
+		case journal.OP_CREATE:
+			// Not sent file is sent as created with new name
+			next.op, next.old_path = journal.OP_CREATE, ""
+		case journal.OP_MOVE:
+			next.old_path = prev.old_path
+			next.modified = prev.modified
+		case journal.OP_MODIFY:
+			next.modified = true
+		}
+	} else {
+		w.seq++
+		next.seq = w.seq
+	}
+
+	// Paths of not sent changes in moved folder are changed
+	if is_dir {
+		prefix := old_path + string(filepath.Separator)
+		for path, c := range w.pending {
+			if rest, ok := strings.CutPrefix(path, prefix); ok {
+				delete(w.pending, path)
+				w.pending[filepath.Join(new_path, rest)] = c
+			}
+		}
+	}
+
+	w.pending[new_path] = next
+}
+
+// Send changes, which weren't updated for DEBOUNCE_DURATION, to handler
+func (w *Watcher) flush(now time.Time) {
+	// Not paired moves are moves out of workspace
+	for cookie, from := range w.moves {
+		if now.Sub(from.time) >= FLUSH_INTERVAL {
+			delete(w.moves, cookie)
+			w.push(from.path, journal.OP_REMOVE, from.is_dir)
+			if from.is_dir {
+				w.removeWatches(from.path)
+			}
+		}
+	}
+
+	type ready struct {
+		path string
+		*change
+	}
+
+	var changes []ready
+	for path, c := range w.pending {
+		if now.Sub(c.updated) >= DEBOUNCE_DURATION {
+			changes = append(changes, ready{path, c})
+			delete(w.pending, path)
+		}
+	}
+
+	if len(changes) == 0 && len(w.postponed) == 0 {
+		return
+	}
+
+	slices.SortFunc(changes, func(a, b ready) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	events := w.postponed
+	for _, c := range changes {
+		user, path, ok := w.split(c.path, c.is_dir)
+		if !ok {
+			continue
+		}
+
+		event := Event{User: user, Event: journal.Event{Time: c.found.Unix(), Op: c.op, Path: path, IsDir: c.is_dir}}
+		if c.op == journal.OP_MOVE {
+			old_user, old_path, ok := w.split(c.old_path, c.is_dir)
+			if !ok || old_user != user {
+				event.Op = journal.OP_CREATE
+			} else {
+				event.OldPath = old_path
+			}
+		}
+		events = append(events, event)
+
+		if c.modified && !c.is_dir {
+			event.Op, event.OldPath = journal.OP_MODIFY, ""
+			events = append(events, event)
+		}
+	}
+
+	w.postponed = nil
+	if len(events) != 0 {
+		w.postponed = w.handler(events)
+	}
+}
@@ -0,0 +1,207 @@
+package fswatch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/repository/fswatch"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+)
+
+const (
+	WORKSPACE_PATH string             = "/tmp/mhserver_tests/fswatch/"
+	TEST_USER      string             = "mayuri"
+	SERVICE        config.ServiceName = "files"
+)
+
+// Events sent to handler
+type received struct {
+	events []fswatch.Event
+	mux    sync.Mutex
+}
+
+func (r *received) handle(events []fswatch.Event) []fswatch.Event {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.events = append(r.events, events...)
+	return nil
+}
+
+// Wait for count events
+func (r *received) wait(t *testing.T, count int) []fswatch.Event {
+	deadline := time.Now().Add(fswatch.DEBOUNCE_DURATION + 5*time.Second)
+	for time.Now().Before(deadline) {
+		r.mux.Lock()
+		if len(r.events) >= count {
+			events := r.events
+			r.events = nil
+			r.mux.Unlock()
+			return events
+		}
+		r.mux.Unlock()
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	t.Fatalf("expected %d events, but got %v", count, r.events)
+	return nil
+}
+
+func startWatcher(t *testing.T, rescan_only bool) (*received, string) {
+	if err := os.RemoveAll(WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	service_dir := filepath.Join(WORKSPACE_PATH, TEST_USER, string(SERVICE))
+	if err := os.MkdirAll(service_dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes made before start are not sent
+	if err := os.WriteFile(filepath.Join(service_dir, "old.txt"), []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+
+	r := &received{}
+	watcher := fswatch.New(fswatch.Config{
+		WorkspacePath:  WORKSPACE_PATH,
+		Service:        SERVICE,
+		RescanOnly:     rescan_only,
+		RescanInterval: time.Second,
+		Ignore: func(name string) bool {
+			return strings.HasSuffix(name, ".tmp")
+		},
+	}, r.handle)
+	go watcher.Run(ctx)
+
+	// Wait for watcher start
+	time.Sleep(200 * time.Millisecond)
+	return r, service_dir
+}
+
+func checkEvents(t *testing.T, got []fswatch.Event, expected []fswatch.Event) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, but got %v", expected, got)
+	}
+
+	for i := range expected {
+		if got[i].User != expected[i].User || got[i].Op != expected[i].Op || got[i].Path != expected[i].Path ||
+			got[i].OldPath != expected[i].OldPath || got[i].IsDir != expected[i].IsDir {
+			t.Errorf("expected event %v, but got %v", expected[i], got[i])
+		}
+	}
+}
+
+func TestInotify(t *testing.T) {
+	r, service_dir := startWatcher(t, false)
+
+	t.Run("copied files", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(service_dir, "photos", "2025"), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"photos/2025/cat.jpg", "notes.txt", "notes.txt.tmp"} {
+			if err := os.WriteFile(filepath.Join(service_dir, name), []byte("data"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Second write is merged with create
+		if err := os.WriteFile(filepath.Join(service_dir, "notes.txt"), []byte("new data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		checkEvents(t, r.wait(t, 4), []fswatch.Event{
+			{User: TEST_USER, Event: journal.Event{Op: journal.OP_CREATE, Path: "/photos/", IsDir: true}},
+			{User: TEST_USER, Event: journal.Event{Op: journal.OP_CREATE, Path: "/photos/2025/", IsDir: true}},
+			{User: TEST_USER, Event: journal.Event{Op: journal.OP_CREATE, Path: "/photos/2025/cat.jpg"}},
+			{User: TEST_USER, Event: journal.Event{Op: journal.OP_CREATE, Path: "/notes.txt"}},
+		})
+	})
+
+	t.Run("move and remove", func(t *testing.T) {
+		if err := os.Rename(filepath.Join(service_dir, "photos"), filepath.Join(service_dir, "images")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Remove(filepath.Join(service_dir, "old.txt")); err != nil {
+			t.Fatal(err)
+		}
+
+		checkEvents(t, r.wait(t, 2), []fswatch.Event{
+			{User: TEST_USER, Event: journal.Event{Op: journal.OP_MOVE, Path: "/images/", OldPath: "/photos/", IsDir: true}},
+			{User: TEST_USER, Event: journal.Event{Op: journal.OP_REMOVE, Path: "/old.txt"}},
+		})
+
+		// Moved folder is watched with new path
+		if err := os.WriteFile(filepath.Join(service_dir, "images", "2025", "cat.jpg"), []byte("cat"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		checkEvents(t, r.wait(t, 1), []fswatch.Event{
+			{User: TEST_USER, Event: journal.Event{Op: journal.OP_MODIFY, Path: "/images/2025/cat.jpg"}},
+		})
+	})
+
+	t.Run("new user", func(t *testing.T) {
+		new_service_dir := filepath.Join(WORKSPACE_PATH, "kurisu", string(SERVICE))
+		if err := os.MkdirAll(new_service_dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		// Watch of new folder is added after event, so wait for it
+		time.Sleep(fswatch.FLUSH_INTERVAL)
+		if err := os.WriteFile(filepath.Join(new_service_dir, "lab.txt"), []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		checkEvents(t, r.wait(t, 1), []fswatch.Event{
+			{User: "kurisu", Event: journal.Event{Op: journal.OP_CREATE, Path: "/lab.txt"}},
+		})
+	})
+}
+
+func TestRescan(t *testing.T) {
+	r, service_dir := startWatcher(t, true)
+
+	if err := os.MkdirAll(filepath.Join(service_dir, "music"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(service_dir, "music", "song.mp3"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(service_dir, "old.txt"), []byte("changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEvents(t, r.wait(t, 3), []fswatch.Event{
+		{User: TEST_USER, Event: journal.Event{Op: journal.OP_CREATE, Path: "/music/", IsDir: true}},
+		{User: TEST_USER, Event: journal.Event{Op: journal.OP_CREATE, Path: "/music/song.mp3"}},
+		{User: TEST_USER, Event: journal.Event{Op: journal.OP_MODIFY, Path: "/old.txt"}},
+	})
+
+	// Only removed folder is sent
+	if err := os.RemoveAll(filepath.Join(service_dir, "music")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEvents(t, r.wait(t, 1), []fswatch.Event{
+		{User: TEST_USER, Event: journal.Event{Op: journal.OP_REMOVE, Path: "/music/", IsDir: true}},
+	})
+}
@@ -0,0 +1,119 @@
+package fswatch
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+)
+
+// Stop inotify and watch workspace with periodic rescans
+func (w *Watcher) startRescan() {
+	w.closeInotify()
+
+	slog.Info("Watch workspace with rescans", slog.String("service", string(w.cfg.Service)), slog.Duration("interval", w.cfg.RescanInterval))
+	w.snapshot = w.scan()
+	w.last_rescan = time.Now()
+}
+
+// State of all files in services folders of users
+func (w *Watcher) scan() map[string]entry {
+	snapshot := make(map[string]entry)
+
+	users, err := os.ReadDir(w.root)
+	if err != nil {
+		slog.Error("failed read workspace", slog.String("service", string(w.cfg.Service)), slog.Any("err", err))
+		return snapshot
+	}
+
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+
+		service_dir := w.serviceDir(filepath.Join(w.root, user.Name()))
+		err := filepath.WalkDir(service_dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+
+			if w.cfg.Ignore(d.Name()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if path == service_dir {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			snapshot[path] = entry{size: info.Size(), mod_time: info.ModTime(), is_dir: d.IsDir()}
+			return nil
+		})
+		if err != nil {
+			slog.Error("failed scan user folder", slog.String("service", string(w.cfg.Service)), slog.String("user", user.Name()), slog.Any("err", err))
+		}
+	}
+
+	return snapshot
+}
+
+// Compare workspace with previous scan. Moves are found as remove and create.
+func (w *Watcher) rescan() {
+	snapshot := w.scan()
+	w.last_rescan = time.Now()
+
+	// Sorted paths, so folders are created before files in them
+	paths := make([]string, 0, len(snapshot))
+	for path := range snapshot {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		next := snapshot[path]
+		prev, ok := w.snapshot[path]
+		switch {
+		case !ok || prev.is_dir != next.is_dir:
+			w.push(path, journal.OP_CREATE, next.is_dir)
+		case !next.is_dir && (prev.size != next.size || !prev.mod_time.Equal(next.mod_time)):
+			w.push(path, journal.OP_MODIFY, false)
+		}
+	}
+
+	// Only removed folder is sent, without files in it
+	for path, prev := range w.snapshot {
+		if _, ok := snapshot[path]; ok || w.parentRemoved(path, snapshot) {
+			continue
+		}
+		w.push(path, journal.OP_REMOVE, prev.is_dir)
+	}
+
+	w.snapshot = snapshot
+}
+
+// Parent folder of path is removed too
+func (w *Watcher) parentRemoved(path string, snapshot map[string]entry) bool {
+	for dir := filepath.Dir(path); w.depth(dir) > 2; dir = filepath.Dir(dir) {
+		if _, ok := w.snapshot[dir]; ok {
+			if _, ok := snapshot[dir]; !ok {
+				return true
+			}
+		}
+	}
+	return false
+}
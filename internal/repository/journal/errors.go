@@ -0,0 +1,9 @@
+package journal
+
+import "errors"
+
+var (
+	ErrBadCursor      error = errors.New("bad changes cursor")
+	ErrCursorExpired  error = errors.New("changes cursor expired")
+	ErrDamagedJournal error = errors.New("changes journal is damaged")
+)
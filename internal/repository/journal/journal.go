@@ -0,0 +1,344 @@
+// Пакет с журналом изменений файлов пользователя для инкрементальной синхронизации клиентов.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Journal of service is saved in user workspace root: "/home/srv/.mhserver/" + username + "/.mhs_journal_files"
+	JOURNAL_FILENAME_PREFIX string = ".mhs_journal_"
+	LOCK_FILENAME_SUFFIX    string = ".lock"
+
+	// Old half of journal is removed, when journal is bigger
+	MAX_JOURNAL_SIZE int64 = 8 * 1024 * 1024
+
+	MAX_EVENTS_PER_READ int = 1000
+)
+
+type Op string
+
+const (
+	OP_CREATE Op = "create"
+	OP_MODIFY Op = "modify"
+	OP_MOVE   Op = "move"
+	OP_REMOVE Op = "remove"
+)
+
+/*
+File or directory change. Path is relative to service folder, directories end with "/" ("/photos/2025/").
+Cursor is position of journal after event, so reading from it returns next events.
+*/
+type Event struct {
+	Cursor  uint64 `json:"-"`
+	Time    int64  `json:"time"`
+	Op      Op     `json:"op"`
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"` // only for move
+	IsDir   bool   `json:"isDir,omitempty"`
+	Size    uint64 `json:"size,omitempty"`
+}
+
+// Part of journal after cursor
+type Changes struct {
+	Events []Event
+
+	// Cursor to continue reading
+	Cursor  uint64
+	HasMore bool
+}
+
+// First line of journal file
+type header struct {
+	// Cursor of first event in file. Events before it were removed.
+	Base uint64 `json:"base"`
+}
+
+/*
+Per-user journal of service changes. Journal is an append-only file with json lines, cursor is absolute
+position in it. Journal is shared between processes (main server and subservers), so it's locked with flock.
+*/
+type Journal struct {
+	workspacePath string
+	service       config.ServiceName
+	mux           *sync.RWMutex
+}
+
+func New(workspace_path string, service config.ServiceName) *Journal {
+	return &Journal{
+		workspacePath: workspace_path,
+		service:       service,
+		mux:           &sync.RWMutex{},
+	}
+}
+
+func (j *Journal) path(user string) string {
+	return fmt.Sprintf("%s%s/%s%s", j.workspacePath, user, JOURNAL_FILENAME_PREFIX, j.service)
+}
+
+// Lock journal of user for other processes. Return unlock function.
+func (j *Journal) lock(user string, how int) (func(), error) {
+	lock_file, err := os.OpenFile(j.path(user)+LOCK_FILENAME_SUFFIX, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Flock(int(lock_file.Fd()), how); err != nil {
+		_ = lock_file.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = unix.Flock(int(lock_file.Fd()), unix.LOCK_UN)
+		_ = lock_file.Close()
+	}, nil
+}
+
+func readHeader(r *bufio.Reader) (header, int64, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return header{}, 0, ErrDamagedJournal
+	}
+
+	var h header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return header{}, 0, ErrDamagedJournal
+	}
+	return h, int64(len(line)), nil
+}
+
+func writeHeader(w io.Writer, h header) error {
+	line, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// Record events in user journal. Event time is set to now, if it's empty.
+func (j *Journal) Record(user string, events ...Event) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	unlock, err := j.lock(user, unix.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(j.path(user), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	if info.Size() == 0 {
+		if err := writeHeader(w, header{}); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().Unix()
+	for _, event := range events {
+		if event.Time == 0 {
+			event.Time = now
+		}
+
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if info, err = file.Stat(); err != nil || info.Size() <= MAX_JOURNAL_SIZE {
+		return err
+	}
+	return j.compact(user, file, info.Size())
+}
+
+// Remove old half of journal. Cursors of kept events are not changed.
+func (j *Journal) compact(user string, file *os.File, size int64) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(file)
+	h, header_len, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+
+	// Keep events from line after the middle of journal
+	middle := header_len + (size-header_len)/2
+	if _, err := file.Seek(middle, io.SeekStart); err != nil {
+		return err
+	}
+
+	r.Reset(file)
+	skipped, err := r.ReadBytes('\n')
+	if err != nil {
+		return ErrDamagedJournal
+	}
+
+	tmp_path := j.path(user) + ".tmp"
+	tmp, err := os.OpenFile(tmp_path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	h.Base += uint64(middle - header_len + int64(len(skipped)))
+	err = writeHeader(tmp, h)
+	if err == nil {
+		_, err = io.Copy(tmp, r)
+	}
+
+	if err := errors.Join(err, tmp.Close()); err != nil {
+		_ = os.Remove(tmp_path)
+		return err
+	}
+
+	return os.Rename(tmp_path, j.path(user))
+}
+
+// Return current cursor of user journal. Events recorded after it are returned by Since.
+func (j *Journal) Cursor(user string) (uint64, error) {
+	j.mux.RLock()
+	defer j.mux.RUnlock()
+
+	unlock, err := j.lock(user, unix.LOCK_SH)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	file, err := os.Open(j.path(user))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	h, header_len, err := readHeader(bufio.NewReader(file))
+	if err != nil {
+		return 0, err
+	}
+	return h.Base + uint64(info.Size()-header_len), nil
+}
+
+/*
+Return events recorded after cursor (no more than limit) and cursor to continue reading.
+Return ErrCursorExpired, if events after cursor were removed from journal, and client must list all files again.
+*/
+func (j *Journal) Since(user string, cursor uint64, limit int) (Changes, error) {
+	j.mux.RLock()
+	defer j.mux.RUnlock()
+
+	if limit <= 0 || limit > MAX_EVENTS_PER_READ {
+		limit = MAX_EVENTS_PER_READ
+	}
+
+	unlock, err := j.lock(user, unix.LOCK_SH)
+	if err != nil {
+		return Changes{}, err
+	}
+	defer unlock()
+
+	file, err := os.Open(j.path(user))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			if cursor == 0 {
+				return Changes{}, nil
+			}
+			return Changes{}, ErrCursorExpired
+		}
+		return Changes{}, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Changes{}, err
+	}
+
+	r := bufio.NewReader(file)
+	h, header_len, err := readHeader(r)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	end := h.Base + uint64(info.Size()-header_len)
+	switch {
+	case cursor < h.Base:
+		return Changes{}, ErrCursorExpired
+	case cursor > end:
+		return Changes{}, ErrBadCursor
+	}
+
+	if _, err := file.Seek(header_len+int64(cursor-h.Base), io.SeekStart); err != nil {
+		return Changes{}, err
+	}
+	r.Reset(file)
+
+	changes := Changes{Cursor: cursor}
+	for len(changes.Events) < limit && changes.Cursor < end {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return Changes{}, ErrDamagedJournal
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			// Cursor isn't at the start of event
+			if len(changes.Events) == 0 {
+				return Changes{}, ErrBadCursor
+			}
+			return Changes{}, ErrDamagedJournal
+		}
+
+		changes.Cursor += uint64(len(line))
+		event.Cursor = changes.Cursor
+		changes.Events = append(changes.Events, event)
+	}
+
+	changes.HasMore = changes.Cursor < end
+	return changes, nil
+}
@@ -0,0 +1,185 @@
+package journal_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+)
+
+const (
+	WORKSPACE_PATH string = "/tmp/mhserver_tests/journal/"
+	TEST_USER      string = "suzuha"
+)
+
+func newJournal(t *testing.T) *journal.Journal {
+	if err := os.RemoveAll(WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(WORKSPACE_PATH+TEST_USER, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return journal.New(WORKSPACE_PATH, "files")
+}
+
+func TestJournal(t *testing.T) {
+	changes := newJournal(t)
+
+	t.Run("empty journal", func(t *testing.T) {
+		cursor, err := changes.Cursor(TEST_USER)
+		if err != nil || cursor != 0 {
+			t.Fatalf("expected zero cursor, but got %d (%v)", cursor, err)
+		}
+
+		got, err := changes.Since(TEST_USER, 0, 0)
+		if err != nil || len(got.Events) != 0 || got.HasMore {
+			t.Fatalf("expected no changes, but got %v (%v)", got, err)
+		}
+
+		if _, err := changes.Since(TEST_USER, 10, 0); !errors.Is(err, journal.ErrCursorExpired) {
+			t.Errorf("expected error %v, but got %v", journal.ErrCursorExpired, err)
+		}
+	})
+
+	events := []journal.Event{
+		{Op: journal.OP_CREATE, Path: "/photos/", IsDir: true},
+		{Op: journal.OP_CREATE, Path: "/photos/cat.jpg", Size: 100},
+		{Op: journal.OP_MOVE, Path: "/photos/dog.jpg", OldPath: "/photos/cat.jpg"},
+		{Op: journal.OP_REMOVE, Path: "/photos/", IsDir: true},
+	}
+
+	if err := changes.Record(TEST_USER, events[:2]...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := changes.Record(TEST_USER, events[2:]...); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("all changes", func(t *testing.T) {
+		got, err := changes.Since(TEST_USER, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got.Events) != len(events) || got.HasMore {
+			t.Fatalf("expected %d changes, but got %d", len(events), len(got.Events))
+		}
+
+		for i, event := range got.Events {
+			if event.Op != events[i].Op || event.Path != events[i].Path || event.OldPath != events[i].OldPath || event.Size != events[i].Size {
+				t.Errorf("expected change %v, but got %v", events[i], event)
+			}
+
+			if event.Time == 0 {
+				t.Errorf("change %d has no time", i)
+			}
+		}
+
+		cursor, err := changes.Cursor(TEST_USER)
+		if err != nil || cursor != got.Cursor {
+			t.Errorf("expected current cursor %d, but got %d (%v)", got.Cursor, cursor, err)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		var cursor uint64
+		var got []journal.Event
+		for {
+			page, err := changes.Since(TEST_USER, cursor, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(got, page.Events...)
+			cursor = page.Cursor
+			if !page.HasMore {
+				break
+			}
+		}
+
+		if len(got) != len(events) || got[3].Path != events[3].Path {
+			t.Errorf("expected %d changes, but got %v", len(events), got)
+		}
+
+		// Reading from event cursor returns next events
+		page, err := changes.Since(TEST_USER, got[1].Cursor, 0)
+		if err != nil || len(page.Events) != 2 || page.Events[0].Op != journal.OP_MOVE {
+			t.Errorf("bad changes after second event: %v (%v)", page, err)
+		}
+	})
+
+	t.Run("bad cursor", func(t *testing.T) {
+		page, err := changes.Since(TEST_USER, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := changes.Since(TEST_USER, page.Cursor-1, 0); !errors.Is(err, journal.ErrBadCursor) {
+			t.Errorf("expected error %v, but got %v", journal.ErrBadCursor, err)
+		}
+
+		if _, err := changes.Since(TEST_USER, page.Cursor*100, 0); !errors.Is(err, journal.ErrBadCursor) {
+			t.Errorf("expected error %v, but got %v", journal.ErrBadCursor, err)
+		}
+	})
+}
+
+func TestJournalCompaction(t *testing.T) {
+	changes := newJournal(t)
+
+	// Record events until journal is compacted
+	long_name := "/" + strings.Repeat("a", 1000)
+	var first_cursor, prev_cursor, last_cursor uint64
+	var last_path string
+	for i := 0; ; i++ {
+		last_path = fmt.Sprintf("%s%d", long_name, i)
+		if err := changes.Record(TEST_USER, journal.Event{Op: journal.OP_CREATE, Path: last_path}); err != nil {
+			t.Fatal(err)
+		}
+
+		cursor, err := changes.Cursor(TEST_USER)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			first_cursor = cursor
+		}
+
+		info, err := os.Stat(WORKSPACE_PATH + TEST_USER + "/" + journal.JOURNAL_FILENAME_PREFIX + "files")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Journal was compacted
+		if uint64(info.Size()) < cursor/2+1 {
+			last_cursor = cursor
+			break
+		}
+		prev_cursor = cursor
+	}
+
+	if _, err := changes.Since(TEST_USER, first_cursor, 0); !errors.Is(err, journal.ErrCursorExpired) {
+		t.Errorf("expected error %v, but got %v", journal.ErrCursorExpired, err)
+	}
+
+	// Cursors of kept events are not changed
+	page, err := changes.Since(TEST_USER, prev_cursor, 0)
+	if err != nil || len(page.Events) != 1 || page.Events[0].Path != last_path || page.Cursor != last_cursor {
+		t.Fatalf("bad last change after compaction: %v (%v)", page, err)
+	}
+
+	if err := changes.Record(TEST_USER, journal.Event{Op: journal.OP_REMOVE, Path: "/last"}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = changes.Since(TEST_USER, last_cursor, 0)
+	if err != nil || len(page.Events) != 1 || page.Events[0].Path != "/last" {
+		t.Errorf("bad changes after compaction: %v (%v)", page, err)
+	}
+}
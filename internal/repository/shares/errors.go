@@ -0,0 +1,9 @@
+package shares
+
+import "errors"
+
+var (
+	ErrShareNotFound    error = errors.New("share not found or expired")
+	ErrBadShareLifetime error = errors.New("share lifetime is out of limits")
+	ErrDamagedShares    error = errors.New("shares file is damaged")
+)
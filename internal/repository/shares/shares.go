@@ -0,0 +1,204 @@
+// Пакет с публичными ссылками на файлы пользователей.
+package shares
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+)
+
+const (
+	// Shares of service are saved in workspace root: "/home/srv/.mhserver/" + ".mhs_shares_files"
+	SHARES_FILENAME_PREFIX string = ".mhs_shares_"
+
+	DEFAULT_LIFETIME time.Duration = 7 * 24 * time.Hour
+	MAX_LIFETIME     time.Duration = 365 * 24 * time.Hour
+)
+
+// Public link to user file. Path is relative to service folder ("/docs/cv.pdf").
+type Share struct {
+	Token   string `json:"token"`
+	User    string `json:"user"`
+	Path    string `json:"path"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+}
+
+func (s Share) isExpired(now time.Time) bool {
+	return now.Unix() >= s.Expires
+}
+
+/*
+Shares of all users of service. Shares are kept in one json file, because share is found by token
+without user. Expired shares are removed on every change.
+*/
+type Shares struct {
+	path string
+	mux  *sync.Mutex
+}
+
+func New(workspace_path string, service config.ServiceName) *Shares {
+	return &Shares{
+		path: fmt.Sprintf("%s%s%s", workspace_path, SHARES_FILENAME_PREFIX, service),
+		mux:  &sync.Mutex{},
+	}
+}
+
+func (s *Shares) load() ([]Share, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var shares []Share
+	if err := json.Unmarshal(data, &shares); err != nil {
+		return nil, ErrDamagedShares
+	}
+	return shares, nil
+}
+
+// Save shares without expired ones. File is replaced atomically.
+func (s *Shares) save(shares []Share) error {
+	now := time.Now()
+	shares = slices.DeleteFunc(shares, func(share Share) bool {
+		return share.isExpired(now)
+	})
+
+	data, err := json.Marshal(shares)
+	if err != nil {
+		return err
+	}
+
+	tmp_path := s.path + ".tmp"
+	if err := os.WriteFile(tmp_path, data, 0600); err != nil {
+		_ = os.Remove(tmp_path)
+		return err
+	}
+	return os.Rename(tmp_path, s.path)
+}
+
+// Create share of user file. Zero lifetime means DEFAULT_LIFETIME.
+func (s *Shares) Create(user, path string, lifetime time.Duration) (Share, error) {
+	if lifetime == 0 {
+		lifetime = DEFAULT_LIFETIME
+	}
+
+	if lifetime < time.Second || lifetime > MAX_LIFETIME {
+		return Share{}, ErrBadShareLifetime
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	shares, err := s.load()
+	if err != nil {
+		return Share{}, err
+	}
+
+	now := time.Now()
+	share := Share{
+		Token:   rand.Text(),
+		User:    user,
+		Path:    path,
+		Created: now.Unix(),
+		Expires: now.Add(lifetime).Unix(),
+	}
+
+	return share, s.save(append(shares, share))
+}
+
+// Find share by token. Expired shares are not found.
+func (s *Shares) Get(token string) (Share, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	shares, err := s.load()
+	if err != nil {
+		return Share{}, err
+	}
+
+	i := slices.IndexFunc(shares, func(share Share) bool {
+		return share.Token == token
+	})
+	if i == -1 || shares[i].isExpired(time.Now()) {
+		return Share{}, ErrShareNotFound
+	}
+	return shares[i], nil
+}
+
+// Active shares of user
+func (s *Shares) List(user string) ([]Share, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	shares, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return slices.DeleteFunc(shares, func(share Share) bool {
+		return share.User != user || share.isExpired(now)
+	}), nil
+}
+
+// Remove share of user. Shares of other users are not found.
+func (s *Shares) Remove(user, token string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	shares, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(shares, func(share Share) bool {
+		return share.Token == token && share.User == user
+	})
+	if i == -1 {
+		return ErrShareNotFound
+	}
+	return s.save(slices.Delete(shares, i, i+1))
+}
+
+/*
+Update shares of user after file or directory move. Directory paths end with "/",
+so shares of all files in directory are moved.
+*/
+func (s *Shares) Move(user, old_path, new_path string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	shares, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	moved := false
+	for i, share := range shares {
+		if share.User != user {
+			continue
+		}
+
+		if share.Path == old_path || (strings.HasSuffix(old_path, "/") && strings.HasPrefix(share.Path, old_path)) {
+			shares[i].Path = new_path + strings.TrimPrefix(share.Path, old_path)
+			moved = true
+		}
+	}
+
+	if !moved {
+		return nil
+	}
+	return s.save(shares)
+}
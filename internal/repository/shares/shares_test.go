@@ -0,0 +1,112 @@
+package shares_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/repository/shares"
+)
+
+const (
+	WORKSPACE_PATH string = "/tmp/mhserver_tests/shares/"
+	TEST_USER      string = "kurisu"
+	OTHER_USER     string = "daru"
+)
+
+func newShares(t *testing.T) *shares.Shares {
+	if err := os.RemoveAll(WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(WORKSPACE_PATH, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return shares.New(WORKSPACE_PATH, "files")
+}
+
+func TestShares(t *testing.T) {
+	links := newShares(t)
+
+	t.Run("bad lifetime", func(t *testing.T) {
+		for _, lifetime := range []time.Duration{-time.Hour, time.Millisecond, shares.MAX_LIFETIME + time.Hour} {
+			if _, err := links.Create(TEST_USER, "/paper.pdf", lifetime); !errors.Is(err, shares.ErrBadShareLifetime) {
+				t.Errorf("lifetime %s: expected %v, but got %v", lifetime, shares.ErrBadShareLifetime, err)
+			}
+		}
+	})
+
+	paper, err := links.Create(TEST_USER, "/lab/paper.pdf", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if paper.Token == "" || paper.Expires-paper.Created != int64(shares.DEFAULT_LIFETIME.Seconds()) {
+		t.Errorf("expected share with default lifetime, but got %+v", paper)
+	}
+
+	expiring, err := links.Create(TEST_USER, "/lab/notes.txt", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := links.Create(OTHER_USER, "/lab/paper.pdf", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("get", func(t *testing.T) {
+		got, err := links.Get(paper.Token)
+		if err != nil || got != paper {
+			t.Errorf("expected %+v, but got %+v (%v)", paper, got, err)
+		}
+
+		if _, err := links.Get("tuturu"); !errors.Is(err, shares.ErrShareNotFound) {
+			t.Errorf("expected %v, but got %v", shares.ErrShareNotFound, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		list, err := links.List(TEST_USER)
+		if err != nil || len(list) != 2 {
+			t.Errorf("expected 2 shares, but got %+v (%v)", list, err)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		if err := links.Move(TEST_USER, "/lab/", "/archive/lab/"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := links.Get(paper.Token); err != nil || got.Path != "/archive/lab/paper.pdf" {
+			t.Errorf("expected moved share, but got %+v (%v)", got, err)
+		}
+
+		if got, err := links.Get(other.Token); err != nil || got.Path != other.Path {
+			t.Errorf("expected not moved share of other user, but got %+v (%v)", got, err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := links.Remove(OTHER_USER, paper.Token); !errors.Is(err, shares.ErrShareNotFound) {
+			t.Errorf("expected %v for share of other user, but got %v", shares.ErrShareNotFound, err)
+		}
+
+		if err := links.Remove(TEST_USER, paper.Token); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := links.Get(paper.Token); !errors.Is(err, shares.ErrShareNotFound) {
+			t.Errorf("expected %v for removed share, but got %v", shares.ErrShareNotFound, err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		time.Sleep(time.Until(time.Unix(expiring.Expires, 0)))
+
+		if _, err := links.Get(expiring.Token); !errors.Is(err, shares.ErrShareNotFound) {
+			t.Errorf("expected %v for expired share, but got %v", shares.ErrShareNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package userfs
+
+import (
+	"context"
+	"crypto/cipher"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+	"golang.org/x/net/webdav"
+)
+
+// Chunk size of encrypted files written through user file system. File size is unknown before upload end, so it's constant.
+const ENCRYPTED_CHUNK_SIZE uint64 = 1024 * 1024 // 1 mb
+
+// File info with plain size of encrypted file
+type plainFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i plainFileInfo) Size() int64 {
+	return i.size
+}
+
+/*
+File system, which encrypts and decrypts user files, if encryption is enabled.
+Plain files (saved before encryption was enabled) are read as is.
+
+Encrypted files can be only rewritten from start, because WebDAV and SFTP clients upload files entirely.
+*/
+type encryptedFS struct {
+	webdav.FileSystem
+	aead cipher.AEAD
+}
+
+func (efs encryptedFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	f, err := efs.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return f.Stat()
+}
+
+func (efs encryptedFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := efs.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	// webdav.Dir always returns *os.File
+	file, ok := f.(*os.File)
+	if !ok {
+		return f, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return encryptedDir{File: file, aead: efs.aead}, nil
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		enc_file, ok, err := filecrypt.Open(file, efs.aead)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+
+		if !ok {
+			return file, nil
+		}
+		return &encryptedReader{file: file, enc: enc_file}, nil
+	}
+
+	if flag&os.O_TRUNC == 0 && info.Size() != 0 {
+		_ = file.Close()
+		return nil, ErrNotSequentialWrite
+	}
+
+	writer, err := filecrypt.NewWriter(file, efs.aead, ENCRYPTED_CHUNK_SIZE)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &encryptedWriter{file: file, writer: writer}, nil
+}
+
+// Plain size of encrypted file. Return false, if file is not encrypted.
+func plainSize(path string, aead cipher.AEAD) (int64, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	header, ok, err := filecrypt.ReadHeader(file, aead)
+	if err != nil || !ok {
+		return 0, false
+	}
+	return int64(header.Size), true
+}
+
+// Directory with encrypted files. Files in listing have plain sizes.
+type encryptedDir struct {
+	*os.File
+	aead cipher.AEAD
+}
+
+func (d encryptedDir) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	for i, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		if size, ok := plainSize(filepath.Join(d.Name(), info.Name()), d.aead); ok {
+			infos[i] = plainFileInfo{FileInfo: info, size: size}
+		}
+	}
+	return infos, err
+}
+
+// Encrypted file opened for reading. *os.File isn't embedded, so plain data can't be read by mistake.
+type encryptedReader struct {
+	file   *os.File
+	enc    *filecrypt.File
+	offset int64
+}
+
+func (r *encryptedReader) Read(p []byte) (int, error) {
+	n, err := r.enc.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *encryptedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.enc.Size()
+	}
+
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *encryptedReader) Write([]byte) (int, error) {
+	return 0, ErrWriteToReadOnlyFile
+}
+
+func (r *encryptedReader) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (r *encryptedReader) Stat() (fs.FileInfo, error) {
+	info, err := r.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return plainFileInfo{FileInfo: info, size: r.enc.Size()}, nil
+}
+
+func (r *encryptedReader) Close() error {
+	return r.file.Close()
+}
+
+// Encrypted file opened for writing. Header with file size is written on Close.
+type encryptedWriter struct {
+	file   *os.File
+	writer *filecrypt.Writer
+}
+
+func (w *encryptedWriter) Read([]byte) (int, error) {
+	return 0, ErrReadFromWriteOnlyFile
+}
+
+func (w *encryptedWriter) Seek(offset int64, whence int) (int64, error) {
+	size := int64(w.writer.Size())
+	switch whence {
+	case io.SeekCurrent, io.SeekEnd:
+		offset += size
+	}
+
+	// Position can't be changed
+	if offset != size {
+		return 0, ErrNotSequentialWrite
+	}
+	return size, nil
+}
+
+func (w *encryptedWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+func (w *encryptedWriter) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (w *encryptedWriter) Stat() (fs.FileInfo, error) {
+	info, err := w.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return plainFileInfo{FileInfo: info, size: int64(w.writer.Size())}, nil
+}
+
+func (w *encryptedWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,152 @@
+package userfs
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	"golang.org/x/net/webdav"
+)
+
+// Path in journal format: directories end with "/"
+func journalPath(name string, is_dir bool) string {
+	name = path.Clean("/" + name)
+	if is_dir && name != "/" {
+		name += "/"
+	}
+	return name
+}
+
+// File system, which records changes of user files in journal, so sync clients see them
+type journalFS struct {
+	webdav.FileSystem
+	journal *journal.Journal
+	user    string
+}
+
+// Record changes made through fs in user journal
+func WithJournal(fs webdav.FileSystem, changes *journal.Journal, user string) webdav.FileSystem {
+	return journalFS{
+		FileSystem: fs,
+		journal:    changes,
+		user:       user,
+	}
+}
+
+// Journal errors don't fail file operations
+func (fs journalFS) record(event journal.Event) {
+	if err := fs.journal.Record(fs.user, event); err != nil {
+		slog.Warn("failed record change", slog.String("user", fs.user), slog.Any("err", err))
+	}
+}
+
+func (fs journalFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if err := fs.FileSystem.Mkdir(ctx, name, perm); err != nil {
+		return err
+	}
+
+	fs.record(journal.Event{Op: journal.OP_CREATE, Path: journalPath(name, true), IsDir: true})
+	return nil
+}
+
+func (fs journalFS) RemoveAll(ctx context.Context, name string) error {
+	info, stat_err := fs.FileSystem.Stat(ctx, name)
+	if err := fs.FileSystem.RemoveAll(ctx, name); err != nil {
+		return err
+	}
+
+	// Nothing was removed
+	if stat_err != nil {
+		return nil
+	}
+
+	fs.record(journal.Event{Op: journal.OP_REMOVE, Path: journalPath(name, info.IsDir()), IsDir: info.IsDir()})
+	return nil
+}
+
+func (fs journalFS) Rename(ctx context.Context, old_name, new_name string) error {
+	info, err := fs.FileSystem.Stat(ctx, old_name)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.FileSystem.Rename(ctx, old_name, new_name); err != nil {
+		return err
+	}
+
+	fs.record(journal.Event{
+		Op:      journal.OP_MOVE,
+		Path:    journalPath(new_name, info.IsDir()),
+		OldPath: journalPath(old_name, info.IsDir()),
+		IsDir:   info.IsDir(),
+	})
+	return nil
+}
+
+func (fs journalFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fs.FileSystem.OpenFile(ctx, name, flag, perm)
+	}
+
+	_, stat_err := fs.FileSystem.Stat(ctx, name)
+	file, err := fs.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	jf := &journalFile{
+		File:    file,
+		fs:      fs,
+		name:    name,
+		created: stat_err != nil,
+		changed: stat_err != nil || flag&os.O_TRUNC != 0,
+	}
+
+	// Directories are opened for writing too, but can't be changed by it
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		jf.changed = false
+	}
+	return jf, nil
+}
+
+// File, which records change on close, if it was created or written
+type journalFile struct {
+	webdav.File
+	fs      journalFS
+	name    string
+	created bool
+	changed bool
+}
+
+func (f *journalFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if n > 0 {
+		f.changed = true
+	}
+	return n, err
+}
+
+func (f *journalFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+
+	if !f.changed {
+		return nil
+	}
+	f.changed = false
+
+	event := journal.Event{Op: journal.OP_MODIFY, Path: journalPath(f.name, false)}
+	if f.created {
+		event.Op = journal.OP_CREATE
+	}
+
+	if info, err := f.fs.FileSystem.Stat(context.Background(), f.name); err == nil {
+		event.Size = uint64(info.Size())
+	}
+
+	f.fs.record(event)
+	return nil
+}
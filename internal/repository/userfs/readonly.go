@@ -0,0 +1,38 @@
+package userfs
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/net/webdav"
+)
+
+const WRITE_FLAGS int = os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_TRUNC | os.O_APPEND
+
+// File system, which allows only reading. Used for guests.
+type readOnlyFS struct {
+	webdav.FileSystem
+}
+
+func ReadOnly(fs webdav.FileSystem) webdav.FileSystem {
+	return readOnlyFS{FileSystem: fs}
+}
+
+func (readOnlyFS) Mkdir(context.Context, string, os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (readOnlyFS) RemoveAll(context.Context, string) error {
+	return os.ErrPermission
+}
+
+func (readOnlyFS) Rename(context.Context, string, string) error {
+	return os.ErrPermission
+}
+
+func (fs readOnlyFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&WRITE_FLAGS != 0 {
+		return nil, os.ErrPermission
+	}
+	return fs.FileSystem.OpenFile(ctx, name, flag, perm)
+}
@@ -0,0 +1,66 @@
+package userfs
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+	"golang.org/x/net/webdav"
+)
+
+// File system, which refuses writes, when disk has no space besides space reserved by running uploads
+type spaceFS struct {
+	webdav.FileSystem
+	dir string
+}
+
+// Check free space of disk with dir before each write. File, which isn't written entirely, is removed on close.
+func WithSpaceCheck(fs webdav.FileSystem, dir string) webdav.FileSystem {
+	return spaceFS{
+		FileSystem: fs,
+		dir:        dir,
+	}
+}
+
+func (fs spaceFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	file, err := fs.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return file, err
+	}
+	return &spaceFile{File: file, fs: fs, name: name}, nil
+}
+
+type spaceFile struct {
+	webdav.File
+	fs   spaceFS
+	name string
+
+	// Write was refused, so file is incomplete
+	full bool
+}
+
+func (f *spaceFile) Write(p []byte) (int, error) {
+	has_space, err := freemem.HasSpace(f.fs.dir, uint64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	if !has_space {
+		f.full = true
+		return 0, ErrNotEnoughDiskSpace
+	}
+	return f.File.Write(p)
+}
+
+func (f *spaceFile) Close() error {
+	err := f.File.Close()
+	if !f.full {
+		return err
+	}
+
+	if err := f.fs.FileSystem.RemoveAll(context.Background(), f.name); err != nil {
+		slog.Warn("failed remove incomplete file", slog.String("name", f.name), slog.Any("err", err))
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+// Пакет с файловой системой пользовательского каталога для WebDAV и SFTP.
+package userfs
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/net/webdav"
+)
+
+var (
+	// Permission error, so clients show it as "access denied"
+	ErrBadName = fmt.Errorf("%w: file or directory name have bad syntax", os.ErrPermission)
+
+	ErrNotSequentialWrite    = errors.New("encrypted files can be written only from start")
+	ErrWriteToReadOnlyFile   = errors.New("file opened for reading")
+	ErrReadFromWriteOnlyFile = errors.New("file opened for writing")
+	ErrNotEnoughDiskSpace    = errors.New("not enough disk space")
+)
+
+/*
+Return file system rooted at user service folder. New files and directories are checked with data service rules.
+If aead isn't nil, files are encrypted the same way as in data service.
+*/
+func New(root string, aead cipher.AEAD) webdav.FileSystem {
+	var fs webdav.FileSystem = webdav.Dir(root)
+	if aead != nil {
+		fs = encryptedFS{FileSystem: fs, aead: aead}
+	}
+	return validatingFS{FileSystem: fs}
+}
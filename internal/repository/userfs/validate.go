@@ -0,0 +1,76 @@
+package userfs
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"golang.org/x/net/webdav"
+)
+
+// Check new directory with the same rules as data service
+func checkDirName(name string) error {
+	dir := path.Clean("/" + name)
+	if dir != "/" {
+		dir += "/"
+	}
+
+	if dirs.CheckDirSyntax(dir) != nil {
+		return ErrBadName
+	}
+	return nil
+}
+
+// Check new file with the same rules as data service
+func checkFileName(name string) error {
+	dir, filename := path.Split(path.Clean("/" + name))
+	if err := checkDirName(dir); err != nil {
+		return err
+	}
+
+	if !data.IsValidFilename(filename) {
+		return ErrBadName
+	}
+	return nil
+}
+
+// File system, which doesn't allow to create files and directories with bad names
+type validatingFS struct {
+	webdav.FileSystem
+}
+
+func (fs validatingFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if err := checkDirName(name); err != nil {
+		return err
+	}
+	return fs.FileSystem.Mkdir(ctx, name, perm)
+}
+
+func (fs validatingFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&os.O_CREATE != 0 {
+		if err := checkFileName(name); err != nil {
+			return nil, err
+		}
+	}
+	return fs.FileSystem.OpenFile(ctx, name, flag, perm)
+}
+
+func (fs validatingFS) Rename(ctx context.Context, old_name, new_name string) error {
+	info, err := fs.FileSystem.Stat(ctx, old_name)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		err = checkDirName(new_name)
+	} else {
+		err = checkFileName(new_name)
+	}
+
+	if err != nil {
+		return err
+	}
+	return fs.FileSystem.Rename(ctx, old_name, new_name)
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/braginantonev/mhserver/internal/config"
 	authhttp "github.com/braginantonev/mhserver/internal/http/auth"
 	datahttp "github.com/braginantonev/mhserver/internal/http/data"
+	davhttp "github.com/braginantonev/mhserver/internal/http/dav"
+	"github.com/braginantonev/mhserver/internal/service/auth"
 	"github.com/braginantonev/mhserver/version"
 	"github.com/gorilla/mux"
 	"golang.org/x/time/rate"
@@ -18,8 +20,37 @@ import (
 const (
 	// Auth
 
-	LOGIN_ENDPOINT    string = "/api/v1/users/login"
-	REGISTER_ENDPOINT string = "/api/v1/users/register"
+	LOGIN_ENDPOINT           string = "/api/v1/users/login"
+	REGISTER_ENDPOINT        string = "/api/v1/users/register"
+	REFRESH_ENDPOINT         string = "/api/v1/users/refresh"
+	LOGOUT_ENDPOINT          string = "/api/v1/users/logout"
+	SESSIONS_ENDPOINT        string = "/api/v1/users/sessions"
+	PASSWORD_ENDPOINT        string = "/api/v1/users/password"
+	RESET_PASSWORD_ENDPOINT  string = "/api/v1/users/password/reset"
+	PUBLIC_KEYS_ENDPOINT     string = "/api/v1/users/keys"
+	USER_INVITES_ENDPOINT    string = "/api/v1/users/invites"
+	LOGIN_TOTP_ENDPOINT      string = "/api/v1/users/login/totp"
+	TOTP_ENDPOINT            string = "/api/v1/users/totp"
+	TOTP_CONFIRM_ENDPOINT    string = "/api/v1/users/totp/confirm"
+	TOTP_DISABLE_ENDPOINT    string = "/api/v1/users/totp/disable"
+	PERSONAL_TOKENS_ENDPOINT string = "/api/v1/users/tokens"
+
+	// Invite links are checked without authorization: "/api/v1/invites/{key}"
+	INVITES_ENDPOINT string = "/api/v1/invites"
+
+	// Public keys of access tokens
+	JWKS_ENDPOINT string = "/.well-known/jwks.json"
+
+	// Administration
+
+	ADMIN_USERS_ENDPOINT          string = "/api/v1/admin/users"
+	ADMIN_DISABLE_USER_ENDPOINT   string = "/api/v1/admin/users/disable"
+	ADMIN_ENABLE_USER_ENDPOINT    string = "/api/v1/admin/users/enable"
+	ADMIN_USER_ROLE_ENDPOINT      string = "/api/v1/admin/users/role"
+	ADMIN_STORAGE_ENDPOINT        string = "/api/v1/admin/storage"
+	ADMIN_REGISTER_KEYS_ENDPOINT  string = "/api/v1/admin/register-keys"
+	ADMIN_LOCKOUTS_ENDPOINT       string = "/api/v1/admin/lockouts"
+	ADMIN_LOGIN_ATTEMPTS_ENDPOINT string = "/api/v1/admin/login-attempts"
 
 	// Data
 
@@ -31,12 +62,33 @@ const (
 	GET_AVAILABLE_SPACE_ENDPOINT string = "/api/v1/files/space"
 	CREATE_DIR_ENDPOINT          string = "/api/v1/files/mkdir"
 	REMOVE_DIR_ENDPOINT          string = "/api/v1/files/rmdir"
+	REMOVE_FILE_ENDPOINT         string = "/api/v1/files/remove"
+	MOVE_ENDPOINT                string = "/api/v1/files/move"
+	SHARES_ENDPOINT              string = "/api/v1/files/shares"
+	DOWNLOAD_ZIP_ENDPOINT        string = "/api/v1/files/zip"
+	EXTRACT_ENDPOINT             string = "/api/v1/files/extract"
+	DOWNLOAD_ENDPOINT            string = "/api/v1/files/download"
+	TUS_ENDPOINT                 string = "/api/v1/files/tus"
+	SIGNATURE_ENDPOINT           string = "/api/v1/files/signature"
+	DELTA_ENDPOINT               string = "/api/v1/files/delta"
+	CHANGES_ENDPOINT             string = "/api/v1/files/changes"
+	EVENTS_ENDPOINT              string = "/api/v1/files/events"
+
+	// WebDAV
+
+	DAV_ENDPOINT string = "/api/v1/dav"
+
+	// Shared files are downloaded without authorization: "/api/v1/share/{token}"
+	SHARE_ENDPOINT string = "/api/v1/share"
 )
 
 type Server struct {
 	sem           chan any
 	AuthTransport *authhttp.AuthTransport
 	DataTransport *datahttp.DataTransport
+
+	// Nil, if WebDAV is disabled
+	DavHandler *davhttp.Handler
 }
 
 func NewServer(memory_cfg config.MemoryConfig) *Server {
@@ -48,6 +100,11 @@ func NewServer(memory_cfg config.MemoryConfig) *Server {
 	}
 }
 
+// Semaphore of main server. Each slot counts memory of one chunk.
+func (s *Server) Semaphore() chan any {
+	return s.sem
+}
+
 func (s *Server) WithMainSemaphore(endpoint http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.sem <- struct{}{}
@@ -62,16 +119,82 @@ func (s *Server) Serve(addr, tls_cert, tls_key string) error {
 	// Auth service
 	r.HandleFunc(LOGIN_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.Login))).Methods(http.MethodPost)
 	r.HandleFunc(REGISTER_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.Register))).Methods(http.MethodPost)
+	r.HandleFunc(REFRESH_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.Refresh))).Methods(http.MethodPost)
+	r.HandleFunc(JWKS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.JWKS))).Methods(http.MethodGet)
+	r.HandleFunc(LOGOUT_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.Logout))))).Methods(http.MethodPost)
+	r.HandleFunc(SESSIONS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.GetSessions))))).Methods(http.MethodGet)
+	r.HandleFunc(SESSIONS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.RevokeSession))))).Methods(http.MethodDelete)
+	r.HandleFunc(PASSWORD_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.ChangePassword))))).Methods(http.MethodPost)
+	r.HandleFunc(RESET_PASSWORD_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.ResetPassword))).Methods(http.MethodPost)
+	r.HandleFunc(USER_INVITES_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.GetInvites))))).Methods(http.MethodGet)
+	r.HandleFunc(USER_INVITES_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.WithRole(auth.ROLE_USER, s.AuthTransport.CreateInvite)))))).Methods(http.MethodPost)
+	r.HandleFunc(USER_INVITES_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.RevokeInvite))))).Methods(http.MethodDelete)
+	r.HandleFunc(INVITES_ENDPOINT+"/{key}", s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.CheckInvite))).Methods(http.MethodGet)
+	r.HandleFunc(LOGIN_TOTP_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.LoginTOTP))).Methods(http.MethodPost)
+	r.HandleFunc(TOTP_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.GetTOTPStatus))))).Methods(http.MethodGet)
+	r.HandleFunc(TOTP_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.EnrollTOTP))))).Methods(http.MethodPost)
+	r.HandleFunc(TOTP_CONFIRM_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.ConfirmTOTP))))).Methods(http.MethodPost)
+	r.HandleFunc(TOTP_DISABLE_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.DisableTOTP))))).Methods(http.MethodPost)
+	r.HandleFunc(PERSONAL_TOKENS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.GetPersonalTokens))))).Methods(http.MethodGet)
+	r.HandleFunc(PERSONAL_TOKENS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.CreatePersonalToken))))).Methods(http.MethodPost)
+	r.HandleFunc(PERSONAL_TOKENS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.RevokePersonalToken))))).Methods(http.MethodDelete)
+	r.HandleFunc(PUBLIC_KEYS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.GetPublicKeys))))).Methods(http.MethodGet)
+	r.HandleFunc(PUBLIC_KEYS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.AddPublicKey))))).Methods(http.MethodPost)
+	r.HandleFunc(PUBLIC_KEYS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ACCOUNT, s.AuthTransport.RemovePublicKey))))).Methods(http.MethodDelete)
+
+	// Administration
+	r.HandleFunc(ADMIN_USERS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminGetUsers)))))).Methods(http.MethodGet)
+	r.HandleFunc(ADMIN_USERS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminCreateUser)))))).Methods(http.MethodPost)
+	r.HandleFunc(ADMIN_USERS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminDeleteUser)))))).Methods(http.MethodDelete)
+	r.HandleFunc(ADMIN_DISABLE_USER_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminDisableUser)))))).Methods(http.MethodPost)
+	r.HandleFunc(ADMIN_ENABLE_USER_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminEnableUser)))))).Methods(http.MethodPost)
+	r.HandleFunc(ADMIN_USER_ROLE_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminSetUserRole)))))).Methods(http.MethodPost)
+	r.HandleFunc(ADMIN_STORAGE_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminGetStorage)))))).Methods(http.MethodGet)
+	r.HandleFunc(ADMIN_REGISTER_KEYS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminGetRegisterKeys)))))).Methods(http.MethodGet)
+	r.HandleFunc(ADMIN_REGISTER_KEYS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminGenerateRegisterKeys)))))).Methods(http.MethodPost)
+	r.HandleFunc(ADMIN_REGISTER_KEYS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminRevokeRegisterKey)))))).Methods(http.MethodDelete)
+	r.HandleFunc(ADMIN_LOCKOUTS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminGetLockouts)))))).Methods(http.MethodGet)
+	r.HandleFunc(ADMIN_LOCKOUTS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminClearLockout)))))).Methods(http.MethodDelete)
+	r.HandleFunc(ADMIN_LOGIN_ATTEMPTS_ENDPOINT, s.WithMainSemaphore(s.AuthTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_ADMIN, s.AuthTransport.WithRole(auth.ROLE_ADMIN, s.AuthTransport.AdminGetLoginAttempts)))))).Methods(http.MethodGet)
 
 	// Data service
-	r.HandleFunc(CREATE_CONNECTION_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.CreateConnection)))).Methods(http.MethodPost)
-	r.HandleFunc(SAVE_DATA_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.SaveData)))).Methods(http.MethodPost)
-	r.HandleFunc(GET_DATA_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.GetData)))).Methods(http.MethodGet)
-	r.HandleFunc(GET_DATA_SUM_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.GetSum)))).Methods(http.MethodGet)
-	r.HandleFunc(GET_FILES_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.GetFiles)))).Methods(http.MethodGet)
-	r.HandleFunc(GET_AVAILABLE_SPACE_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.GetAvailableDiskSpace)))).Methods(http.MethodGet)
-	r.HandleFunc(CREATE_DIR_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.CreateDir)))).Methods(http.MethodPost)
-	r.HandleFunc(REMOVE_DIR_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.DataTransport.RemoveDir)))).Methods(http.MethodPost)
+	r.HandleFunc(CREATE_CONNECTION_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.CreateConnection))))).Methods(http.MethodPost)
+	r.HandleFunc(SAVE_DATA_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.SaveData)))))).Methods(http.MethodPost)
+	r.HandleFunc(GET_DATA_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.GetData))))).Methods(http.MethodGet)
+	r.HandleFunc(GET_DATA_SUM_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.GetSum))))).Methods(http.MethodGet)
+	r.HandleFunc(GET_FILES_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.GetFiles))))).Methods(http.MethodGet)
+	r.HandleFunc(GET_AVAILABLE_SPACE_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.GetAvailableDiskSpace))))).Methods(http.MethodGet)
+	r.HandleFunc(CREATE_DIR_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.CreateDir)))))).Methods(http.MethodPost)
+	r.HandleFunc(REMOVE_DIR_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.RemoveDir)))))).Methods(http.MethodPost)
+	r.HandleFunc(REMOVE_FILE_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.RemoveFile)))))).Methods(http.MethodPost)
+	r.HandleFunc(MOVE_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.Move)))))).Methods(http.MethodPost)
+	r.HandleFunc(DOWNLOAD_ZIP_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.DownloadZip))))).Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc(EXTRACT_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.Extract)))))).Methods(http.MethodPost)
+	r.HandleFunc(DOWNLOAD_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.Download))))).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(SIGNATURE_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.GetSignature))))).Methods(http.MethodGet)
+	r.HandleFunc(DELTA_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.ApplyDelta)))))).Methods(http.MethodPost)
+	r.HandleFunc(CHANGES_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.GetChanges))))).Methods(http.MethodGet)
+
+	// Events stream lives while client is connected, so it doesn't hold main semaphore
+	r.HandleFunc(EVENTS_ENDPOINT, s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.Events)))).Methods(http.MethodGet)
+
+	// Public links
+	r.HandleFunc(SHARES_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.CreateShare)))))).Methods(http.MethodPost)
+	r.HandleFunc(SHARES_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.GetShares))))).Methods(http.MethodGet)
+	r.HandleFunc(SHARES_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.RemoveShare)))))).Methods(http.MethodDelete)
+	r.HandleFunc(SHARE_ENDPOINT+"/{token}", s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.DataTransport.DownloadShare))).Methods(http.MethodGet, http.MethodHead)
+
+	// tus.io uploads
+	r.HandleFunc(TUS_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.DataTransport.TusOptions))).Methods(http.MethodOptions)
+	r.HandleFunc(TUS_ENDPOINT, s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.TusCreate)))))).Methods(http.MethodPost)
+	r.HandleFunc(TUS_ENDPOINT+"/{id}", s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_READ, s.DataTransport.TusHead))))).Methods(http.MethodHead)
+	r.HandleFunc(TUS_ENDPOINT+"/{id}", s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.TusPatch)))))).Methods(http.MethodPatch)
+	r.HandleFunc(TUS_ENDPOINT+"/{id}", s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.AuthTransport.WithAuth(s.AuthTransport.WithScope(auth.SCOPE_FILES_WRITE, s.AuthTransport.WithRole(auth.ROLE_USER, s.DataTransport.TusDelete)))))).Methods(http.MethodDelete)
+
+	// WebDAV. Clients use Basic auth, so auth middleware is not used.
+	if s.DavHandler != nil {
+		r.PathPrefix(DAV_ENDPOINT).Handler(s.WithMainSemaphore(s.DataTransport.WithRateLimit(s.DavHandler.ServeHTTP)))
+	}
 
 	ns_limiter := rate.NewLimiter(rate.Every(time.Minute), 10) // limiter for non-service requests
 
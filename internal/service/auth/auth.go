@@ -2,10 +2,7 @@ package auth
 
 import (
 	"database/sql"
-	"errors"
-	"fmt"
 	"log/slog"
-	"time"
 
 	"github.com/braginantonev/mhserver/internal/repository/dirs"
 	"github.com/golang-jwt/jwt/v5"
@@ -13,14 +10,17 @@ import (
 )
 
 const (
-	USER_NAME_MAX_LENGTH           int    = 30
-	INSERT_USER                    string = "INSERT INTO users (user, password) VALUES (?, ?)"
-	SELECT_USERID                  string = "SELECT id FROM users WHERE user = ?"
-	SELECT_USER                    string = "SELECT user, password FROM users WHERE user = ?"
-	SELECT_REGISTER_SECRET_KEY     string = "SELECT id FROM register_secret_keys WHERE secret_key = ?"
-	DELETE_REGISTRATION_SECRET_KEY string = "DELETE FROM register_secret_keys WHERE id = ?"
+	USER_NAME_MAX_LENGTH int    = 30
+	INSERT_USER          string = "INSERT INTO users (user, password, role) VALUES (?, ?, ?)"
+	SELECT_USERID        string = "SELECT id FROM users WHERE user = ?"
+	SELECT_USER          string = "SELECT user, password, disabled, totp_enabled FROM users WHERE user = ?"
 )
 
+// Runs sql statements. Implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 type User struct {
 	Name     string `json:"username"`
 	Password string `json:"password"`
@@ -57,86 +57,146 @@ func NewAuthService(cfg AuthConfig, db *sql.DB) *AuthService {
 	}
 }
 
-// If user exist in database, return personal jwt token
-func (s *AuthService) Login(user User) (string, error) {
+// Check that user exist in database, password is right and user isn't disabled. Return, that user has two-factor authentication.
+func (s *AuthService) verifyPassword(user User) (bool, error) {
 	db_user := User{}
+	var disabled, totp_enabled bool
+
 	row := s.db.QueryRow(SELECT_USER, user.Name)
-	if err := row.Scan(&db_user.Name, &db_user.Password); err != nil {
+	if err := row.Scan(&db_user.Name, &db_user.Password, &disabled, &totp_enabled); err != nil {
 		if err == sql.ErrNoRows {
-			return "", ErrUserNotExist
+			return false, ErrUserNotExist
 		}
 
 		slog.Error("failed scan sql rows", slog.Any("err", err))
-		return "", ErrInternal
+		return false, ErrInternal
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(db_user.Password), []byte(user.Password)); err != nil {
-		return "", ErrWrongPassword
+		return false, ErrWrongPassword
 	}
 
-	now := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"name": user.Name,
-		"nbf":  now.Unix(),
-		"exp":  now.Add(24 * time.Hour).Unix(),
-		"iat":  now.Unix(),
-	})
+	if disabled {
+		return false, ErrUserDisabled
+	}
+	return totp_enabled, nil
+}
 
-	token_str, err := token.SignedString([]byte(s.cfg.JWTSignature))
+/*
+Check password of user, who isn't locked after failed attempts. Attempt is saved to audit log.
+Failures of user with two-factor authentication are forgotten only after right code.
+*/
+func (s *AuthService) checkPassword(user User, source LoginSource) (bool, error) {
+	if err := s.CheckLockout(user.Name); err != nil {
+		s.recordLoginAttempt(user.Name, source, err)
+		return false, err
+	}
+
+	totp_enabled, err := s.verifyPassword(user)
+	s.recordLoginAttempt(user.Name, source, err)
+	if err == nil && !totp_enabled {
+		s.resetLoginFailures(user.Name)
+	}
+	return totp_enabled, err
+}
+
+// Check that user can log in with password only. Users with two-factor authentication get ErrTOTPRequired.
+func (s *AuthService) CheckPassword(user User, source LoginSource) error {
+	totp_enabled, err := s.checkPassword(user, source)
 	if err != nil {
-		slog.Error("failed complete signed jwt token", slog.Any("err", err))
-		return "", ErrInternal
+		return err
 	}
 
-	return token_str, nil
+	if totp_enabled {
+		return ErrTOTPRequired
+	}
+	return nil
 }
 
-// Crypt user password and put them to database
-func (s *AuthService) Register(user RegisterUser) error {
-	if len(user.Name) > USER_NAME_MAX_LENGTH {
+// Check that user can be created with this name
+func (s *AuthService) checkNewUser(name string) error {
+	if len(name) > USER_NAME_MAX_LENGTH {
 		return ErrNameTooLong
 	}
 
-	row := s.db.QueryRow(SELECT_USERID, user.Name)
+	row := s.db.QueryRow(SELECT_USERID, name)
 	if err := row.Scan(); err != sql.ErrNoRows {
 		return ErrUserAlreadyExists
 	}
+	return nil
+}
 
-	var key_id int
-	key_row := s.db.QueryRow(SELECT_REGISTER_SECRET_KEY, user.Key)
-	if err := key_row.Scan(&key_id); errors.Is(err, sql.ErrNoRows) {
-		return ErrRegSecretKeyNotFound
-	}
-
+// Crypt user password and put them to database
+func insertUser(db execer, user User, role Role) error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		slog.Error("failed generate hash from password", slog.Any("err", err))
 		return ErrInternal
 	}
 
-	if _, err = s.db.Exec(INSERT_USER, user.Name, string(hash)); err != nil {
+	if _, err = db.Exec(INSERT_USER, user.Name, string(hash), string(role)); err != nil {
 		slog.Error("failed insert user to sql", slog.Any("err", err))
 		return ErrInternal
 	}
+	return nil
+}
 
-	if _, err = s.db.Exec(DELETE_REGISTRATION_SECRET_KEY, key_id); err != nil {
-		slog.Error("failed delete registration secret key from sql", slog.Any("err", err))
+func (s *AuthService) createUserFolders(name string) error {
+	if err := dirs.GenerateUserFolders(s.cfg.WorkspacePath, name, s.cfg.UserCatalogs...); err != nil {
+		slog.Error("failed create service catalogs", slog.Any("err", err))
 		return ErrInternal
 	}
+	return nil
+}
 
-	if err = dirs.GenerateUserFolders(s.cfg.WorkspacePath, user.Name, s.cfg.UserCatalogs...); err != nil {
-		slog.Error("failed create service catalogs", slog.Any("err", err))
+// Create user by registration key. Key is consumed in the same transaction, which creates user,
+// so one key use can't register two users.
+func (s *AuthService) Register(user RegisterUser) error {
+	if err := s.checkNewUser(user.Name); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Error("failed begin sql transaction", slog.Any("err", err))
 		return ErrInternal
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	return nil
+	role, invited_by, err := consumeRegisterKey(tx, user.Key, user.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := insertUser(tx, user.User, role); err != nil {
+		return err
+	}
+
+	if invited_by != "" {
+		if _, err := tx.Exec(UPDATE_USER_INVITED_BY, invited_by, user.Name); err != nil {
+			slog.Error("failed save user inviter", slog.Any("err", err))
+			return ErrInternal
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed commit sql transaction", slog.Any("err", err))
+		return ErrInternal
+	}
+	return s.createUserFolders(user.Name)
 }
 
+// Check signature, expiration, issuer and audience of jwt. Issuer and audience are checked, if they are set in config.
 func (s *AuthService) ParseToJWT(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("%w: %s", ErrJwtSignatureInvalid, t.Header["alg"])
-		}
-		return []byte(s.cfg.JWTSignature), nil
-	})
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if s.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.cfg.Issuer))
+	}
+
+	if s.cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(s.cfg.Audience))
+	}
+	return jwt.Parse(token, s.verificationKey, opts...)
 }
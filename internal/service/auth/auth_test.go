@@ -1,16 +1,28 @@
 package auth_test
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/braginantonev/mhserver/internal/repository/database"
 	"github.com/braginantonev/mhserver/internal/service/auth"
 	"github.com/go-sql-driver/mysql"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -205,7 +217,7 @@ func TestLogin(t *testing.T) {
 
 	for _, test := range cases {
 		t.Run(test.name, func(t *testing.T) {
-			token, err := service.Login(test.user)
+			token, err := service.Login(test.user, auth.Device{})
 			if !errors.Is(err, test.expected_err) {
 				t.Errorf("expected error: %v, but got: %v", test.expected_err, err)
 			}
@@ -214,7 +226,7 @@ func TestLogin(t *testing.T) {
 				return
 			}
 
-			if err := checkJWTUserMatch(service, test.user.Name, token); err != nil {
+			if err := checkJWTUserMatch(service, test.user.Name, token.AccessToken); err != nil {
 				t.Error(err)
 			}
 		})
@@ -225,3 +237,1486 @@ func TestLogin(t *testing.T) {
 		fmt.Println(err)
 	}
 }
+
+func TestPublicKeys(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered_user := auth.NewRegisterUser(auth.NewUser("test_keys1", "123"), TEST_REGISTER_SECRET_KEY)
+
+	if err := insertRegisterKeyToDB(db, TEST_REGISTER_SECRET_KEY); err != nil {
+		t.Fatalf("failed to insert register key to DB: %v", err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	if err := service.Register(registered_user); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if _, err := db.Exec("DELETE FROM users WHERE user = ?", registered_user.Name); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ssh_key, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized_key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ssh_key))) + " laptop"
+
+	cases := [...]struct {
+		name         string
+		user         string
+		key          string
+		expected_err error
+	}{
+		{
+			name:         "bad key",
+			user:         registered_user.Name,
+			key:          "ssh-ed25519 not-a-key",
+			expected_err: auth.ErrBadPublicKey,
+		},
+		{
+			name:         "user not exist",
+			user:         "unregistered user",
+			key:          authorized_key,
+			expected_err: auth.ErrUserNotExist,
+		},
+		{
+			name: "normal add",
+			user: registered_user.Name,
+			key:  authorized_key,
+		},
+		{
+			name:         "already added",
+			user:         registered_user.Name,
+			key:          authorized_key,
+			expected_err: auth.ErrPublicKeyAlreadyExists,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := service.AddPublicKey(test.user, test.key); !errors.Is(err, test.expected_err) {
+				t.Errorf("expected error: %v, but got: %v", test.expected_err, err)
+			}
+		})
+	}
+
+	keys, err := service.GetPublicKeys(registered_user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0].Comment != "laptop" || keys[0].Fingerprint != ssh.FingerprintSHA256(ssh_key) {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	if err := service.CheckPublicKey(registered_user.Name, ssh_key); err != nil {
+		t.Errorf("expected registered key, but got: %v", err)
+	}
+
+	if err := service.RemovePublicKey(registered_user.Name, keys[0].Fingerprint); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.CheckPublicKey(registered_user.Name, ssh_key); !errors.Is(err, auth.ErrPublicKeyNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrPublicKeyNotFound, err)
+	}
+}
+
+func TestAdministration(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{"files"},
+	}, db)
+
+	user := auth.NewUser("test_admin1", "123")
+	if err := service.AddUser(auth.NewUser(user.Name, ""), auth.ROLE_USER); !errors.Is(err, auth.ErrEmptyPassword) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrEmptyPassword, err)
+	}
+
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.AddUser(user, auth.ROLE_USER); !errors.Is(err, auth.ErrUserAlreadyExists) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrUserAlreadyExists, err)
+	}
+
+	users, err := service.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(users, auth.UserInfo{Name: user.Name, Role: auth.ROLE_USER}) {
+		t.Errorf("user %s not found in %v", user.Name, users)
+	}
+
+	if err := service.SetPassword(auth.NewUser(user.Name, "456")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Login(user, auth.Device{}); !errors.Is(err, auth.ErrWrongPassword) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrWrongPassword, err)
+	}
+
+	if _, err := service.Login(auth.NewUser(user.Name, "456"), auth.Device{}); err != nil {
+		t.Errorf("login with new password failed: %v", err)
+	}
+
+	if err := service.SetPassword(auth.NewUser("unregistered user", "456")); !errors.Is(err, auth.ErrUserNotExist) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrUserNotExist, err)
+	}
+
+	if err := service.DeleteUser(user.Name, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat("/tmp/mhserver_tests/" + user.Name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("user folder not removed: %v", err)
+	}
+
+	if err := service.DeleteUser(user.Name, false); !errors.Is(err, auth.ErrUserNotExist) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrUserNotExist, err)
+	}
+}
+
+func TestRegisterKeys(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	if _, err := service.GenerateRegisterKeys(0, auth.RegisterKeyOptions{}); !errors.Is(err, auth.ErrBadKeysCount) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadKeysCount, err)
+	}
+
+	if _, err := service.GenerateRegisterKeys(1, auth.RegisterKeyOptions{Role: "root"}); !errors.Is(err, auth.ErrBadRole) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadRole, err)
+	}
+
+	generated, err := service.GenerateRegisterKeys(2, auth.RegisterKeyOptions{CreatedBy: "test_admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(generated) != 2 || len(generated[0].Key) != auth.REGISTER_SECRET_KEY_SIZE*2 || generated[0].Key == generated[1].Key {
+		t.Fatalf("unexpected keys: %v", generated)
+	}
+
+	if generated[0].MaxUses != 1 || generated[0].Role != auth.ROLE_USER || generated[0].Expires != 0 {
+		t.Errorf("unexpected default key options: %+v", generated[0])
+	}
+
+	keys, err := service.GetRegisterKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range generated {
+		if !slices.Contains(keys, key) {
+			t.Errorf("key %+v not found in list", key)
+		}
+
+		if err := service.RevokeRegisterKey(key.Key); err != nil {
+			t.Error(err)
+		}
+
+		if err := service.RevokeRegisterKey(key.Key); !errors.Is(err, auth.ErrRegSecretKeyNotFound) {
+			t.Errorf("expected error: %v, but got: %v", auth.ErrRegSecretKeyNotFound, err)
+		}
+	}
+
+	names := []string{"test_regkeys1", "test_regkeys2", "test_regkeys3"}
+	defer func() {
+		for _, name := range names {
+			_ = service.DeleteUser(name, true)
+		}
+	}()
+
+	// Multi-use key with role
+	multi_use, err := service.GenerateRegisterKeys(1, auth.RegisterKeyOptions{MaxUses: 2, Role: auth.ROLE_GUEST})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names[:2] {
+		if err := service.Register(auth.NewRegisterUser(auth.NewUser(name, "123"), multi_use[0].Key)); err != nil {
+			t.Fatal(err)
+		}
+
+		if role, err := service.UserRole(name); err != nil || role != auth.ROLE_GUEST {
+			t.Errorf("expected role: %s, but got: %s (%v)", auth.ROLE_GUEST, role, err)
+		}
+	}
+
+	if err := service.Register(auth.NewRegisterUser(auth.NewUser(names[2], "123"), multi_use[0].Key)); !errors.Is(err, auth.ErrRegSecretKeyNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrRegSecretKeyNotFound, err)
+	}
+
+	// Key bound to username
+	bound, err := service.GenerateRegisterKeys(1, auth.RegisterKeyOptions{Username: names[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Register(auth.NewRegisterUser(auth.NewUser("test_regkeys4", "123"), bound[0].Key)); !errors.Is(err, auth.ErrRegSecretKeyBound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrRegSecretKeyBound, err)
+	}
+
+	if err := service.Register(auth.NewRegisterUser(auth.NewUser(names[2], "123"), bound[0].Key)); err != nil {
+		t.Error(err)
+	}
+
+	// Expired key
+	expiring, err := service.GenerateRegisterKeys(1, auth.RegisterKeyOptions{Lifetime: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if err := service.Register(auth.NewRegisterUser(auth.NewUser("test_regkeys5", "123"), expiring[0].Key)); !errors.Is(err, auth.ErrRegSecretKeyExpired) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrRegSecretKeyExpired, err)
+	}
+
+	if keys, err = service.GetRegisterKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if slices.Contains(keys, expiring[0]) {
+		t.Errorf("expired key %s is listed", expiring[0].Key)
+	}
+	_ = service.RevokeRegisterKey(expiring[0].Key)
+}
+
+func TestRefreshTokens(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	user := auth.NewUser("test_tokens1", "123")
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := service.DeleteUser(user.Name, true); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	tokens, err := service.Login(user, auth.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := service.ParseAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Name != user.Name || claims.ID == "" || claims.Session == "" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	refreshed, err := service.Refresh(tokens.RefreshToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshed.RefreshToken == tokens.RefreshToken {
+		t.Error("refresh token isn't rotated")
+	}
+
+	// Reuse of rotated token revokes whole session
+	if _, err := service.Refresh(tokens.RefreshToken, ""); !errors.Is(err, auth.ErrBadRefreshToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadRefreshToken, err)
+	}
+
+	if _, err := service.Refresh(refreshed.RefreshToken, ""); !errors.Is(err, auth.ErrBadRefreshToken) {
+		t.Errorf("expected revoked session, but got: %v", err)
+	}
+
+	tokens, err = service.Login(user, auth.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims, err = service.ParseAccessToken(tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Logout(claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ParseAccessToken(tokens.AccessToken); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTokenRevoked, err)
+	}
+
+	if _, err := service.Refresh(tokens.RefreshToken, ""); !errors.Is(err, auth.ErrBadRefreshToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadRefreshToken, err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	user := auth.NewUser("test_sessions1", "123")
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := service.DeleteUser(user.Name, true); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	laptop, err := service.Login(user, auth.Device{Name: "laptop", UserAgent: "mhctl", IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phone, err := service.Login(user, auth.Device{Name: "phone", UserAgent: "mhsync", IP: "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := service.GetSessions(user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, but got: %+v", sessions)
+	}
+
+	phone_claims, err := service.ParseAccessToken(phone.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, session := range sessions {
+		if session.ID == phone_claims.Session {
+			found = true
+			if session.Device != "phone" || session.UserAgent != "mhsync" || session.IP != "10.0.0.2" || session.Created == 0 {
+				t.Errorf("unexpected session: %+v", session)
+			}
+		}
+	}
+
+	if !found {
+		t.Fatalf("session %s not found in %+v", phone_claims.Session, sessions)
+	}
+
+	if err := service.RevokeUserSession("test_sessions_other", phone_claims.Session); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrSessionNotFound, err)
+	}
+
+	if err := service.RevokeUserSession(user.Name, phone_claims.Session); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ParseAccessToken(phone.AccessToken); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTokenRevoked, err)
+	}
+
+	if _, err := service.Refresh(phone.RefreshToken, ""); !errors.Is(err, auth.ErrBadRefreshToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadRefreshToken, err)
+	}
+
+	if err := service.RevokeUserSession(user.Name, phone_claims.Session); !errors.Is(err, auth.ErrSessionNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrSessionNotFound, err)
+	}
+
+	// Other sessions still work
+	if _, err := service.ParseAccessToken(laptop.AccessToken); err != nil {
+		t.Error(err)
+	}
+
+	if sessions, err = service.GetSessions(user.Name); err != nil || len(sessions) != 1 {
+		t.Errorf("expected 1 session, but got: %+v, err: %v", sessions, err)
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	user := auth.NewUser("test_passwords1", "123")
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := service.DeleteUser(user.Name, true); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	tokens, err := service.Login(user, auth.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access_only, err := service.LoginAccessOnly(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ChangePassword(user.Name, "wrong", "456", ""); !errors.Is(err, auth.ErrWrongPassword) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrWrongPassword, err)
+	}
+
+	if err := service.ChangePassword(user.Name, user.Password, "", ""); !errors.Is(err, auth.ErrEmptyPassword) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrEmptyPassword, err)
+	}
+
+	// Issue time of token is saved in seconds
+	time.Sleep(time.Second)
+
+	if err := service.ChangePassword(user.Name, user.Password, "456", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{tokens.AccessToken, access_only} {
+		if _, err := service.ParseAccessToken(token); !errors.Is(err, auth.ErrTokenRevoked) {
+			t.Errorf("expected error: %v, but got: %v", auth.ErrTokenRevoked, err)
+		}
+	}
+
+	if _, err := service.Refresh(tokens.RefreshToken, ""); !errors.Is(err, auth.ErrBadRefreshToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadRefreshToken, err)
+	}
+
+	if _, err := service.CreatePasswordReset("test_passwords_unknown", 0); !errors.Is(err, auth.ErrUserNotExist) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrUserNotExist, err)
+	}
+
+	reset_token, err := service.CreatePasswordReset(user.Name, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ResetPassword(reset_token, "789"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ResetPassword(reset_token, "000"); !errors.Is(err, auth.ErrBadResetToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadResetToken, err)
+	}
+
+	if err := service.CheckPassword(auth.NewUser(user.Name, "789"), auth.LoginSource{}); err != nil {
+		t.Error(err)
+	}
+
+	// Unused reset tokens don't work after password change
+	reset_token, err = service.CreatePasswordReset(user.Name, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.SetPassword(auth.NewUser(user.Name, "123")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ResetPassword(reset_token, "456"); !errors.Is(err, auth.ErrBadResetToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadResetToken, err)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	user := auth.NewUser("test_roles1", "123")
+	if err := service.AddUser(user, auth.ROLE_GUEST); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := service.DeleteUser(user.Name, true); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	if err := service.AddUser(auth.NewUser("test_roles2", "123"), "root"); !errors.Is(err, auth.ErrBadRole) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadRole, err)
+	}
+
+	tokens, err := service.Login(user, auth.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := service.ParseAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Role != auth.ROLE_GUEST {
+		t.Errorf("expected role: %s, but got: %s", auth.ROLE_GUEST, claims.Role)
+	}
+
+	if claims.Role.Allows(auth.ROLE_USER) {
+		t.Errorf("guest role allows rights of %s", auth.ROLE_USER)
+	}
+
+	if err := service.SetRole("test_roles_unknown", auth.ROLE_ADMIN); !errors.Is(err, auth.ErrUserNotExist) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrUserNotExist, err)
+	}
+
+	// Issue time of token is saved in seconds
+	time.Sleep(time.Second)
+
+	if err := service.SetRole(user.Name, auth.ROLE_ADMIN); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ParseAccessToken(tokens.AccessToken); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTokenRevoked, err)
+	}
+
+	access_token, err := service.LoginAccessOnly(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims, err = service.ParseAccessToken(access_token); err != nil {
+		t.Fatal(err)
+	}
+
+	if !claims.Role.Allows(auth.ROLE_USER) {
+		t.Errorf("expected role: %s, but got: %s", auth.ROLE_ADMIN, claims.Role)
+	}
+
+	time.Sleep(time.Second)
+
+	if err := service.SetDisabled(user.Name, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ParseAccessToken(access_token); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTokenRevoked, err)
+	}
+
+	if _, err := service.Login(user, auth.Device{}); !errors.Is(err, auth.ErrUserDisabled) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrUserDisabled, err)
+	}
+
+	if err := service.SetDisabled(user.Name, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Login(user, auth.Device{}); err != nil {
+		t.Error(err)
+	}
+
+	usage, err := service.GetStorageUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.ContainsFunc(usage.Users, func(storage auth.UserStorage) bool { return storage.Name == user.Name }) {
+		t.Errorf("user %s not found in storage usage", user.Name)
+	}
+}
+
+func TestInvites(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:   "test",
+		WorkspacePath:  "/tmp/mhserver_tests/",
+		UserCatalogs:   []string{},
+		InvitesPerUser: 2,
+	}, db)
+
+	inviter := auth.NewUser("test_invites1", "123")
+	if err := service.AddUser(inviter, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	invited := auth.NewUser("test_invites2", "123")
+	defer func() {
+		for _, name := range []string{inviter.Name, invited.Name} {
+			if err := service.DeleteUser(name, true); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}()
+
+	first, err := service.CreateInvite(inviter.Name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := service.CreateInvite(inviter.Name, "test_invites3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.CreateInvite(inviter.Name, ""); !errors.Is(err, auth.ErrInviteLimit) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrInviteLimit, err)
+	}
+
+	info, err := service.CheckInvite(first.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.InvitedBy != inviter.Name || info.Expires != first.Expires {
+		t.Errorf("unexpected invite info: %+v", info)
+	}
+
+	if err := service.Register(auth.NewRegisterUser(invited, first.Key)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.CheckInvite(first.Key); !errors.Is(err, auth.ErrInviteNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrInviteNotFound, err)
+	}
+
+	invites, err := service.GetInvites(inviter.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invites.Available != 0 || len(invites.Unused) != 1 || invites.Unused[0].Key != second.Key || !slices.Equal(invites.Registered, []string{invited.Name}) {
+		t.Errorf("unexpected invites: %+v", invites)
+	}
+
+	// Registered users are counted in allowance, revoked invites are not
+	if err := service.RevokeInvite(invited.Name, second.Key); !errors.Is(err, auth.ErrInviteNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrInviteNotFound, err)
+	}
+
+	if err := service.RevokeInvite(inviter.Name, second.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.CreateInvite(inviter.Name, ""); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := service.CreateInvite(inviter.Name, ""); !errors.Is(err, auth.ErrInviteLimit) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrInviteLimit, err)
+	}
+
+	// Invites of disabled user don't work
+	if err := service.SetDisabled(inviter.Name, true); err != nil {
+		t.Fatal(err)
+	}
+
+	invites, err = service.GetInvites(inviter.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, invite := range invites.Unused {
+		if _, err := service.CheckInvite(invite.Key); !errors.Is(err, auth.ErrInviteNotFound) {
+			t.Errorf("expected error: %v, but got: %v", auth.ErrInviteNotFound, err)
+		}
+
+		if err := service.Register(auth.NewRegisterUser(auth.NewUser("test_invites4", "123"), invite.Key)); !errors.Is(err, auth.ErrRegSecretKeyNotFound) {
+			t.Errorf("expected error: %v, but got: %v", auth.ErrRegSecretKeyNotFound, err)
+		}
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238 for SHA1, last 6 digits
+	const SECRET string = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	cases := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test_case := range cases {
+		code, err := auth.TOTPCode(SECRET, time.Unix(test_case.time, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != test_case.code {
+			t.Errorf("time %d: expected code %s, but got %s", test_case.time, test_case.code, code)
+		}
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	user := auth.NewUser("test_totp", "123")
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := service.DeleteUser(user.Name, true); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	device := auth.Device{Name: "test", UserAgent: "go test", IP: "127.0.0.1"}
+
+	if _, err := service.ConfirmTOTP(user.Name, "000000"); !errors.Is(err, auth.ErrTOTPNotEnrolled) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTOTPNotEnrolled, err)
+	}
+
+	enrollment, err := service.EnrollTOTP(user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Errorf("unexpected otpauth uri: %s", enrollment.URI)
+	}
+
+	// Not confirmed secret doesn't change login
+	if _, err := service.Login(user, device); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := auth.TOTPCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovery_codes, err := service.ConfirmTOTP(user.Name, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recovery_codes) != auth.RECOVERY_CODES_COUNT {
+		t.Fatalf("expected %d recovery codes, but got %d", auth.RECOVERY_CODES_COUNT, len(recovery_codes))
+	}
+
+	if _, err := service.EnrollTOTP(user.Name); !errors.Is(err, auth.ErrTOTPAlreadyEnabled) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTOTPAlreadyEnabled, err)
+	}
+
+	// Password only isn't enough
+	if err := service.CheckPassword(user, auth.LoginSource{}); !errors.Is(err, auth.ErrTOTPRequired) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTOTPRequired, err)
+	}
+
+	if _, err := service.LoginAccessOnly(user, ""); !errors.Is(err, auth.ErrTOTPRequired) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTOTPRequired, err)
+	}
+
+	login := func() *auth.TOTPRequiredError {
+		t.Helper()
+
+		_, err := service.Login(user, device)
+
+		var challenge *auth.TOTPRequiredError
+		if !errors.As(err, &challenge) {
+			t.Fatalf("expected error: %v, but got: %v", auth.ErrTOTPRequired, err)
+		}
+		return challenge
+	}
+
+	// Code, which was used for confirmation, can't be used again
+	challenge := login()
+	if _, err := service.LoginTOTP(challenge.Challenge, code, ""); !errors.Is(err, auth.ErrWrongTOTPCode) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrWrongTOTPCode, err)
+	}
+
+	// Code of next period is accepted because of clock skew
+	next_code, err := auth.TOTPCode(enrollment.Secret, time.Now().Add(auth.TOTP_PERIOD))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := service.LoginTOTP(challenge.Challenge, next_code, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkJWTUserMatch(service, user.Name, tokens.AccessToken); err != nil {
+		t.Error(err)
+	}
+
+	// Challenge is used only once
+	if _, err := service.LoginTOTP(challenge.Challenge, recovery_codes[0], ""); !errors.Is(err, auth.ErrBadLoginChallenge) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadLoginChallenge, err)
+	}
+
+	// Recovery code works once, case and dashes are ignored
+	challenge = login()
+	if _, err := service.LoginTOTP(challenge.Challenge, strings.ToLower(strings.ReplaceAll(recovery_codes[0], "-", "")), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	challenge = login()
+	if _, err := service.LoginTOTP(challenge.Challenge, recovery_codes[0], ""); !errors.Is(err, auth.ErrWrongTOTPCode) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrWrongTOTPCode, err)
+	}
+
+	// Challenge is removed after too many wrong codes
+	for range auth.LOGIN_CHALLENGE_MAX_ATTEMPTS - 1 {
+		if _, err := service.LoginTOTP(challenge.Challenge, "000000", ""); !errors.Is(err, auth.ErrWrongTOTPCode) {
+			t.Errorf("expected error: %v, but got: %v", auth.ErrWrongTOTPCode, err)
+		}
+	}
+
+	if _, err := service.LoginTOTP(challenge.Challenge, recovery_codes[1], ""); !errors.Is(err, auth.ErrBadLoginChallenge) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadLoginChallenge, err)
+	}
+
+	status, err := service.GetTOTPStatus(user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Enabled || status.RecoveryCodes != auth.RECOVERY_CODES_COUNT-1 {
+		t.Errorf("unexpected totp status: %+v", status)
+	}
+
+	if err := service.DisableTOTP(user.Name, "wrong", recovery_codes[1], ""); !errors.Is(err, auth.ErrWrongPassword) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrWrongPassword, err)
+	}
+
+	if err := service.DisableTOTP(user.Name, user.Password, recovery_codes[1], ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.CheckPassword(user, auth.LoginSource{}); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := service.Login(user, device); err != nil {
+		t.Error(err)
+	}
+
+	if err := service.DisableTOTP(user.Name, user.Password, recovery_codes[2], ""); !errors.Is(err, auth.ErrTOTPNotEnabled) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrTOTPNotEnabled, err)
+	}
+}
+
+func TestPersonalTokens(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:  "test",
+		WorkspacePath: "/tmp/mhserver_tests/",
+		UserCatalogs:  []string{},
+	}, db)
+
+	user := auth.NewUser("test_pat", "123")
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := service.DeleteUser(user.Name, true); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	bad_options := []struct {
+		opts     auth.PersonalTokenOptions
+		expected error
+	}{
+		{auth.PersonalTokenOptions{Scopes: []auth.Scope{auth.SCOPE_FILES_READ}}, auth.ErrPersonalTokenNameEmpty},
+		{auth.PersonalTokenOptions{Name: "backup"}, auth.ErrBadScope},
+		{auth.PersonalTokenOptions{Name: "backup", Scopes: []auth.Scope{auth.SCOPE_ACCOUNT}}, auth.ErrBadScope},
+		{auth.PersonalTokenOptions{Name: "backup", Scopes: []auth.Scope{"files:*"}}, auth.ErrBadScope},
+		{auth.PersonalTokenOptions{Name: "backup", Scopes: []auth.Scope{auth.SCOPE_FILES_READ}, Lifetime: -time.Hour}, auth.ErrBadTokenExpire},
+	}
+
+	for _, test := range bad_options {
+		if _, _, err := service.CreatePersonalToken(user.Name, test.opts); !errors.Is(err, test.expected) {
+			t.Errorf("options %+v: expected error: %v, but got: %v", test.opts, test.expected, err)
+		}
+	}
+
+	token, info, err := service.CreatePersonalToken(user.Name, auth.PersonalTokenOptions{
+		Name:   "backup",
+		Scopes: []auth.Scope{auth.SCOPE_FILES_WRITE, auth.SCOPE_FILES_WRITE},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(token, auth.PERSONAL_TOKEN_PREFIX) || info.Expires != 0 || !slices.Equal(info.Scopes, []auth.Scope{auth.SCOPE_FILES_WRITE}) {
+		t.Errorf("unexpected personal token %s: %+v", token, info)
+	}
+
+	if _, _, err := service.CreatePersonalToken(user.Name, auth.PersonalTokenOptions{Name: "backup", Scopes: []auth.Scope{auth.SCOPE_FILES_READ}}); !errors.Is(err, auth.ErrPersonalTokenExists) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrPersonalTokenExists, err)
+	}
+
+	claims, err := service.ParseAccessToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Name != user.Name || claims.Role != auth.ROLE_USER {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if !claims.HasScope(auth.SCOPE_FILES_READ) || claims.HasScope(auth.SCOPE_ADMIN) || claims.HasScope(auth.SCOPE_ACCOUNT) {
+		t.Errorf("unexpected scopes: %v", claims.Scopes)
+	}
+
+	if _, err := service.ParseAccessToken(auth.PERSONAL_TOKEN_PREFIX + "WRONG"); !errors.Is(err, auth.ErrBadPersonalToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadPersonalToken, err)
+	}
+
+	tokens, err := service.GetPersonalTokens(user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tokens) != 1 || tokens[0].ID != info.ID || tokens[0].LastUsed == 0 {
+		t.Errorf("unexpected personal tokens: %+v", tokens)
+	}
+
+	// Tokens of disabled user don't work
+	if err := service.SetDisabled(user.Name, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ParseAccessToken(token); !errors.Is(err, auth.ErrBadPersonalToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadPersonalToken, err)
+	}
+
+	if err := service.SetDisabled(user.Name, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.RevokePersonalToken("test_pat_other", info.ID); !errors.Is(err, auth.ErrPersonalTokenNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrPersonalTokenNotFound, err)
+	}
+
+	if err := service.RevokePersonalToken(user.Name, info.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ParseAccessToken(token); !errors.Is(err, auth.ErrBadPersonalToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadPersonalToken, err)
+	}
+
+	// Tokens are removed after password change
+	token, _, err = service.CreatePersonalToken(user.Name, auth.PersonalTokenOptions{Name: "sync", Scopes: []auth.Scope{auth.SCOPE_FILES_READ}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.SetPassword(auth.NewUser(user.Name, "456")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ParseAccessToken(token); !errors.Is(err, auth.ErrBadPersonalToken) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrBadPersonalToken, err)
+	}
+
+	if tokens, err := service.GetPersonalTokens(user.Name); err != nil || len(tokens) != 0 {
+		t.Errorf("expected no personal tokens, but got %+v, err: %v", tokens, err)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	db, err := database.OpenDB(mysql.Config{
+		User:                 "mhserver_tests",
+		Passwd:               "",
+		Net:                  "tcp",
+		Addr:                 "127.0.0.1:3306",
+		DBName:               "mhs_main_test",
+		AllowNativePasswords: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature:     "test",
+		WorkspacePath:    "/tmp/mhserver_tests/",
+		UserCatalogs:     []string{},
+		MaxLoginFailures: 3,
+		LoginBaseDelay:   time.Second,
+		LockoutDuration:  time.Hour,
+	}, db)
+
+	user := auth.NewUser("test_lockout", "123")
+	if err := service.AddUser(user, auth.ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := auth.NewUser("test_lockout_nobody", "123")
+	defer func() {
+		_ = service.ClearLockout(user.Name)
+		_ = service.ClearLockout(unknown.Name)
+		if err := service.DeleteUser(user.Name, true); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	start := time.Now().Unix()
+	source := auth.LoginSource{Method: auth.LOGIN_METHOD_WEBDAV, IP: "10.0.0.1"}
+	wrong := auth.NewUser(user.Name, "wrong")
+
+	if err := service.ClearLockout(user.Name); !errors.Is(err, auth.ErrLockoutNotFound) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrLockoutNotFound, err)
+	}
+
+	// Right password is refused until delay after failure passes
+	if err := service.CheckPassword(wrong, source); !errors.Is(err, auth.ErrWrongPassword) {
+		t.Fatalf("expected error: %v, but got: %v", auth.ErrWrongPassword, err)
+	}
+
+	var locked *auth.LoginLockedError
+	if err := service.CheckPassword(user, source); !errors.As(err, &locked) || locked.RetryAfter < 1 || locked.RetryAfter > 2 {
+		t.Fatalf("expected delay of 1 second, but got: %v", err)
+	}
+
+	time.Sleep(time.Duration(locked.RetryAfter) * time.Second)
+	if err := service.CheckPassword(user, source); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures are forgotten after success
+	if err := service.ClearLockout(user.Name); !errors.Is(err, auth.ErrLockoutNotFound) {
+		t.Errorf("expected forgotten failures, but got: %v", err)
+	}
+
+	for i := range 3 {
+		if err := service.CheckPassword(wrong, source); !errors.Is(err, auth.ErrWrongPassword) {
+			t.Fatalf("failure %d: expected error: %v, but got: %v", i+1, auth.ErrWrongPassword, err)
+		}
+
+		if i == 2 {
+			break
+		}
+
+		// Delay doubles after each failure
+		if err := service.CheckPassword(user, source); !errors.As(err, &locked) || locked.RetryAfter < 1<<i {
+			t.Fatalf("failure %d: expected delay of %d seconds, but got: %v", i+1, 1<<i, err)
+		}
+		time.Sleep(time.Duration(locked.RetryAfter) * time.Second)
+	}
+
+	if err := service.CheckPassword(user, source); !errors.As(err, &locked) || locked.RetryAfter < 3500 {
+		t.Fatalf("expected lockout for an hour, but got: %v", err)
+	}
+
+	// Unknown usernames are counted too
+	if err := service.CheckPassword(unknown, source); !errors.Is(err, auth.ErrUserNotExist) {
+		t.Errorf("expected error: %v, but got: %v", auth.ErrUserNotExist, err)
+	}
+
+	lockouts, err := service.GetLockouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]auth.Lockout{}
+	for _, lockout := range lockouts {
+		found[lockout.Username] = lockout
+	}
+
+	if found[user.Name].LockedUntil == 0 || found[user.Name].Lockouts != 1 {
+		t.Errorf("expected first lockout of %s, but got: %+v", user.Name, found[user.Name])
+	}
+
+	if found[unknown.Name].Failures != 1 || found[unknown.Name].LockedUntil != 0 {
+		t.Errorf("expected one failure of %s, but got: %+v", unknown.Name, found[unknown.Name])
+	}
+
+	if err := service.ClearLockout(user.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.CheckPassword(user, source); err != nil {
+		t.Errorf("expected unlocked login, but got: %v", err)
+	}
+
+	// wrong, locked, success, 2 times wrong and locked, wrong, locked, success
+	attempts, err := service.GetLoginAttempts(user.Name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recent := make([]auth.LoginAttempt, 0)
+	for _, attempt := range attempts {
+		if attempt.Time >= start {
+			recent = append(recent, attempt)
+		}
+	}
+
+	if len(recent) != 10 {
+		t.Fatalf("expected 10 attempts, but got: %+v", recent)
+	}
+
+	if !recent[0].Success || recent[0].Method != auth.LOGIN_METHOD_WEBDAV || recent[0].IP != source.IP {
+		t.Errorf("expected successful attempt from %s, but got: %+v", source.IP, recent[0])
+	}
+
+	if recent[1].Success || recent[1].Reason != auth.ErrLoginLocked.Error() {
+		t.Errorf("expected locked attempt, but got: %+v", recent[1])
+	}
+}
+
+func TestSigningKeys(t *testing.T) {
+	// Example of RFC 8037: thumbprint of Ed25519 public key
+	public, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	example, err := auth.NewSigningKey(ed25519.PublicKey(public))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if example.ID != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("expected RFC 8037 thumbprint, but got %s", example.ID)
+	}
+
+	dir := t.TempDir()
+
+	// Old RSA key, which only verifies tokens after rotation
+	rsa_private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsa_path := filepath.Join(dir, "old_rsa.pem")
+	rsa_pem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsa_private)})
+	if err := os.WriteFile(rsa_path, rsa_pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// First key doesn't exist, so it must be generated
+	current_path := filepath.Join(dir, "current.pem")
+	keys, err := auth.LoadSigningKeys([]string{current_path, rsa_path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0].Method != jwt.SigningMethodEdDSA || keys[1].Method != jwt.SigningMethodRS256 {
+		t.Fatalf("expected EdDSA and RS256 keys, but got %v", keys)
+	}
+
+	reloaded, err := auth.LoadSigningKeys([]string{current_path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded[0].ID != keys[0].ID {
+		t.Error("generated key isn't saved")
+	}
+
+	public_der, err := x509.MarshalPKIXPublicKey(keys[0].Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public_path := filepath.Join(dir, "public.pem")
+	if err := os.WriteFile(public_path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public_der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.LoadSigningKeys([]string{public_path}); !errors.Is(err, auth.ErrPublicSigningKey) {
+		t.Errorf("expected %v for public first key, but got %v", auth.ErrPublicSigningKey, err)
+	}
+
+	if _, err := auth.LoadSigningKeys([]string{current_path, public_path}); err != nil {
+		t.Errorf("public key must be allowed after first key, but got %v", err)
+	}
+
+	small_rsa, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.NewSigningKey(small_rsa); !errors.Is(err, auth.ErrBadSigningKey) {
+		t.Errorf("expected %v for small rsa key, but got %v", auth.ErrBadSigningKey, err)
+	}
+
+	_, unknown_private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown, err := auth.NewSigningKey(unknown_private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth_service := auth.NewAuthService(auth.AuthConfig{
+		JWTSignature: "test",
+		SigningKeys:  keys,
+		Issuer:       "mhserver",
+		Audience:     "mhserver-test",
+	}, nil)
+
+	valid_claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"name": "signing_test",
+			"iss":  "mhserver",
+			"aud":  "mhserver-test",
+			"exp":  time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	sign := func(key auth.SigningKey, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		signed, err := token.SignedString(key.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	wrong_issuer := valid_claims()
+	wrong_issuer["iss"] = "other"
+
+	wrong_audience := valid_claims()
+	wrong_audience["aud"] = "other"
+
+	without_exp := valid_claims()
+	delete(without_exp, "exp")
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid_claims()).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token signed by HMAC with public key, but with kid of EdDSA key
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, valid_claims())
+	confused.Header["kid"] = keys[0].ID
+	confused_token, err := confused.SignedString([]byte(keys[0].Public.(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name         string
+		token        string
+		expected_err error
+	}{
+		{
+			name:  "current key",
+			token: sign(keys[0], valid_claims()),
+		},
+		{
+			name:  "key before rotation",
+			token: sign(keys[1], valid_claims()),
+		},
+		{
+			name:         "unknown key",
+			token:        sign(unknown, valid_claims()),
+			expected_err: auth.ErrUnknownSigningKey,
+		},
+		{
+			name:         "hs256 token",
+			token:        hs256,
+			expected_err: auth.ErrUnknownSigningKey,
+		},
+		{
+			name:         "algorithm mismatch",
+			token:        confused_token,
+			expected_err: auth.ErrJwtSignatureInvalid,
+		},
+		{
+			name:         "wrong issuer",
+			token:        sign(keys[0], wrong_issuer),
+			expected_err: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:         "wrong audience",
+			token:        sign(keys[0], wrong_audience),
+			expected_err: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:         "without expiration",
+			token:        sign(keys[0], without_exp),
+			expected_err: jwt.ErrTokenRequiredClaimMissing,
+		},
+	}
+
+	for _, test_case := range cases {
+		t.Run(test_case.name, func(t *testing.T) {
+			_, err := auth_service.ParseToJWT(test_case.token)
+			if test_case.expected_err == nil && err != nil {
+				t.Fatalf("expected valid token, but got %v", err)
+			}
+
+			if test_case.expected_err != nil && !errors.Is(err, test_case.expected_err) {
+				t.Errorf("expected %v, but got %v", test_case.expected_err, err)
+			}
+		})
+	}
+
+	jwks := auth_service.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys in jwks, but got %d", len(jwks.Keys))
+	}
+
+	if jwk := jwks.Keys[0]; jwk.Kid != keys[0].ID || jwk.Kty != "OKP" || jwk.Alg != "EdDSA" || jwk.Crv != "Ed25519" || jwk.X == "" {
+		t.Errorf("wrong Ed25519 jwk: %+v", jwk)
+	}
+
+	if jwk := jwks.Keys[1]; jwk.Kid != keys[1].ID || jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.E != "AQAB" || jwk.N == "" {
+		t.Errorf("wrong RSA jwk: %+v", jwk)
+	}
+
+	if keys := auth.NewAuthService(auth.AuthConfig{JWTSignature: "test"}, nil).JWKS().Keys; len(keys) != 0 {
+		t.Errorf("expected empty jwks without signing keys, but got %v", keys)
+	}
+}
@@ -1,7 +1,34 @@
 package auth
 
+import "time"
+
 type AuthConfig struct {
-	JWTSignature  string
+	// Secret of HS256 tokens. Used only without signing keys.
+	JWTSignature string
+
+	// Keys of access tokens. First key signs new tokens, other keys only verify tokens signed before rotation.
+	SigningKeys []SigningKey
+
+	// Zero lifetime means default (15 minutes)
+	AccessTokenLifetime time.Duration
+
+	// Written to tokens and checked, if not empty
+	Issuer   string
+	Audience string
+
 	WorkspacePath string
 	UserCatalogs  []string
+
+	// Count of invites of each user. 0 disables invites.
+	InvitesPerUser int
+	InviteLifetime time.Duration
+
+	// Failed logins in a row, after which username is locked. 0 disables lockout and delays.
+	MaxLoginFailures int
+
+	// Delay after first failed login, it doubles after each next failure
+	LoginBaseDelay time.Duration
+
+	// Lockout time. Failures are forgotten after the same time without them.
+	LockoutDuration time.Duration
 }
@@ -9,16 +9,66 @@ var (
 
 	//JWT errors
 	ErrJwtSignatureInvalid error = errors.New("wrong token signature")
+	ErrUnknownSigningKey   error = errors.New("token is signed by unknown key")
+	ErrBadSigningKey       error = errors.New("signing key must be Ed25519 or RSA key (2048 bits or more) in PEM")
+	ErrPublicSigningKey    error = errors.New("first signing key signs tokens, it must be private key")
 	ErrWrongJWTName        error = errors.New("wrong username from jwt token")
+	ErrTokenRevoked        error = errors.New("token revoked")
+	ErrBadRefreshToken     error = errors.New("refresh token is invalid or expired")
+	ErrBadResetToken       error = errors.New("password reset token is invalid or expired")
 
 	// External errors
 	ErrNameTooLong          error = errors.New("name is too long")
 	ErrRegSecretKeyNotFound error = errors.New("wrong register secret key")
+	ErrRegSecretKeyExpired  error = errors.New("register secret key expired")
+	ErrRegSecretKeyBound    error = errors.New("register secret key is issued for another username")
 
 	// - Login errors
 	ErrUserNotExist  error = errors.New("wrong username or user not registered")
 	ErrWrongPassword error = errors.New("wrong password")
+	ErrUserDisabled  error = errors.New("user is disabled")
+	ErrLoginLocked   error = errors.New("too many failed login attempts, try later")
 
 	// - Register errors
 	ErrUserAlreadyExists error = errors.New("user already registered")
+
+	// - Administration errors
+	ErrEmptyPassword error = errors.New("password is empty")
+	ErrBadKeysCount  error = errors.New("count of keys must be positive")
+	ErrBadKeyUses    error = errors.New("max uses of key must be positive")
+	ErrBadKeyExpire  error = errors.New("key lifetime must be positive")
+	ErrBadUserFolder error = errors.New("user folder is outside of workspace")
+	ErrBadRole       error = errors.New("unknown role, expected: admin, user or guest")
+
+	// - Sessions errors
+	ErrSessionNotFound error = errors.New("session not found")
+
+	// - Invites errors
+	ErrInviteLimit    error = errors.New("invite limit reached")
+	ErrInviteNotFound error = errors.New("invite not found or expired")
+
+	// - Two-factor authentication errors
+	ErrTOTPRequired       error = errors.New("two-factor authentication code required")
+	ErrTOTPAlreadyEnabled error = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnrolled    error = errors.New("two-factor authentication isn't enrolled")
+	ErrTOTPNotEnabled     error = errors.New("two-factor authentication isn't enabled")
+	ErrWrongTOTPCode      error = errors.New("wrong two-factor authentication code")
+	ErrBadLoginChallenge  error = errors.New("login challenge is invalid or expired")
+
+	// - Personal tokens errors
+	ErrBadScope               error = errors.New("unknown scope, expected: files:read, files:write or admin")
+	ErrBadTokenExpire         error = errors.New("token lifetime must be positive")
+	ErrPersonalTokenNameEmpty error = errors.New("personal token name is empty")
+	ErrPersonalTokenExists    error = errors.New("personal token with this name already exists")
+	ErrPersonalTokenNotFound  error = errors.New("personal token not found")
+	ErrBadPersonalToken       error = errors.New("personal token is invalid, expired or revoked")
+
+	// - Lockout errors
+	ErrLockoutNotFound error = errors.New("username has no failed login attempts")
+
+	// - Public keys errors
+	ErrBadPublicKey            error = errors.New("public key have bad format")
+	ErrPublicKeyCommentTooLong error = errors.New("public key comment is too long")
+	ErrPublicKeyAlreadyExists  error = errors.New("public key already registered")
+	ErrPublicKeyNotFound       error = errors.New("public key not found")
 )
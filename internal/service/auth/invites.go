@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	DEFAULT_INVITE_LIFETIME time.Duration = 7 * 24 * time.Hour
+
+	LOCK_USER            string = "SELECT id FROM users WHERE user = ? FOR UPDATE"
+	COUNT_USER_INVITES   string = "SELECT COUNT(*) FROM register_secret_keys WHERE invite AND created_by = ? AND (expires_at = 0 OR expires_at > ?) AND uses < max_uses"
+	COUNT_INVITED_USERS  string = "SELECT COUNT(*) FROM users WHERE invited_by = ?"
+	SELECT_USER_INVITES  string = "SELECT secret_key, created_at, expires_at, username FROM register_secret_keys WHERE invite AND created_by = ? AND (expires_at = 0 OR expires_at > ?) AND uses < max_uses ORDER BY id"
+	SELECT_INVITED_USERS string = "SELECT user FROM users WHERE invited_by = ? ORDER BY id"
+	SELECT_INVITE        string = "SELECT created_by, expires_at, username FROM register_secret_keys WHERE secret_key = ? AND invite AND (expires_at = 0 OR expires_at > ?) AND uses < max_uses"
+	DELETE_USER_INVITE   string = "DELETE FROM register_secret_keys WHERE secret_key = ? AND invite AND created_by = ?"
+	DELETE_USER_INVITES  string = "DELETE FROM register_secret_keys WHERE invite AND created_by = ?"
+)
+
+// Unused invite of user. Times are unix seconds.
+type Invite struct {
+	Key     string `json:"key"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+
+	// Only user with this name can be registered by invite. Empty means any name.
+	Username string `json:"username"`
+}
+
+type Invites struct {
+	// Count of invites, which user can have: unused invites and users registered by them
+	Allowance int `json:"allowance"`
+
+	// Count of invites, which user can create now
+	Available int `json:"available"`
+
+	Unused []Invite `json:"unused"`
+
+	// Names of users registered by invites
+	Registered []string `json:"registered"`
+}
+
+// Public information about invite, which is shown before registration
+type InviteInfo struct {
+	InvitedBy string `json:"invited_by"`
+	Expires   int64  `json:"expires"`
+	Username  string `json:"username"`
+}
+
+func (s *AuthService) inviteLifetime() time.Duration {
+	if s.cfg.InviteLifetime <= 0 {
+		return DEFAULT_INVITE_LIFETIME
+	}
+	return s.cfg.InviteLifetime
+}
+
+// Count of unused invites of user and users registered by them
+func countInvites(tx *sql.Tx, name string) (int, error) {
+	var unused, registered int
+	if err := tx.QueryRow(COUNT_USER_INVITES, name, time.Now().Unix()).Scan(&unused); err != nil {
+		return 0, err
+	}
+
+	if err := tx.QueryRow(COUNT_INVITED_USERS, name).Scan(&registered); err != nil {
+		return 0, err
+	}
+	return unused + registered, nil
+}
+
+// Create one-time invite of user. Registered user gets "user" role. With username invite works only for this name.
+func (s *AuthService) CreateInvite(name, username string) (Invite, error) {
+	if s.cfg.InvitesPerUser <= 0 {
+		return Invite{}, ErrInviteLimit
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Error("failed begin sql transaction", slog.Any("err", err))
+		return Invite{}, ErrInternal
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Lock user, so parallel requests can't exceed allowance
+	var user_id int
+	if err := tx.QueryRow(LOCK_USER, name).Scan(&user_id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Invite{}, ErrUserNotExist
+		}
+
+		slog.Error("failed lock user", slog.Any("err", err))
+		return Invite{}, ErrInternal
+	}
+
+	count, err := countInvites(tx, name)
+	if err != nil {
+		slog.Error("failed count user invites", slog.Any("err", err))
+		return Invite{}, ErrInternal
+	}
+
+	if count >= s.cfg.InvitesPerUser {
+		return Invite{}, ErrInviteLimit
+	}
+
+	keys, err := generateRegisterKeys(tx, 1, RegisterKeyOptions{
+		Lifetime:  s.inviteLifetime(),
+		Username:  username,
+		Role:      ROLE_USER,
+		CreatedBy: name,
+		invite:    true,
+	})
+	if err != nil {
+		return Invite{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed commit sql transaction", slog.Any("err", err))
+		return Invite{}, ErrInternal
+	}
+
+	return Invite{
+		Key:      keys[0].Key,
+		Created:  keys[0].Created,
+		Expires:  keys[0].Expires,
+		Username: keys[0].Username,
+	}, nil
+}
+
+// Return unused invites of user and names of users registered by his invites
+func (s *AuthService) GetInvites(name string) (Invites, error) {
+	invites := Invites{
+		Allowance:  max(s.cfg.InvitesPerUser, 0),
+		Unused:     make([]Invite, 0),
+		Registered: make([]string, 0),
+	}
+
+	rows, err := s.db.Query(SELECT_USER_INVITES, name, time.Now().Unix())
+	if err != nil {
+		slog.Error("failed select user invites", slog.Any("err", err))
+		return Invites{}, ErrInternal
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var invite Invite
+		if err := rows.Scan(&invite.Key, &invite.Created, &invite.Expires, &invite.Username); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return Invites{}, ErrInternal
+		}
+		invites.Unused = append(invites.Unused, invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return Invites{}, ErrInternal
+	}
+
+	users, err := s.db.Query(SELECT_INVITED_USERS, name)
+	if err != nil {
+		slog.Error("failed select invited users", slog.Any("err", err))
+		return Invites{}, ErrInternal
+	}
+	defer func() {
+		_ = users.Close()
+	}()
+
+	for users.Next() {
+		var username string
+		if err := users.Scan(&username); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return Invites{}, ErrInternal
+		}
+		invites.Registered = append(invites.Registered, username)
+	}
+
+	if err := users.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return Invites{}, ErrInternal
+	}
+
+	invites.Available = max(invites.Allowance-len(invites.Unused)-len(invites.Registered), 0)
+	return invites, nil
+}
+
+// Delete unused invite of user
+func (s *AuthService) RevokeInvite(name, key string) error {
+	result, err := s.db.Exec(DELETE_USER_INVITE, key, name)
+	if err != nil {
+		slog.Error("failed delete user invite", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// Return information about invite, which can be used for registration
+func (s *AuthService) CheckInvite(key string) (InviteInfo, error) {
+	var info InviteInfo
+
+	row := s.db.QueryRow(SELECT_INVITE, key, time.Now().Unix())
+	if err := row.Scan(&info.InvitedBy, &info.Expires, &info.Username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return InviteInfo{}, ErrInviteNotFound
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return InviteInfo{}, ErrInternal
+	}
+
+	if _, err := s.UserRole(info.InvitedBy); err != nil {
+		if errors.Is(err, ErrUserDisabled) || errors.Is(err, ErrUserNotExist) {
+			return InviteInfo{}, ErrInviteNotFound
+		}
+		return InviteInfo{}, err
+	}
+	return info, nil
+}
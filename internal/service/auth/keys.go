@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	PUBLIC_KEY_COMMENT_MAX_LENGTH int = 256
+
+	INSERT_USER_KEY  string = "INSERT INTO user_keys (user_id, public_key, comment) VALUES (?, ?, ?)"
+	SELECT_USER_KEYS string = "SELECT user_keys.id, public_key, comment FROM user_keys JOIN users ON users.id = user_keys.user_id WHERE users.user = ?"
+	DELETE_USER_KEY  string = "DELETE FROM user_keys WHERE id = ?"
+)
+
+// Public key for SFTP authentication
+type PublicKey struct {
+	id int
+
+	// Key in authorized_keys format without comment ("ssh-ed25519 AAAA...")
+	Key         string `json:"key"`
+	Comment     string `json:"comment"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func newPublicKey(id int, key ssh.PublicKey, comment string) PublicKey {
+	return PublicKey{
+		id:          id,
+		Key:         strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Comment:     comment,
+		Fingerprint: ssh.FingerprintSHA256(key),
+	}
+}
+
+func (s *AuthService) selectPublicKeys(username string) ([]PublicKey, error) {
+	rows, err := s.db.Query(SELECT_USER_KEYS, username)
+	if err != nil {
+		slog.Error("failed select user keys", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	keys := make([]PublicKey, 0)
+	for rows.Next() {
+		var id int
+		var authorized_key, comment string
+		if err := rows.Scan(&id, &authorized_key, &comment); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorized_key))
+		if err != nil {
+			slog.Warn("bad public key in database", slog.String("user", username), slog.Int("id", id), slog.Any("err", err))
+			continue
+		}
+
+		keys = append(keys, newPublicKey(id, key, comment))
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return keys, nil
+}
+
+// Return registered public keys of user
+func (s *AuthService) GetPublicKeys(username string) ([]PublicKey, error) {
+	return s.selectPublicKeys(username)
+}
+
+// Register public key in authorized_keys format ("ssh-ed25519 AAAA... comment")
+func (s *AuthService) AddPublicKey(username, authorized_key string) (PublicKey, error) {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(authorized_key))
+	if err != nil {
+		return PublicKey{}, ErrBadPublicKey
+	}
+
+	if len(comment) > PUBLIC_KEY_COMMENT_MAX_LENGTH {
+		return PublicKey{}, ErrPublicKeyCommentTooLong
+	}
+
+	var user_id int
+	row := s.db.QueryRow(SELECT_USERID, username)
+	if err := row.Scan(&user_id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PublicKey{}, ErrUserNotExist
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return PublicKey{}, ErrInternal
+	}
+
+	keys, err := s.selectPublicKeys(username)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	new_key := newPublicKey(0, key, comment)
+	for _, k := range keys {
+		if k.Fingerprint == new_key.Fingerprint {
+			return PublicKey{}, ErrPublicKeyAlreadyExists
+		}
+	}
+
+	if _, err := s.db.Exec(INSERT_USER_KEY, user_id, new_key.Key, new_key.Comment); err != nil {
+		slog.Error("failed insert user key to sql", slog.Any("err", err))
+		return PublicKey{}, ErrInternal
+	}
+
+	return new_key, nil
+}
+
+// Remove public key by his fingerprint ("SHA256:...")
+func (s *AuthService) RemovePublicKey(username, fingerprint string) error {
+	keys, err := s.selectPublicKeys(username)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if k.Fingerprint != fingerprint {
+			continue
+		}
+
+		if _, err := s.db.Exec(DELETE_USER_KEY, k.id); err != nil {
+			slog.Error("failed delete user key from sql", slog.Any("err", err))
+			return ErrInternal
+		}
+		return nil
+	}
+
+	return ErrPublicKeyNotFound
+}
+
+// Check that public key is registered by user and user is not disabled
+func (s *AuthService) CheckPublicKey(username string, key ssh.PublicKey) error {
+	if _, err := s.UserRole(username); err != nil {
+		return err
+	}
+
+	keys, err := s.selectPublicKeys(username)
+	if err != nil {
+		return err
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, k := range keys {
+		if k.Fingerprint == fingerprint {
+			return nil
+		}
+	}
+
+	return ErrPublicKeyNotFound
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Way, in which user tried to log in
+type LoginMethod string
+
+const (
+	LOGIN_METHOD_PASSWORD        LoginMethod = "password"
+	LOGIN_METHOD_TOTP            LoginMethod = "totp"
+	LOGIN_METHOD_WEBDAV          LoginMethod = "webdav"
+	LOGIN_METHOD_SFTP            LoginMethod = "sftp"
+	LOGIN_METHOD_CHANGE_PASSWORD LoginMethod = "change_password"
+	LOGIN_METHOD_DISABLE_TOTP    LoginMethod = "disable_totp"
+
+	// Lockout time and time, after which failures are forgotten, if config doesn't set it
+	DEFAULT_LOCKOUT_DURATION time.Duration = 15 * time.Minute
+
+	// Each next lockout in a row is twice as long, but not longer than this time.
+	// Lockouts are forgotten after the same time without failures.
+	MAX_LOCKOUT_DURATION time.Duration = 24 * time.Hour
+
+	// Attempts are kept in audit log for this time
+	LOGIN_ATTEMPTS_RETENTION     time.Duration = 90 * 24 * time.Hour
+	DEFAULT_LOGIN_ATTEMPTS_LIMIT int           = 100
+
+	LOGIN_ATTEMPT_USERNAME_MAX_LENGTH int = 64
+	LOGIN_ATTEMPT_REASON_MAX_LENGTH   int = 128
+
+	INSERT_LOGIN_ATTEMPT  string = "INSERT INTO login_attempts (username, ip, method, success, reason, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	SELECT_LOGIN_ATTEMPTS string = "SELECT username, ip, method, success, reason, created_at FROM login_attempts " +
+		"ORDER BY id DESC LIMIT ?"
+	SELECT_USER_LOGIN_ATTEMPTS string = "SELECT username, ip, method, success, reason, created_at FROM login_attempts " +
+		"WHERE username = ? ORDER BY id DESC LIMIT ?"
+	DELETE_OLD_LOGIN_ATTEMPTS string = "DELETE FROM login_attempts WHERE created_at < ?"
+
+	// Failures before forget time are counted from the beginning, lockouts - from zero
+	SELECT_LOGIN_FAILURES string = "SELECT failures, last_failure, locked_until FROM login_failures WHERE username = ?"
+	INSERT_LOGIN_FAILURE  string = "INSERT INTO login_failures (username, failures, last_failure) VALUES (?, 1, ?) " +
+		"ON DUPLICATE KEY UPDATE lockouts = IF(GREATEST(last_failure, locked_until) < ?, 0, lockouts), " +
+		"failures = IF(last_failure < ?, 1, failures + 1), last_failure = ?"
+	SELECT_LOGIN_LOCKOUTS string = "SELECT failures, lockouts FROM login_failures WHERE username = ?"
+	LOCK_LOGIN            string = "UPDATE login_failures SET failures = 0, lockouts = lockouts + 1, locked_until = ? " +
+		"WHERE username = ? AND failures >= ?"
+	SELECT_LOCKOUTS string = "SELECT username, failures, lockouts, last_failure, locked_until FROM login_failures " +
+		"WHERE locked_until > ? OR (failures > 0 AND last_failure >= ?) ORDER BY username"
+	DELETE_LOGIN_FAILURES         string = "DELETE FROM login_failures WHERE username = ?"
+	DELETE_EXPIRED_LOGIN_FAILURES string = "DELETE FROM login_failures WHERE GREATEST(last_failure, locked_until) < ?"
+)
+
+// Place of login attempt, which is saved in audit log
+type LoginSource struct {
+	Method LoginMethod
+	IP     string
+}
+
+/*
+Login of username is refused after failed attempts: next attempt is allowed after delay,
+which doubles after each failure, or when lockout ends.
+errors.Is(err, ErrLoginLocked) is true for this error.
+*/
+type LoginLockedError struct {
+	// Seconds until next attempt is allowed
+	RetryAfter int64
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
+// Failed logins of username. Times are unix seconds.
+type Lockout struct {
+	Username    string `json:"username"`
+	Failures    int    `json:"failures"`
+	LastFailure int64  `json:"last_failure"`
+
+	// Lockouts in a row, each next one is twice as long
+	Lockouts int `json:"lockouts"`
+
+	// Zero if username isn't locked
+	LockedUntil int64 `json:"locked_until"`
+}
+
+// Record of audit log. Time is unix seconds.
+type LoginAttempt struct {
+	Username string      `json:"username"`
+	IP       string      `json:"ip"`
+	Method   LoginMethod `json:"method"`
+	Success  bool        `json:"success"`
+
+	// Error of failed attempt
+	Reason string `json:"reason"`
+	Time   int64  `json:"time"`
+}
+
+// Errors, which are counted as failures of username
+var loginFailures = []error{ErrWrongPassword, ErrUserNotExist, ErrWrongTOTPCode}
+
+func (s *AuthService) lockoutEnabled() bool {
+	return s.cfg.MaxLoginFailures > 0
+}
+
+func (s *AuthService) lockoutDuration() time.Duration {
+	if s.cfg.LockoutDuration <= 0 {
+		return DEFAULT_LOCKOUT_DURATION
+	}
+	return s.cfg.LockoutDuration
+}
+
+// Lockouts aren't longer than a day or configured lockout time
+func (s *AuthService) maxLockoutDuration() time.Duration {
+	return max(MAX_LOCKOUT_DURATION, s.lockoutDuration())
+}
+
+// Time of next lockout after lockouts in a row: lockout time doubled for each lockout, but not longer than max
+func (s *AuthService) lockDuration(lockouts int) time.Duration {
+	max_duration := s.maxLockoutDuration()
+
+	duration := s.lockoutDuration()
+	for i := 0; i < lockouts && duration < max_duration; i++ {
+		duration *= 2
+	}
+	return min(duration, max_duration)
+}
+
+// Delay after failures in a row: base delay doubled for each failure after first, but not longer than lockout
+func (s *AuthService) loginDelay(failures int) time.Duration {
+	if failures <= 0 || s.cfg.LoginBaseDelay <= 0 {
+		return 0
+	}
+
+	delay := s.cfg.LoginBaseDelay
+	for i := 1; i < failures && delay < s.lockoutDuration(); i++ {
+		delay *= 2
+	}
+	return min(delay, s.lockoutDuration())
+}
+
+func newLoginLockedError(until time.Time) *LoginLockedError {
+	return &LoginLockedError{
+		RetryAfter: int64((time.Until(until) + time.Second - 1) / time.Second),
+	}
+}
+
+// Check, that username isn't locked and delay after last failure has passed. Used also for cached passwords (WebDAV).
+func (s *AuthService) CheckLockout(name string) error {
+	if !s.lockoutEnabled() {
+		return nil
+	}
+
+	var failures int
+	var last_failure, locked_until int64
+
+	row := s.db.QueryRow(SELECT_LOGIN_FAILURES, truncate(name, LOGIN_ATTEMPT_USERNAME_MAX_LENGTH))
+	if err := row.Scan(&failures, &last_failure, &locked_until); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	now := time.Now()
+	if locked_until > now.Unix() {
+		return newLoginLockedError(time.Unix(locked_until, 0))
+	}
+
+	// Old failures are forgotten
+	if now.Sub(time.Unix(last_failure, 0)) > s.lockoutDuration() {
+		return nil
+	}
+
+	// Failure time is saved in seconds, so delay is counted from the end of that second
+	if next := time.Unix(last_failure+1, 0).Add(s.loginDelay(failures)); next.After(now) {
+		return newLoginLockedError(next)
+	}
+	return nil
+}
+
+/*
+Count failure of username and lock it, when failures limit is reached.
+Failures are counted from zero after lockout, but next lockout in a row is twice as long.
+*/
+func (s *AuthService) registerLoginFailure(name string) {
+	now := time.Now()
+	forget := now.Add(-s.lockoutDuration()).Unix()
+	forget_lockouts := now.Add(-s.maxLockoutDuration()).Unix()
+	name = truncate(name, LOGIN_ATTEMPT_USERNAME_MAX_LENGTH)
+
+	if _, err := s.db.Exec(INSERT_LOGIN_FAILURE, name, now.Unix(), forget_lockouts, forget, now.Unix()); err != nil {
+		slog.Error("failed insert login failure to sql", slog.Any("err", err))
+		return
+	}
+
+	var failures, lockouts int
+	if err := s.db.QueryRow(SELECT_LOGIN_LOCKOUTS, name).Scan(&failures, &lockouts); err != nil {
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return
+	}
+
+	if failures < s.cfg.MaxLoginFailures {
+		return
+	}
+
+	duration := s.lockDuration(lockouts)
+	result, err := s.db.Exec(LOCK_LOGIN, now.Add(duration).Unix(), name, s.cfg.MaxLoginFailures)
+	if err != nil {
+		slog.Error("failed lock login", slog.Any("err", err))
+		return
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected != 0 {
+		slog.Warn("Login locked after failed attempts", slog.String("user", name), slog.Duration("duration", duration))
+	}
+}
+
+// Forget failures of username after successful login
+func (s *AuthService) resetLoginFailures(name string) {
+	if _, err := s.db.Exec(DELETE_LOGIN_FAILURES, truncate(name, LOGIN_ATTEMPT_USERNAME_MAX_LENGTH)); err != nil {
+		slog.Error("failed delete login failures", slog.Any("err", err))
+	}
+}
+
+// Save attempt to audit log and count it, if it's failed. Errors of saving don't break login.
+func (s *AuthService) recordLoginAttempt(name string, source LoginSource, err error) {
+	if errors.Is(err, ErrInternal) {
+		return
+	}
+
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+
+	_, db_err := s.db.Exec(INSERT_LOGIN_ATTEMPT,
+		truncate(name, LOGIN_ATTEMPT_USERNAME_MAX_LENGTH),
+		truncate(source.IP, SESSION_IP_MAX_LENGTH),
+		string(source.Method), err == nil,
+		truncate(reason, LOGIN_ATTEMPT_REASON_MAX_LENGTH),
+		time.Now().Unix())
+	if db_err != nil {
+		slog.Error("failed insert login attempt to sql", slog.Any("err", db_err))
+	}
+
+	if !s.lockoutEnabled() {
+		return
+	}
+
+	for _, failure := range loginFailures {
+		if errors.Is(err, failure) {
+			s.registerLoginFailure(name)
+			return
+		}
+	}
+}
+
+// Usernames with recent failures or active lockout
+func (s *AuthService) GetLockouts() ([]Lockout, error) {
+	now := time.Now()
+	rows, err := s.db.Query(SELECT_LOCKOUTS, now.Unix(), now.Add(-s.lockoutDuration()).Unix())
+	if err != nil {
+		slog.Error("failed select lockouts", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	lockouts := make([]Lockout, 0)
+	for rows.Next() {
+		var lockout Lockout
+		if err := rows.Scan(&lockout.Username, &lockout.Failures, &lockout.Lockouts, &lockout.LastFailure, &lockout.LockedUntil); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+
+		if lockout.LockedUntil <= now.Unix() {
+			lockout.LockedUntil = 0
+		}
+		lockouts = append(lockouts, lockout)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return lockouts, nil
+}
+
+// Remove lockout and failures of username. Used by administrator.
+func (s *AuthService) ClearLockout(name string) error {
+	result, err := s.db.Exec(DELETE_LOGIN_FAILURES, truncate(name, LOGIN_ATTEMPT_USERNAME_MAX_LENGTH))
+	if err != nil {
+		slog.Error("failed delete login failures", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrLockoutNotFound
+	}
+	return nil
+}
+
+// Last login attempts, newest first. Empty name means attempts of all usernames, zero limit means default (100).
+func (s *AuthService) GetLoginAttempts(name string, limit int) ([]LoginAttempt, error) {
+	if limit <= 0 {
+		limit = DEFAULT_LOGIN_ATTEMPTS_LIMIT
+	}
+
+	var rows *sql.Rows
+	var err error
+	if name == "" {
+		rows, err = s.db.Query(SELECT_LOGIN_ATTEMPTS, limit)
+	} else {
+		rows, err = s.db.Query(SELECT_USER_LOGIN_ATTEMPTS, truncate(name, LOGIN_ATTEMPT_USERNAME_MAX_LENGTH), limit)
+	}
+	if err != nil {
+		slog.Error("failed select login attempts", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	attempts := make([]LoginAttempt, 0)
+	for rows.Next() {
+		var attempt LoginAttempt
+		if err := rows.Scan(&attempt.Username, &attempt.IP, &attempt.Method, &attempt.Success, &attempt.Reason, &attempt.Time); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return attempts, nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DEFAULT_PASSWORD_RESET_LIFETIME time.Duration = 24 * time.Hour
+
+	UPDATE_USER_PASSWORD string = "UPDATE users SET password = ? WHERE user = ?"
+	SELECT_TOKENS_AFTER  string = "SELECT tokens_after FROM users WHERE user = ?"
+	DELETE_USER_SESSIONS string = "DELETE sessions FROM sessions JOIN users ON users.id = sessions.user_id WHERE users.user = ?"
+
+	// Reset token is saved in database only as sha256 hash
+	INSERT_PASSWORD_RESET string = "INSERT INTO password_resets (token_hash, user_id, created_at, expires_at) " +
+		"SELECT ?, id, ?, ? FROM users WHERE user = ?"
+	SELECT_PASSWORD_RESET string = "SELECT users.user, expires_at " +
+		"FROM password_resets JOIN users ON users.id = password_resets.user_id WHERE token_hash = ?"
+	DELETE_PASSWORD_RESET          string = "DELETE FROM password_resets WHERE token_hash = ?"
+	DELETE_USER_PASSWORD_RESETS    string = "DELETE password_resets FROM password_resets JOIN users ON users.id = password_resets.user_id WHERE users.user = ?"
+	DELETE_EXPIRED_PASSWORD_RESETS string = "DELETE FROM password_resets WHERE expires_at < ?"
+)
+
+/*
+Save new password of user and end all his sessions. Access tokens issued before are rejected,
+personal tokens and unused reset tokens are removed.
+*/
+func (s *AuthService) setPassword(name, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.Error("failed generate hash from password", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	result, err := s.db.Exec(UPDATE_USER_PASSWORD, string(hash), name)
+	if err != nil {
+		slog.Error("failed update user password", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		// New hash always differs from old, so nothing is changed only without user
+		return ErrUserNotExist
+	}
+
+	if err := s.revokeUserTokens(name); err != nil {
+		return err
+	}
+
+	// Personal token could be created by someone, who knew old password
+	if _, err := s.db.Exec(DELETE_USER_PERSONAL_TOKENS, name); err != nil {
+		slog.Error("failed delete personal tokens", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if _, err := s.db.Exec(DELETE_USER_PASSWORD_RESETS, name); err != nil {
+		slog.Error("failed delete password reset tokens", slog.Any("err", err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// Set new password for user. Used by server administrator.
+func (s *AuthService) SetPassword(user User) error {
+	return s.setPassword(user.Name, user.Password)
+}
+
+// Change password of user, if current password is right. Ip address is saved to audit log.
+func (s *AuthService) ChangePassword(name, current_password, new_password, ip string) error {
+	if new_password == "" {
+		return ErrEmptyPassword
+	}
+
+	if _, err := s.checkPassword(NewUser(name, current_password), LoginSource{Method: LOGIN_METHOD_CHANGE_PASSWORD, IP: ip}); err != nil {
+		return err
+	}
+	return s.setPassword(name, new_password)
+}
+
+// Create one-time token to set new password without current one. Zero lifetime means default (24 hours).
+func (s *AuthService) CreatePasswordReset(name string, lifetime time.Duration) (string, error) {
+	if lifetime <= 0 {
+		lifetime = DEFAULT_PASSWORD_RESET_LIFETIME
+	}
+
+	now := time.Now()
+	if _, err := s.db.Exec(DELETE_EXPIRED_PASSWORD_RESETS, now.Unix()); err != nil {
+		slog.Warn("failed delete expired password reset tokens", slog.Any("err", err))
+	}
+
+	token := rand.Text()
+	result, err := s.db.Exec(INSERT_PASSWORD_RESET, hashToken(token), now.Unix(), now.Add(lifetime).Unix(), name)
+	if err != nil {
+		slog.Error("failed insert password reset token to sql", slog.Any("err", err))
+		return "", ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", ErrUserNotExist
+	}
+	return token, nil
+}
+
+// Set new password by reset token. Token can be used only once.
+func (s *AuthService) ResetPassword(token, new_password string) error {
+	if new_password == "" {
+		return ErrEmptyPassword
+	}
+
+	var name string
+	var expires int64
+
+	token_hash := hashToken(token)
+	row := s.db.QueryRow(SELECT_PASSWORD_RESET, token_hash)
+	if err := row.Scan(&name, &expires); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrBadResetToken
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	result, err := s.db.Exec(DELETE_PASSWORD_RESET, token_hash)
+	if err != nil {
+		slog.Error("failed delete password reset token", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	// Token can be used by concurrent request
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrBadResetToken
+	}
+
+	if time.Now().Unix() > expires {
+		return ErrBadResetToken
+	}
+
+	slog.Info("Password is reset", slog.String("user", name))
+	return s.setPassword(name, new_password)
+}
+
+// Time of last password change or tokens revocation of user in unix milliseconds
+func (s *AuthService) tokensAfter(name string) (int64, error) {
+	var tokens_after int64
+	row := s.db.QueryRow(SELECT_TOKENS_AFTER, name)
+	if err := row.Scan(&tokens_after); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUserNotExist
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return 0, ErrInternal
+	}
+	return tokens_after, nil
+}
+
+/*
+Check, that access token is issued after last password change of user.
+Token issued in the same millisecond as change is rejected, because order of them is unknown.
+*/
+func (s *AuthService) checkTokenIssued(name string, issued time.Time) error {
+	tokens_after, err := s.tokensAfter(name)
+	if err != nil {
+		if errors.Is(err, ErrUserNotExist) {
+			return ErrTokenRevoked
+		}
+		return err
+	}
+
+	if issued.UnixMilli() <= tokens_after {
+		return ErrTokenRevoked
+	}
+	return nil
+}
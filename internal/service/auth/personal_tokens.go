@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Right of personal token. Login sessions have all scopes.
+type Scope string
+
+const (
+	// Listing and download of files
+	SCOPE_FILES_READ Scope = "files:read"
+
+	// Upload, changes and removal of files. Includes files:read.
+	SCOPE_FILES_WRITE Scope = "files:write"
+
+	// Administration API. Works only for users with admin role.
+	SCOPE_ADMIN Scope = "admin"
+
+	// Sessions, password, keys, invites, two-factor authentication and personal tokens.
+	// Only login sessions have it, personal tokens can't get it.
+	SCOPE_ACCOUNT Scope = "account"
+
+	// Personal tokens are distinguished from jwt by prefix
+	PERSONAL_TOKEN_PREFIX          string = "mhs_"
+	PERSONAL_TOKEN_NAME_MAX_LENGTH int    = 64
+
+	INSERT_PERSONAL_TOKEN string = "INSERT INTO personal_tokens (user_id, name, token_hash, scopes, created_at, expires_at) " +
+		"SELECT id, ?, ?, ?, ?, ? FROM users WHERE user = ?"
+	SELECT_PERSONAL_TOKEN_ID string = "SELECT personal_tokens.id FROM personal_tokens JOIN users ON users.id = personal_tokens.user_id " +
+		"WHERE users.user = ? AND name = ?"
+	SELECT_PERSONAL_TOKEN string = "SELECT personal_tokens.id, users.user, scopes, expires_at, last_used " +
+		"FROM personal_tokens JOIN users ON users.id = personal_tokens.user_id WHERE token_hash = ?"
+	SELECT_USER_PERSONAL_TOKENS string = "SELECT personal_tokens.id, name, scopes, created_at, expires_at, last_used " +
+		"FROM personal_tokens JOIN users ON users.id = personal_tokens.user_id WHERE users.user = ? ORDER BY personal_tokens.id"
+	UPDATE_PERSONAL_TOKEN_LAST_USED string = "UPDATE personal_tokens SET last_used = ? WHERE id = ?"
+	DELETE_USER_PERSONAL_TOKEN      string = "DELETE personal_tokens FROM personal_tokens JOIN users ON users.id = personal_tokens.user_id " +
+		"WHERE personal_tokens.id = ? AND users.user = ?"
+	DELETE_USER_PERSONAL_TOKENS string = "DELETE personal_tokens FROM personal_tokens JOIN users ON users.id = personal_tokens.user_id WHERE users.user = ?"
+)
+
+// Scopes, which can be given to personal tokens
+var tokenScopes = []Scope{SCOPE_FILES_READ, SCOPE_FILES_WRITE, SCOPE_ADMIN}
+
+// Scopes, which include other scopes
+var impliedScopes = map[Scope][]Scope{
+	SCOPE_FILES_WRITE: {SCOPE_FILES_READ},
+}
+
+func ParseScope(scope string) (Scope, error) {
+	if !slices.Contains(tokenScopes, Scope(scope)) {
+		return "", ErrBadScope
+	}
+	return Scope(scope), nil
+}
+
+// Options of new personal token
+type PersonalTokenOptions struct {
+	// Name, which is shown in tokens list. Unique for user.
+	Name string
+
+	Scopes []Scope
+
+	// Zero lifetime means token never expires
+	Lifetime time.Duration
+}
+
+// Personal token of user without secret part. Times are unix seconds.
+type PersonalToken struct {
+	ID      int64   `json:"id"`
+	Name    string  `json:"name"`
+	Scopes  []Scope `json:"scopes"`
+	Created int64   `json:"created"`
+
+	// Zero if token never expires
+	Expires int64 `json:"expires"`
+
+	// Zero if token wasn't used
+	LastUsed int64 `json:"last_used"`
+}
+
+func joinScopes(scopes []Scope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, ",")
+}
+
+func splitScopes(scopes string) []Scope {
+	result := make([]Scope, 0)
+	for scope := range strings.SplitSeq(scopes, ",") {
+		if scope != "" {
+			result = append(result, Scope(scope))
+		}
+	}
+	return result
+}
+
+/*
+Create personal token of user. Secret token is returned only once, in database only its hash is saved.
+Token works with rights of user role, but only within its scopes.
+*/
+func (s *AuthService) CreatePersonalToken(username string, opts PersonalTokenOptions) (string, PersonalToken, error) {
+	if opts.Name == "" {
+		return "", PersonalToken{}, ErrPersonalTokenNameEmpty
+	}
+
+	if len(opts.Name) > PERSONAL_TOKEN_NAME_MAX_LENGTH {
+		return "", PersonalToken{}, ErrNameTooLong
+	}
+
+	if len(opts.Scopes) == 0 {
+		return "", PersonalToken{}, ErrBadScope
+	}
+
+	scopes := make([]Scope, 0, len(opts.Scopes))
+	for _, scope := range opts.Scopes {
+		if _, err := ParseScope(string(scope)); err != nil {
+			return "", PersonalToken{}, err
+		}
+
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if opts.Lifetime < 0 {
+		return "", PersonalToken{}, ErrBadTokenExpire
+	}
+
+	var id int64
+	switch err := s.db.QueryRow(SELECT_PERSONAL_TOKEN_ID, username, opts.Name).Scan(&id); {
+	case err == nil:
+		return "", PersonalToken{}, ErrPersonalTokenExists
+	case !errors.Is(err, sql.ErrNoRows):
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return "", PersonalToken{}, ErrInternal
+	}
+
+	now := time.Now()
+	personal_token := PersonalToken{
+		Name:    opts.Name,
+		Scopes:  scopes,
+		Created: now.Unix(),
+	}
+
+	if opts.Lifetime > 0 {
+		personal_token.Expires = now.Add(opts.Lifetime).Unix()
+	}
+
+	token := PERSONAL_TOKEN_PREFIX + rand.Text()
+
+	result, err := s.db.Exec(INSERT_PERSONAL_TOKEN, personal_token.Name, hashToken(token), joinScopes(scopes),
+		personal_token.Created, personal_token.Expires, username)
+	if err != nil {
+		slog.Error("failed insert personal token to sql", slog.Any("err", err))
+		return "", PersonalToken{}, ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", PersonalToken{}, ErrUserNotExist
+	}
+
+	if personal_token.ID, err = result.LastInsertId(); err != nil {
+		slog.Error("failed get personal token id", slog.Any("err", err))
+		return "", PersonalToken{}, ErrInternal
+	}
+	return token, personal_token, nil
+}
+
+// Personal tokens of user, including expired ones
+func (s *AuthService) GetPersonalTokens(username string) ([]PersonalToken, error) {
+	rows, err := s.db.Query(SELECT_USER_PERSONAL_TOKENS, username)
+	if err != nil {
+		slog.Error("failed select personal tokens", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	tokens := make([]PersonalToken, 0)
+	for rows.Next() {
+		var token PersonalToken
+		var scopes string
+		if err := rows.Scan(&token.ID, &token.Name, &scopes, &token.Created, &token.Expires, &token.LastUsed); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+
+		token.Scopes = splitScopes(scopes)
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return tokens, nil
+}
+
+func (s *AuthService) RevokePersonalToken(username string, id int64) error {
+	result, err := s.db.Exec(DELETE_USER_PERSONAL_TOKEN, id, username)
+	if err != nil {
+		slog.Error("failed delete personal token", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrPersonalTokenNotFound
+	}
+	return nil
+}
+
+// Check personal token and return claims with its scopes and current role of user
+func (s *AuthService) parsePersonalToken(token string) (AccessClaims, error) {
+	var id, expires, last_used int64
+	var scopes string
+	claims := AccessClaims{}
+
+	row := s.db.QueryRow(SELECT_PERSONAL_TOKEN, hashToken(token))
+	if err := row.Scan(&id, &claims.Name, &scopes, &expires, &last_used); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AccessClaims{}, ErrBadPersonalToken
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return AccessClaims{}, ErrInternal
+	}
+
+	now := time.Now()
+	if expires != 0 && expires <= now.Unix() {
+		return AccessClaims{}, ErrBadPersonalToken
+	}
+
+	role, err := s.UserRole(claims.Name)
+	if err != nil {
+		if errors.Is(err, ErrUserDisabled) || errors.Is(err, ErrUserNotExist) {
+			return AccessClaims{}, ErrBadPersonalToken
+		}
+		return AccessClaims{}, err
+	}
+
+	claims.Role = role
+	claims.Scopes = splitScopes(scopes)
+	if expires != 0 {
+		claims.Expires = time.Unix(expires, 0)
+	}
+
+	if now.Sub(time.Unix(last_used, 0)) >= SESSION_TOUCH_INTERVAL {
+		if _, err := s.db.Exec(UPDATE_PERSONAL_TOKEN_LAST_USED, now.Unix(), id); err != nil {
+			slog.Warn("failed update personal token last use", slog.Any("err", err))
+		}
+	}
+	return claims, nil
+}
+
+// Check, that token has scope. Claims of login sessions have all scopes.
+func (c AccessClaims) HasScope(scope Scope) bool {
+	if c.Scopes == nil {
+		return true
+	}
+
+	for _, granted := range c.Scopes {
+		if granted == scope || slices.Contains(impliedScopes[granted], scope) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	// Size of registration key in bytes. Key is saved as hex string.
+	REGISTER_SECRET_KEY_SIZE int = 32
+
+	INSERT_REGISTER_SECRET_KEY string = `INSERT INTO register_secret_keys (secret_key, created_at, expires_at, max_uses, username, role, created_by, invite)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	SELECT_REGISTER_SECRET_KEYS string = `SELECT secret_key, created_at, expires_at, max_uses, uses, username, role, created_by, invite
+FROM register_secret_keys WHERE (expires_at = 0 OR expires_at > ?) AND uses < max_uses ORDER BY id`
+	SELECT_REGISTER_SECRET_KEY string = `SELECT id, expires_at, max_uses, uses, username, role, created_by, invite
+FROM register_secret_keys WHERE secret_key = ? FOR UPDATE`
+	UPDATE_USER_INVITED_BY              string = "UPDATE users SET invited_by = ? WHERE user = ?"
+	UPDATE_REGISTER_SECRET_KEY_USES     string = "UPDATE register_secret_keys SET uses = uses + 1 WHERE id = ?"
+	DELETE_REGISTRATION_SECRET_KEY      string = "DELETE FROM register_secret_keys WHERE id = ?"
+	DELETE_EXPIRED_REGISTER_SECRET_KEYS string = "DELETE FROM register_secret_keys WHERE expires_at != 0 AND expires_at <= ?"
+	REVOKE_REGISTER_SECRET_KEY          string = "DELETE FROM register_secret_keys WHERE secret_key = ?"
+)
+
+// Options of generated registration keys. Zero options give one-time key without expiry, which creates user with "user" role.
+type RegisterKeyOptions struct {
+	// Zero lifetime means key never expires
+	Lifetime time.Duration
+
+	// Count of users, which can be registered by key. Zero means one.
+	MaxUses int
+
+	// Only user with this name can be registered by key. Empty means any name.
+	Username string
+
+	// Role of registered users. Empty means "user".
+	Role Role
+
+	// Name of administrator, which generated key, or user, which created invite
+	CreatedBy string
+
+	// Key is invite of user CreatedBy
+	invite bool
+}
+
+// Registration key. Times are unix seconds.
+type RegisterKey struct {
+	Key     string `json:"key"`
+	Created int64  `json:"created"`
+
+	// Zero if key never expires
+	Expires int64 `json:"expires"`
+
+	MaxUses   int    `json:"max_uses"`
+	Uses      int    `json:"uses"`
+	Username  string `json:"username"`
+	Role      Role   `json:"role"`
+	CreatedBy string `json:"created_by"`
+
+	// Key is invite, which is created by user
+	Invite bool `json:"invite"`
+}
+
+// Generate new registration keys
+func (s *AuthService) GenerateRegisterKeys(count int, opts RegisterKeyOptions) ([]RegisterKey, error) {
+	return generateRegisterKeys(s.db, count, opts)
+}
+
+func generateRegisterKeys(db execer, count int, opts RegisterKeyOptions) ([]RegisterKey, error) {
+	if count <= 0 {
+		return nil, ErrBadKeysCount
+	}
+
+	if opts.MaxUses < 0 {
+		return nil, ErrBadKeyUses
+	} else if opts.MaxUses == 0 {
+		opts.MaxUses = 1
+	}
+
+	if opts.Lifetime < 0 {
+		return nil, ErrBadKeyExpire
+	}
+
+	if opts.Role == "" {
+		opts.Role = ROLE_USER
+	} else if _, err := ParseRole(string(opts.Role)); err != nil {
+		return nil, err
+	}
+
+	if len(opts.Username) > USER_NAME_MAX_LENGTH {
+		return nil, ErrNameTooLong
+	}
+
+	now := time.Now()
+	var expires int64
+	if opts.Lifetime > 0 {
+		expires = now.Add(opts.Lifetime).Unix()
+	}
+
+	keys := make([]RegisterKey, 0, count)
+	for range count {
+		key := make([]byte, REGISTER_SECRET_KEY_SIZE)
+		_, _ = rand.Read(key)
+
+		register_key := RegisterKey{
+			Key:       hex.EncodeToString(key),
+			Created:   now.Unix(),
+			Expires:   expires,
+			MaxUses:   opts.MaxUses,
+			Username:  opts.Username,
+			Role:      opts.Role,
+			CreatedBy: opts.CreatedBy,
+			Invite:    opts.invite,
+		}
+
+		_, err := db.Exec(INSERT_REGISTER_SECRET_KEY, register_key.Key, register_key.Created, register_key.Expires,
+			register_key.MaxUses, register_key.Username, string(register_key.Role), register_key.CreatedBy, register_key.Invite)
+		if err != nil {
+			slog.Error("failed insert registration secret key to sql", slog.Any("err", err))
+			return keys, ErrInternal
+		}
+		keys = append(keys, register_key)
+	}
+	return keys, nil
+}
+
+// Return registration keys, which aren't expired and used up
+func (s *AuthService) GetRegisterKeys() ([]RegisterKey, error) {
+	rows, err := s.db.Query(SELECT_REGISTER_SECRET_KEYS, time.Now().Unix())
+	if err != nil {
+		slog.Error("failed select registration secret keys", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	keys := make([]RegisterKey, 0)
+	for rows.Next() {
+		var key RegisterKey
+		if err := rows.Scan(&key.Key, &key.Created, &key.Expires, &key.MaxUses, &key.Uses, &key.Username, &key.Role, &key.CreatedBy, &key.Invite); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return keys, nil
+}
+
+// Delete registration key
+func (s *AuthService) RevokeRegisterKey(key string) error {
+	result, err := s.db.Exec(REVOKE_REGISTER_SECRET_KEY, key)
+	if err != nil {
+		slog.Error("failed delete registration secret key from sql", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrRegSecretKeyNotFound
+	}
+	return nil
+}
+
+// Check registration key for user and count its use. Key is locked until transaction ends.
+// Last use deletes key. Return role of registered user and name of user, whose invite is used.
+func consumeRegisterKey(tx *sql.Tx, secret_key, username string) (Role, string, error) {
+	var id, max_uses, uses int
+	var expires int64
+	var bound_username, role, created_by string
+	var invite bool
+
+	row := tx.QueryRow(SELECT_REGISTER_SECRET_KEY, secret_key)
+	if err := row.Scan(&id, &expires, &max_uses, &uses, &bound_username, &role, &created_by, &invite); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", ErrRegSecretKeyNotFound
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return "", "", ErrInternal
+	}
+
+	if uses >= max_uses {
+		return "", "", ErrRegSecretKeyNotFound
+	}
+
+	if expires != 0 && expires <= time.Now().Unix() {
+		return "", "", ErrRegSecretKeyExpired
+	}
+
+	if bound_username != "" && bound_username != username {
+		return "", "", ErrRegSecretKeyBound
+	}
+
+	user_role, err := ParseRole(role)
+	if err != nil {
+		slog.Error("registration secret key has unknown role", slog.String("role", role))
+		return "", "", ErrInternal
+	}
+
+	// Invites of disabled users don't work
+	invited_by := ""
+	if invite {
+		var inviter_role string
+		var disabled bool
+		if err := tx.QueryRow(SELECT_USER_ROLE, created_by).Scan(&inviter_role, &disabled); err != nil || disabled {
+			return "", "", ErrRegSecretKeyNotFound
+		}
+		invited_by = created_by
+	}
+
+	query := UPDATE_REGISTER_SECRET_KEY_USES
+	if uses+1 >= max_uses {
+		query = DELETE_REGISTRATION_SECRET_KEY
+	}
+
+	if _, err := tx.Exec(query, id); err != nil {
+		slog.Error("failed update registration secret key", slog.Any("err", err))
+		return "", "", ErrInternal
+	}
+	return user_role, invited_by, nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Role of user. Each role has rights of roles below it.
+type Role string
+
+const (
+	// Read-only access to own files
+	ROLE_GUEST Role = "guest"
+	ROLE_USER  Role = "user"
+
+	// Management of users and registration keys
+	ROLE_ADMIN Role = "admin"
+
+	SELECT_USER_ROLE     string = "SELECT role, disabled FROM users WHERE user = ?"
+	SELECT_USER_ACCESS   string = "SELECT role, disabled, tokens_after FROM users WHERE user = ?"
+	UPDATE_USER_ROLE     string = "UPDATE users SET role = ? WHERE user = ?"
+	UPDATE_USER_DISABLED string = "UPDATE users SET disabled = ? WHERE user = ?"
+	UPDATE_TOKENS_AFTER  string = "UPDATE users SET tokens_after = ? WHERE user = ?"
+)
+
+var rolesRank = map[Role]int{
+	ROLE_GUEST: 0,
+	ROLE_USER:  1,
+	ROLE_ADMIN: 2,
+}
+
+func ParseRole(role string) (Role, error) {
+	if _, ok := rolesRank[Role(role)]; !ok {
+		return "", ErrBadRole
+	}
+	return Role(role), nil
+}
+
+// Check, that role has rights of required role
+func (r Role) Allows(required Role) bool {
+	rank, ok := rolesRank[r]
+	return ok && rank >= rolesRank[required]
+}
+
+// Return role of user. Disabled users get ErrUserDisabled.
+func (s *AuthService) UserRole(name string) (Role, error) {
+	role, _, err := s.UserAccess(name)
+	return role, err
+}
+
+/*
+Return role of user and time of his last password change or tokens revocation in unix milliseconds.
+Disabled users get ErrUserDisabled. Used to check users, whose passwords are cached (WebDAV).
+*/
+func (s *AuthService) UserAccess(name string) (Role, int64, error) {
+	var role string
+	var disabled bool
+	var tokens_after int64
+
+	row := s.db.QueryRow(SELECT_USER_ACCESS, name)
+	if err := row.Scan(&role, &disabled, &tokens_after); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", 0, ErrUserNotExist
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return "", 0, ErrInternal
+	}
+
+	if disabled {
+		return "", 0, ErrUserDisabled
+	}
+	return Role(role), tokens_after, nil
+}
+
+// Check, that user exists. Disabled users are found too.
+func (s *AuthService) checkUserExists(name string) error {
+	if _, err := s.UserRole(name); err != nil && !errors.Is(err, ErrUserDisabled) {
+		return err
+	}
+	return nil
+}
+
+// End all sessions of user and reject his access tokens issued before. Time is saved in milliseconds.
+func (s *AuthService) revokeUserTokens(name string) error {
+	if _, err := s.db.Exec(UPDATE_TOKENS_AFTER, time.Now().UnixMilli(), name); err != nil {
+		slog.Error("failed update tokens issue time", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if _, err := s.db.Exec(DELETE_USER_SESSIONS, name); err != nil {
+		slog.Error("failed delete user sessions", slog.Any("err", err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// Set role of user. Sessions of user are ended, so new role is applied at next login.
+func (s *AuthService) SetRole(name string, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+
+	if err := s.checkUserExists(name); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(UPDATE_USER_ROLE, string(role), name); err != nil {
+		slog.Error("failed update user role", slog.Any("err", err))
+		return ErrInternal
+	}
+	return s.revokeUserTokens(name)
+}
+
+// Disable or enable user. Disabled user can't log in, his sessions are ended.
+func (s *AuthService) SetDisabled(name string, disabled bool) error {
+	if err := s.checkUserExists(name); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(UPDATE_USER_DISABLED, disabled, name); err != nil {
+		slog.Error("failed update user state", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if !disabled {
+		return nil
+	}
+	return s.revokeUserTokens(name)
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SESSION_DEVICE_MAX_LENGTH     int = 128
+	SESSION_USER_AGENT_MAX_LENGTH int = 256
+	SESSION_IP_MAX_LENGTH         int = 64
+
+	// Last use of session is updated not often than this interval
+	SESSION_TOUCH_INTERVAL time.Duration = time.Minute
+
+	INSERT_SESSION string = "INSERT INTO sessions (id, user_id, device, user_agent, ip, created_at, last_used) " +
+		"SELECT ?, id, ?, ?, ?, ?, ? FROM users WHERE user = ?"
+	SELECT_SESSION_LAST_USED string = "SELECT last_used FROM sessions WHERE id = ?"
+	SELECT_USER_SESSIONS     string = "SELECT sessions.id, device, user_agent, ip, created_at, last_used " +
+		"FROM sessions JOIN users ON users.id = sessions.user_id WHERE users.user = ? ORDER BY last_used DESC"
+	UPDATE_SESSION_LAST_USED string = "UPDATE sessions SET last_used = ? WHERE id = ?"
+	UPDATE_SESSION_IP        string = "UPDATE sessions SET last_used = ?, ip = ? WHERE id = ?"
+
+	// Refresh tokens of session are deleted with him
+	DELETE_SESSION          string = "DELETE FROM sessions WHERE id = ?"
+	DELETE_USER_SESSION     string = "DELETE sessions FROM sessions JOIN users ON users.id = sessions.user_id WHERE sessions.id = ? AND users.user = ?"
+	DELETE_EXPIRED_SESSIONS string = "DELETE FROM sessions WHERE last_used < ?"
+)
+
+// Device, from which user is logged in
+type Device struct {
+	// Name of device, given by client
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+// Active login session of user
+type Session struct {
+	ID        string `json:"id"`
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+
+	// Unix time of login
+	Created int64 `json:"created"`
+
+	// Unix time of last request or token refresh
+	LastUsed int64 `json:"last_used"`
+
+	// Session of token, which is used in request
+	Current bool `json:"current"`
+}
+
+func truncate(str string, max_length int) string {
+	if len(str) <= max_length {
+		return str
+	}
+
+	// Cut on runes boundary
+	cut := 0
+	for i := range str {
+		if i > max_length {
+			break
+		}
+		cut = i
+	}
+	return str[:cut]
+}
+
+func (s *AuthService) createSession(name string, device Device) (string, error) {
+	session_id := uuid.NewString()
+	now := time.Now().Unix()
+
+	result, err := s.db.Exec(INSERT_SESSION, session_id,
+		truncate(device.Name, SESSION_DEVICE_MAX_LENGTH),
+		truncate(device.UserAgent, SESSION_USER_AGENT_MAX_LENGTH),
+		truncate(device.IP, SESSION_IP_MAX_LENGTH),
+		now, now, name)
+	if err != nil {
+		slog.Error("failed insert session to sql", slog.Any("err", err))
+		return "", ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", ErrUserNotExist
+	}
+	return session_id, nil
+}
+
+// Update last use time and ip address of session
+func (s *AuthService) touchSession(session_id, ip string) error {
+	var err error
+	if ip == "" {
+		_, err = s.db.Exec(UPDATE_SESSION_LAST_USED, time.Now().Unix(), session_id)
+	} else {
+		_, err = s.db.Exec(UPDATE_SESSION_IP, time.Now().Unix(), truncate(ip, SESSION_IP_MAX_LENGTH), session_id)
+	}
+
+	if err != nil {
+		slog.Error("failed update session", slog.Any("err", err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// Check, that session is not revoked, and update his last use time
+func (s *AuthService) checkSession(session_id string) error {
+	var last_used int64
+	row := s.db.QueryRow(SELECT_SESSION_LAST_USED, session_id)
+	if err := row.Scan(&last_used); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTokenRevoked
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if time.Since(time.Unix(last_used, 0)) < SESSION_TOUCH_INTERVAL {
+		return nil
+	}
+	return s.touchSession(session_id, "")
+}
+
+// Get active sessions of user, recently used first
+func (s *AuthService) GetSessions(username string) ([]Session, error) {
+	rows, err := s.db.Query(SELECT_USER_SESSIONS, username)
+	if err != nil {
+		slog.Error("failed get sessions from sql", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.Device, &session.UserAgent, &session.IP, &session.Created, &session.LastUsed); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return sessions, nil
+}
+
+// Revoke session of user. Access tokens of session are rejected immediately.
+func (s *AuthService) RevokeUserSession(username, session_id string) error {
+	result, err := s.db.Exec(DELETE_USER_SESSION, session_id, username)
+	if err != nil {
+		slog.Error("failed delete session from sql", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// Revoke session with all his tokens
+func (s *AuthService) RevokeSession(session_id string) error {
+	if _, err := s.db.Exec(DELETE_SESSION, session_id); err != nil {
+		slog.Error("failed delete session from sql", slog.Any("err", err))
+		return ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// Shorter RSA keys are rejected
+	MIN_RSA_KEY_BITS int = 2048
+
+	JWK_USE_SIGNATURE string = "sig"
+)
+
+/*
+Key of access tokens. Ed25519 keys sign tokens with EdDSA, RSA keys - with RS256.
+Keys, which are kept after rotation only to verify old tokens, can have only public part.
+*/
+type SigningKey struct {
+	// Key id in "kid" header of token: RFC 7638 thumbprint of public key
+	ID     string
+	Method jwt.SigningMethod
+
+	// Nil for keys, which only verify tokens
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// Public key in JWK format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+
+	// Ed25519 key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+
+	// RSA key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// Public keys, by which access tokens can be verified without shared secret
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func base64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Create signing key from ed25519 or rsa key, private or public
+func NewSigningKey(key any) (SigningKey, error) {
+	signing_key := SigningKey{}
+
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		signing_key.Private, signing_key.Public = key, key.Public()
+	case ed25519.PublicKey:
+		signing_key.Public = key
+	case *rsa.PrivateKey:
+		signing_key.Private, signing_key.Public = key, key.Public()
+	case *rsa.PublicKey:
+		signing_key.Public = key
+	default:
+		return SigningKey{}, ErrBadSigningKey
+	}
+
+	var thumbprint string
+	switch public := signing_key.Public.(type) {
+	case ed25519.PublicKey:
+		signing_key.Method = jwt.SigningMethodEdDSA
+		thumbprint = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64URL(public))
+	case *rsa.PublicKey:
+		if public.N.BitLen() < MIN_RSA_KEY_BITS {
+			return SigningKey{}, ErrBadSigningKey
+		}
+
+		signing_key.Method = jwt.SigningMethodRS256
+		thumbprint = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			base64URL(big.NewInt(int64(public.E)).Bytes()), base64URL(public.N.Bytes()))
+	}
+
+	sum := sha256.Sum256([]byte(thumbprint))
+	signing_key.ID = base64URL(sum[:])
+	return signing_key, nil
+}
+
+// Public part of key in JWK format
+func (k SigningKey) JWK() JWK {
+	jwk := JWK{
+		Use: JWK_USE_SIGNATURE,
+		Alg: k.Method.Alg(),
+		Kid: k.ID,
+	}
+
+	switch public := k.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", base64URL(public)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64URL(public.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(public.E)).Bytes())
+	}
+	return jwk
+}
+
+// Parse key from PEM: PKCS #8 or PKCS #1 private key, or PKIX public key
+func ParseSigningKey(pem_bytes []byte) (SigningKey, error) {
+	block, _ := pem.Decode(pem_bytes)
+	if block == nil {
+		return SigningKey{}, ErrBadSigningKey
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, ErrBadSigningKey
+	}
+
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("%w: %w", ErrBadSigningKey, err)
+	}
+	return NewSigningKey(key)
+}
+
+// Generate ed25519 key and save it to file in PKCS #8 PEM
+func GenerateSigningKey(path string) (SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return SigningKey{}, err
+	}
+	return NewSigningKey(private)
+}
+
+/*
+Load keys of access tokens from PEM files. First key signs new tokens, so it must be private,
+it's generated, if file doesn't exist. Other keys only verify tokens, which were signed before rotation.
+*/
+func LoadSigningKeys(paths []string) ([]SigningKey, error) {
+	keys := make([]SigningKey, 0, len(paths))
+	for i, path := range paths {
+		pem_bytes, err := os.ReadFile(path)
+		if i == 0 && errors.Is(err, os.ErrNotExist) {
+			key, err := GenerateSigningKey(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+
+			keys = append(keys, key)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := ParseSigningKey(pem_bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if i == 0 && key.Private == nil {
+			return nil, fmt.Errorf("%s: %w", path, ErrPublicSigningKey)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Lifetime of access tokens from config or default (15 minutes)
+func (s *AuthService) accessTokenLifetime() time.Duration {
+	if s.cfg.AccessTokenLifetime <= 0 {
+		return ACCESS_TOKEN_LIFETIME
+	}
+	return s.cfg.AccessTokenLifetime
+}
+
+// Sign claims of access token by first key or, without keys, by jwt signature (HS256)
+func (s *AuthService) signToken(claims jwt.MapClaims) (string, error) {
+	if len(s.cfg.SigningKeys) == 0 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.JWTSignature))
+	}
+
+	key := s.cfg.SigningKeys[0]
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Find key of token by "kid" header. Algorithm of token must match the key.
+func (s *AuthService) verificationKey(token *jwt.Token) (any, error) {
+	if len(s.cfg.SigningKeys) == 0 {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrJwtSignatureInvalid, token.Header["alg"])
+		}
+		return []byte(s.cfg.JWTSignature), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range s.cfg.SigningKeys {
+		if key.ID != kid {
+			continue
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("%w: %s", ErrJwtSignatureInvalid, token.Header["alg"])
+		}
+		return key.Public, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// Public keys of access tokens. Empty, when tokens are signed by jwt signature.
+func (s *AuthService) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(s.cfg.SigningKeys))}
+	for _, key := range s.cfg.SigningKeys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	return jwks
+}
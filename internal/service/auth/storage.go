@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+)
+
+type UserStorage struct {
+	Name string `json:"username"`
+
+	// Size of user files in bytes
+	Used int64 `json:"used"`
+}
+
+type StorageUsage struct {
+	// Free space of workspace disk in bytes
+	Available uint64 `json:"available"`
+
+	// Size of all users files in bytes
+	Used  int64         `json:"used"`
+	Users []UserStorage `json:"users"`
+}
+
+// Size of files in directory. Missing directory has zero size.
+func dirSize(dir_path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir_path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Calculate size of files of each user and free space of workspace
+func (s *AuthService) GetStorageUsage() (StorageUsage, error) {
+	users, err := s.GetUsers()
+	if err != nil {
+		return StorageUsage{}, err
+	}
+
+	usage := StorageUsage{
+		Users: make([]UserStorage, 0, len(users)),
+	}
+
+	if usage.Available, err = freemem.GetAvailableDiskSpace(s.cfg.WorkspacePath); err != nil {
+		slog.Error("failed get available disk space", slog.Any("err", err))
+		return StorageUsage{}, ErrInternal
+	}
+
+	for _, user := range users {
+		// Old registrations didn't check names, so folder must be direct child of workspace
+		if filepath.Base(user.Name) != user.Name || user.Name == ".." {
+			continue
+		}
+
+		used, err := dirSize(filepath.Join(s.cfg.WorkspacePath, user.Name))
+		if err != nil {
+			slog.Error("failed calculate user folder size", slog.String("user", user.Name), slog.Any("err", err))
+			return StorageUsage{}, ErrInternal
+		}
+
+		usage.Used += used
+		usage.Users = append(usage.Users, UserStorage{Name: user.Name, Used: used})
+	}
+	return usage, nil
+}
@@ -0,0 +1,356 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// Default lifetime of access token
+	ACCESS_TOKEN_LIFETIME  time.Duration = 15 * time.Minute
+	REFRESH_TOKEN_LIFETIME time.Duration = 30 * 24 * time.Hour
+
+	TOKEN_TYPE string = "Bearer"
+
+	// Refresh token is saved in database only as sha256 hash. Revoked tokens are kept until expiration to detect reuse.
+	INSERT_REFRESH_TOKEN string = "INSERT INTO refresh_tokens (user_id, session_id, token_hash, created_at, expires_at) " +
+		"SELECT id, ?, ?, ?, ? FROM users WHERE user = ?"
+	SELECT_REFRESH_TOKEN string = "SELECT refresh_tokens.id, users.user, session_id, revoked, expires_at " +
+		"FROM refresh_tokens JOIN users ON users.id = refresh_tokens.user_id WHERE token_hash = ?"
+	REVOKE_REFRESH_TOKEN          string = "UPDATE refresh_tokens SET revoked = TRUE WHERE id = ? AND revoked = FALSE"
+	DELETE_EXPIRED_REFRESH_TOKENS string = "DELETE FROM refresh_tokens WHERE expires_at < ?"
+
+	// Denylist of access tokens (jti), which were revoked before expiration
+	INSERT_REVOKED_TOKEN          string = "INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)"
+	SELECT_REVOKED_TOKEN          string = "SELECT expires_at FROM revoked_tokens WHERE jti = ?"
+	DELETE_EXPIRED_REVOKED_TOKENS string = "DELETE FROM revoked_tokens WHERE expires_at < ?"
+)
+
+// Tokens of session. Access token is sent in Authorization header, refresh token is exchanged to new tokens.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+
+	// Access token lifetime in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// Claims of checked access token
+type AccessClaims struct {
+	Name string
+
+	// Token id (jti). Empty for tokens issued before revocation support.
+	ID string
+
+	// Session of refresh token. Empty for tokens issued without session.
+	Session string
+
+	// Role of user at token issue
+	Role Role
+
+	// Scopes of personal token. Nil for login sessions, which have all scopes.
+	Scopes []Scope
+
+	Issued  time.Time
+	Expires time.Time
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AuthService) newAccessToken(name, session_id string, role Role) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"name": name,
+		"role": string(role),
+		"jti":  uuid.NewString(),
+		"nbf":  now.Unix(),
+		"exp":  now.Add(s.accessTokenLifetime()).Unix(),
+		// Milliseconds are kept to compare with time of password change
+		"iat": float64(now.UnixMilli()) / 1000,
+	}
+
+	if session_id != "" {
+		claims["sid"] = session_id
+	}
+
+	if s.cfg.Issuer != "" {
+		claims["iss"] = s.cfg.Issuer
+	}
+
+	if s.cfg.Audience != "" {
+		claims["aud"] = s.cfg.Audience
+	}
+
+	token_str, err := s.signToken(claims)
+	if err != nil {
+		slog.Error("failed complete signed jwt token", slog.Any("err", err))
+		return "", ErrInternal
+	}
+	return token_str, nil
+}
+
+// Create new refresh token of session and access token for him
+func (s *AuthService) issueTokens(name, session_id string) (Tokens, error) {
+	role, err := s.UserRole(name)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	refresh_token := rand.Text()
+
+	now := time.Now()
+	result, err := s.db.Exec(INSERT_REFRESH_TOKEN, session_id, hashToken(refresh_token), now.Unix(), now.Add(REFRESH_TOKEN_LIFETIME).Unix(), name)
+	if err != nil {
+		slog.Error("failed insert refresh token to sql", slog.Any("err", err))
+		return Tokens{}, ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return Tokens{}, ErrUserNotExist
+	}
+
+	access_token, err := s.newAccessToken(name, session_id, role)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:  access_token,
+		RefreshToken: refresh_token,
+		TokenType:    TOKEN_TYPE,
+		ExpiresIn:    int64(s.accessTokenLifetime().Seconds()),
+	}, nil
+}
+
+// Remove expired refresh tokens, unused sessions, denylist entries, registration keys, login challenges,
+// forgotten login failures and old records of audit log
+func (s *AuthService) deleteExpiredTokens() {
+	now := time.Now().Unix()
+	if _, err := s.db.Exec(DELETE_EXPIRED_SESSIONS, time.Now().Add(-REFRESH_TOKEN_LIFETIME).Unix()); err != nil {
+		slog.Warn("failed delete expired sessions", slog.Any("err", err))
+	}
+
+	if _, err := s.db.Exec(DELETE_EXPIRED_REFRESH_TOKENS, now); err != nil {
+		slog.Warn("failed delete expired refresh tokens", slog.Any("err", err))
+	}
+
+	if _, err := s.db.Exec(DELETE_EXPIRED_REVOKED_TOKENS, now); err != nil {
+		slog.Warn("failed delete expired revoked tokens", slog.Any("err", err))
+	}
+
+	if _, err := s.db.Exec(DELETE_EXPIRED_REGISTER_SECRET_KEYS, now); err != nil {
+		slog.Warn("failed delete expired registration secret keys", slog.Any("err", err))
+	}
+
+	if _, err := s.db.Exec(DELETE_EXPIRED_LOGIN_CHALLENGES, now); err != nil {
+		slog.Warn("failed delete expired login challenges", slog.Any("err", err))
+	}
+
+	if _, err := s.db.Exec(DELETE_EXPIRED_LOGIN_FAILURES, time.Now().Add(-s.maxLockoutDuration()).Unix()); err != nil {
+		slog.Warn("failed delete expired login failures", slog.Any("err", err))
+	}
+
+	if _, err := s.db.Exec(DELETE_OLD_LOGIN_ATTEMPTS, time.Now().Add(-LOGIN_ATTEMPTS_RETENTION).Unix()); err != nil {
+		slog.Warn("failed delete old login attempts", slog.Any("err", err))
+	}
+}
+
+/*
+Check user password and open new session on device. Return access and refresh tokens.
+For user with two-factor authentication return *TOTPRequiredError with challenge token for LoginTOTP.
+*/
+func (s *AuthService) Login(user User, device Device) (Tokens, error) {
+	totp_enabled, err := s.checkPassword(user, LoginSource{Method: LOGIN_METHOD_PASSWORD, IP: device.IP})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	s.deleteExpiredTokens()
+
+	if totp_enabled {
+		challenge, err := s.createLoginChallenge(user.Name, device)
+		if err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, challenge
+	}
+
+	session_id, err := s.createSession(user.Name, device)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.issueTokens(user.Name, session_id)
+}
+
+// Check user password and return access token without session. Used by clients, which don't support refresh tokens.
+// Users with two-factor authentication get ErrTOTPRequired.
+func (s *AuthService) LoginAccessOnly(user User, ip string) (string, error) {
+	if err := s.CheckPassword(user, LoginSource{Method: LOGIN_METHOD_PASSWORD, IP: ip}); err != nil {
+		return "", err
+	}
+
+	role, err := s.UserRole(user.Name)
+	if err != nil {
+		return "", err
+	}
+	return s.newAccessToken(user.Name, "", role)
+}
+
+/*
+Exchange refresh token to new tokens of the same session. Refresh token can be used only once:
+if used token is presented again, it was stolen, so whole session is revoked.
+Ip address is saved as last address of session.
+*/
+func (s *AuthService) Refresh(refresh_token, ip string) (Tokens, error) {
+	var id int
+	var name, session_id string
+	var revoked bool
+	var expires int64
+
+	row := s.db.QueryRow(SELECT_REFRESH_TOKEN, hashToken(refresh_token))
+	if err := row.Scan(&id, &name, &session_id, &revoked, &expires); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tokens{}, ErrBadRefreshToken
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return Tokens{}, ErrInternal
+	}
+
+	if time.Now().Unix() > expires {
+		return Tokens{}, ErrBadRefreshToken
+	}
+
+	if !revoked {
+		result, err := s.db.Exec(REVOKE_REFRESH_TOKEN, id)
+		if err != nil {
+			slog.Error("failed revoke refresh token", slog.Any("err", err))
+			return Tokens{}, ErrInternal
+		}
+
+		// Token can be used by concurrent request
+		affected, err := result.RowsAffected()
+		revoked = err == nil && affected == 0
+	}
+
+	if revoked {
+		slog.Warn("Reuse of refresh token, session is revoked", slog.String("user", name), slog.String("session", session_id))
+		if err := s.RevokeSession(session_id); err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, ErrBadRefreshToken
+	}
+
+	if err := s.touchSession(session_id, ip); err != nil {
+		return Tokens{}, err
+	}
+	return s.issueTokens(name, session_id)
+}
+
+// Add access token to denylist until his expiration
+func (s *AuthService) RevokeAccessToken(claims AccessClaims) error {
+	if claims.ID == "" {
+		return nil
+	}
+
+	if _, err := s.db.Exec(INSERT_REVOKED_TOKEN, claims.ID, claims.Expires.Unix()); err != nil {
+		slog.Error("failed insert revoked token to sql", slog.Any("err", err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// Revoke session of access token and token itself
+func (s *AuthService) Logout(claims AccessClaims) error {
+	if claims.Session != "" {
+		if err := s.RevokeSession(claims.Session); err != nil {
+			return err
+		}
+	}
+	return s.RevokeAccessToken(claims)
+}
+
+/*
+Check access token signature, expiration, denylist, session and password change time.
+Personal tokens are checked by database.
+*/
+func (s *AuthService) ParseAccessToken(token string) (AccessClaims, error) {
+	if strings.HasPrefix(token, PERSONAL_TOKEN_PREFIX) {
+		return s.parsePersonalToken(token)
+	}
+
+	parsed, err := s.ParseToJWT(token)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+
+	map_claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return AccessClaims{}, ErrInternal
+	}
+
+	claims := AccessClaims{}
+	if claims.Name, ok = map_claims["name"].(string); !ok || claims.Name == "" {
+		return AccessClaims{}, ErrWrongJWTName
+	}
+
+	claims.ID, _ = map_claims["jti"].(string)
+	claims.Session, _ = map_claims["sid"].(string)
+
+	// Tokens issued before roles have rights of user
+	claims.Role = ROLE_USER
+	if role, ok := map_claims["role"].(string); ok {
+		if claims.Role, err = ParseRole(role); err != nil {
+			return AccessClaims{}, ErrBadRole
+		}
+	}
+	if exp, err := map_claims.GetExpirationTime(); err == nil && exp != nil {
+		claims.Expires = exp.Time
+	}
+
+	// jwt library truncates times to seconds
+	if iat, ok := map_claims["iat"].(float64); ok {
+		claims.Issued = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+
+	// Sessions are ended on password change, tokens without session are checked by issue time
+	if claims.Session != "" {
+		err = s.checkSession(claims.Session)
+	} else {
+		err = s.checkTokenIssued(claims.Name, claims.Issued)
+	}
+
+	if err != nil {
+		return AccessClaims{}, err
+	}
+
+	if claims.ID == "" {
+		return claims, nil
+	}
+
+	var expires int64
+	row := s.db.QueryRow(SELECT_REVOKED_TOKEN, claims.ID)
+	switch err := row.Scan(&expires); {
+	case err == nil:
+		return AccessClaims{}, ErrTokenRevoked
+	case !errors.Is(err, sql.ErrNoRows):
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return AccessClaims{}, ErrInternal
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,508 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTP parameters (RFC 6238). They are supported by all authenticator apps.
+	TOTP_PERIOD      time.Duration = 30 * time.Second
+	TOTP_DIGITS      int           = 6
+	TOTP_SKEW        int64         = 1
+	TOTP_SECRET_SIZE int           = 20
+	TOTP_ISSUER      string        = "MHServer"
+
+	RECOVERY_CODES_COUNT int = 10
+	RECOVERY_CODE_LENGTH int = 10
+
+	// Time and count of attempts to enter code after password
+	LOGIN_CHALLENGE_LIFETIME     time.Duration = 5 * time.Minute
+	LOGIN_CHALLENGE_MAX_ATTEMPTS int           = 5
+
+	SELECT_USER_TOTP string = "SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE user = ?"
+	UPDATE_USER_TOTP string = "UPDATE users SET totp_secret = ? WHERE user = ? AND totp_enabled = FALSE"
+	ENABLE_USER_TOTP string = "UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE user = ? AND totp_enabled = FALSE"
+	RESET_USER_TOTP  string = "UPDATE users SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0 WHERE user = ?"
+
+	// Code is accepted only if its time step is after last used step, so one code can't be used twice
+	UPDATE_TOTP_LAST_STEP string = "UPDATE users SET totp_last_step = ? WHERE user = ? AND totp_last_step < ?"
+
+	// Recovery codes are saved in database only as sha256 hash
+	INSERT_RECOVERY_CODE string = "INSERT INTO recovery_codes (code_hash, user_id) SELECT ?, id FROM users WHERE user = ?"
+	COUNT_RECOVERY_CODES string = "SELECT COUNT(*) FROM recovery_codes JOIN users ON users.id = recovery_codes.user_id WHERE users.user = ?"
+	DELETE_RECOVERY_CODE string = "DELETE recovery_codes FROM recovery_codes JOIN users ON users.id = recovery_codes.user_id " +
+		"WHERE code_hash = ? AND users.user = ?"
+	DELETE_RECOVERY_CODES string = "DELETE recovery_codes FROM recovery_codes JOIN users ON users.id = recovery_codes.user_id WHERE users.user = ?"
+
+	// Challenge token is saved in database only as sha256 hash
+	INSERT_LOGIN_CHALLENGE string = "INSERT INTO login_challenges (token_hash, user_id, device, user_agent, ip, expires_at) " +
+		"SELECT ?, id, ?, ?, ?, ? FROM users WHERE user = ?"
+	SELECT_LOGIN_CHALLENGE string = "SELECT users.user, device, user_agent, ip, expires_at, attempts " +
+		"FROM login_challenges JOIN users ON users.id = login_challenges.user_id WHERE token_hash = ?"
+	UPDATE_LOGIN_CHALLENGE_ATTEMPTS string = "UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?"
+	DELETE_LOGIN_CHALLENGE          string = "DELETE FROM login_challenges WHERE token_hash = ?"
+	DELETE_USER_LOGIN_CHALLENGES    string = "DELETE login_challenges FROM login_challenges JOIN users ON users.id = login_challenges.user_id WHERE users.user = ?"
+	DELETE_EXPIRED_LOGIN_CHALLENGES string = "DELETE FROM login_challenges WHERE expires_at < ?"
+)
+
+var totp_encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+/*
+Returned by Login for user with two-factor authentication. Challenge token is exchanged
+with code from authenticator app or recovery code to tokens by LoginTOTP.
+errors.Is(err, ErrTOTPRequired) is true for this error.
+*/
+type TOTPRequiredError struct {
+	Challenge string
+
+	// Challenge lifetime in seconds
+	ExpiresIn int64
+}
+
+func (e *TOTPRequiredError) Error() string {
+	return ErrTOTPRequired.Error()
+}
+
+func (e *TOTPRequiredError) Is(target error) bool {
+	return target == ErrTOTPRequired
+}
+
+// Secret of enrolled two-factor authentication. Uri is shown to user as QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPStatus struct {
+	Enabled bool `json:"enabled"`
+
+	// Count of unused recovery codes
+	RecoveryCodes int `json:"recovery_codes"`
+}
+
+func totpCodeAt(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range TOTP_DIGITS {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTP_DIGITS, value%mod)
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTP_PERIOD.Seconds())
+}
+
+// Return TOTP code of base32 secret at time t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totp_encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCodeAt(key, totpStep(t)), nil
+}
+
+// Find time step of code near current time, which is after last used step. Return false, if code is wrong.
+func matchTOTP(secret, code string, last_step int64) (int64, bool) {
+	key, err := totp_encoding.DecodeString(secret)
+	if err != nil {
+		slog.Error("user has bad totp secret", slog.Any("err", err))
+		return 0, false
+	}
+
+	now := totpStep(time.Now())
+	for step := now - TOTP_SKEW; step <= now+TOTP_SKEW; step++ {
+		if step <= last_step {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(totpCodeAt(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != TOTP_DIGITS {
+		return false
+	}
+
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Recovery codes are shown in groups split by dash. Dashes, spaces and case are ignored on check.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func normalizeTOTPCode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
+
+/*
+Check code from authenticator app or recovery code of user. Used code can't be used again.
+Return false, if code is wrong.
+*/
+func (s *AuthService) useSecondFactor(name, secret string, last_step int64, code string) (bool, error) {
+	code = normalizeTOTPCode(code)
+
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(secret, code, last_step)
+		if !ok {
+			return false, nil
+		}
+
+		// Parallel request can use the same code, so step is saved only if it is still after last step
+		result, err := s.db.Exec(UPDATE_TOTP_LAST_STEP, step, name, step)
+		if err != nil {
+			slog.Error("failed update totp last step", slog.Any("err", err))
+			return false, ErrInternal
+		}
+
+		affected, err := result.RowsAffected()
+		return err == nil && affected == 1, nil
+	}
+
+	result, err := s.db.Exec(DELETE_RECOVERY_CODE, hashToken(normalizeRecoveryCode(code)), name)
+	if err != nil {
+		slog.Error("failed delete recovery code", slog.Any("err", err))
+		return false, ErrInternal
+	}
+
+	affected, err := result.RowsAffected()
+	return err == nil && affected == 1, nil
+}
+
+func (s *AuthService) userTOTP(name string) (secret string, enabled bool, last_step int64, err error) {
+	if err := s.db.QueryRow(SELECT_USER_TOTP, name).Scan(&secret, &enabled, &last_step); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, 0, ErrUserNotExist
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return "", false, 0, ErrInternal
+	}
+	return secret, enabled, last_step, nil
+}
+
+/*
+Generate new TOTP secret of user. Two-factor authentication is enabled only after ConfirmTOTP,
+so repeated enrollment replaces unconfirmed secret.
+*/
+func (s *AuthService) EnrollTOTP(name string) (TOTPEnrollment, error) {
+	_, enabled, _, err := s.userTOTP(name)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	if enabled {
+		return TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+	}
+
+	key := make([]byte, TOTP_SECRET_SIZE)
+	_, _ = rand.Read(key)
+	secret := totp_encoding.EncodeToString(key)
+
+	result, err := s.db.Exec(UPDATE_USER_TOTP, secret, name)
+	if err != nil {
+		slog.Error("failed update user totp secret", slog.Any("err", err))
+		return TOTPEnrollment{}, ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+	}
+
+	label := url.PathEscape(TOTP_ISSUER + ":" + name)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", TOTP_ISSUER)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTP_DIGITS))
+	params.Set("period", fmt.Sprint(int(TOTP_PERIOD.Seconds())))
+
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    "otpauth://totp/" + label + "?" + params.Encode(),
+	}, nil
+}
+
+// Enable two-factor authentication, if code of enrolled secret is right. Return one-time recovery codes.
+func (s *AuthService) ConfirmTOTP(name, code string) ([]string, error) {
+	secret, enabled, last_step, err := s.userTOTP(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	if secret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	step, ok := matchTOTP(secret, normalizeTOTPCode(code), last_step)
+	if !ok {
+		return nil, ErrWrongTOTPCode
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Error("failed begin sql transaction", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	result, err := tx.Exec(ENABLE_USER_TOTP, step, name)
+	if err != nil {
+		slog.Error("failed enable user totp", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	codes, err := generateRecoveryCodes(tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed commit sql transaction", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return codes, nil
+}
+
+// Replace recovery codes of user with new ones
+func generateRecoveryCodes(tx *sql.Tx, name string) ([]string, error) {
+	if _, err := tx.Exec(DELETE_RECOVERY_CODES, name); err != nil {
+		slog.Error("failed delete recovery codes", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	codes := make([]string, 0, RECOVERY_CODES_COUNT)
+	for range RECOVERY_CODES_COUNT {
+		code := rand.Text()[:RECOVERY_CODE_LENGTH]
+		if _, err := tx.Exec(INSERT_RECOVERY_CODE, hashToken(code), name); err != nil {
+			slog.Error("failed insert recovery code to sql", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+
+		half := RECOVERY_CODE_LENGTH / 2
+		codes = append(codes, code[:half]+"-"+code[half:])
+	}
+	return codes, nil
+}
+
+/*
+Disable two-factor authentication of user. Password and code from authenticator app or recovery code are required.
+Ip address is saved to audit log.
+*/
+func (s *AuthService) DisableTOTP(name, password, code, ip string) error {
+	source := LoginSource{Method: LOGIN_METHOD_DISABLE_TOTP, IP: ip}
+	enabled, err := s.checkPassword(NewUser(name, password), source)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return ErrTOTPNotEnabled
+	}
+
+	secret, _, last_step, err := s.userTOTP(name)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.useSecondFactor(name, secret, last_step, code)
+	if err != nil {
+		return err
+	} else if !ok {
+		s.recordLoginAttempt(name, source, ErrWrongTOTPCode)
+		return ErrWrongTOTPCode
+	}
+
+	s.recordLoginAttempt(name, source, nil)
+	s.resetLoginFailures(name)
+	return s.ResetTOTP(name)
+}
+
+// Disable two-factor authentication of user without checks. Used by server administrator, when user lost his device.
+func (s *AuthService) ResetTOTP(name string) error {
+	if _, _, _, err := s.userTOTP(name); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(RESET_USER_TOTP, name); err != nil {
+		slog.Error("failed reset user totp", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if _, err := s.db.Exec(DELETE_RECOVERY_CODES, name); err != nil {
+		slog.Error("failed delete recovery codes", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if _, err := s.db.Exec(DELETE_USER_LOGIN_CHALLENGES, name); err != nil {
+		slog.Error("failed delete login challenges", slog.Any("err", err))
+		return ErrInternal
+	}
+	return nil
+}
+
+func (s *AuthService) GetTOTPStatus(name string) (TOTPStatus, error) {
+	_, enabled, _, err := s.userTOTP(name)
+	if err != nil {
+		return TOTPStatus{}, err
+	}
+
+	status := TOTPStatus{Enabled: enabled}
+	if err := s.db.QueryRow(COUNT_RECOVERY_CODES, name).Scan(&status.RecoveryCodes); err != nil {
+		slog.Error("failed count recovery codes", slog.Any("err", err))
+		return TOTPStatus{}, ErrInternal
+	}
+	return status, nil
+}
+
+// Save device of login with right password until code is entered
+func (s *AuthService) createLoginChallenge(name string, device Device) (*TOTPRequiredError, error) {
+	challenge := rand.Text()
+
+	_, err := s.db.Exec(INSERT_LOGIN_CHALLENGE, hashToken(challenge),
+		truncate(device.Name, SESSION_DEVICE_MAX_LENGTH),
+		truncate(device.UserAgent, SESSION_USER_AGENT_MAX_LENGTH),
+		truncate(device.IP, SESSION_IP_MAX_LENGTH),
+		time.Now().Add(LOGIN_CHALLENGE_LIFETIME).Unix(), name)
+	if err != nil {
+		slog.Error("failed insert login challenge to sql", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+
+	return &TOTPRequiredError{
+		Challenge: challenge,
+		ExpiresIn: int64(LOGIN_CHALLENGE_LIFETIME.Seconds()),
+	}, nil
+}
+
+/*
+Second login step of user with two-factor authentication. Exchange challenge token from Login
+and code from authenticator app or recovery code to tokens of new session.
+Challenge is removed after success or too many wrong codes. Ip address is saved to audit log.
+*/
+func (s *AuthService) LoginTOTP(challenge, code, ip string) (Tokens, error) {
+	var name string
+	var device Device
+	var expires int64
+	var attempts int
+
+	challenge_hash := hashToken(challenge)
+	row := s.db.QueryRow(SELECT_LOGIN_CHALLENGE, challenge_hash)
+	if err := row.Scan(&name, &device.Name, &device.UserAgent, &device.IP, &expires, &attempts); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tokens{}, ErrBadLoginChallenge
+		}
+
+		slog.Error("failed scan sql rows", slog.Any("err", err))
+		return Tokens{}, ErrInternal
+	}
+
+	if expires < time.Now().Unix() || attempts >= LOGIN_CHALLENGE_MAX_ATTEMPTS {
+		_, _ = s.db.Exec(DELETE_LOGIN_CHALLENGE, challenge_hash)
+		return Tokens{}, ErrBadLoginChallenge
+	}
+
+	source := LoginSource{Method: LOGIN_METHOD_TOTP, IP: ip}
+	if err := s.CheckLockout(name); err != nil {
+		s.recordLoginAttempt(name, source, err)
+		return Tokens{}, err
+	}
+
+	// User can be disabled after password check
+	if _, err := s.UserRole(name); err != nil {
+		return Tokens{}, err
+	}
+
+	secret, enabled, last_step, err := s.userTOTP(name)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if !enabled {
+		_, _ = s.db.Exec(DELETE_LOGIN_CHALLENGE, challenge_hash)
+		return Tokens{}, ErrBadLoginChallenge
+	}
+
+	ok, err := s.useSecondFactor(name, secret, last_step, code)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if !ok {
+		query := UPDATE_LOGIN_CHALLENGE_ATTEMPTS
+		if attempts+1 >= LOGIN_CHALLENGE_MAX_ATTEMPTS {
+			query = DELETE_LOGIN_CHALLENGE
+		}
+
+		if _, err := s.db.Exec(query, challenge_hash); err != nil {
+			slog.Error("failed update login challenge", slog.Any("err", err))
+			return Tokens{}, ErrInternal
+		}
+
+		s.recordLoginAttempt(name, source, ErrWrongTOTPCode)
+		return Tokens{}, ErrWrongTOTPCode
+	}
+
+	// Challenge can be exchanged only once
+	result, err := s.db.Exec(DELETE_LOGIN_CHALLENGE, challenge_hash)
+	if err != nil {
+		slog.Error("failed delete login challenge", slog.Any("err", err))
+		return Tokens{}, ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return Tokens{}, ErrBadLoginChallenge
+	}
+
+	s.recordLoginAttempt(name, source, nil)
+	s.resetLoginFailures(name)
+
+	session_id, err := s.createSession(name, device)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.issueTokens(name, session_id)
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const (
+	SELECT_USERS string = "SELECT user, role, disabled, invited_by FROM users ORDER BY user"
+	DELETE_USER  string = "DELETE FROM users WHERE user = ?"
+)
+
+type UserInfo struct {
+	Name     string `json:"username"`
+	Role     Role   `json:"role"`
+	Disabled bool   `json:"disabled"`
+
+	// Name of user, whose invite was used for registration
+	InvitedBy string `json:"invited_by"`
+}
+
+// Create user with role without registration key. Used by server administrator.
+func (s *AuthService) AddUser(user User, role Role) error {
+	if user.Password == "" {
+		return ErrEmptyPassword
+	}
+
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+
+	if err := s.checkNewUser(user.Name); err != nil {
+		return err
+	}
+
+	if err := insertUser(s.db, user, role); err != nil {
+		return err
+	}
+	return s.createUserFolders(user.Name)
+}
+
+// Return all registered users
+func (s *AuthService) GetUsers() ([]UserInfo, error) {
+	rows, err := s.db.Query(SELECT_USERS)
+	if err != nil {
+		slog.Error("failed select users", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	users := make([]UserInfo, 0)
+	for rows.Next() {
+		var user UserInfo
+		if err := rows.Scan(&user.Name, &user.Role, &user.Disabled, &user.InvitedBy); err != nil {
+			slog.Error("failed scan sql rows", slog.Any("err", err))
+			return nil, ErrInternal
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("failed read sql rows", slog.Any("err", err))
+		return nil, ErrInternal
+	}
+	return users, nil
+}
+
+// Delete user, his public keys and unused invites. With remove_files user workspace folder is removed too.
+func (s *AuthService) DeleteUser(name string, remove_files bool) error {
+	result, err := s.db.Exec(DELETE_USER, name)
+	if err != nil {
+		slog.Error("failed delete user from sql", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrUserNotExist
+	}
+
+	if _, err := s.db.Exec(DELETE_USER_INVITES, name); err != nil {
+		slog.Error("failed delete user invites", slog.Any("err", err))
+		return ErrInternal
+	}
+
+	if !remove_files {
+		return nil
+	}
+
+	// Old registrations didn't check names, so folder must be direct child of workspace
+	if filepath.Base(name) != name || name == ".." {
+		return ErrBadUserFolder
+	}
+
+	if err := os.RemoveAll(s.cfg.WorkspacePath + name); err != nil {
+		slog.Error("failed remove user folders", slog.String("user", name), slog.Any("err", err))
+		return ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package sftp
+
+import "errors"
+
+var (
+	ErrBadPacket          = errors.New("bad packet")
+	ErrUnsupported        = errors.New("operation not supported")
+	ErrBadHandle          = errors.New("bad handle")
+	ErrTooManyHandles     = errors.New("too many open files")
+	ErrDirNotEmpty        = errors.New("directory not empty")
+	ErrNotDir             = errors.New("not a directory")
+	ErrIsDir              = errors.New("is a directory")
+	ErrCrossServiceRename = errors.New("file can't be moved to another service folder")
+	ErrBadHostKey         = errors.New("failed load sftp host key")
+)
@@ -0,0 +1,220 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SFTP version 3 (draft-ietf-secsh-filexfer-02), which is supported by all clients
+const (
+	SFTP_VERSION uint32 = 3
+
+	// Max size of incoming packet. Clients write files by 32 kb, so that's enough with reserve.
+	MAX_PACKET_SIZE uint32 = 256 * 1024
+
+	// Max size of data in one read response
+	MAX_READ_SIZE uint32 = 64 * 1024
+)
+
+// Packet types
+const (
+	FXP_INIT     byte = 1
+	FXP_VERSION  byte = 2
+	FXP_OPEN     byte = 3
+	FXP_CLOSE    byte = 4
+	FXP_READ     byte = 5
+	FXP_WRITE    byte = 6
+	FXP_LSTAT    byte = 7
+	FXP_FSTAT    byte = 8
+	FXP_SETSTAT  byte = 9
+	FXP_FSETSTAT byte = 10
+	FXP_OPENDIR  byte = 11
+	FXP_READDIR  byte = 12
+	FXP_REMOVE   byte = 13
+	FXP_MKDIR    byte = 14
+	FXP_RMDIR    byte = 15
+	FXP_REALPATH byte = 16
+	FXP_STAT     byte = 17
+	FXP_RENAME   byte = 18
+	FXP_READLINK byte = 19
+	FXP_SYMLINK  byte = 20
+
+	FXP_STATUS byte = 101
+	FXP_HANDLE byte = 102
+	FXP_DATA   byte = 103
+	FXP_NAME   byte = 104
+	FXP_ATTRS  byte = 105
+)
+
+// Status codes
+const (
+	FX_OK                uint32 = 0
+	FX_EOF               uint32 = 1
+	FX_NO_SUCH_FILE      uint32 = 2
+	FX_PERMISSION_DENIED uint32 = 3
+	FX_FAILURE           uint32 = 4
+	FX_BAD_MESSAGE       uint32 = 5
+	FX_OP_UNSUPPORTED    uint32 = 8
+)
+
+// Open flags
+const (
+	FXF_READ   uint32 = 0x01
+	FXF_WRITE  uint32 = 0x02
+	FXF_APPEND uint32 = 0x04
+	FXF_CREAT  uint32 = 0x08
+	FXF_TRUNC  uint32 = 0x10
+	FXF_EXCL   uint32 = 0x20
+)
+
+// Attributes flags
+const (
+	FILEXFER_ATTR_SIZE        uint32 = 0x01
+	FILEXFER_ATTR_UIDGID      uint32 = 0x02
+	FILEXFER_ATTR_PERMISSIONS uint32 = 0x04
+	FILEXFER_ATTR_ACMODTIME   uint32 = 0x08
+)
+
+// Reader of packet fields. After first error every read returns zero values, so error is checked once.
+type packetReader struct {
+	buf []byte
+	err error
+}
+
+func (r *packetReader) take(n int) []byte {
+	if r.err != nil || n < 0 || len(r.buf) < n {
+		r.err = ErrBadPacket
+		return nil
+	}
+
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *packetReader) byte() byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *packetReader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *packetReader) uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *packetReader) bytes() []byte {
+	return r.take(int(r.uint32()))
+}
+
+func (r *packetReader) string() string {
+	return string(r.bytes())
+}
+
+// Writer of packet fields. Packet length is written on finish.
+type packetWriter struct {
+	buf []byte
+}
+
+func newPacket(packet_type byte, id uint32) *packetWriter {
+	w := &packetWriter{buf: make([]byte, 4, 64)}
+	w.byte(packet_type)
+	w.uint32(id)
+	return w
+}
+
+func (w *packetWriter) byte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *packetWriter) uint32(v uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *packetWriter) uint64(v uint64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, v)
+}
+
+func (w *packetWriter) bytes(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *packetWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// Write file attributes. Owner is not sent, because all files belong to server user.
+func (w *packetWriter) attrs(info os.FileInfo) {
+	w.uint32(FILEXFER_ATTR_SIZE | FILEXFER_ATTR_PERMISSIONS | FILEXFER_ATTR_ACMODTIME)
+	w.uint64(uint64(info.Size()))
+	w.uint32(fileMode(info))
+
+	mod_time := uint32(info.ModTime().Unix())
+	w.uint32(mod_time)
+	w.uint32(mod_time)
+}
+
+func (w *packetWriter) finish() []byte {
+	binary.BigEndian.PutUint32(w.buf, uint32(len(w.buf)-4))
+	return w.buf
+}
+
+// Read one packet (type and body) from client
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size == 0 || size > MAX_PACKET_SIZE {
+		return 0, nil, ErrBadPacket
+	}
+
+	packet := make([]byte, size)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, nil, err
+	}
+	return packet[0], packet[1:], nil
+}
+
+// Unix file mode with type bits
+func fileMode(info os.FileInfo) uint32 {
+	mode := uint32(info.Mode().Perm())
+	switch {
+	case info.IsDir():
+		mode |= 0040000
+	case info.Mode().IsRegular():
+		mode |= 0100000
+	}
+	return mode
+}
+
+// Line like in "ls -l", which is shown by some clients
+func longName(info os.FileInfo) string {
+	mod_time := info.ModTime()
+	time_format := "Jan _2 15:04"
+	if time.Since(mod_time) > 180*24*time.Hour {
+		time_format = "Jan _2  2006"
+	}
+
+	return fmt.Sprintf("%s    1 mhserver mhserver %12d %s %s", info.Mode(), info.Size(), mod_time.Format(time_format), info.Name())
+}
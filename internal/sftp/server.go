@@ -0,0 +1,336 @@
+// Пакет с SFTP сервером для доступа к файлам пользователей.
+package sftp
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/repository/dirs"
+	"github.com/braginantonev/mhserver/internal/repository/filecrypt"
+	"github.com/braginantonev/mhserver/internal/repository/journal"
+	"github.com/braginantonev/mhserver/internal/repository/userfs"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	// Keys of ssh.Permissions extensions with authenticated username, his role and time of last password change
+	USERNAME_EXTENSION     string = "mhserver-user"
+	ROLE_EXTENSION         string = "mhserver-role"
+	TOKENS_AFTER_EXTENSION string = "mhserver-tokens-after"
+
+	MAX_AUTH_TRIES int = 5
+
+	// Connection is closed, when password or role of user is changed, or user is disabled or deleted
+	ACCOUNT_CHECK_INTERVAL time.Duration = 30 * time.Second
+)
+
+// Implemented by auth.AuthService
+type Authenticator interface {
+	CheckPassword(user auth.User, source auth.LoginSource) error
+	CheckPublicKey(username string, key ssh.PublicKey) error
+	UserAccess(name string) (auth.Role, int64, error)
+}
+
+type Server struct {
+	cfg           config.SFTPConfig
+	workspacePath string
+	services      []config.ServiceName
+	authenticator Authenticator
+
+	// Nil, if encryption is disabled
+	keyring *filecrypt.KeyRing
+
+	// Changes journals of services
+	journals map[config.ServiceName]*journal.Journal
+
+	sshConfig *ssh.ServerConfig
+}
+
+/*
+Create SFTP server. Host key is loaded from cfg.HostKey and generated, if file doesn't exist.
+Services are user folders, which are shown in root ("files", ...).
+*/
+func NewServer(cfg config.SFTPConfig, workspace_path string, services []config.ServiceName, authenticator Authenticator, enc_cfg config.EncryptionConfig) (*Server, error) {
+	s := &Server{
+		cfg:           cfg,
+		workspacePath: workspace_path,
+		services:      services,
+		authenticator: authenticator,
+		journals:      make(map[config.ServiceName]*journal.Journal, len(services)),
+	}
+
+	for _, service := range services {
+		s.journals[service] = journal.New(workspace_path, service)
+	}
+
+	if enc_cfg.Enabled {
+		master_key, err := filecrypt.ParseMasterKey(enc_cfg.MasterKey)
+		if err != nil {
+			return nil, err
+		}
+		s.keyring = filecrypt.NewKeyRing(workspace_path, master_key)
+	}
+
+	host_key, err := loadHostKey(cfg.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadHostKey, err)
+	}
+
+	s.sshConfig = &ssh.ServerConfig{
+		MaxAuthTries:      MAX_AUTH_TRIES,
+		PasswordCallback:  s.checkPassword,
+		PublicKeyCallback: s.checkPublicKey,
+	}
+	s.sshConfig.AddHostKey(host_key)
+
+	return s, nil
+}
+
+// Load ssh host key in OpenSSH format. New ed25519 key is generated, if file doesn't exist.
+func loadHostKey(path string) (ssh.Signer, error) {
+	pem_bytes, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(pem_bytes)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(private, "mhserver sftp host key")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Generated new SFTP host key", slog.String("path", path))
+	return ssh.NewSignerFromKey(private)
+}
+
+func (s *Server) checkPassword(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	source := auth.LoginSource{Method: auth.LOGIN_METHOD_SFTP, IP: meta.RemoteAddr().String()}
+	if addr, ok := meta.RemoteAddr().(*net.TCPAddr); ok {
+		source.IP = addr.IP.String()
+	}
+
+	if err := s.authenticator.CheckPassword(auth.NewUser(meta.User(), string(password)), source); err != nil {
+		slog.Info("SFTP wrong credentials", slog.String("user", meta.User()), slog.String("ip", meta.RemoteAddr().String()))
+		return nil, err
+	}
+	return s.permissions(meta.User())
+}
+
+func (s *Server) checkPublicKey(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if err := s.authenticator.CheckPublicKey(meta.User(), key); err != nil {
+		return nil, err
+	}
+	return s.permissions(meta.User())
+}
+
+// Permissions of authenticated user with his role
+func (s *Server) permissions(username string) (*ssh.Permissions, error) {
+	role, tokens_after, err := s.authenticator.UserAccess(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			USERNAME_EXTENSION:     username,
+			ROLE_EXTENSION:         string(role),
+			TOKENS_AFTER_EXTENSION: strconv.FormatInt(tokens_after, 10),
+		},
+	}, nil
+}
+
+// Close connection, when account of user is changed after login. Stop, when closed is closed.
+func (s *Server) watchAccount(ssh_conn *ssh.ServerConn, closed <-chan struct{}) {
+	username := ssh_conn.Permissions.Extensions[USERNAME_EXTENSION]
+	role := auth.Role(ssh_conn.Permissions.Extensions[ROLE_EXTENSION])
+	tokens_after, _ := strconv.ParseInt(ssh_conn.Permissions.Extensions[TOKENS_AFTER_EXTENSION], 10, 64)
+
+	ticker := time.NewTicker(ACCOUNT_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		current_role, current_tokens_after, err := s.authenticator.UserAccess(username)
+		if errors.Is(err, auth.ErrInternal) {
+			continue
+		}
+
+		if err != nil || current_role != role || current_tokens_after != tokens_after {
+			slog.Info("SFTP connection closed after account change", slog.String("user", username), slog.Any("err", err))
+			_ = ssh_conn.Close()
+			return
+		}
+	}
+}
+
+// Listen address from config and serve connections until ctx is done
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	addr := fmt.Sprintf("%s:%d", s.cfg.Address, s.cfg.Port)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Serve SFTP server", slog.String("address", addr))
+	return s.Serve(ctx, lis)
+}
+
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = lis.Close()
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go s.handleConn(ctx, conn)
+	}
+}
+
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	ssh_conn, channels, requests, err := ssh.NewServerConn(conn, s.sshConfig)
+	if err != nil {
+		slog.Debug("SFTP handshake failed", slog.String("ip", conn.RemoteAddr().String()), slog.Any("err", err))
+		return
+	}
+	defer func() {
+		_ = ssh_conn.Close()
+	}()
+
+	username := ssh_conn.Permissions.Extensions[USERNAME_EXTENSION]
+	role := auth.Role(ssh_conn.Permissions.Extensions[ROLE_EXTENSION])
+	slog.Info("SFTP connection", slog.String("user", username), slog.String("ip", conn.RemoteAddr().String()))
+
+	closed := make(chan struct{})
+	defer close(closed)
+	go s.watchAccount(ssh_conn, closed)
+
+	go ssh.DiscardRequests(requests)
+
+	for new_channel := range channels {
+		if new_channel.ChannelType() != "session" {
+			_ = new_channel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+
+		channel, channel_requests, err := new_channel.Accept()
+		if err != nil {
+			slog.Debug("failed accept SFTP channel", slog.Any("err", err))
+			continue
+		}
+
+		go s.handleChannel(ctx, username, role, channel, channel_requests)
+	}
+}
+
+// Wait "sftp" subsystem request. Shell and commands are rejected.
+func (s *Server) handleChannel(ctx context.Context, username string, role auth.Role, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() {
+		_ = channel.Close()
+	}()
+
+	for req := range requests {
+		// Payload of subsystem request is ssh string with subsystem name
+		is_sftp := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		if req.WantReply {
+			_ = req.Reply(is_sftp, nil)
+		}
+
+		if !is_sftp {
+			continue
+		}
+
+		go ssh.DiscardRequests(requests)
+
+		sess, err := s.newSession(ctx, username, role, channel)
+		if err != nil {
+			slog.Error("failed create SFTP session", slog.String("user", username), slog.Any("err", err))
+			return
+		}
+
+		if err := sess.serve(); err != nil {
+			slog.Debug("SFTP session closed with error", slog.String("user", username), slog.Any("err", err))
+		}
+		return
+	}
+}
+
+// Guests get read-only file systems
+func (s *Server) newSession(ctx context.Context, username string, role auth.Role, channel ssh.Channel) (*session, error) {
+	sess := &session{
+		ctx:       ctx,
+		rw:        channel,
+		username:  username,
+		workspace: s.workspacePath,
+		services:  make(map[string]webdav.FileSystem, len(s.services)),
+		handles:   make(map[string]*handle),
+	}
+
+	var aead cipher.AEAD
+	if s.keyring != nil {
+		var err error
+		if aead, err = s.keyring.UserCipher(username); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, service := range s.services {
+		root, err := dirs.GetDataPath(s.workspacePath, username, "/", service)
+		if err != nil {
+			return nil, err
+		}
+
+		// Service folders are created on registration, but services can be added later
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		fs := userfs.WithJournal(userfs.New(root, aead), s.journals[service], username)
+		if !role.Allows(auth.ROLE_USER) {
+			fs = userfs.ReadOnly(fs)
+		}
+		sess.services[string(service)] = fs
+	}
+
+	return sess, nil
+}
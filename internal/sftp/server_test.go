@@ -0,0 +1,356 @@
+package sftp_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/internal/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	TEST_WORKSPACE_PATH string = "/tmp/mhserver_tests/sftp/"
+	TEST_USERNAME       string = "kurisu"
+	TEST_PASSWORD       string = "christina"
+	TEST_FILE_BODY      string = "hello world!"
+	TEST_MASTER_KEY     string = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+type authenticator struct {
+	key ssh.PublicKey
+}
+
+func (a authenticator) CheckPassword(user auth.User, source auth.LoginSource) error {
+	if user.Name != TEST_USERNAME || user.Password != TEST_PASSWORD {
+		return auth.ErrWrongPassword
+	}
+	return nil
+}
+
+func (a authenticator) CheckPublicKey(username string, key ssh.PublicKey) error {
+	if username != TEST_USERNAME || !bytes.Equal(key.Marshal(), a.key.Marshal()) {
+		return auth.ErrPublicKeyNotFound
+	}
+	return nil
+}
+
+func (a authenticator) UserAccess(name string) (auth.Role, int64, error) {
+	return auth.ROLE_USER, 0, nil
+}
+
+// Minimal sftp client, which sends requests one by one
+type client struct {
+	t   *testing.T
+	in  io.Writer
+	out io.Reader
+	id  uint32
+}
+
+// Send request with fields (string, []byte, uint32 or uint64) and return response type and body after id
+func (c *client) request(packet_type byte, fields ...any) (byte, []byte) {
+	c.t.Helper()
+
+	c.id += 1
+	buf := []byte{packet_type}
+	buf = binary.BigEndian.AppendUint32(buf, c.id)
+	for _, field := range fields {
+		switch v := field.(type) {
+		case string:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+			buf = append(buf, v...)
+		case []byte:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+			buf = append(buf, v...)
+		case uint32:
+			buf = binary.BigEndian.AppendUint32(buf, v)
+		case uint64:
+			buf = binary.BigEndian.AppendUint64(buf, v)
+		}
+	}
+
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(buf)))
+	if _, err := c.in.Write(append(packet, buf...)); err != nil {
+		c.t.Fatal(err)
+	}
+
+	res_type, body := c.read()
+	if binary.BigEndian.Uint32(body) != c.id {
+		c.t.Fatalf("expected response id %d, but got %d", c.id, binary.BigEndian.Uint32(body))
+	}
+	return res_type, body[4:]
+}
+
+func (c *client) read() (byte, []byte) {
+	c.t.Helper()
+
+	var length [4]byte
+	if _, err := io.ReadFull(c.out, length[:]); err != nil {
+		c.t.Fatal(err)
+	}
+
+	packet := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(c.out, packet); err != nil {
+		c.t.Fatal(err)
+	}
+	return packet[0], packet[1:]
+}
+
+// Send request and check response status
+func (c *client) expectStatus(code uint32, packet_type byte, fields ...any) {
+	c.t.Helper()
+
+	res_type, body := c.request(packet_type, fields...)
+	if res_type != sftp.FXP_STATUS {
+		c.t.Fatalf("expected status response, but got %d", res_type)
+	}
+
+	if got := binary.BigEndian.Uint32(body); got != code {
+		c.t.Fatalf("expected status %d, but got %d", code, got)
+	}
+}
+
+// Send request and return handle from response
+func (c *client) expectHandle(packet_type byte, fields ...any) string {
+	c.t.Helper()
+
+	res_type, body := c.request(packet_type, fields...)
+	if res_type != sftp.FXP_HANDLE {
+		c.t.Fatalf("expected handle response, but got %d; body: %v", res_type, body)
+	}
+	return string(body[4:])
+}
+
+func newServer(t *testing.T, enc_cfg config.EncryptionConfig) (net.Addr, ssh.Signer) {
+	if err := os.RemoveAll(TEST_WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(TEST_WORKSPACE_PATH+TEST_USERNAME+"/files", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	_, user_key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(user_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := sftp.NewServer(config.SFTPConfig{
+		HostKey: TEST_WORKSPACE_PATH + "host_key",
+	}, TEST_WORKSPACE_PATH, []config.ServiceName{"files", "music"}, authenticator{key: signer.PublicKey()}, enc_cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = srv.Serve(t.Context(), lis)
+	}()
+
+	return lis.Addr(), signer
+}
+
+func connect(t *testing.T, addr net.Addr, auth_method ssh.AuthMethod) (*client, error) {
+	conn, err := ssh.Dial("tcp", addr.String(), &ssh.ClientConfig{
+		User:            TEST_USERNAME,
+		Auth:            []ssh.AuthMethod{auth_method},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	session, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &client{t: t, in: in, out: out}
+
+	// Init packet has version instead of id
+	if _, err := in.Write([]byte{0, 0, 0, 5, sftp.FXP_INIT, 0, 0, 0, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	res_type, body := c.read()
+	if res_type != sftp.FXP_VERSION || binary.BigEndian.Uint32(body) != sftp.SFTP_VERSION {
+		t.Fatalf("bad version response: %d %v", res_type, body)
+	}
+	return c, nil
+}
+
+func testSession(t *testing.T, enc_cfg config.EncryptionConfig) {
+	addr, signer := newServer(t, enc_cfg)
+
+	t.Run("wrong password", func(t *testing.T) {
+		if _, err := connect(t, addr, ssh.Password("okarin")); err == nil {
+			t.Fatal("expected auth error")
+		}
+	})
+
+	t.Run("public key", func(t *testing.T) {
+		if _, err := connect(t, addr, ssh.PublicKeys(signer)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	c, err := connect(t, addr, ssh.Password(TEST_PASSWORD))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("root contains only existing service folders", func(t *testing.T) {
+		handle := c.expectHandle(sftp.FXP_OPENDIR, "/")
+		res_type, body := c.request(sftp.FXP_READDIR, handle)
+		if res_type != sftp.FXP_NAME || binary.BigEndian.Uint32(body) != 1 {
+			t.Fatalf("expected one name, but got type %d; body: %v", res_type, body)
+		}
+
+		name_len := binary.BigEndian.Uint32(body[4:])
+		if string(body[8:8+name_len]) != "files" {
+			t.Fatalf("expected `files`, but got `%s`", body[8:8+name_len])
+		}
+
+		c.expectStatus(sftp.FX_EOF, sftp.FXP_READDIR, handle)
+		c.expectStatus(sftp.FX_OK, sftp.FXP_CLOSE, handle)
+	})
+
+	t.Run("mkdir", func(t *testing.T) {
+		c.expectStatus(sftp.FX_OK, sftp.FXP_MKDIR, "/files/lab", uint32(0))
+		c.expectStatus(sftp.FX_PERMISSION_DENIED, sftp.FXP_MKDIR, "/files/lab!", uint32(0))
+		c.expectStatus(sftp.FX_PERMISSION_DENIED, sftp.FXP_MKDIR, "/lab", uint32(0))
+		c.expectStatus(sftp.FX_PERMISSION_DENIED, sftp.FXP_MKDIR, "/files/../../lab", uint32(0))
+	})
+
+	t.Run("write file", func(t *testing.T) {
+		c.expectStatus(sftp.FX_PERMISSION_DENIED, sftp.FXP_OPEN, "/files/lab/gadget?.txt", sftp.FXF_WRITE|sftp.FXF_CREAT|sftp.FXF_TRUNC, uint32(0))
+
+		handle := c.expectHandle(sftp.FXP_OPEN, "/files/lab/gadget.txt", sftp.FXF_WRITE|sftp.FXF_CREAT|sftp.FXF_TRUNC, uint32(0))
+		c.expectStatus(sftp.FX_OK, sftp.FXP_WRITE, handle, uint64(0), []byte(TEST_FILE_BODY[:6]))
+		c.expectStatus(sftp.FX_OK, sftp.FXP_WRITE, handle, uint64(6), []byte(TEST_FILE_BODY[6:]))
+		c.expectStatus(sftp.FX_OK, sftp.FXP_CLOSE, handle)
+		c.expectStatus(sftp.FX_FAILURE, sftp.FXP_CLOSE, handle)
+	})
+
+	t.Run("stat file", func(t *testing.T) {
+		res_type, body := c.request(sftp.FXP_STAT, "/files/lab/gadget.txt")
+		if res_type != sftp.FXP_ATTRS {
+			t.Fatalf("expected attrs, but got %d", res_type)
+		}
+
+		if size := binary.BigEndian.Uint64(body[4:]); size != uint64(len(TEST_FILE_BODY)) {
+			t.Fatalf("expected size %d, but got %d", len(TEST_FILE_BODY), size)
+		}
+
+		c.expectStatus(sftp.FX_NO_SUCH_FILE, sftp.FXP_STAT, "/files/lab/phone.txt")
+	})
+
+	t.Run("read file", func(t *testing.T) {
+		handle := c.expectHandle(sftp.FXP_OPEN, "/files/lab/gadget.txt", sftp.FXF_READ, uint32(0))
+
+		res_type, body := c.request(sftp.FXP_READ, handle, uint64(6), uint32(100))
+		if res_type != sftp.FXP_DATA {
+			t.Fatalf("expected data, but got %d", res_type)
+		}
+
+		if string(body[4:]) != TEST_FILE_BODY[6:] {
+			t.Fatalf("expected `%s`, but got `%s`", TEST_FILE_BODY[6:], body[4:])
+		}
+
+		c.expectStatus(sftp.FX_EOF, sftp.FXP_READ, handle, uint64(len(TEST_FILE_BODY)), uint32(100))
+		c.expectStatus(sftp.FX_OK, sftp.FXP_CLOSE, handle)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		c.expectStatus(sftp.FX_PERMISSION_DENIED, sftp.FXP_RENAME, "/files/lab/gadget.txt", "/files/lab/gadget!.txt")
+		c.expectStatus(sftp.FX_PERMISSION_DENIED, sftp.FXP_RENAME, "/files", "/files2")
+		c.expectStatus(sftp.FX_OK, sftp.FXP_RENAME, "/files/lab/gadget.txt", "/files/lab/phone microwave.txt")
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		c.expectStatus(sftp.FX_FAILURE, sftp.FXP_RMDIR, "/files/lab")
+		c.expectStatus(sftp.FX_FAILURE, sftp.FXP_REMOVE, "/files/lab")
+		c.expectStatus(sftp.FX_OK, sftp.FXP_REMOVE, "/files/lab/phone microwave.txt")
+		c.expectStatus(sftp.FX_OK, sftp.FXP_RMDIR, "/files/lab")
+		c.expectStatus(sftp.FX_PERMISSION_DENIED, sftp.FXP_RMDIR, "/files")
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		c.expectStatus(sftp.FX_OP_UNSUPPORTED, sftp.FXP_SYMLINK, "/files/link", "/files")
+	})
+}
+
+func TestSession(t *testing.T) {
+	testSession(t, config.EncryptionConfig{})
+}
+
+func TestSessionWithEncryption(t *testing.T) {
+	enc_cfg := config.EncryptionConfig{
+		Enabled:   true,
+		MasterKey: TEST_MASTER_KEY,
+	}
+	testSession(t, enc_cfg)
+
+	addr, _ := newServer(t, enc_cfg)
+	c, err := connect(t, addr, ssh.Password(TEST_PASSWORD))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle := c.expectHandle(sftp.FXP_OPEN, "/files/secret.txt", sftp.FXF_WRITE|sftp.FXF_CREAT|sftp.FXF_TRUNC, uint32(0))
+	c.expectStatus(sftp.FX_FAILURE, sftp.FXP_WRITE, handle, uint64(6), []byte(TEST_FILE_BODY))
+	c.expectStatus(sftp.FX_OK, sftp.FXP_WRITE, handle, uint64(0), []byte(TEST_FILE_BODY))
+	c.expectStatus(sftp.FX_OK, sftp.FXP_CLOSE, handle)
+
+	on_disk, err := os.ReadFile(TEST_WORKSPACE_PATH + TEST_USERNAME + "/files/secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(on_disk, []byte(TEST_FILE_BODY)) {
+		t.Fatal("file saved without encryption")
+	}
+
+	// Listing shows plain size
+	handle = c.expectHandle(sftp.FXP_OPENDIR, "/files")
+	res_type, body := c.request(sftp.FXP_READDIR, handle)
+	if res_type != sftp.FXP_NAME {
+		t.Fatalf("expected name, but got %d", res_type)
+	}
+
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(TEST_FILE_BODY)))
+	if !bytes.Contains(body, size) {
+		t.Fatal("plain size not found in listing")
+	}
+}
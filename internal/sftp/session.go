@@ -0,0 +1,626 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	"github.com/braginantonev/mhserver/internal/repository/freemem"
+	"github.com/braginantonev/mhserver/internal/repository/userfs"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	// Max open files and directories in one session
+	MAX_HANDLES int = 256
+
+	// Max entries in one readdir response
+	READDIR_BATCH int = 128
+)
+
+// Errors, which messages are sent to client. Other errors are sent as "failure", so server paths don't leak.
+var publicErrors = []error{
+	ErrBadHandle, ErrTooManyHandles, ErrDirNotEmpty, ErrNotDir, ErrIsDir, ErrCrossServiceRename,
+	userfs.ErrBadName, userfs.ErrNotSequentialWrite, userfs.ErrWriteToReadOnlyFile, userfs.ErrReadFromWriteOnlyFile,
+	data.ErrNotEnoughDiskSpace,
+}
+
+type handle struct {
+	// Nil for virtual root directory
+	file webdav.File
+
+	// Entries of virtual root directory
+	entries []os.FileInfo
+	listed  bool
+}
+
+// Info of virtual root directory
+type rootInfo struct{}
+
+func (rootInfo) Name() string       { return "/" }
+func (rootInfo) Size() int64        { return 0 }
+func (rootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0500 }
+func (rootInfo) ModTime() time.Time { return time.Now() }
+func (rootInfo) IsDir() bool        { return true }
+func (rootInfo) Sys() any           { return nil }
+
+/*
+SFTP session of one user. User see service folders ("/files", ...) in root, and can't go out of them.
+Requests are processed one by one, so writes of one file are always sequential.
+*/
+type session struct {
+	ctx       context.Context
+	rw        io.ReadWriter
+	username  string
+	workspace string
+
+	// Service folder name -> file system
+	services map[string]webdav.FileSystem
+
+	handles     map[string]*handle
+	next_handle uint64
+}
+
+// Split virtual path to service folder and path inside them. Service is empty for root.
+func (s *session) resolve(p string) (webdav.FileSystem, string, string, error) {
+	clean := path.Clean("/" + p)
+	if clean == "/" {
+		return nil, "", "/", nil
+	}
+
+	service, rel, _ := strings.Cut(clean[1:], "/")
+	fs, ok := s.services[service]
+	if !ok {
+		return nil, "", "", os.ErrNotExist
+	}
+	return fs, service, "/" + rel, nil
+}
+
+// Resolve path, which will be changed. Root and service folders can't be changed.
+func (s *session) resolveWritable(p string) (webdav.FileSystem, string, string, error) {
+	fs, service, rel, err := s.resolve(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && path.Dir(path.Clean("/"+p)) == "/" {
+			return nil, "", "", os.ErrPermission
+		}
+		return nil, "", "", err
+	}
+
+	if fs == nil || rel == "/" {
+		return nil, "", "", os.ErrPermission
+	}
+	return fs, service, rel, nil
+}
+
+func (s *session) stat(p string) (os.FileInfo, error) {
+	fs, _, rel, err := s.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs == nil {
+		return rootInfo{}, nil
+	}
+	return fs.Stat(s.ctx, rel)
+}
+
+func (s *session) addHandle(h *handle) (string, error) {
+	if len(s.handles) >= MAX_HANDLES {
+		return "", ErrTooManyHandles
+	}
+
+	s.next_handle += 1
+	id := strconv.FormatUint(s.next_handle, 10)
+	s.handles[id] = h
+	return id, nil
+}
+
+func (s *session) closeAll() {
+	for _, h := range s.handles {
+		if h.file != nil {
+			_ = h.file.Close()
+		}
+	}
+	clear(s.handles)
+}
+
+func (s *session) send(packet *packetWriter) error {
+	_, err := s.rw.Write(packet.finish())
+	return err
+}
+
+func (s *session) sendStatus(id uint32, err error) error {
+	code, msg := FX_OK, "ok"
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		code, msg = FX_EOF, "end of file"
+	case errors.Is(err, os.ErrNotExist):
+		code, msg = FX_NO_SUCH_FILE, "no such file or directory"
+	case errors.Is(err, userfs.ErrBadName):
+		code, msg = FX_PERMISSION_DENIED, err.Error()
+	case errors.Is(err, os.ErrPermission):
+		code, msg = FX_PERMISSION_DENIED, "permission denied"
+	case errors.Is(err, os.ErrExist):
+		code, msg = FX_FAILURE, "file already exists"
+	case errors.Is(err, ErrBadPacket):
+		code, msg = FX_BAD_MESSAGE, err.Error()
+	case errors.Is(err, ErrUnsupported):
+		code, msg = FX_OP_UNSUPPORTED, err.Error()
+	default:
+		code, msg = FX_FAILURE, "failure"
+		for _, public := range publicErrors {
+			if errors.Is(err, public) {
+				msg = public.Error()
+				break
+			}
+		}
+
+		if msg == "failure" {
+			slog.Debug("SFTP request failed", slog.String("user", s.username), slog.Any("err", err))
+		}
+	}
+
+	packet := newPacket(FXP_STATUS, id)
+	packet.uint32(code)
+	packet.string(msg)
+	packet.string("")
+	return s.send(packet)
+}
+
+func (s *session) sendHandle(id uint32, h *handle) error {
+	handle_id, err := s.addHandle(h)
+	if err != nil {
+		if h.file != nil {
+			_ = h.file.Close()
+		}
+		return s.sendStatus(id, err)
+	}
+
+	packet := newPacket(FXP_HANDLE, id)
+	packet.string(handle_id)
+	return s.send(packet)
+}
+
+func (s *session) sendAttrs(id uint32, info os.FileInfo, err error) error {
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	packet := newPacket(FXP_ATTRS, id)
+	packet.attrs(info)
+	return s.send(packet)
+}
+
+// Serve session until client closes channel
+func (s *session) serve() error {
+	defer s.closeAll()
+
+	packet_type, body, err := readPacket(s.rw)
+	if err != nil {
+		return err
+	}
+
+	if packet_type != FXP_INIT {
+		return ErrBadPacket
+	}
+
+	version := newPacket(FXP_VERSION, SFTP_VERSION)
+	if err := s.send(version); err != nil {
+		return err
+	}
+
+	for {
+		packet_type, body, err = readPacket(s.rw)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if err := s.handle(packet_type, &packetReader{buf: body}); err != nil {
+			return err
+		}
+	}
+}
+
+// Handle one request. Returned error closes session.
+func (s *session) handle(packet_type byte, r *packetReader) error {
+	id := r.uint32()
+	if r.err != nil {
+		return r.err
+	}
+
+	switch packet_type {
+	case FXP_OPEN:
+		return s.open(id, r)
+	case FXP_CLOSE:
+		return s.close(id, r)
+	case FXP_READ:
+		return s.read(id, r)
+	case FXP_WRITE:
+		return s.write(id, r)
+	case FXP_LSTAT, FXP_STAT:
+		p := r.string()
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		info, err := s.stat(p)
+		return s.sendAttrs(id, info, err)
+	case FXP_FSTAT:
+		h, err := s.getHandle(r)
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		if h.file == nil {
+			return s.sendAttrs(id, rootInfo{}, nil)
+		}
+		info, err := h.file.Stat()
+		return s.sendAttrs(id, info, err)
+	case FXP_SETSTAT, FXP_FSETSTAT:
+		// Owner, permissions and times of files are managed by server
+		return s.sendStatus(id, nil)
+	case FXP_OPENDIR:
+		return s.openDir(id, r)
+	case FXP_READDIR:
+		return s.readDir(id, r)
+	case FXP_REMOVE:
+		return s.remove(id, r, false)
+	case FXP_RMDIR:
+		return s.remove(id, r, true)
+	case FXP_MKDIR:
+		return s.mkdir(id, r)
+	case FXP_REALPATH:
+		return s.realPath(id, r)
+	case FXP_RENAME:
+		return s.rename(id, r)
+	default:
+		// Links, extensions and unknown requests
+		return s.sendStatus(id, ErrUnsupported)
+	}
+}
+
+func (s *session) getHandle(r *packetReader) (*handle, error) {
+	handle_id := r.string()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	h, ok := s.handles[handle_id]
+	if !ok {
+		return nil, ErrBadHandle
+	}
+	return h, nil
+}
+
+func (s *session) open(id uint32, r *packetReader) error {
+	p := r.string()
+	pflags := r.uint32()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	var flag int
+	switch {
+	case pflags&FXF_READ != 0 && pflags&FXF_WRITE != 0:
+		flag = os.O_RDWR
+	case pflags&FXF_WRITE != 0:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDONLY
+	}
+
+	if pflags&FXF_APPEND != 0 {
+		flag |= os.O_APPEND
+	}
+
+	if pflags&FXF_CREAT != 0 {
+		flag |= os.O_CREATE
+	}
+
+	if pflags&FXF_TRUNC != 0 {
+		flag |= os.O_TRUNC
+	}
+
+	if pflags&FXF_EXCL != 0 {
+		flag |= os.O_EXCL
+	}
+
+	var fs webdav.FileSystem
+	var rel string
+	var err error
+	if flag == os.O_RDONLY {
+		fs, _, rel, err = s.resolve(p)
+	} else {
+		fs, _, rel, err = s.resolveWritable(p)
+	}
+
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	if fs == nil || rel == "/" {
+		return s.sendStatus(id, ErrIsDir)
+	}
+
+	file, err := fs.OpenFile(s.ctx, rel, flag, 0660)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		_ = file.Close()
+		if err == nil {
+			err = ErrIsDir
+		}
+		return s.sendStatus(id, err)
+	}
+
+	return s.sendHandle(id, &handle{file: file})
+}
+
+func (s *session) close(id uint32, r *packetReader) error {
+	handle_id := r.string()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	h, ok := s.handles[handle_id]
+	if !ok {
+		return s.sendStatus(id, ErrBadHandle)
+	}
+	delete(s.handles, handle_id)
+
+	if h.file == nil {
+		return s.sendStatus(id, nil)
+	}
+	return s.sendStatus(id, h.file.Close())
+}
+
+func (s *session) read(id uint32, r *packetReader) error {
+	h, err := s.getHandle(r)
+	offset := r.uint64()
+	length := min(r.uint32(), MAX_READ_SIZE)
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	if h.file == nil {
+		return s.sendStatus(id, ErrIsDir)
+	}
+
+	if _, err := h.file.Seek(int64(offset), io.SeekStart); err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	buf := make([]byte, length)
+	n, err := io.ReadFull(h.file, buf)
+	if n == 0 {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return s.sendStatus(id, err)
+	}
+
+	packet := newPacket(FXP_DATA, id)
+	packet.bytes(buf[:n])
+	return s.send(packet)
+}
+
+func (s *session) write(id uint32, r *packetReader) error {
+	h, err := s.getHandle(r)
+	offset := r.uint64()
+	body := r.bytes()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	if h.file == nil {
+		return s.sendStatus(id, ErrIsDir)
+	}
+
+	// Space of unfinished uploads and other writes is kept for them, as in data service
+	has_space, err := freemem.HasSpace(s.workspace, uint64(len(body)))
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	if !has_space {
+		return s.sendStatus(id, data.ErrNotEnoughDiskSpace)
+	}
+
+	if _, err := h.file.Seek(int64(offset), io.SeekStart); err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	_, err = h.file.Write(body)
+	return s.sendStatus(id, err)
+}
+
+func (s *session) openDir(id uint32, r *packetReader) error {
+	p := r.string()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	fs, _, rel, err := s.resolve(p)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	// Root contains only service folders
+	if fs == nil {
+		entries := make([]os.FileInfo, 0, len(s.services))
+		for _, service_fs := range s.services {
+			info, err := service_fs.Stat(s.ctx, "/")
+			if err != nil {
+				continue
+			}
+			entries = append(entries, info)
+		}
+		return s.sendHandle(id, &handle{entries: entries})
+	}
+
+	file, err := fs.OpenFile(s.ctx, rel, os.O_RDONLY, 0)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || !info.IsDir() {
+		_ = file.Close()
+		if err == nil {
+			err = ErrNotDir
+		}
+		return s.sendStatus(id, err)
+	}
+
+	return s.sendHandle(id, &handle{file: file})
+}
+
+func (s *session) readDir(id uint32, r *packetReader) error {
+	h, err := s.getHandle(r)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	var entries []os.FileInfo
+	if h.file == nil {
+		if h.listed {
+			return s.sendStatus(id, io.EOF)
+		}
+		entries, h.listed = h.entries, true
+	} else {
+		entries, err = h.file.Readdir(READDIR_BATCH)
+		if len(entries) == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return s.sendStatus(id, err)
+		}
+	}
+
+	packet := newPacket(FXP_NAME, id)
+	packet.uint32(uint32(len(entries)))
+	for _, info := range entries {
+		packet.string(info.Name())
+		packet.string(longName(info))
+		packet.attrs(info)
+	}
+	return s.send(packet)
+}
+
+func (s *session) remove(id uint32, r *packetReader, is_dir bool) error {
+	p := r.string()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	fs, _, rel, err := s.resolveWritable(p)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	info, err := fs.Stat(s.ctx, rel)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	if info.IsDir() != is_dir {
+		if is_dir {
+			return s.sendStatus(id, ErrNotDir)
+		}
+		return s.sendStatus(id, ErrIsDir)
+	}
+
+	// RemoveAll removes directory with files, but rmdir must remove only empty directory
+	if is_dir {
+		dir, err := fs.OpenFile(s.ctx, rel, os.O_RDONLY, 0)
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+
+		children, _ := dir.Readdir(1)
+		_ = dir.Close()
+		if len(children) != 0 {
+			return s.sendStatus(id, ErrDirNotEmpty)
+		}
+	}
+
+	return s.sendStatus(id, fs.RemoveAll(s.ctx, rel))
+}
+
+func (s *session) mkdir(id uint32, r *packetReader) error {
+	p := r.string()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	fs, _, rel, err := s.resolveWritable(p)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+	return s.sendStatus(id, fs.Mkdir(s.ctx, rel, 0700))
+}
+
+func (s *session) realPath(id uint32, r *packetReader) error {
+	p := r.string()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	clean := path.Clean("/" + p)
+	packet := newPacket(FXP_NAME, id)
+	packet.uint32(1)
+	packet.string(clean)
+	packet.string(clean)
+	packet.uint32(0)
+	return s.send(packet)
+}
+
+func (s *session) rename(id uint32, r *packetReader) error {
+	old_path := r.string()
+	new_path := r.string()
+	if r.err != nil {
+		return s.sendStatus(id, r.err)
+	}
+
+	fs, old_service, old_rel, err := s.resolveWritable(old_path)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	_, new_service, new_rel, err := s.resolveWritable(new_path)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	if old_service != new_service {
+		return s.sendStatus(id, ErrCrossServiceRename)
+	}
+
+	// SFTP v3 rename doesn't overwrite files
+	if _, err := fs.Stat(s.ctx, new_rel); err == nil {
+		return s.sendStatus(id, os.ErrExist)
+	}
+
+	return s.sendStatus(id, fs.Rename(s.ctx, old_rel, new_rel))
+}
@@ -0,0 +1,78 @@
+// Пакет для работы с терминалом: ввод паролей без эха.
+package terminal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var ErrPasswordsMismatch = errors.New("passwords don't match")
+
+// Shared reader, so lines buffered by previous read aren't lost
+var stdin = bufio.NewReader(os.Stdin)
+
+func IsTerminal(file *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(file.Fd()), unix.TCGETS)
+	return err == nil
+}
+
+// Read password from terminal without echo. If stdin isn't terminal, first line is read.
+func ReadPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	if state, err := unix.IoctlGetTermios(fd, unix.TCGETS); err == nil {
+		fmt.Fprint(os.Stderr, prompt)
+		defer fmt.Fprintln(os.Stderr)
+
+		no_echo := *state
+		no_echo.Lflag &^= unix.ECHO
+		if err := unix.IoctlSetTermios(fd, unix.TCSETS, &no_echo); err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = unix.IoctlSetTermios(fd, unix.TCSETS, state)
+		}()
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Read new password. Password is asked twice only in terminal.
+func ReadNewPassword(prompt string) (string, error) {
+	password, err := ReadPassword(prompt)
+	if err != nil || !IsTerminal(os.Stdin) {
+		return password, err
+	}
+
+	confirm, err := ReadPassword("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+
+	if confirm != password {
+		return "", ErrPasswordsMismatch
+	}
+	return password, nil
+}
+
+// Read line with echo. Prompt is shown only in terminal.
+func ReadLine(prompt string) (string, error) {
+	if IsTerminal(os.Stdin) {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
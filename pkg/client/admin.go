@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Endpoints of administration API. Available only to users with "admin" role.
+const (
+	ADMIN_USERS_ENDPOINT          string = "/api/v1/admin/users"
+	ADMIN_DISABLE_USER_ENDPOINT   string = "/api/v1/admin/users/disable"
+	ADMIN_ENABLE_USER_ENDPOINT    string = "/api/v1/admin/users/enable"
+	ADMIN_USER_ROLE_ENDPOINT      string = "/api/v1/admin/users/role"
+	ADMIN_STORAGE_ENDPOINT        string = "/api/v1/admin/storage"
+	ADMIN_REGISTER_KEYS_ENDPOINT  string = "/api/v1/admin/register-keys"
+	ADMIN_LOCKOUTS_ENDPOINT       string = "/api/v1/admin/lockouts"
+	ADMIN_LOGIN_ATTEMPTS_ENDPOINT string = "/api/v1/admin/login-attempts"
+)
+
+// Roles of users
+const (
+	ROLE_GUEST string = "guest"
+	ROLE_USER  string = "user"
+	ROLE_ADMIN string = "admin"
+)
+
+type UserInfo struct {
+	Name     string `json:"username"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+type UserStorage struct {
+	Name string `json:"username"`
+	Used int64  `json:"used"`
+}
+
+// Storage usage of server. Sizes are in bytes.
+type StorageUsage struct {
+	Available uint64        `json:"available"`
+	Used      int64         `json:"used"`
+	Users     []UserStorage `json:"users"`
+}
+
+// Registration key. Times are unix seconds, zero Expires means key never expires.
+type RegisterKey struct {
+	Key       string `json:"key"`
+	Created   int64  `json:"created"`
+	Expires   int64  `json:"expires"`
+	MaxUses   int    `json:"max_uses"`
+	Uses      int    `json:"uses"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	CreatedBy string `json:"created_by"`
+}
+
+// Failed logins of username. Times are unix seconds, zero LockedUntil means username isn't locked.
+type Lockout struct {
+	Username    string `json:"username"`
+	Failures    int    `json:"failures"`
+	LastFailure int64  `json:"last_failure"`
+	LockedUntil int64  `json:"locked_until"`
+
+	// Lockouts in a row, each next one is twice as long
+	Lockouts int `json:"lockouts"`
+}
+
+// Record of login audit log. Method is password, totp, webdav, sftp, change_password or disable_totp.
+type LoginAttempt struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+	Method   string `json:"method"`
+	Success  bool   `json:"success"`
+	Reason   string `json:"reason"`
+	Time     int64  `json:"time"`
+}
+
+// Options of generated registration keys. Zero fields use server defaults:
+// one key, which never expires, can be used once by any name and registers user with "user" role.
+type RegisterKeyOptions struct {
+	Count int `json:"count,omitempty"`
+
+	// Key lifetime in seconds
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+
+	MaxUses  int    `json:"max_uses,omitempty"`
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+func (c *Client) AdminUsers(ctx context.Context) ([]UserInfo, error) {
+	var users []UserInfo
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: ADMIN_USERS_ENDPOINT}, &users)
+	return users, err
+}
+
+// Create user without registration key. Empty role means "user".
+func (c *Client) AdminCreateUser(ctx context.Context, username, password, role string) (UserInfo, error) {
+	var created UserInfo
+
+	body, err := jsonBody(map[string]string{"username": username, "password": password, "role": role})
+	if err == nil {
+		err = c.call(ctx, request{method: http.MethodPost, endpoint: ADMIN_USERS_ENDPOINT, body: body, content_type: "application/json"}, &created)
+	}
+	return created, err
+}
+
+// Delete user. With remove_files user folder is removed too.
+func (c *Client) AdminDeleteUser(ctx context.Context, username string, remove_files bool) error {
+	return c.call(ctx, request{
+		method:   http.MethodDelete,
+		endpoint: ADMIN_USERS_ENDPOINT,
+		query:    url.Values{"username": {username}, "files": {strconv.FormatBool(remove_files)}},
+	}, nil)
+}
+
+// Disable or enable user. Disabled user can't log in and his sessions are ended.
+func (c *Client) AdminSetDisabled(ctx context.Context, username string, disabled bool) error {
+	endpoint := ADMIN_ENABLE_USER_ENDPOINT
+	if disabled {
+		endpoint = ADMIN_DISABLE_USER_ENDPOINT
+	}
+	return c.call(ctx, request{method: http.MethodPost, endpoint: endpoint, query: url.Values{"username": {username}}}, nil)
+}
+
+func (c *Client) AdminSetRole(ctx context.Context, username, role string) error {
+	return c.call(ctx, request{
+		method:   http.MethodPost,
+		endpoint: ADMIN_USER_ROLE_ENDPOINT,
+		query:    url.Values{"username": {username}, "role": {role}},
+	}, nil)
+}
+
+func (c *Client) AdminStorage(ctx context.Context) (StorageUsage, error) {
+	var usage StorageUsage
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: ADMIN_STORAGE_ENDPOINT}, &usage)
+	return usage, err
+}
+
+// Registration keys, which aren't expired and used up
+func (c *Client) AdminRegisterKeys(ctx context.Context) ([]RegisterKey, error) {
+	var keys []RegisterKey
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: ADMIN_REGISTER_KEYS_ENDPOINT}, &keys)
+	return keys, err
+}
+
+func (c *Client) AdminGenerateRegisterKeys(ctx context.Context, opts RegisterKeyOptions) ([]RegisterKey, error) {
+	var keys []RegisterKey
+
+	body, err := jsonBody(opts)
+	if err == nil {
+		err = c.call(ctx, request{method: http.MethodPost, endpoint: ADMIN_REGISTER_KEYS_ENDPOINT, body: body, content_type: "application/json"}, &keys)
+	}
+	return keys, err
+}
+
+func (c *Client) AdminRevokeRegisterKey(ctx context.Context, key string) error {
+	return c.call(ctx, request{method: http.MethodDelete, endpoint: ADMIN_REGISTER_KEYS_ENDPOINT, query: url.Values{"key": {key}}}, nil)
+}
+
+// Usernames with recent failed logins or active lockout
+func (c *Client) AdminLockouts(ctx context.Context) ([]Lockout, error) {
+	var lockouts []Lockout
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: ADMIN_LOCKOUTS_ENDPOINT}, &lockouts)
+	return lockouts, err
+}
+
+// Unlock username and forget its failed logins
+func (c *Client) AdminClearLockout(ctx context.Context, username string) error {
+	return c.call(ctx, request{method: http.MethodDelete, endpoint: ADMIN_LOCKOUTS_ENDPOINT, query: url.Values{"username": {username}}}, nil)
+}
+
+// Last login attempts, newest first. Empty username means all users, zero limit means server default.
+func (c *Client) AdminLoginAttempts(ctx context.Context, username string, limit int) ([]LoginAttempt, error) {
+	query := url.Values{}
+	if username != "" {
+		query.Set("username", username)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var attempts []LoginAttempt
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: ADMIN_LOGIN_ATTEMPTS_ENDPOINT, query: query}, &attempts)
+	return attempts, err
+}
@@ -0,0 +1,589 @@
+// Пакет с клиентом HTTP API MHServer: авторизация, файлы, чанковая загрузка и скачивание с проверкой sha256 сумм.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Requests limited by server (429, 503) are retried after Retry-After seconds
+	DEFAULT_MAX_RETRIES int           = 5
+	DEFAULT_RETRY_AFTER time.Duration = time.Second
+
+	// Count of chunks uploaded or downloaded at the same time
+	DEFAULT_WORKERS int = 4
+
+	// Token is refreshed before expiration, so long requests don't fail
+	TOKEN_REFRESH_BEFORE time.Duration = time.Minute
+)
+
+// Endpoints of server API
+const (
+	LOGIN_ENDPOINT        string = "/api/v1/users/login"
+	REGISTER_ENDPOINT     string = "/api/v1/users/register"
+	REFRESH_ENDPOINT      string = "/api/v1/users/refresh"
+	LOGOUT_ENDPOINT       string = "/api/v1/users/logout"
+	SESSIONS_ENDPOINT     string = "/api/v1/users/sessions"
+	PASSWORD_ENDPOINT     string = "/api/v1/users/password"
+	RESET_ENDPOINT        string = "/api/v1/users/password/reset"
+	PUBLIC_KEYS_ENDPOINT  string = "/api/v1/users/keys"
+	USER_INVITES_ENDPOINT string = "/api/v1/users/invites"
+	LOGIN_TOTP_ENDPOINT   string = "/api/v1/users/login/totp"
+	TOTP_ENDPOINT         string = "/api/v1/users/totp"
+	TOTP_CONFIRM_ENDPOINT string = "/api/v1/users/totp/confirm"
+	TOTP_DISABLE_ENDPOINT string = "/api/v1/users/totp/disable"
+	TOKENS_ENDPOINT       string = "/api/v1/users/tokens"
+
+	CONNECT_ENDPOINT     string = "/api/v1/files/connect"
+	SAVE_DATA_ENDPOINT   string = "/api/v1/files/save"
+	GET_DATA_ENDPOINT    string = "/api/v1/files/get"
+	GET_SUM_ENDPOINT     string = "/api/v1/files/sum"
+	FILES_ENDPOINT       string = "/api/v1/files"
+	SPACE_ENDPOINT       string = "/api/v1/files/space"
+	MKDIR_ENDPOINT       string = "/api/v1/files/mkdir"
+	RMDIR_ENDPOINT       string = "/api/v1/files/rmdir"
+	REMOVE_FILE_ENDPOINT string = "/api/v1/files/remove"
+	MOVE_ENDPOINT        string = "/api/v1/files/move"
+	SHARES_ENDPOINT      string = "/api/v1/files/shares"
+	ZIP_ENDPOINT         string = "/api/v1/files/zip"
+	EXTRACT_ENDPOINT     string = "/api/v1/files/extract"
+	DOWNLOAD_ENDPOINT    string = "/api/v1/files/download"
+	SIGNATURE_ENDPOINT   string = "/api/v1/files/signature"
+	DELTA_ENDPOINT       string = "/api/v1/files/delta"
+	CHANGES_ENDPOINT     string = "/api/v1/files/changes"
+	EVENTS_ENDPOINT      string = "/api/v1/files/events"
+
+	// Public download of shared file: "/api/v1/share/{token}"
+	SHARE_ENDPOINT string = "/api/v1/share"
+
+	// Public information about invite: "/api/v1/invites/{key}"
+	INVITES_ENDPOINT string = "/api/v1/invites"
+)
+
+type Config struct {
+	// Server address ("https://example.com:8443")
+	URL      string
+	Username string
+	Password string
+
+	// Tokens of existing session. Access token is used, while it is valid, then it's renewed
+	// with refresh token. Client logs in with password, if session can't be continued.
+	// Personal token can be used as access token without refresh token and password.
+	Token        string
+	RefreshToken string
+
+	// Name of device and program, which are shown in sessions list of user
+	Device    string
+	UserAgent string
+
+	// Don't verify server certificate (self-signed). Ignored, if HTTPClient is set.
+	Insecure   bool
+	HTTPClient *http.Client
+
+	Workers    int
+	MaxRetries int
+}
+
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	token   string
+	refresh string
+	expires time.Time
+	mux     *sync.Mutex
+
+	// Only one login at the same time, other requests wait for new token
+	login_mux *sync.Mutex
+}
+
+func New(cfg Config) *Client {
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+
+	if cfg.Workers <= 0 {
+		cfg.Workers = DEFAULT_WORKERS
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = DEFAULT_MAX_RETRIES
+	}
+
+	http_client := cfg.HTTPClient
+	if http_client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if cfg.Insecure {
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		http_client = &http.Client{Transport: transport}
+	}
+
+	c := &Client{
+		cfg:       cfg,
+		http:      http_client,
+		mux:       &sync.Mutex{},
+		login_mux: &sync.Mutex{},
+	}
+
+	if cfg.Token != "" {
+		c.setToken(cfg.Token)
+	}
+	c.refresh = cfg.RefreshToken
+	return c
+}
+
+// Expiration time from jwt payload. Signature isn't checked: token is checked by server.
+func tokenExpiration(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(claims.Exp), 0)
+}
+
+func (c *Client) setToken(token string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.token = token
+	c.expires = tokenExpiration(token)
+}
+
+// Forget token rejected by server. Token can be already refreshed by other request.
+func (c *Client) dropToken(token string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.token == token {
+		c.token = ""
+		c.expires = time.Time{}
+	}
+}
+
+func (c *Client) setTokens(tokens tokens) {
+	c.setToken(tokens.AccessToken)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.refresh = tokens.RefreshToken
+}
+
+/*
+Renew token, if it wasn't refreshed by other request yet. Refresh token is used first, then password.
+ErrUnauthorized is returned, if session can't be continued.
+*/
+func (c *Client) refreshToken(ctx context.Context) (string, error) {
+	c.login_mux.Lock()
+	defer c.login_mux.Unlock()
+
+	if token := c.Token(); token != "" {
+		return token, nil
+	}
+
+	if c.RefreshToken() != "" {
+		token, err := c.renew(ctx)
+		if err == nil || !errors.Is(err, ErrUnauthorized) {
+			return token, err
+		}
+
+		// Session is expired or revoked
+		c.mux.Lock()
+		c.refresh = ""
+		c.mux.Unlock()
+	}
+
+	if c.cfg.Password == "" {
+		return "", ErrUnauthorized
+	}
+	return c.Login(ctx)
+}
+
+// Session can be continued without user
+func (c *Client) canRefresh() bool {
+	return c.cfg.Password != "" || c.RefreshToken() != ""
+}
+
+// Current token. Empty token means, that client must log in.
+func (c *Client) Token() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if !c.expires.IsZero() && time.Until(c.expires) < TOKEN_REFRESH_BEFORE {
+		return ""
+	}
+	return c.token
+}
+
+// Refresh token of current session. Empty, if server doesn't support refresh tokens.
+func (c *Client) RefreshToken() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.refresh
+}
+
+// Request to server. Body is created again for each retry.
+type request struct {
+	method   string
+	endpoint string
+	query    url.Values
+	header   http.Header
+
+	body         func() (io.Reader, error)
+	content_type string
+
+	// Request without token (login, register)
+	public bool
+}
+
+func jsonBody(data any) (func() (io.Reader, error), error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (io.Reader, error) {
+		return bytes.NewReader(body), nil
+	}, nil
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return DEFAULT_RETRY_AFTER
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Read error from response and close body
+func responseError(req request, resp *http.Response) error {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// Error description is short, big body isn't an error from API
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	err := &Error{
+		Method:   req.method,
+		Endpoint: req.endpoint,
+		Status:   resp.StatusCode,
+		Message:  strings.TrimSpace(string(message)),
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err.RetryAfter = retryAfter(resp)
+	}
+	return err
+}
+
+func (c *Client) newRequest(ctx context.Context, req request, token string) (*http.Request, error) {
+	var body io.Reader
+	if req.body != nil {
+		var err error
+		if body, err = req.body(); err != nil {
+			return nil, err
+		}
+	}
+
+	target := c.cfg.URL + req.endpoint
+	if len(req.query) != 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	http_req, err := http.NewRequestWithContext(ctx, req.method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range req.header {
+		http_req.Header[key] = values
+	}
+
+	if c.cfg.UserAgent != "" {
+		http_req.Header.Set("User-Agent", c.cfg.UserAgent)
+	}
+
+	if req.content_type != "" {
+		http_req.Header.Set("Content-Type", req.content_type)
+	}
+
+	if !req.public {
+		http_req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return http_req, nil
+}
+
+/*
+Send request and return successful response, caller must close its body. Token is refreshed by login,
+if it's expired or rejected by server. Limited requests are retried after time from Retry-After header.
+*/
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var err error
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		token := ""
+		if !req.public {
+			if token = c.Token(); token == "" {
+				if token, err = c.refreshToken(ctx); err != nil {
+					return nil, err
+				}
+				refreshed = true
+			}
+		}
+
+		http_req, err := c.newRequest(ctx, req, token)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.http.Do(http_req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		switch {
+		// Token could be expired or revoked, so session is renewed
+		case resp.StatusCode == http.StatusUnauthorized && !req.public && !refreshed && c.canRefresh():
+			_ = resp.Body.Close()
+			c.dropToken(token)
+			continue
+
+		case (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) && attempt < c.cfg.MaxRetries:
+			delay := retryAfter(resp)
+
+			// Locked login isn't retried: user must check password, and lockout can be long
+			if err := responseError(req, resp); errors.Is(err, ErrLoginLocked) {
+				return nil, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		return nil, responseError(req, resp)
+	}
+}
+
+// Send request and decode json response to out (if not nil)
+func (c *Client) call(ctx context.Context, req request, out any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Send request and return response body
+func (c *Client) read(ctx context.Context, req request) ([]byte, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	return io.ReadAll(resp.Body)
+}
+
+type user struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Key      string `json:"key,omitempty"`
+	Device   string `json:"device,omitempty"`
+}
+
+// Tokens of session. Old servers return only access token as plain text.
+type tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Send login or refresh request and save received tokens
+func (c *Client) requestTokens(ctx context.Context, endpoint string, data any) (string, error) {
+	body, err := jsonBody(data)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.send(ctx, request{
+		method:       http.MethodPost,
+		endpoint:     endpoint,
+		header:       http.Header{"Accept": {"application/json"}},
+		body:         body,
+		content_type: "application/json",
+		public:       true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var received tokens
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		err = json.NewDecoder(resp.Body).Decode(&received)
+	} else {
+		var token []byte
+		token, err = io.ReadAll(resp.Body)
+		received.AccessToken = string(token)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	c.setTokens(received)
+	return received.AccessToken, nil
+}
+
+/*
+Log in with username and password from config. Tokens are saved in client, access token is returned.
+User with two-factor authentication gets *TOTPRequiredError, login is finished by LoginTOTP.
+*/
+func (c *Client) Login(ctx context.Context) (string, error) {
+	token, err := c.requestTokens(ctx, LOGIN_ENDPOINT, user{Username: c.cfg.Username, Password: c.cfg.Password, Device: c.cfg.Device})
+	if err != nil {
+		return "", totpChallenge(err)
+	}
+	return token, nil
+}
+
+// Exchange refresh token to new tokens
+func (c *Client) renew(ctx context.Context) (string, error) {
+	return c.requestTokens(ctx, REFRESH_ENDPOINT, map[string]string{"refresh_token": c.RefreshToken()})
+}
+
+// End session on server. Tokens are forgotten, even if request failed.
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.call(ctx, request{method: http.MethodPost, endpoint: LOGOUT_ENDPOINT}, nil)
+	c.setTokens(tokens{})
+	return err
+}
+
+// Register user with username and password from config. Registration key is given by server administrator.
+func (c *Client) Register(ctx context.Context, key string) error {
+	body, err := jsonBody(user{Username: c.cfg.Username, Password: c.cfg.Password, Key: key})
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, request{
+		method:       http.MethodPost,
+		endpoint:     REGISTER_ENDPOINT,
+		body:         body,
+		content_type: "application/json",
+		public:       true,
+	}, nil)
+}
+
+/*
+Change password of user. Server ends all sessions of user, so tokens are forgotten
+and client logs in again with new password.
+*/
+func (c *Client) ChangePassword(ctx context.Context, current_password, new_password string) error {
+	body, err := jsonBody(map[string]string{"current_password": current_password, "new_password": new_password})
+	if err != nil {
+		return err
+	}
+
+	if err := c.call(ctx, request{method: http.MethodPost, endpoint: PASSWORD_ENDPOINT, body: body, content_type: "application/json"}, nil); err != nil {
+		return err
+	}
+
+	c.login_mux.Lock()
+	c.cfg.Password = new_password
+	c.login_mux.Unlock()
+
+	c.setTokens(tokens{})
+	return nil
+}
+
+// Set new password with one-time token from server administrator. Username isn't needed.
+func (c *Client) ResetPassword(ctx context.Context, token, new_password string) error {
+	body, err := jsonBody(map[string]string{"token": token, "new_password": new_password})
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, request{
+		method:       http.MethodPost,
+		endpoint:     RESET_ENDPOINT,
+		body:         body,
+		content_type: "application/json",
+		public:       true,
+	}, nil)
+}
+
+// Public key for SFTP
+type PublicKey struct {
+	Key         string `json:"key"`
+	Comment     string `json:"comment"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (c *Client) PublicKeys(ctx context.Context) ([]PublicKey, error) {
+	var keys []PublicKey
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: PUBLIC_KEYS_ENDPOINT}, &keys)
+	return keys, err
+}
+
+// Add public key in authorized_keys format ("ssh-ed25519 AAAA... laptop")
+func (c *Client) AddPublicKey(ctx context.Context, key string) (PublicKey, error) {
+	var added PublicKey
+
+	body, err := jsonBody(map[string]string{"key": key})
+	if err == nil {
+		err = c.call(ctx, request{method: http.MethodPost, endpoint: PUBLIC_KEYS_ENDPOINT, body: body, content_type: "application/json"}, &added)
+	}
+	return added, err
+}
+
+func (c *Client) RemovePublicKey(ctx context.Context, fingerprint string) error {
+	return c.call(ctx, request{
+		method:   http.MethodDelete,
+		endpoint: PUBLIC_KEYS_ENDPOINT,
+		query:    url.Values{"fingerprint": {fingerprint}},
+	}, nil)
+}
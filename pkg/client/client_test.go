@@ -0,0 +1,650 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/braginantonev/mhserver/internal/config"
+	"github.com/braginantonev/mhserver/internal/grpc/data"
+	datahttp "github.com/braginantonev/mhserver/internal/http/data"
+	"github.com/braginantonev/mhserver/internal/server"
+	"github.com/braginantonev/mhserver/internal/service/auth"
+	"github.com/braginantonev/mhserver/pkg/client"
+	"github.com/braginantonev/mhserver/pkg/httpcontextkeys"
+	pb "github.com/braginantonev/mhserver/proto/data"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	WORKSPACE_PATH string = "/tmp/mhserver_tests/client/"
+	TEST_USER      string = "okabe"
+	TEST_PASSWORD  string = "el_psy_congroo"
+
+	// Login with this password is locked by server
+	LOCKED_PASSWORD string = "ibn5100"
+)
+
+// Server with real data handlers and simple auth: login returns new token, old tokens are rejected
+type testServer struct {
+	*httptest.Server
+
+	token  atomic.Value
+	logins atomic.Int32
+
+	// Refresh tokens are returned only with json_tokens
+	json_tokens atomic.Bool
+	refresh     atomic.Value
+	refreshes   atomic.Int32
+
+	// Count of requests, which are limited before success
+	limited atomic.Int32
+}
+
+func (s *testServer) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limited.Load() > 0 {
+			s.limited.Add(-1)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "to many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+s.token.Load().(string) {
+			http.Error(w, "authorization expired", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), httpcontextkeys.USERNAME, TEST_USER)
+		next(w, r.WithContext(context.WithValue(ctx, httpcontextkeys.ACCESS_CLAIMS, auth.AccessClaims{Name: TEST_USER, Role: auth.ROLE_USER})))
+	}
+}
+
+func (s *testServer) login(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if strings.Contains(string(body), LOCKED_PASSWORD) {
+		w.Header().Set("Retry-After", "900")
+		http.Error(w, "too many failed login attempts, try later", http.StatusTooManyRequests)
+		return
+	}
+
+	if !strings.Contains(string(body), TEST_PASSWORD) {
+		http.Error(w, "wrong password", http.StatusBadRequest)
+		return
+	}
+
+	s.writeTokens(w, r, s.logins.Add(1))
+}
+
+// Old servers return access token as plain text, new ones return tokens as json
+func (s *testServer) writeTokens(w http.ResponseWriter, r *http.Request, n int32) {
+	token := fmt.Sprintf("token-%d", n)
+	s.token.Store(token)
+
+	if !s.json_tokens.Load() || r.Header.Get("Accept") != "application/json" {
+		_, _ = w.Write([]byte(token))
+		return
+	}
+
+	refresh := fmt.Sprintf("refresh-%d", n)
+	s.refresh.Store(refresh)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": token, "refresh_token": refresh})
+}
+
+func (s *testServer) refreshTokens(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken != s.refresh.Load().(string) {
+		http.Error(w, "refresh token is invalid or expired", http.StatusUnauthorized)
+		return
+	}
+	s.writeTokens(w, r, 1000+s.refreshes.Add(1))
+}
+
+func (s *testServer) logout(w http.ResponseWriter, r *http.Request) {
+	s.token.Store("")
+	s.refresh.Store("")
+}
+
+func startServer(t *testing.T) *testServer {
+	if err := os.RemoveAll(WORKSPACE_PATH); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(WORKSPACE_PATH+TEST_USER+"/files", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	grpc_server := grpc.NewServer()
+	pb.RegisterDataServiceServer(grpc_server, data.NewDataServer(t.Context(), data.NewDataServerConfig(WORKSPACE_PATH, config.MemoryConfig{
+		MaxChunkSize: 64,                 //byte
+		MinChunkSize: 16,                 //byte
+		Allocated:    1024 * 1024 * 1024, //byte
+	})))
+
+	lis, err := net.Listen("tcp", "localhost:8093")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := grpc_server.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+	t.Cleanup(grpc_server.Stop)
+
+	grpc_connection, err := grpc.NewClient("localhost:8093", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := datahttp.NewHandler(pb.NewDataServiceClient(grpc_connection))
+	s := &testServer{}
+	s.token.Store("")
+	s.refresh.Store("")
+
+	r := mux.NewRouter()
+	r.HandleFunc(server.LOGIN_ENDPOINT, s.login).Methods(http.MethodPost)
+	r.HandleFunc(server.REFRESH_ENDPOINT, s.refreshTokens).Methods(http.MethodPost)
+	r.HandleFunc(server.LOGOUT_ENDPOINT, s.auth(s.logout)).Methods(http.MethodPost)
+	r.HandleFunc(server.CREATE_CONNECTION_ENDPOINT, s.auth(handler.CreateConnection)).Methods(http.MethodPost)
+	r.HandleFunc(server.SAVE_DATA_ENDPOINT, s.auth(handler.SaveData)).Methods(http.MethodPost)
+	r.HandleFunc(server.GET_DATA_ENDPOINT, s.auth(handler.GetData)).Methods(http.MethodGet)
+	r.HandleFunc(server.GET_DATA_SUM_ENDPOINT, s.auth(handler.GetSum)).Methods(http.MethodGet)
+	r.HandleFunc(server.GET_FILES_ENDPOINT, s.auth(handler.GetFiles)).Methods(http.MethodGet)
+	r.HandleFunc(server.CREATE_DIR_ENDPOINT, s.auth(handler.CreateDir)).Methods(http.MethodPost)
+	r.HandleFunc(server.REMOVE_DIR_ENDPOINT, s.auth(handler.RemoveDir)).Methods(http.MethodPost)
+	r.HandleFunc(server.REMOVE_FILE_ENDPOINT, s.auth(handler.RemoveFile)).Methods(http.MethodPost)
+	r.HandleFunc(server.DOWNLOAD_ENDPOINT, s.auth(handler.Download)).Methods(http.MethodGet)
+	r.HandleFunc(server.SIGNATURE_ENDPOINT, s.auth(handler.GetSignature)).Methods(http.MethodGet)
+	r.HandleFunc(server.DELTA_ENDPOINT, s.auth(handler.ApplyDelta)).Methods(http.MethodPost)
+	r.HandleFunc(server.CHANGES_ENDPOINT, s.auth(handler.GetChanges)).Methods(http.MethodGet)
+	r.HandleFunc(server.EVENTS_ENDPOINT, s.auth(handler.Events)).Methods(http.MethodGet)
+	r.HandleFunc(server.MOVE_ENDPOINT, s.auth(handler.Move)).Methods(http.MethodPost)
+	r.HandleFunc(server.SHARES_ENDPOINT, s.auth(handler.CreateShare)).Methods(http.MethodPost)
+	r.HandleFunc(server.SHARES_ENDPOINT, s.auth(handler.GetShares)).Methods(http.MethodGet)
+	r.HandleFunc(server.SHARES_ENDPOINT, s.auth(handler.RemoveShare)).Methods(http.MethodDelete)
+	r.HandleFunc(server.SHARE_ENDPOINT+"/{token}", handler.DownloadShare).Methods(http.MethodGet)
+
+	s.Server = httptest.NewTLSServer(r)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newClient(s *testServer, token string) *client.Client {
+	return client.New(client.Config{
+		URL:        s.URL,
+		Username:   TEST_USER,
+		Password:   TEST_PASSWORD,
+		Token:      token,
+		HTTPClient: s.Client(),
+	})
+}
+
+// Fake jwt with expiration time
+func fakeJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, `{"exp":%d}`, exp.Unix()))
+	return "header." + payload + ".signature"
+}
+
+// File in memory for downloads
+type memoryFile struct {
+	data []byte
+	mux  sync.Mutex
+}
+
+func (f *memoryFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if end := int(off) + len(p); end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestFiles(t *testing.T) {
+	s := startServer(t)
+	c := newClient(s, "")
+
+	body := []byte(strings.Repeat("Tuturu! Mayushii desu. ", 20))
+	const file_path string = "/lab/gadgets/phone_microwave.txt"
+
+	start, err := c.Changes(t.Context(), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"/lab/", "/lab/gadgets/"} {
+		if err := c.Mkdir(t.Context(), dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("upload", func(t *testing.T) {
+		var last uint64
+		conn, err := c.Upload(t.Context(), file_path, bytes.NewReader(body), int64(len(body)), func(done, total uint64) {
+			last = done
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if conn.Size != uint64(len(body)) || last != uint64(len(body)) {
+			t.Errorf("expected uploaded %d bytes, but got size %d, progress %d", len(body), conn.Size, last)
+		}
+
+		if _, err := c.Upload(t.Context(), "/empty.txt", bytes.NewReader(nil), 0, nil); !errors.Is(err, client.ErrEmptyFile) {
+			t.Errorf("expected %v, but got %v", client.ErrEmptyFile, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		files, err := c.List(t.Context(), "/lab/gadgets/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(files) != 1 || files[0].Name != "phone_microwave.txt" || files[0].Size != uint64(len(body)) {
+			t.Errorf("expected uploaded file, but got %v", files)
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		var file memoryFile
+		if _, err := c.DownloadTo(t.Context(), file_path, &file, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(file.data, body) {
+			t.Errorf("expected %q, but got %q", body, file.data)
+		}
+
+		stream, err := c.Download(t.Context(), file_path, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = stream.Close() }()
+
+		tail, err := io.ReadAll(stream)
+		if err != nil || !bytes.Equal(tail, body[100:]) {
+			t.Errorf("expected file tail, but got %q (%v)", tail, err)
+		}
+	})
+
+	t.Run("compare and delta", func(t *testing.T) {
+		changed := bytes.Clone(body)
+		copy(changed[200:], "El Psy Kongroo")
+
+		_, same, err := c.Compare(t.Context(), file_path, bytes.NewReader(changed), int64(len(changed)))
+		if err != nil || same {
+			t.Fatalf("expected different files, but got same: %t (%v)", same, err)
+		}
+
+		if _, err := c.UploadDelta(t.Context(), file_path, bytes.NewReader(changed), int64(len(changed))); err != nil {
+			t.Fatal(err)
+		}
+
+		_, same, err = c.Compare(t.Context(), file_path, bytes.NewReader(changed), int64(len(changed)))
+		if err != nil || !same {
+			t.Errorf("expected same files after delta, but got %t (%v)", same, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := c.Remove(t.Context(), "/lab/ibn5100.txt")
+		if !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("expected %v, but got %v", client.ErrNotFound, err)
+		}
+
+		var server_err *client.Error
+		if !errors.As(err, &server_err) || server_err.Message != data.ErrFileNotExist.Error() {
+			t.Errorf("expected server error %q, but got %v", data.ErrFileNotExist, err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := c.Remove(t.Context(), file_path); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.Rmdir(t.Context(), "/lab/"); err != nil {
+			t.Fatal(err)
+		}
+
+		changes, err := c.Changes(t.Context(), &start.Cursor, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ops := make([]string, 0, len(changes.Changes))
+		for _, change := range changes.Changes {
+			ops = append(ops, change.Op+" "+change.Path)
+		}
+
+		expected := "create /lab/, create /lab/gadgets/, create " + file_path + ", modify " + file_path + ", remove " + file_path + ", remove /lab/"
+		if strings.Join(ops, ", ") != expected {
+			t.Errorf("expected changes %s, but got %s", expected, strings.Join(ops, ", "))
+		}
+	})
+
+	if got := s.logins.Load(); got != 1 {
+		t.Errorf("expected one login, but got %d", got)
+	}
+}
+
+func TestResumeDownload(t *testing.T) {
+	s := startServer(t)
+	c := newClient(s, "")
+
+	body := []byte(strings.Repeat("Operation Skuld. ", 16))
+	if _, err := c.Upload(t.Context(), "/skuld.txt", bytes.NewReader(body), int64(len(body)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupted download: first half is downloaded, second half is damaged
+	part := memoryFile{data: bytes.Clone(body)}
+	copy(part.data[len(body)/2:], make([]byte, len(body)/2))
+
+	var done uint64
+	conn, err := c.ResumeDownload(t.Context(), "/skuld.txt", &part, func(d, total uint64) {
+		done = d
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(part.data, body) || done != conn.Size {
+		t.Errorf("expected resumed file %q with full progress, but got %q, progress %d", body, part.data, done)
+	}
+}
+
+func TestMoveAndShares(t *testing.T) {
+	s := startServer(t)
+	c := newClient(s, "")
+
+	body := []byte("Dear Okabe, this is the choice of Steins Gate")
+	for _, dir := range []string{"/mail/", "/archive/"} {
+		if err := c.Mkdir(t.Context(), dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file_path := range []string{"/mail/d_mail.txt", "/archive/d_mail.txt"} {
+		if _, err := c.Upload(t.Context(), file_path, bytes.NewReader(body), int64(len(body)), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	share, err := c.CreateShare(t.Context(), "/mail/d_mail.txt", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if share.Path != "/mail/d_mail.txt" || share.Expires-share.Created != 3600 {
+		t.Errorf("expected share for hour, but got %+v", share)
+	}
+
+	t.Run("move", func(t *testing.T) {
+		if err := c.Move(t.Context(), "/mail/d_mail.txt", "/archive/d_mail.txt", false); !errors.Is(err, client.ErrAlreadyExist) {
+			t.Errorf("expected %v, but got %v", client.ErrAlreadyExist, err)
+		}
+
+		if err := c.Move(t.Context(), "/mail/d_mail.txt", "/archive/d_mail.txt", true); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.Move(t.Context(), "/mail/", "/sent/", false); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := c.List(t.Context(), "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, 0, len(files))
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+
+		if strings.Join(names, ",") != "archive,sent" {
+			t.Errorf("expected directories archive and sent, but got %v", names)
+		}
+	})
+
+	t.Run("shares", func(t *testing.T) {
+		shares, err := c.Shares(t.Context())
+		if err != nil || len(shares) != 1 || shares[0].Path != "/archive/d_mail.txt" {
+			t.Fatalf("expected moved share, but got %+v (%v)", shares, err)
+		}
+
+		// Shared file is downloaded without authorization
+		resp, err := s.Client().Get(c.ShareURL(share))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		got, err := io.ReadAll(resp.Body)
+		if err != nil || !bytes.Equal(got, body) {
+			t.Errorf("expected shared file %q, but got %q (%v)", body, got, err)
+		}
+
+		if err := c.RemoveShare(t.Context(), share.Token); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.RemoveShare(t.Context(), share.Token); !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("expected %v for removed share, but got %v", client.ErrNotFound, err)
+		}
+	})
+}
+
+func TestRetries(t *testing.T) {
+	s := startServer(t)
+
+	t.Run("too many requests", func(t *testing.T) {
+		c := newClient(s, "")
+		s.limited.Store(1)
+
+		start := time.Now()
+		if _, err := c.List(t.Context(), "/"); err != nil {
+			t.Fatal(err)
+		}
+
+		if time.Since(start) < time.Second {
+			t.Errorf("expected retry after 1 second, but got %s", time.Since(start))
+		}
+	})
+
+	t.Run("rejected token", func(t *testing.T) {
+		c := newClient(s, "old-token")
+		logins := s.logins.Load()
+
+		if _, err := c.List(t.Context(), "/"); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.logins.Load() != logins+1 || c.Token() != s.token.Load().(string) {
+			t.Errorf("expected new token after login, but got %s", c.Token())
+		}
+	})
+
+	t.Run("expiring token", func(t *testing.T) {
+		c := newClient(s, fakeJWT(time.Now().Add(10*time.Second)))
+		if c.Token() != "" {
+			t.Errorf("expected refresh of expiring token, but got %s", c.Token())
+		}
+
+		valid := fakeJWT(time.Now().Add(time.Hour))
+		if c = newClient(s, valid); c.Token() != valid {
+			t.Errorf("expected valid token, but got %s", c.Token())
+		}
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		s.json_tokens.Store(true)
+		defer s.json_tokens.Store(false)
+
+		c := newClient(s, "")
+		if _, err := c.Login(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		if c.RefreshToken() != s.refresh.Load().(string) {
+			t.Fatalf("expected refresh token %s, but got %s", s.refresh.Load(), c.RefreshToken())
+		}
+
+		// Session is continued without password
+		c = client.New(client.Config{URL: s.URL, Token: "old-token", RefreshToken: c.RefreshToken(), HTTPClient: s.Client()})
+		logins := s.logins.Load()
+		if _, err := c.List(t.Context(), "/"); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.logins.Load() != logins || c.Token() != s.token.Load().(string) || c.RefreshToken() != s.refresh.Load().(string) {
+			t.Errorf("expected rotated tokens without login, but got %s, %s", c.Token(), c.RefreshToken())
+		}
+
+		if err := c.Logout(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := c.List(t.Context(), "/"); !errors.Is(err, client.ErrUnauthorized) {
+			t.Errorf("expected %v after logout, but got %v", client.ErrUnauthorized, err)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		c := client.New(client.Config{URL: s.URL, Username: TEST_USER, Password: "tuturu", HTTPClient: s.Client()})
+
+		var server_err *client.Error
+		if _, err := c.List(t.Context(), "/"); !errors.As(err, &server_err) || server_err.Status != http.StatusBadRequest {
+			t.Errorf("expected login error, but got %v", err)
+		}
+	})
+
+	t.Run("locked login", func(t *testing.T) {
+		c := client.New(client.Config{URL: s.URL, Username: TEST_USER, Password: LOCKED_PASSWORD, HTTPClient: s.Client()})
+
+		start := time.Now()
+		_, err := c.List(t.Context(), "/")
+		if !errors.Is(err, client.ErrLoginLocked) {
+			t.Fatalf("expected %v, but got %v", client.ErrLoginLocked, err)
+		}
+
+		var server_err *client.Error
+		if !errors.As(err, &server_err) || server_err.RetryAfter != 900*time.Second {
+			t.Errorf("expected retry after 15 minutes, but got %v", err)
+		}
+
+		if time.Since(start) >= time.Second {
+			t.Errorf("expected locked login without retries, but got %s", time.Since(start))
+		}
+	})
+}
+
+func TestEvents(t *testing.T) {
+	s := startServer(t)
+	c := newClient(s, "")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	var events []client.Event
+	err := c.Events(ctx, nil, func(event client.Event) error {
+		events = append(events, event)
+		if event.Type == client.EVENT_READY {
+			return c.Mkdir(ctx, "/future_gadgets/")
+		}
+		return io.EOF
+	})
+
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected end by handler, but got %v", err)
+	}
+
+	if len(events) != 2 || events[1].Type != client.EVENT_CHANGE || events[1].Change.Path != "/future_gadgets/" || events[1].Cursor <= events[0].Cursor {
+		t.Errorf("expected ready and change events, but got %+v", events)
+	}
+}
+
+func TestParseInviteURL(t *testing.T) {
+	cases := []struct {
+		link   string
+		server string
+		key    string
+		err    error
+	}{
+		{
+			link:   "https://example.com:8443/api/v1/invites/59addea5",
+			server: "https://example.com:8443",
+			key:    "59addea5",
+		},
+		{
+			link:   "https://example.com/mhserver/api/v1/invites/59addea5",
+			server: "https://example.com/mhserver",
+			key:    "59addea5",
+		},
+		{
+			link: "https://example.com/api/v1/share/59addea5",
+			err:  client.ErrBadInviteURL,
+		},
+		{
+			link: "https://example.com/api/v1/invites/",
+			err:  client.ErrBadInviteURL,
+		},
+		{
+			link: "59addea5",
+			err:  client.ErrBadInviteURL,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.link, func(t *testing.T) {
+			server, key, err := client.ParseInviteURL(test.link)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error: %v, but got: %v", test.err, err)
+			}
+
+			if server != test.server || key != test.key {
+				t.Errorf("expected %s and %s, but got %s and %s", test.server, test.key, server, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/braginantonev/mhserver/pkg/delta"
+)
+
+type BlockSum struct {
+	Weak   uint32 `json:"weak"`
+	Strong []byte `json:"strong"`
+}
+
+// Checksums of blocks of server file
+type Signature struct {
+	BlockSize uint32     `json:"blockSize"`
+	Size      uint64     `json:"size"`
+	ModTime   uint64     `json:"modTime"`
+	Blocks    []BlockSum `json:"blocks"`
+}
+
+type DeltaResult struct {
+	Size    uint64 `json:"size"`
+	Copied  uint64 `json:"copied"`
+	Literal uint64 `json:"literal"`
+}
+
+// Block checksums of server file. Zero block size means, that server chooses it.
+func (c *Client) Signature(ctx context.Context, file_path string, block_size uint32) (Signature, error) {
+	query := url.Values{"path": {file_path}}
+	if block_size != 0 {
+		query.Set("blockSize", strconv.FormatUint(uint64(block_size), 10))
+	}
+
+	var signature Signature
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: SIGNATURE_ENDPOINT, query: query}, &signature)
+	return signature, err
+}
+
+/*
+Upload only changed parts of file (rsync algorithm): server file is rebuilt from its blocks and new data.
+Delta is calculated from local data again on retry, so it isn't kept in memory.
+*/
+func (c *Client) UploadDelta(ctx context.Context, file_path string, r io.ReaderAt, size int64) (DeltaResult, error) {
+	var result DeltaResult
+
+	signature, err := c.Signature(ctx, file_path, 0)
+	if err != nil {
+		return result, err
+	}
+
+	blocks := make([]delta.Block, len(signature.Blocks))
+	for i, block := range signature.Blocks {
+		blocks[i].Weak = block.Weak
+		copy(blocks[i].Strong[:], block.Strong)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(r, 0, size)); err != nil {
+		return result, err
+	}
+
+	body := func() (io.Reader, error) {
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(delta.Diff(io.NewSectionReader(r, 0, size), int(signature.BlockSize), blocks, func(op delta.Op) error {
+				return delta.WriteOp(writer, op)
+			}))
+		}()
+		return reader, nil
+	}
+
+	err = c.call(ctx, request{
+		method:   http.MethodPost,
+		endpoint: DELTA_ENDPOINT,
+		query: url.Values{
+			"path":        {file_path},
+			"blockSize":   {strconv.FormatUint(uint64(signature.BlockSize), 10)},
+			"baseSize":    {strconv.FormatUint(signature.Size, 10)},
+			"baseModTime": {strconv.FormatUint(signature.ModTime, 10)},
+			"size":        {strconv.FormatInt(size, 10)},
+			"sum":         {hex.EncodeToString(hash.Sum(nil))},
+		},
+		body:         body,
+		content_type: "application/octet-stream",
+	}, &result)
+	return result, err
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrAlreadyExist    = errors.New("already exist")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrSumMismatch     = errors.New("chunk sum mismatch")
+	ErrEmptyFile       = errors.New("server doesn't save empty files")
+	ErrBadPath         = errors.New("path have bad syntax")
+	ErrBadEvent        = errors.New("bad server event")
+	ErrTOTPRequired    = errors.New("two-factor authentication code required")
+	ErrLoginLocked     = errors.New("too many failed login attempts, try later")
+)
+
+// Messages of server errors, which mean, that file or directory doesn't exist
+var notFoundMessages = map[string]bool{
+	"file not exist":             true,
+	"file not found":             true,
+	"directory not found":        true,
+	"share not found or expired": true,
+}
+
+// Messages of server errors, which mean, that file or directory already exists
+var existMessages = map[string]bool{
+	"file already exist":      true,
+	"directory already exist": true,
+}
+
+/*
+Error returned by server. Message is the text of response body, like in API documentation.
+Error can be checked with errors.Is: ErrNotFound, ErrAlreadyExist, ErrUnauthorized, ErrTooManyRequests, ErrLoginLocked.
+*/
+type Error struct {
+	Method   string
+	Endpoint string
+	Status   int
+	Message  string
+
+	// Only for ErrTooManyRequests and ErrLoginLocked
+	RetryAfter time.Duration
+}
+
+func (err *Error) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("%s %s: %d %s", err.Method, err.Endpoint, err.Status, http.StatusText(err.Status))
+	}
+	return fmt.Sprintf("%s %s: %d %s", err.Method, err.Endpoint, err.Status, err.Message)
+}
+
+func (err *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return err.Status == http.StatusNotFound || notFoundMessages[err.Message]
+	case ErrAlreadyExist:
+		return existMessages[err.Message]
+	case ErrUnauthorized:
+		return err.Status == http.StatusUnauthorized
+	case ErrTooManyRequests:
+		return err.Status == http.StatusTooManyRequests
+	case ErrLoginLocked:
+		return err.Status == http.StatusTooManyRequests && err.Message == ErrLoginLocked.Error()
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	EVENT_READY    string = "ready"
+	EVENT_CHANGE   string = "change"
+	EVENT_PROGRESS string = "progress"
+	EVENT_ERROR    string = "error"
+)
+
+type UploadProgress struct {
+	Path   string `json:"path"`
+	Loaded uint64 `json:"loaded"`
+	Size   uint64 `json:"size"`
+}
+
+// Server event. Only field of event type is set, cursor is set for "ready" and "change" events.
+// Unknown events have only type.
+type Event struct {
+	Type     string
+	Cursor   uint64
+	Change   *Change
+	Progress *UploadProgress
+}
+
+/*
+Listen to changes of user files and upload progress (server-sent events), until context is done
+or handler returns error. Without cursor only new changes are sent.
+*/
+func (c *Client) Events(ctx context.Context, since *uint64, handler func(Event) error) error {
+	query := url.Values{}
+	if since != nil {
+		query.Set("since", strconv.FormatUint(*since, 10))
+	}
+
+	resp, err := c.send(ctx, request{method: http.MethodGet, endpoint: EVENTS_ENDPOINT, query: query})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var event_type, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event_type = strings.TrimPrefix(line, "event: ")
+			continue
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+			continue
+		case line != "" || event_type == "":
+			// Ids, pings and incomplete events
+			continue
+		}
+
+		event, err := parseEvent(event_type, data)
+		if err != nil {
+			return err
+		}
+		event_type, data = "", ""
+
+		if err := handler(event); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+func parseEvent(event_type, data string) (Event, error) {
+	event := Event{Type: event_type}
+
+	var err error
+	switch event_type {
+	case EVENT_READY:
+		var ready struct {
+			Cursor uint64 `json:"cursor"`
+		}
+		err = json.Unmarshal([]byte(data), &ready)
+		event.Cursor = ready.Cursor
+
+	case EVENT_CHANGE:
+		event.Change = &Change{}
+		err = json.Unmarshal([]byte(data), event.Change)
+		event.Cursor = event.Change.Cursor
+
+	case EVENT_PROGRESS:
+		event.Progress = &UploadProgress{}
+		err = json.Unmarshal([]byte(data), event.Progress)
+
+	case EVENT_ERROR:
+		var stream_err struct {
+			Error string `json:"error"`
+		}
+		if err = json.Unmarshal([]byte(data), &stream_err); err == nil {
+			err = &Error{Method: http.MethodGet, Endpoint: EVENTS_ENDPOINT, Status: http.StatusOK, Message: stream_err.Error}
+		}
+		return event, err
+
+	// Events of newer server versions
+	default:
+		return event, nil
+	}
+
+	if err != nil {
+		return event, fmt.Errorf("%w: %w", ErrBadEvent, err)
+	}
+	return event, nil
+}
@@ -0,0 +1,262 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type ConnectionMode string
+
+const (
+	MODE_RDONLY ConnectionMode = "RDONLY"
+	MODE_RDWR   ConnectionMode = "RDWR"
+)
+
+// File connection. File is read or saved by chunks of ChunkSize bytes, last chunk can be shorter.
+type Connection struct {
+	UUID        string `json:"UUID"`
+	ChunkSize   uint64 `json:"chunkSize"`
+	ChunksCount uint32 `json:"chunksCount"`
+	Size        uint64 `json:"size"`
+	ModTime     uint64 `json:"modTime"`
+}
+
+type FileInfo struct {
+	Name    string `json:"name"`
+	IsDir   bool   `json:"isDir"`
+	Size    uint64 `json:"size"`
+	ModTime uint64 `json:"modTime"`
+}
+
+type ExtractRequest struct {
+	// Archive path ("/backups/photos.zip")
+	Path string `json:"-"`
+
+	// Directory to extract archive ("/photos/"). It is created, if not exist.
+	Target    string `json:"target"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+type ExtractProgress struct {
+	Current    string `json:"current"`
+	Files      uint32 `json:"files"`
+	FilesCount uint32 `json:"filesCount"`
+	Written    uint64 `json:"written"`
+	Size       uint64 `json:"size"`
+
+	// Only in last line, if extraction failed after start
+	Error string `json:"error"`
+}
+
+type Change struct {
+	Cursor  uint64 `json:"cursor"`
+	Time    int64  `json:"time"`
+	Op      string `json:"op"`
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath"`
+	IsDir   bool   `json:"isDir"`
+	Size    uint64 `json:"size"`
+}
+
+type ChangesList struct {
+	Changes []Change `json:"changes"`
+	Cursor  uint64   `json:"cursor"`
+	HasMore bool     `json:"hasMore"`
+}
+
+// Split "/dir/file.txt" to "/dir/" and "file.txt"
+func splitPath(file_path string) (string, string, error) {
+	i := strings.LastIndex(file_path, "/")
+	if i == -1 || i == len(file_path)-1 {
+		return "", "", fmt.Errorf("%w: %s", ErrBadPath, file_path)
+	}
+	return file_path[:i+1], file_path[i+1:], nil
+}
+
+// Open file connection. Size is needed only for RDWR mode.
+func (c *Client) Connect(ctx context.Context, mode ConnectionMode, file_path string, size uint64) (Connection, error) {
+	var conn Connection
+
+	dir, filename, err := splitPath(file_path)
+	if err != nil {
+		return conn, err
+	}
+
+	body, err := jsonBody(map[string]any{"directory": dir, "filename": filename, "size": size})
+	if err != nil {
+		return conn, err
+	}
+
+	err = c.call(ctx, request{
+		method:       http.MethodPost,
+		endpoint:     CONNECT_ENDPOINT,
+		query:        url.Values{"mode": {string(mode)}},
+		body:         body,
+		content_type: "application/json",
+	}, &conn)
+	return conn, err
+}
+
+// Save chunk of RDWR connection. File is saved, when all chunks are saved.
+func (c *Client) SaveChunk(ctx context.Context, conn Connection, chunk_id uint32, chunk []byte) error {
+	body, err := jsonBody(map[string]any{"chunk": chunk, "offset": conn.ChunkSize * uint64(chunk_id)})
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, request{
+		method:       http.MethodPost,
+		endpoint:     SAVE_DATA_ENDPOINT,
+		query:        url.Values{"connID": {conn.UUID}},
+		body:         body,
+		content_type: "application/json",
+	}, nil)
+}
+
+func chunkQuery(conn Connection, chunk_id uint32) url.Values {
+	return url.Values{
+		"connID":  {conn.UUID},
+		"chunkID": {strconv.FormatUint(uint64(chunk_id), 10)},
+	}
+}
+
+// Read chunk of RDONLY connection
+func (c *Client) GetChunk(ctx context.Context, conn Connection, chunk_id uint32) ([]byte, error) {
+	return c.read(ctx, request{method: http.MethodGet, endpoint: GET_DATA_ENDPOINT, query: chunkQuery(conn, chunk_id)})
+}
+
+// Sha256 sum of chunk of RDONLY connection
+func (c *Client) ChunkSum(ctx context.Context, conn Connection, chunk_id uint32) ([]byte, error) {
+	return c.read(ctx, request{method: http.MethodGet, endpoint: GET_SUM_ENDPOINT, query: chunkQuery(conn, chunk_id)})
+}
+
+// Files and directories in directory ("/photos/")
+func (c *Client) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	var files []FileInfo
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: FILES_ENDPOINT, query: url.Values{"dir": {dir}}}, &files)
+	return files, err
+}
+
+// Available disk space for user files in bytes
+func (c *Client) AvailableSpace(ctx context.Context) (uint64, error) {
+	body, err := c.read(ctx, request{method: http.MethodGet, endpoint: SPACE_ENDPOINT})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(body)), 10, 64)
+}
+
+func (c *Client) Mkdir(ctx context.Context, dir string) error {
+	return c.call(ctx, request{method: http.MethodPost, endpoint: MKDIR_ENDPOINT, query: url.Values{"dir": {dir}}}, nil)
+}
+
+// Remove directory with all files
+func (c *Client) Rmdir(ctx context.Context, dir string) error {
+	return c.call(ctx, request{method: http.MethodPost, endpoint: RMDIR_ENDPOINT, query: url.Values{"dir": {dir}}}, nil)
+}
+
+func (c *Client) Remove(ctx context.Context, file_path string) error {
+	return c.call(ctx, request{method: http.MethodPost, endpoint: REMOVE_FILE_ENDPOINT, query: url.Values{"path": {file_path}}}, nil)
+}
+
+// Move or rename file ("/docs/cv.pdf") or directory ("/docs/"). Existing file is replaced only with overwrite.
+func (c *Client) Move(ctx context.Context, from, to string, overwrite bool) error {
+	query := url.Values{"from": {from}, "to": {to}}
+	if overwrite {
+		query.Set("overwrite", "")
+	}
+	return c.call(ctx, request{method: http.MethodPost, endpoint: MOVE_ENDPOINT, query: query}, nil)
+}
+
+/*
+Download file as one stream from offset (Range request), so download can be resumed.
+Caller must close returned body. Chunks aren't verified, use DownloadTo for verified download.
+*/
+func (c *Client) Download(ctx context.Context, file_path string, offset int64) (io.ReadCloser, error) {
+	req := request{method: http.MethodGet, endpoint: DOWNLOAD_ENDPOINT, query: url.Values{"path": {file_path}}}
+	if offset > 0 {
+		req.header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}}
+	}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Download zip archive of files and directories ("/photos/"). Caller must close returned body.
+func (c *Client) DownloadZip(ctx context.Context, paths []string) (io.ReadCloser, error) {
+	body, err := jsonBody(map[string][]string{"paths": paths})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, request{method: http.MethodPost, endpoint: ZIP_ENDPOINT, body: body, content_type: "application/json"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Extract archive on server. Progress function (can be nil) is called after each extracted file.
+func (c *Client) Extract(ctx context.Context, req ExtractRequest, progress func(ExtractProgress)) error {
+	dir, filename, err := splitPath(req.Path)
+	if err != nil {
+		return err
+	}
+
+	body, err := jsonBody(map[string]any{"directory": dir, "filename": filename, "target": req.Target, "overwrite": req.Overwrite})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, request{method: http.MethodPost, endpoint: EXTRACT_ENDPOINT, body: body, content_type: "application/json"})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// Progress is streamed as json lines
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line ExtractProgress
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return err
+		}
+
+		if line.Error != "" {
+			return &Error{Method: http.MethodPost, Endpoint: EXTRACT_ENDPOINT, Status: http.StatusOK, Message: line.Error}
+		}
+
+		if progress != nil {
+			progress(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// Changes of user files after cursor. Without cursor only current cursor is returned. Zero limit means server default.
+func (c *Client) Changes(ctx context.Context, since *uint64, limit uint32) (ChangesList, error) {
+	query := url.Values{}
+	if since != nil {
+		query.Set("since", strconv.FormatUint(*since, 10))
+	}
+
+	if limit != 0 {
+		query.Set("limit", strconv.FormatUint(uint64(limit), 10))
+	}
+
+	var list ChangesList
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: CHANGES_ENDPOINT, query: query}, &list)
+	return list, err
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var (
+	ErrBadInviteURL = errors.New("bad invite link")
+)
+
+// Unused invite. Times are unix seconds.
+type Invite struct {
+	Key     string `json:"key"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+
+	// Only user with this name can be registered by invite. Empty means any name.
+	Username string `json:"username"`
+}
+
+type Invites struct {
+	// Count of unused invites and users registered by them, which user can have
+	Allowance int `json:"allowance"`
+
+	// Count of invites, which can be created now
+	Available int `json:"available"`
+
+	Unused []Invite `json:"unused"`
+
+	// Names of users registered by invites
+	Registered []string `json:"registered"`
+}
+
+// Information about invite, which is available without authorization
+type InviteInfo struct {
+	InvitedBy string `json:"invited_by"`
+	Expires   int64  `json:"expires"`
+	Username  string `json:"username"`
+}
+
+// Create one-time invite for new user. With username invite works only for this name.
+func (c *Client) CreateInvite(ctx context.Context, username string) (Invite, error) {
+	var invite Invite
+
+	body, err := jsonBody(map[string]string{"username": username})
+	if err == nil {
+		err = c.call(ctx, request{method: http.MethodPost, endpoint: USER_INVITES_ENDPOINT, body: body, content_type: "application/json"}, &invite)
+	}
+	return invite, err
+}
+
+// Unused invites of user and users registered by them
+func (c *Client) Invites(ctx context.Context) (Invites, error) {
+	var invites Invites
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: USER_INVITES_ENDPOINT}, &invites)
+	return invites, err
+}
+
+func (c *Client) RevokeInvite(ctx context.Context, key string) error {
+	return c.call(ctx, request{method: http.MethodDelete, endpoint: USER_INVITES_ENDPOINT, query: url.Values{"key": {key}}}, nil)
+}
+
+// Check invite before registration
+func (c *Client) CheckInvite(ctx context.Context, key string) (InviteInfo, error) {
+	var info InviteInfo
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: INVITES_ENDPOINT + "/" + url.PathEscape(key), public: true}, &info)
+	return info, err
+}
+
+// Link, which is given to new user
+func (c *Client) InviteURL(invite Invite) string {
+	return c.cfg.URL + INVITES_ENDPOINT + "/" + url.PathEscape(invite.Key)
+}
+
+// Split invite link into server address and invite key
+func ParseInviteURL(link string) (server, key string, err error) {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", "", ErrBadInviteURL
+	}
+
+	dir, key := path.Split(parsed.Path)
+	if key == "" || !strings.HasSuffix(dir, INVITES_ENDPOINT+"/") {
+		return "", "", ErrBadInviteURL
+	}
+
+	// Server can be behind reverse proxy with path prefix
+	parsed.Path = strings.TrimSuffix(dir, INVITES_ENDPOINT+"/")
+	parsed.RawQuery, parsed.Fragment = "", ""
+	return parsed.String(), key, nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Scopes of personal tokens
+const (
+	SCOPE_FILES_READ  string = "files:read"
+	SCOPE_FILES_WRITE string = "files:write"
+	SCOPE_ADMIN       string = "admin"
+)
+
+// Personal token for scripts and integrations. Times are unix seconds, zero expiration means token never expires.
+type PersonalToken struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Created  int64    `json:"created"`
+	Expires  int64    `json:"expires"`
+	LastUsed int64    `json:"last_used"`
+}
+
+/*
+Create personal token with scopes. Secret token is returned only once. Zero lifetime means token never expires.
+Token is used as Config.Token.
+*/
+func (c *Client) CreatePersonalToken(ctx context.Context, name string, scopes []string, lifetime time.Duration) (string, PersonalToken, error) {
+	var resp struct {
+		PersonalToken
+
+		Token string `json:"token"`
+	}
+
+	body, err := jsonBody(map[string]any{"name": name, "scopes": scopes, "expires_in": int64(lifetime.Seconds())})
+	if err == nil {
+		err = c.call(ctx, request{method: http.MethodPost, endpoint: TOKENS_ENDPOINT, body: body, content_type: "application/json"}, &resp)
+	}
+	return resp.Token, resp.PersonalToken, err
+}
+
+func (c *Client) PersonalTokens(ctx context.Context) ([]PersonalToken, error) {
+	var tokens []PersonalToken
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: TOKENS_ENDPOINT}, &tokens)
+	return tokens, err
+}
+
+func (c *Client) RevokePersonalToken(ctx context.Context, id int64) error {
+	return c.call(ctx, request{method: http.MethodDelete, endpoint: TOKENS_ENDPOINT, query: url.Values{"id": {strconv.FormatInt(id, 10)}}}, nil)
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Login session of user on device. Times are unix seconds.
+type Session struct {
+	ID        string `json:"id"`
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	Created   int64  `json:"created"`
+	LastUsed  int64  `json:"last_used"`
+
+	// Session of this client
+	Current bool `json:"current"`
+}
+
+// Active sessions of user, recently used first
+func (c *Client) Sessions(ctx context.Context) ([]Session, error) {
+	var sessions []Session
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: SESSIONS_ENDPOINT}, &sessions)
+	return sessions, err
+}
+
+// Sign out session on other device. Its tokens are rejected by server immediately.
+func (c *Client) RevokeSession(ctx context.Context, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, endpoint: SESSIONS_ENDPOINT, query: url.Values{"id": {id}}}, nil)
+}
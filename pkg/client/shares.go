@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Public link to file. Times are unix seconds.
+type Share struct {
+	Token   string `json:"token"`
+	Path    string `json:"path"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+}
+
+// Create public link to file. Zero lifetime means server default (7 days).
+func (c *Client) CreateShare(ctx context.Context, file_path string, lifetime time.Duration) (Share, error) {
+	query := url.Values{"path": {file_path}}
+	if lifetime > 0 {
+		query.Set("lifetime", strconv.FormatInt(int64(lifetime/time.Second), 10))
+	}
+
+	var share Share
+	err := c.call(ctx, request{method: http.MethodPost, endpoint: SHARES_ENDPOINT, query: query}, &share)
+	return share, err
+}
+
+// Active public links of user
+func (c *Client) Shares(ctx context.Context) ([]Share, error) {
+	var shares []Share
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: SHARES_ENDPOINT}, &shares)
+	return shares, err
+}
+
+func (c *Client) RemoveShare(ctx context.Context, token string) error {
+	return c.call(ctx, request{method: http.MethodDelete, endpoint: SHARES_ENDPOINT, query: url.Values{"token": {token}}}, nil)
+}
+
+// Link to download shared file without authorization
+func (c *Client) ShareURL(share Share) string {
+	return c.cfg.URL + SHARE_ENDPOINT + "/" + url.PathEscape(share.Token)
+}
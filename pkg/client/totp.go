@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+/*
+Returned by Login for user with two-factor authentication. Challenge token is exchanged
+with code from authenticator app or recovery code to tokens by LoginTOTP.
+errors.Is(err, ErrTOTPRequired) is true for this error.
+*/
+type TOTPRequiredError struct {
+	Challenge string `json:"challenge_token"`
+
+	// Challenge lifetime in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+func (err *TOTPRequiredError) Error() string {
+	return ErrTOTPRequired.Error()
+}
+
+func (err *TOTPRequiredError) Is(target error) bool {
+	return target == ErrTOTPRequired
+}
+
+// Secret of authenticator app. URI is shown as QR code or secret is entered manually.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPStatus struct {
+	Enabled bool `json:"enabled"`
+
+	// Count of unused recovery codes
+	RecoveryCodes int `json:"recovery_codes"`
+}
+
+// Server answers login of user with two-factor authentication by 401 with challenge token in body
+func totpChallenge(err error) error {
+	var server_err *Error
+	if !errors.As(err, &server_err) || server_err.Status != http.StatusUnauthorized {
+		return err
+	}
+
+	var challenge TOTPRequiredError
+	if json.Unmarshal([]byte(server_err.Message), &challenge) != nil || challenge.Challenge == "" {
+		return err
+	}
+	return &challenge
+}
+
+// Finish login with challenge token from Login and code from authenticator app or recovery code
+func (c *Client) LoginTOTP(ctx context.Context, challenge, code string) (string, error) {
+	return c.requestTokens(ctx, LOGIN_TOTP_ENDPOINT, map[string]string{"challenge_token": challenge, "code": code})
+}
+
+func (c *Client) TOTPStatus(ctx context.Context) (TOTPStatus, error) {
+	var status TOTPStatus
+	err := c.call(ctx, request{method: http.MethodGet, endpoint: TOTP_ENDPOINT}, &status)
+	return status, err
+}
+
+// Generate new secret of authenticator app. Two-factor authentication is enabled by ConfirmTOTP.
+func (c *Client) EnrollTOTP(ctx context.Context) (TOTPEnrollment, error) {
+	var enrollment TOTPEnrollment
+	err := c.call(ctx, request{method: http.MethodPost, endpoint: TOTP_ENDPOINT}, &enrollment)
+	return enrollment, err
+}
+
+// Enable two-factor authentication with code from authenticator app. Return one-time recovery codes.
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	var resp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	body, err := jsonBody(map[string]string{"code": code})
+	if err == nil {
+		err = c.call(ctx, request{method: http.MethodPost, endpoint: TOTP_CONFIRM_ENDPOINT, body: body, content_type: "application/json"}, &resp)
+	}
+	return resp.RecoveryCodes, err
+}
+
+// Disable two-factor authentication. Password and code from authenticator app or recovery code are required.
+func (c *Client) DisableTOTP(ctx context.Context, password, code string) error {
+	body, err := jsonBody(map[string]string{"password": password, "code": code})
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, request{method: http.MethodPost, endpoint: TOTP_DISABLE_ENDPOINT, body: body, content_type: "application/json"}, nil)
+}
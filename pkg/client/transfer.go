@@ -0,0 +1,208 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Transfer progress: done and total bytes. It is called from one goroutine at a time.
+type Progress func(done, total uint64)
+
+/*
+Run function for each chunk by workers. First error cancels other chunks and is returned.
+Progress (can be nil) is called with size returned by function.
+*/
+func (c *Client) forEachChunk(ctx context.Context, conn Connection, progress Progress, f func(ctx context.Context, chunk_id uint32) (int, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan uint32)
+	errs := make(chan error, c.cfg.Workers)
+
+	var done uint64
+	progress_mux := sync.Mutex{}
+
+	wg := sync.WaitGroup{}
+	for range c.cfg.Workers {
+		wg.Go(func() {
+			for chunk_id := range chunks {
+				n, err := f(ctx, chunk_id)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+
+				if progress != nil {
+					progress_mux.Lock()
+					done += uint64(n)
+					progress(done, conn.Size)
+					progress_mux.Unlock()
+				}
+			}
+		})
+	}
+
+send:
+	for chunk_id := range conn.ChunksCount {
+		select {
+		case chunks <- chunk_id:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(chunks)
+
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Read chunk of local file. Last chunk can be shorter.
+func readChunk(r io.ReaderAt, conn Connection, chunk_id uint32) ([]byte, error) {
+	chunk := make([]byte, conn.ChunkSize)
+	n, err := r.ReadAt(chunk, int64(conn.ChunkSize)*int64(chunk_id))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return chunk[:n], nil
+}
+
+// Check chunk with its sha256 sum from server
+func (c *Client) verifyChunk(ctx context.Context, conn Connection, chunk_id uint32, chunk []byte) error {
+	remote_sum, err := c.ChunkSum(ctx, conn, chunk_id)
+	if err != nil {
+		return err
+	}
+
+	if sum := sha256.Sum256(chunk); !bytes.Equal(sum[:], remote_sum) {
+		return ErrSumMismatch
+	}
+	return nil
+}
+
+/*
+Compare file on server with local data by sha256 sums of chunks. Local data isn't sent to server.
+Return connection of server file with its size and modification time.
+*/
+func (c *Client) Compare(ctx context.Context, file_path string, r io.ReaderAt, size int64) (Connection, bool, error) {
+	conn, err := c.Connect(ctx, MODE_RDONLY, file_path, 0)
+	if err != nil {
+		return conn, false, err
+	}
+
+	if conn.Size != uint64(size) {
+		return conn, false, nil
+	}
+
+	err = c.forEachChunk(ctx, conn, nil, func(ctx context.Context, chunk_id uint32) (int, error) {
+		chunk, err := readChunk(r, conn, chunk_id)
+		if err != nil {
+			return 0, err
+		}
+		return len(chunk), c.verifyChunk(ctx, conn, chunk_id, chunk)
+	})
+
+	if errors.Is(err, ErrSumMismatch) {
+		return conn, false, nil
+	}
+	return conn, err == nil, err
+}
+
+/*
+Upload local data to file on server by chunks in parallel. Existing file is replaced.
+After upload chunks are verified by sha256 sums from server. Return connection of saved file.
+*/
+func (c *Client) Upload(ctx context.Context, file_path string, r io.ReaderAt, size int64, progress Progress) (Connection, error) {
+	if size == 0 {
+		return Connection{}, ErrEmptyFile
+	}
+
+	conn, err := c.Connect(ctx, MODE_RDWR, file_path, uint64(size))
+	if err != nil {
+		return conn, err
+	}
+
+	err = c.forEachChunk(ctx, conn, progress, func(ctx context.Context, chunk_id uint32) (int, error) {
+		chunk, err := readChunk(r, conn, chunk_id)
+		if err != nil {
+			return 0, err
+		}
+		return len(chunk), c.SaveChunk(ctx, conn, chunk_id, chunk)
+	})
+	if err != nil {
+		return conn, err
+	}
+
+	saved, same, err := c.Compare(ctx, file_path, r, size)
+	if err == nil && !same {
+		err = ErrSumMismatch
+	}
+	return saved, err
+}
+
+// Local file of resumed download. Downloaded chunks are read to check them.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Download file from server by chunks in parallel. Each chunk is verified by sha256 sum from server.
+func (c *Client) DownloadTo(ctx context.Context, file_path string, w io.WriterAt, progress Progress) (Connection, error) {
+	return c.download(ctx, file_path, w, nil, progress)
+}
+
+/*
+Continue interrupted download: chunks of local file with the same sha256 sums as on server aren't downloaded again.
+Progress includes skipped chunks. Caller truncates local file to returned size, if it was longer.
+*/
+func (c *Client) ResumeDownload(ctx context.Context, file_path string, f ReadWriterAt, progress Progress) (Connection, error) {
+	return c.download(ctx, file_path, f, f, progress)
+}
+
+// Download chunks in parallel. If local file is not nil, chunks are downloaded only if they differ.
+func (c *Client) download(ctx context.Context, file_path string, w io.WriterAt, local io.ReaderAt, progress Progress) (Connection, error) {
+	conn, err := c.Connect(ctx, MODE_RDONLY, file_path, 0)
+	if err != nil {
+		return conn, err
+	}
+
+	err = c.forEachChunk(ctx, conn, progress, func(ctx context.Context, chunk_id uint32) (int, error) {
+		remote_sum, err := c.ChunkSum(ctx, conn, chunk_id)
+		if err != nil {
+			return 0, err
+		}
+
+		if local != nil {
+			chunk, err := readChunk(local, conn, chunk_id)
+			if err != nil {
+				return 0, err
+			}
+
+			if sum := sha256.Sum256(chunk); bytes.Equal(sum[:], remote_sum) {
+				return len(chunk), nil
+			}
+		}
+
+		chunk, err := c.GetChunk(ctx, conn, chunk_id)
+		if err != nil {
+			return 0, err
+		}
+
+		if sum := sha256.Sum256(chunk); !bytes.Equal(sum[:], remote_sum) {
+			return 0, ErrSumMismatch
+		}
+
+		_, err = w.WriteAt(chunk, int64(conn.ChunkSize)*int64(chunk_id))
+		return len(chunk), err
+	})
+	return conn, err
+}
@@ -0,0 +1,338 @@
+// Пакет для дельта-синхронизации файлов (по алгоритму rsync): подписи блоков, вычисление и формат дельты.
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	OP_BLOCKS  byte = 1
+	OP_LITERAL byte = 2
+
+	// Max literal data in one operation
+	MAX_LITERAL_SIZE int = 1024 * 1024
+)
+
+var (
+	ErrBadOp          = errors.New("bad delta operation")
+	ErrBadBlockSize   = errors.New("bad block size")
+	ErrLiteralTooLong = errors.New("delta literal is too long")
+)
+
+// Checksums of one block of base file
+type Block struct {
+	Weak   uint32
+	Strong [sha256.Size]byte
+}
+
+/*
+Delta operation. Copy BlockCount blocks of base file starting from BlockIndex, or write Literal data.
+Literal is used, if it's not empty.
+*/
+type Op struct {
+	BlockIndex uint32
+	BlockCount uint32
+	Literal    []byte
+}
+
+// Rolling checksum of rsync (two 16-bit sums), which can be moved by one byte
+type Rolling struct {
+	a, b   uint32
+	length uint32
+}
+
+func NewRolling(block []byte) Rolling {
+	var r Rolling
+	for i, c := range block {
+		r.a += uint32(c)
+		r.b += uint32(len(block)-i) * uint32(c)
+	}
+	r.length = uint32(len(block))
+	return r
+}
+
+// Move window by one byte: remove first byte "out" and add "in" at the end
+func (r *Rolling) Roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.length*uint32(out)
+}
+
+// Remove first byte without adding new one (window at the end of file)
+func (r *Rolling) Shrink(out byte) {
+	r.a -= uint32(out)
+	r.b -= r.length * uint32(out)
+	r.length -= 1
+}
+
+func (r Rolling) Sum() uint32 {
+	return (r.a & 0xffff) | (r.b << 16)
+}
+
+func WeakSum(block []byte) uint32 {
+	r := NewRolling(block)
+	return r.Sum()
+}
+
+// Calculate checksums of every block of base file. Last block can be smaller than block size.
+func BlockSums(r io.Reader, block_size int, fn func(Block) error) error {
+	if block_size <= 0 {
+		return ErrBadBlockSize
+	}
+
+	buf := make([]byte, block_size)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := fn(Block{Weak: WeakSum(buf[:n]), Strong: sha256.Sum256(buf[:n])}); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Generator of delta operations. Consecutive blocks are merged into one operation.
+type opWriter struct {
+	fn      func(Op) error
+	blocks  Op
+	literal []byte
+}
+
+func (w *opWriter) flushBlocks() error {
+	if w.blocks.BlockCount == 0 {
+		return nil
+	}
+
+	err := w.fn(w.blocks)
+	w.blocks = Op{}
+	return err
+}
+
+func (w *opWriter) flushLiteral() error {
+	if len(w.literal) == 0 {
+		return nil
+	}
+
+	err := w.fn(Op{Literal: w.literal})
+	w.literal = make([]byte, 0, cap(w.literal))
+	return err
+}
+
+func (w *opWriter) block(index uint32) error {
+	if err := w.flushLiteral(); err != nil {
+		return err
+	}
+
+	if w.blocks.BlockCount != 0 && w.blocks.BlockIndex+w.blocks.BlockCount == index {
+		w.blocks.BlockCount += 1
+		return nil
+	}
+
+	if err := w.flushBlocks(); err != nil {
+		return err
+	}
+
+	w.blocks = Op{BlockIndex: index, BlockCount: 1}
+	return nil
+}
+
+func (w *opWriter) byte(c byte) error {
+	if err := w.flushBlocks(); err != nil {
+		return err
+	}
+
+	w.literal = append(w.literal, c)
+	if len(w.literal) >= MAX_LITERAL_SIZE {
+		return w.flushLiteral()
+	}
+	return nil
+}
+
+/*
+Calculate delta between new file and base file, described by block checksums.
+Operations are passed to fn in file order. Literal slices are reused after fn returns.
+*/
+func Diff(r io.Reader, block_size int, blocks []Block, fn func(Op) error) error {
+	if block_size <= 0 {
+		return ErrBadBlockSize
+	}
+
+	table := make(map[uint32][]uint32, len(blocks))
+	for i, block := range blocks {
+		table[block.Weak] = append(table[block.Weak], uint32(i))
+	}
+
+	ops := &opWriter{fn: fn, literal: make([]byte, 0, 4096)}
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	window := make([]byte, block_size)
+	fill := func() error {
+		n, err := io.ReadFull(br, window[:block_size])
+		window = window[:n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	}
+
+	if err := fill(); err != nil {
+		return err
+	}
+	roll := NewRolling(window)
+
+	for len(window) > 0 {
+		if indexes, ok := table[roll.Sum()]; ok {
+			// Blocks with other length can't have the same strong sum, so last (smaller) block is checked too
+			strong := sha256.Sum256(window)
+			matched := false
+			for _, index := range indexes {
+				if blocks[index].Strong == strong {
+					if err := ops.block(index); err != nil {
+						return err
+					}
+					matched = true
+					break
+				}
+			}
+
+			if matched {
+				window = window[:cap(window)]
+				if err := fill(); err != nil {
+					return err
+				}
+				roll = NewRolling(window)
+				continue
+			}
+		}
+
+		out := window[0]
+		if err := ops.byte(out); err != nil {
+			return err
+		}
+
+		in, err := br.ReadByte()
+		if err == io.EOF {
+			copy(window, window[1:])
+			window = window[:len(window)-1]
+			roll.Shrink(out)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		copy(window, window[1:])
+		window[len(window)-1] = in
+		roll.Roll(out, in)
+	}
+
+	if err := ops.flushBlocks(); err != nil {
+		return err
+	}
+	return ops.flushLiteral()
+}
+
+/*
+Write operation in binary format (big endian):
+
+	blocks:  0x01, uint32 block index, uint32 blocks count
+	literal: 0x02, uint32 length, data
+*/
+func WriteOp(w io.Writer, op Op) error {
+	if len(op.Literal) > MAX_LITERAL_SIZE {
+		return ErrLiteralTooLong
+	}
+
+	var header [9]byte
+	if len(op.Literal) == 0 {
+		header[0] = OP_BLOCKS
+		binary.BigEndian.PutUint32(header[1:5], op.BlockIndex)
+		binary.BigEndian.PutUint32(header[5:9], op.BlockCount)
+		_, err := w.Write(header[:])
+		return err
+	}
+
+	header[0] = OP_LITERAL
+	binary.BigEndian.PutUint32(header[1:5], uint32(len(op.Literal)))
+	if _, err := w.Write(header[:5]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(op.Literal)
+	return err
+}
+
+// Read operation in binary format. Return io.EOF after last operation.
+func ReadOp(r io.Reader) (Op, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:1]); err != nil {
+		return Op{}, err
+	}
+
+	switch header[0] {
+	case OP_BLOCKS:
+		if _, err := io.ReadFull(r, header[1:9]); err != nil {
+			return Op{}, ErrBadOp
+		}
+
+		op := Op{
+			BlockIndex: binary.BigEndian.Uint32(header[1:5]),
+			BlockCount: binary.BigEndian.Uint32(header[5:9]),
+		}
+		if op.BlockCount == 0 {
+			return Op{}, ErrBadOp
+		}
+		return op, nil
+
+	case OP_LITERAL:
+		if _, err := io.ReadFull(r, header[1:5]); err != nil {
+			return Op{}, ErrBadOp
+		}
+
+		length := binary.BigEndian.Uint32(header[1:5])
+		if length == 0 {
+			return Op{}, ErrBadOp
+		}
+
+		if length > uint32(MAX_LITERAL_SIZE) {
+			return Op{}, ErrLiteralTooLong
+		}
+
+		literal := make([]byte, length)
+		if _, err := io.ReadFull(r, literal); err != nil {
+			return Op{}, ErrBadOp
+		}
+		return Op{Literal: literal}, nil
+	}
+
+	return Op{}, ErrBadOp
+}
+
+// Apply operations to base file. Used by clients to check delta and in tests.
+func Apply(dst io.Writer, base io.ReaderAt, base_size int64, block_size int, op Op) error {
+	if len(op.Literal) != 0 {
+		_, err := dst.Write(op.Literal)
+		return err
+	}
+
+	offset := int64(op.BlockIndex) * int64(block_size)
+	length := min(int64(op.BlockCount)*int64(block_size), base_size-offset)
+	if offset >= base_size || length <= 0 || offset+int64(op.BlockCount-1)*int64(block_size) >= base_size {
+		return ErrBadOp
+	}
+
+	_, err := io.Copy(dst, io.NewSectionReader(base, offset, length))
+	return err
+}
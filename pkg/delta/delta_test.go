@@ -0,0 +1,143 @@
+package delta_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/braginantonev/mhserver/pkg/delta"
+)
+
+const TEST_BLOCK_SIZE int = 64
+
+func randomBytes(rnd *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	_, _ = rnd.Read(b)
+	return b
+}
+
+func TestRolling(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := randomBytes(rnd, 1000)
+
+	roll := delta.NewRolling(data[:TEST_BLOCK_SIZE])
+	for i := 1; i+TEST_BLOCK_SIZE <= len(data); i++ {
+		roll.Roll(data[i-1], data[i+TEST_BLOCK_SIZE-1])
+		if roll.Sum() != delta.WeakSum(data[i:i+TEST_BLOCK_SIZE]) {
+			t.Fatalf("rolling sum differs from weak sum at %d", i)
+		}
+	}
+
+	tail := data[len(data)-TEST_BLOCK_SIZE:]
+	roll = delta.NewRolling(tail)
+	for i := 1; i < len(tail); i++ {
+		roll.Shrink(tail[i-1])
+		if roll.Sum() != delta.WeakSum(tail[i:]) {
+			t.Fatalf("shrinked sum differs from weak sum at %d", i)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	base := randomBytes(rnd, TEST_BLOCK_SIZE*20+10)
+
+	cases := [...]struct {
+		name         string
+		new_file     []byte
+		max_literals int
+	}{
+		{
+			name:     "same file",
+			new_file: base,
+		},
+		{
+			name:         "changed byte",
+			new_file:     append(append(bytes.Clone(base[:300]), 'x'), base[301:]...),
+			max_literals: TEST_BLOCK_SIZE,
+		},
+		{
+			name:         "inserted data",
+			new_file:     append(append(bytes.Clone(base[:100]), []byte("hello world!")...), base[100:]...),
+			max_literals: TEST_BLOCK_SIZE + 12,
+		},
+		{
+			name:         "removed data",
+			new_file:     append(bytes.Clone(base[:200]), base[250:]...),
+			max_literals: TEST_BLOCK_SIZE,
+		},
+		{
+			name:         "new file",
+			new_file:     randomBytes(rnd, 500),
+			max_literals: 500,
+		},
+		{
+			name:     "empty file",
+			new_file: []byte{},
+		},
+	}
+
+	blocks := make([]delta.Block, 0)
+	err := delta.BlockSums(bytes.NewReader(base), TEST_BLOCK_SIZE, func(b delta.Block) error {
+		blocks = append(blocks, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			// Ops are written and read back to check binary format
+			var encoded bytes.Buffer
+			err := delta.Diff(bytes.NewReader(test.new_file), TEST_BLOCK_SIZE, blocks, func(op delta.Op) error {
+				return delta.WriteOp(&encoded, op)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var result bytes.Buffer
+			literals := 0
+			for {
+				op, err := delta.ReadOp(&encoded)
+				if err != nil {
+					break
+				}
+
+				literals += len(op.Literal)
+				if err := delta.Apply(&result, bytes.NewReader(base), int64(len(base)), TEST_BLOCK_SIZE, op); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !bytes.Equal(result.Bytes(), test.new_file) {
+				t.Fatal("rebuilt file differs from new file")
+			}
+
+			if literals > test.max_literals {
+				t.Fatalf("expected not more than %d literal bytes, but got %d", test.max_literals, literals)
+			}
+		})
+	}
+}
+
+func TestReadBadOp(t *testing.T) {
+	cases := [...]struct {
+		name string
+		body []byte
+	}{
+		{name: "unknown op", body: []byte{9}},
+		{name: "zero blocks", body: []byte{delta.OP_BLOCKS, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "short literal", body: []byte{delta.OP_LITERAL, 0, 0, 0, 5, 'a'}},
+		{name: "too long literal", body: []byte{delta.OP_LITERAL, 0xff, 0, 0, 0}},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := delta.ReadOp(bytes.NewReader(test.body)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
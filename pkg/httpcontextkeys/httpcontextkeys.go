@@ -4,4 +4,7 @@ type HTTPContextKey string
 
 const (
 	USERNAME HTTPContextKey = "username"
+
+	// auth.AccessClaims of request token
+	ACCESS_CLAIMS HTTPContextKey = "access_claims"
 )
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.36.10
+// 	protoc-gen-go v1.36.11
 // 	protoc        v7.35.1
 // source: data/data.proto
 
@@ -121,12 +121,14 @@ func (x *FilePart) GetOffset() uint64 {
 }
 
 type ConnectionRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
-	Mode          ConnectionMode         `protobuf:"varint,2,opt,name=mode,proto3,enum=data.ConnectionMode" json:"mode,omitempty"`
-	Directory     string                 `protobuf:"bytes,3,opt,name=directory,proto3" json:"directory,omitempty"`
-	Filename      string                 `protobuf:"bytes,4,opt,name=filename,proto3" json:"filename,omitempty"`
-	Size          uint64                 `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Username  string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Mode      ConnectionMode         `protobuf:"varint,2,opt,name=mode,proto3,enum=data.ConnectionMode" json:"mode,omitempty"`
+	Directory string                 `protobuf:"bytes,3,opt,name=directory,proto3" json:"directory,omitempty"`
+	Filename  string                 `protobuf:"bytes,4,opt,name=filename,proto3" json:"filename,omitempty"`
+	Size      uint64                 `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	// Seconds without requests, after which connection is closed. 0 - default lifetime
+	Lifetime      uint64 `protobuf:"varint,6,opt,name=lifetime,proto3" json:"lifetime,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -196,6 +198,13 @@ func (x *ConnectionRequest) GetSize() uint64 {
 	return 0
 }
 
+func (x *ConnectionRequest) GetLifetime() uint64 {
+	if x != nil {
+		return x.Lifetime
+	}
+	return 0
+}
+
 type SaveChunk struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	UUID          string                 `protobuf:"bytes,1,opt,name=UUID,proto3" json:"UUID,omitempty"`
@@ -300,6 +309,59 @@ func (x *GetChunk) GetChunkId() uint32 {
 	return 0
 }
 
+type CloseConnectionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	UUID  string                 `protobuf:"bytes,1,opt,name=UUID,proto3" json:"UUID,omitempty"`
+	// Remove unfinished file. Only for RDWR connections
+	Remove        bool `protobuf:"varint,2,opt,name=remove,proto3" json:"remove,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseConnectionRequest) Reset() {
+	*x = CloseConnectionRequest{}
+	mi := &file_data_data_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseConnectionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseConnectionRequest) ProtoMessage() {}
+
+func (x *CloseConnectionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseConnectionRequest.ProtoReflect.Descriptor instead.
+func (*CloseConnectionRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CloseConnectionRequest) GetUUID() string {
+	if x != nil {
+		return x.UUID
+	}
+	return ""
+}
+
+func (x *CloseConnectionRequest) GetRemove() bool {
+	if x != nil {
+		return x.Remove
+	}
+	return false
+}
+
 type Directory struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
@@ -310,7 +372,7 @@ type Directory struct {
 
 func (x *Directory) Reset() {
 	*x = Directory{}
-	mi := &file_data_data_proto_msgTypes[4]
+	mi := &file_data_data_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -322,7 +384,7 @@ func (x *Directory) String() string {
 func (*Directory) ProtoMessage() {}
 
 func (x *Directory) ProtoReflect() protoreflect.Message {
-	mi := &file_data_data_proto_msgTypes[4]
+	mi := &file_data_data_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -335,7 +397,7 @@ func (x *Directory) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Directory.ProtoReflect.Descriptor instead.
 func (*Directory) Descriptor() ([]byte, []int) {
-	return file_data_data_proto_rawDescGZIP(), []int{4}
+	return file_data_data_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Directory) GetUser() string {
@@ -352,30 +414,30 @@ func (x *Directory) GetValue() string {
 	return ""
 }
 
-type Connection struct {
+type FilePath struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	UUID          string                 `protobuf:"bytes,1,opt,name=UUID,proto3" json:"UUID,omitempty"`
-	ChunkSize     uint64                 `protobuf:"varint,2,opt,name=chunkSize,proto3" json:"chunkSize,omitempty"`
-	ChunksCount   uint32                 `protobuf:"varint,3,opt,name=chunksCount,proto3" json:"chunksCount,omitempty"`
+	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Directory     string                 `protobuf:"bytes,2,opt,name=directory,proto3" json:"directory,omitempty"`
+	Filename      string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Connection) Reset() {
-	*x = Connection{}
-	mi := &file_data_data_proto_msgTypes[5]
+func (x *FilePath) Reset() {
+	*x = FilePath{}
+	mi := &file_data_data_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Connection) String() string {
+func (x *FilePath) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Connection) ProtoMessage() {}
+func (*FilePath) ProtoMessage() {}
 
-func (x *Connection) ProtoReflect() protoreflect.Message {
-	mi := &file_data_data_proto_msgTypes[5]
+func (x *FilePath) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -386,54 +448,61 @@ func (x *Connection) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
-func (*Connection) Descriptor() ([]byte, []int) {
-	return file_data_data_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use FilePath.ProtoReflect.Descriptor instead.
+func (*FilePath) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{6}
 }
 
-func (x *Connection) GetUUID() string {
+func (x *FilePath) GetUsername() string {
 	if x != nil {
-		return x.UUID
+		return x.Username
 	}
 	return ""
 }
 
-func (x *Connection) GetChunkSize() uint64 {
+func (x *FilePath) GetDirectory() string {
 	if x != nil {
-		return x.ChunkSize
+		return x.Directory
 	}
-	return 0
+	return ""
 }
 
-func (x *Connection) GetChunksCount() uint32 {
+func (x *FilePath) GetFilename() string {
 	if x != nil {
-		return x.ChunksCount
+		return x.Filename
 	}
-	return 0
+	return ""
 }
 
-type SHASum struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Value         []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+type ExtractRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	// Archive location
+	Directory string `protobuf:"bytes,2,opt,name=directory,proto3" json:"directory,omitempty"`
+	Filename  string `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Directory to extract archive. Will be created, if not exist
+	Target string `protobuf:"bytes,4,opt,name=target,proto3" json:"target,omitempty"`
+	// Replace existing files. Otherwise extraction fails, if any file already exist
+	Overwrite     bool `protobuf:"varint,5,opt,name=overwrite,proto3" json:"overwrite,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *SHASum) Reset() {
-	*x = SHASum{}
-	mi := &file_data_data_proto_msgTypes[6]
+func (x *ExtractRequest) Reset() {
+	*x = ExtractRequest{}
+	mi := &file_data_data_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *SHASum) String() string {
+func (x *ExtractRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SHASum) ProtoMessage() {}
+func (*ExtractRequest) ProtoMessage() {}
 
-func (x *SHASum) ProtoReflect() protoreflect.Message {
-	mi := &file_data_data_proto_msgTypes[6]
+func (x *ExtractRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -444,43 +513,72 @@ func (x *SHASum) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SHASum.ProtoReflect.Descriptor instead.
-func (*SHASum) Descriptor() ([]byte, []int) {
-	return file_data_data_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use ExtractRequest.ProtoReflect.Descriptor instead.
+func (*ExtractRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{7}
 }
 
-func (x *SHASum) GetValue() []byte {
+func (x *ExtractRequest) GetUsername() string {
 	if x != nil {
-		return x.Value
+		return x.Username
 	}
-	return nil
+	return ""
 }
 
-type FileInfo struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	IsDir         bool                   `protobuf:"varint,2,opt,name=isDir,proto3" json:"isDir,omitempty"`
-	Size          uint64                 `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
-	ModTime       uint64                 `protobuf:"varint,4,opt,name=modTime,proto3" json:"modTime,omitempty"`
+func (x *ExtractRequest) GetDirectory() string {
+	if x != nil {
+		return x.Directory
+	}
+	return ""
+}
+
+func (x *ExtractRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *ExtractRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *ExtractRequest) GetOverwrite() bool {
+	if x != nil {
+		return x.Overwrite
+	}
+	return false
+}
+
+type SignatureRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Username  string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Directory string                 `protobuf:"bytes,2,opt,name=directory,proto3" json:"directory,omitempty"`
+	Filename  string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Wanted block size. Server chooses block size, if it's zero or out of limits
+	BlockSize     uint32 `protobuf:"varint,4,opt,name=blockSize,proto3" json:"blockSize,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *FileInfo) Reset() {
-	*x = FileInfo{}
-	mi := &file_data_data_proto_msgTypes[7]
+func (x *SignatureRequest) Reset() {
+	*x = SignatureRequest{}
+	mi := &file_data_data_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *FileInfo) String() string {
+func (x *SignatureRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FileInfo) ProtoMessage() {}
+func (*SignatureRequest) ProtoMessage() {}
 
-func (x *FileInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_data_data_proto_msgTypes[7]
+func (x *SignatureRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -491,61 +589,70 @@ func (x *FileInfo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
-func (*FileInfo) Descriptor() ([]byte, []int) {
-	return file_data_data_proto_rawDescGZIP(), []int{7}
+// Deprecated: Use SignatureRequest.ProtoReflect.Descriptor instead.
+func (*SignatureRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{8}
 }
 
-func (x *FileInfo) GetName() string {
+func (x *SignatureRequest) GetUsername() string {
 	if x != nil {
-		return x.Name
+		return x.Username
 	}
 	return ""
 }
 
-func (x *FileInfo) GetIsDir() bool {
+func (x *SignatureRequest) GetDirectory() string {
 	if x != nil {
-		return x.IsDir
+		return x.Directory
 	}
-	return false
+	return ""
 }
 
-func (x *FileInfo) GetSize() uint64 {
+func (x *SignatureRequest) GetFilename() string {
 	if x != nil {
-		return x.Size
+		return x.Filename
 	}
-	return 0
+	return ""
 }
 
-func (x *FileInfo) GetModTime() uint64 {
+func (x *SignatureRequest) GetBlockSize() uint32 {
 	if x != nil {
-		return x.ModTime
+		return x.BlockSize
 	}
 	return 0
 }
 
-type FilesList struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Value         []*FileInfo            `protobuf:"bytes,1,rep,name=value,proto3" json:"value,omitempty"`
+type DeltaHeader struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Username  string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Directory string                 `protobuf:"bytes,2,opt,name=directory,proto3" json:"directory,omitempty"`
+	Filename  string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Values from signature. Delta is rejected, if base file was changed after signature
+	BlockSize   uint32 `protobuf:"varint,4,opt,name=blockSize,proto3" json:"blockSize,omitempty"`
+	BaseSize    uint64 `protobuf:"varint,5,opt,name=baseSize,proto3" json:"baseSize,omitempty"`
+	BaseModTime uint64 `protobuf:"varint,6,opt,name=baseModTime,proto3" json:"baseModTime,omitempty"`
+	// Size and sha256 sum of new file
+	Size          uint64 `protobuf:"varint,7,opt,name=size,proto3" json:"size,omitempty"`
+	Sum           []byte `protobuf:"bytes,8,opt,name=sum,proto3" json:"sum,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *FilesList) Reset() {
-	*x = FilesList{}
-	mi := &file_data_data_proto_msgTypes[8]
+func (x *DeltaHeader) Reset() {
+	*x = DeltaHeader{}
+	mi := &file_data_data_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *FilesList) String() string {
+func (x *DeltaHeader) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FilesList) ProtoMessage() {}
+func (*DeltaHeader) ProtoMessage() {}
 
-func (x *FilesList) ProtoReflect() protoreflect.Message {
-	mi := &file_data_data_proto_msgTypes[8]
+func (x *DeltaHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -556,40 +663,92 @@ func (x *FilesList) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FilesList.ProtoReflect.Descriptor instead.
-func (*FilesList) Descriptor() ([]byte, []int) {
-	return file_data_data_proto_rawDescGZIP(), []int{8}
+// Deprecated: Use DeltaHeader.ProtoReflect.Descriptor instead.
+func (*DeltaHeader) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{9}
 }
 
-func (x *FilesList) GetValue() []*FileInfo {
+func (x *DeltaHeader) GetUsername() string {
 	if x != nil {
-		return x.Value
+		return x.Username
+	}
+	return ""
+}
+
+func (x *DeltaHeader) GetDirectory() string {
+	if x != nil {
+		return x.Directory
+	}
+	return ""
+}
+
+func (x *DeltaHeader) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *DeltaHeader) GetBlockSize() uint32 {
+	if x != nil {
+		return x.BlockSize
+	}
+	return 0
+}
+
+func (x *DeltaHeader) GetBaseSize() uint64 {
+	if x != nil {
+		return x.BaseSize
+	}
+	return 0
+}
+
+func (x *DeltaHeader) GetBaseModTime() uint64 {
+	if x != nil {
+		return x.BaseModTime
+	}
+	return 0
+}
+
+func (x *DeltaHeader) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *DeltaHeader) GetSum() []byte {
+	if x != nil {
+		return x.Sum
 	}
 	return nil
 }
 
-type Size struct {
+// Copy blockCount blocks of base file from blockIndex, or write literal data (if not empty)
+type DeltaOp struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Value         uint64                 `protobuf:"varint,1,opt,name=value,proto3" json:"value,omitempty"`
+	BlockIndex    uint32                 `protobuf:"varint,1,opt,name=blockIndex,proto3" json:"blockIndex,omitempty"`
+	BlockCount    uint32                 `protobuf:"varint,2,opt,name=blockCount,proto3" json:"blockCount,omitempty"`
+	Literal       []byte                 `protobuf:"bytes,3,opt,name=literal,proto3" json:"literal,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Size) Reset() {
-	*x = Size{}
-	mi := &file_data_data_proto_msgTypes[9]
+func (x *DeltaOp) Reset() {
+	*x = DeltaOp{}
+	mi := &file_data_data_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Size) String() string {
+func (x *DeltaOp) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Size) ProtoMessage() {}
+func (*DeltaOp) ProtoMessage() {}
 
-func (x *Size) ProtoReflect() protoreflect.Message {
-	mi := &file_data_data_proto_msgTypes[9]
+func (x *DeltaOp) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -600,46 +759,1455 @@ func (x *Size) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Size.ProtoReflect.Descriptor instead.
-func (*Size) Descriptor() ([]byte, []int) {
-	return file_data_data_proto_rawDescGZIP(), []int{9}
+// Deprecated: Use DeltaOp.ProtoReflect.Descriptor instead.
+func (*DeltaOp) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{10}
 }
 
-func (x *Size) GetValue() uint64 {
+func (x *DeltaOp) GetBlockIndex() uint32 {
 	if x != nil {
-		return x.Value
+		return x.BlockIndex
 	}
 	return 0
 }
 
-var File_data_data_proto protoreflect.FileDescriptor
+func (x *DeltaOp) GetBlockCount() uint32 {
+	if x != nil {
+		return x.BlockCount
+	}
+	return 0
+}
 
-const file_data_data_proto_rawDesc = "" +
-	"\n" +
-	"\x0fdata/data.proto\x12\x04data\x1a\x1bgoogle/protobuf/empty.proto\"8\n" +
-	"\bFilePart\x12\x14\n" +
-	"\x05chunk\x18\x01 \x01(\fR\x05chunk\x12\x16\n" +
-	"\x06offset\x18\x02 \x01(\x04R\x06offset\"\xa7\x01\n" +
-	"\x11ConnectionRequest\x12\x1a\n" +
-	"\busername\x18\x01 \x01(\tR\busername\x12(\n" +
-	"\x04mode\x18\x02 \x01(\x0e2\x14.data.ConnectionModeR\x04mode\x12\x1c\n" +
-	"\tdirectory\x18\x03 \x01(\tR\tdirectory\x12\x1a\n" +
-	"\bfilename\x18\x04 \x01(\tR\bfilename\x12\x12\n" +
-	"\x04size\x18\x05 \x01(\x04R\x04size\"C\n" +
-	"\tSaveChunk\x12\x12\n" +
-	"\x04UUID\x18\x01 \x01(\tR\x04UUID\x12\"\n" +
-	"\x04data\x18\x02 \x01(\v2\x0e.data.FilePartR\x04data\"8\n" +
-	"\bGetChunk\x12\x12\n" +
-	"\x04UUID\x18\x01 \x01(\tR\x04UUID\x12\x18\n" +
-	"\achunkId\x18\x02 \x01(\rR\achunkId\"5\n" +
-	"\tDirectory\x12\x12\n" +
-	"\x04user\x18\x01 \x01(\tR\x04user\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value\"`\n" +
-	"\n" +
-	"Connection\x12\x12\n" +
-	"\x04UUID\x18\x01 \x01(\tR\x04UUID\x12\x1c\n" +
+func (x *DeltaOp) GetLiteral() []byte {
+	if x != nil {
+		return x.Literal
+	}
+	return nil
+}
+
+type DeltaChunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only in first message
+	Header        *DeltaHeader `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Ops           []*DeltaOp   `protobuf:"bytes,2,rep,name=ops,proto3" json:"ops,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeltaChunk) Reset() {
+	*x = DeltaChunk{}
+	mi := &file_data_data_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeltaChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeltaChunk) ProtoMessage() {}
+
+func (x *DeltaChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeltaChunk.ProtoReflect.Descriptor instead.
+func (*DeltaChunk) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DeltaChunk) GetHeader() *DeltaHeader {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+func (x *DeltaChunk) GetOps() []*DeltaOp {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
+}
+
+type ChangesRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	// Return changes after cursor. If it's not set, only current cursor is returned
+	Since         *uint64 `protobuf:"varint,2,opt,name=since,proto3,oneof" json:"since,omitempty"`
+	Limit         uint32  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangesRequest) Reset() {
+	*x = ChangesRequest{}
+	mi := &file_data_data_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangesRequest) ProtoMessage() {}
+
+func (x *ChangesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangesRequest.ProtoReflect.Descriptor instead.
+func (*ChangesRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ChangesRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *ChangesRequest) GetSince() uint64 {
+	if x != nil && x.Since != nil {
+		return *x.Since
+	}
+	return 0
+}
+
+func (x *ChangesRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type WatchRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	// Send changes after cursor. If it's not set, changes after current cursor are sent
+	Since         *uint64 `protobuf:"varint,2,opt,name=since,proto3,oneof" json:"since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_data_data_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *WatchRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *WatchRequest) GetSince() uint64 {
+	if x != nil && x.Since != nil {
+		return *x.Since
+	}
+	return 0
+}
+
+type MoveRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	// Paths of file ("/docs/cv.pdf") or directory ("/docs/"). Directory is moved with all files
+	From string `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To   string `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+	// Replace existing file. Existing directory is never replaced
+	Overwrite     bool `protobuf:"varint,4,opt,name=overwrite,proto3" json:"overwrite,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MoveRequest) Reset() {
+	*x = MoveRequest{}
+	mi := &file_data_data_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoveRequest) ProtoMessage() {}
+
+func (x *MoveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoveRequest.ProtoReflect.Descriptor instead.
+func (*MoveRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *MoveRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *MoveRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *MoveRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *MoveRequest) GetOverwrite() bool {
+	if x != nil {
+		return x.Overwrite
+	}
+	return false
+}
+
+type ShareRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Username  string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Directory string                 `protobuf:"bytes,2,opt,name=directory,proto3" json:"directory,omitempty"`
+	Filename  string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Share lifetime in seconds. Default lifetime is used, if it's zero
+	Lifetime      int64 `protobuf:"varint,4,opt,name=lifetime,proto3" json:"lifetime,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShareRequest) Reset() {
+	*x = ShareRequest{}
+	mi := &file_data_data_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShareRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShareRequest) ProtoMessage() {}
+
+func (x *ShareRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShareRequest.ProtoReflect.Descriptor instead.
+func (*ShareRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ShareRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *ShareRequest) GetDirectory() string {
+	if x != nil {
+		return x.Directory
+	}
+	return ""
+}
+
+func (x *ShareRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *ShareRequest) GetLifetime() int64 {
+	if x != nil {
+		return x.Lifetime
+	}
+	return 0
+}
+
+type ShareToken struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Empty for public access to shared file
+	Username      string `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Token         string `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShareToken) Reset() {
+	*x = ShareToken{}
+	mi := &file_data_data_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShareToken) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShareToken) ProtoMessage() {}
+
+func (x *ShareToken) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShareToken.ProtoReflect.Descriptor instead.
+func (*ShareToken) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ShareToken) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *ShareToken) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type SharesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SharesRequest) Reset() {
+	*x = SharesRequest{}
+	mi := &file_data_data_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SharesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SharesRequest) ProtoMessage() {}
+
+func (x *SharesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SharesRequest.ProtoReflect.Descriptor instead.
+func (*SharesRequest) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *SharesRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+type Connection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UUID          string                 `protobuf:"bytes,1,opt,name=UUID,proto3" json:"UUID,omitempty"`
+	ChunkSize     uint64                 `protobuf:"varint,2,opt,name=chunkSize,proto3" json:"chunkSize,omitempty"`
+	ChunksCount   uint32                 `protobuf:"varint,3,opt,name=chunksCount,proto3" json:"chunksCount,omitempty"`
+	Size          uint64                 `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	ModTime       uint64                 `protobuf:"varint,5,opt,name=modTime,proto3" json:"modTime,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connection) Reset() {
+	*x = Connection{}
+	mi := &file_data_data_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connection) ProtoMessage() {}
+
+func (x *Connection) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
+func (*Connection) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *Connection) GetUUID() string {
+	if x != nil {
+		return x.UUID
+	}
+	return ""
+}
+
+func (x *Connection) GetChunkSize() uint64 {
+	if x != nil {
+		return x.ChunkSize
+	}
+	return 0
+}
+
+func (x *Connection) GetChunksCount() uint32 {
+	if x != nil {
+		return x.ChunksCount
+	}
+	return 0
+}
+
+func (x *Connection) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Connection) GetModTime() uint64 {
+	if x != nil {
+		return x.ModTime
+	}
+	return 0
+}
+
+type SHASum struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SHASum) Reset() {
+	*x = SHASum{}
+	mi := &file_data_data_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SHASum) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SHASum) ProtoMessage() {}
+
+func (x *SHASum) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SHASum.ProtoReflect.Descriptor instead.
+func (*SHASum) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *SHASum) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+type FileInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	IsDir         bool                   `protobuf:"varint,2,opt,name=isDir,proto3" json:"isDir,omitempty"`
+	Size          uint64                 `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	ModTime       uint64                 `protobuf:"varint,4,opt,name=modTime,proto3" json:"modTime,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileInfo) Reset() {
+	*x = FileInfo{}
+	mi := &file_data_data_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileInfo) ProtoMessage() {}
+
+func (x *FileInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *FileInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileInfo) GetIsDir() bool {
+	if x != nil {
+		return x.IsDir
+	}
+	return false
+}
+
+func (x *FileInfo) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileInfo) GetModTime() uint64 {
+	if x != nil {
+		return x.ModTime
+	}
+	return 0
+}
+
+type FilesList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         []*FileInfo            `protobuf:"bytes,1,rep,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FilesList) Reset() {
+	*x = FilesList{}
+	mi := &file_data_data_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FilesList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilesList) ProtoMessage() {}
+
+func (x *FilesList) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilesList.ProtoReflect.Descriptor instead.
+func (*FilesList) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *FilesList) GetValue() []*FileInfo {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+type Size struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         uint64                 `protobuf:"varint,1,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Size) Reset() {
+	*x = Size{}
+	mi := &file_data_data_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Size) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Size) ProtoMessage() {}
+
+func (x *Size) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Size.ProtoReflect.Descriptor instead.
+func (*Size) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *Size) GetValue() uint64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+type BlockSum struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Weak          uint32                 `protobuf:"varint,1,opt,name=weak,proto3" json:"weak,omitempty"`    // rolling checksum
+	Strong        []byte                 `protobuf:"bytes,2,opt,name=strong,proto3" json:"strong,omitempty"` // sha256
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlockSum) Reset() {
+	*x = BlockSum{}
+	mi := &file_data_data_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockSum) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockSum) ProtoMessage() {}
+
+func (x *BlockSum) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockSum.ProtoReflect.Descriptor instead.
+func (*BlockSum) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *BlockSum) GetWeak() uint32 {
+	if x != nil {
+		return x.Weak
+	}
+	return 0
+}
+
+func (x *BlockSum) GetStrong() []byte {
+	if x != nil {
+		return x.Strong
+	}
+	return nil
+}
+
+type Signature struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BlockSize     uint32                 `protobuf:"varint,1,opt,name=blockSize,proto3" json:"blockSize,omitempty"`
+	Size          uint64                 `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	ModTime       uint64                 `protobuf:"varint,3,opt,name=modTime,proto3" json:"modTime,omitempty"`
+	Blocks        []*BlockSum            `protobuf:"bytes,4,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Signature) Reset() {
+	*x = Signature{}
+	mi := &file_data_data_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Signature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Signature) ProtoMessage() {}
+
+func (x *Signature) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Signature.ProtoReflect.Descriptor instead.
+func (*Signature) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *Signature) GetBlockSize() uint32 {
+	if x != nil {
+		return x.BlockSize
+	}
+	return 0
+}
+
+func (x *Signature) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Signature) GetModTime() uint64 {
+	if x != nil {
+		return x.ModTime
+	}
+	return 0
+}
+
+func (x *Signature) GetBlocks() []*BlockSum {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+type DeltaResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Size          uint64                 `protobuf:"varint,1,opt,name=size,proto3" json:"size,omitempty"`
+	Copied        uint64                 `protobuf:"varint,2,opt,name=copied,proto3" json:"copied,omitempty"`   // bytes copied from base file
+	Literal       uint64                 `protobuf:"varint,3,opt,name=literal,proto3" json:"literal,omitempty"` // bytes received from client
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeltaResult) Reset() {
+	*x = DeltaResult{}
+	mi := &file_data_data_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeltaResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeltaResult) ProtoMessage() {}
+
+func (x *DeltaResult) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeltaResult.ProtoReflect.Descriptor instead.
+func (*DeltaResult) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *DeltaResult) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *DeltaResult) GetCopied() uint64 {
+	if x != nil {
+		return x.Copied
+	}
+	return 0
+}
+
+func (x *DeltaResult) GetLiteral() uint64 {
+	if x != nil {
+		return x.Literal
+	}
+	return 0
+}
+
+type Change struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cursor        uint64                 `protobuf:"varint,1,opt,name=cursor,proto3" json:"cursor,omitempty"` // cursor after change
+	Time          int64                  `protobuf:"varint,2,opt,name=time,proto3" json:"time,omitempty"`
+	Op            string                 `protobuf:"bytes,3,opt,name=op,proto3" json:"op,omitempty"`           // create, modify, move or remove
+	Path          string                 `protobuf:"bytes,4,opt,name=path,proto3" json:"path,omitempty"`       // directories end with "/"
+	OldPath       string                 `protobuf:"bytes,5,opt,name=oldPath,proto3" json:"oldPath,omitempty"` // only for move
+	IsDir         bool                   `protobuf:"varint,6,opt,name=isDir,proto3" json:"isDir,omitempty"`
+	Size          uint64                 `protobuf:"varint,7,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Change) Reset() {
+	*x = Change{}
+	mi := &file_data_data_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Change) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Change) ProtoMessage() {}
+
+func (x *Change) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Change.ProtoReflect.Descriptor instead.
+func (*Change) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *Change) GetCursor() uint64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *Change) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *Change) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *Change) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Change) GetOldPath() string {
+	if x != nil {
+		return x.OldPath
+	}
+	return ""
+}
+
+func (x *Change) GetIsDir() bool {
+	if x != nil {
+		return x.IsDir
+	}
+	return false
+}
+
+func (x *Change) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type ChangesList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Changes       []*Change              `protobuf:"bytes,1,rep,name=changes,proto3" json:"changes,omitempty"`
+	Cursor        uint64                 `protobuf:"varint,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	HasMore       bool                   `protobuf:"varint,3,opt,name=hasMore,proto3" json:"hasMore,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangesList) Reset() {
+	*x = ChangesList{}
+	mi := &file_data_data_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangesList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangesList) ProtoMessage() {}
+
+func (x *ChangesList) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangesList.ProtoReflect.Descriptor instead.
+func (*ChangesList) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ChangesList) GetChanges() []*Change {
+	if x != nil {
+		return x.Changes
+	}
+	return nil
+}
+
+func (x *ChangesList) GetCursor() uint64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *ChangesList) GetHasMore() bool {
+	if x != nil {
+		return x.HasMore
+	}
+	return false
+}
+
+type UploadProgress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Loaded        uint64                 `protobuf:"varint,2,opt,name=loaded,proto3" json:"loaded,omitempty"` // loaded bytes
+	Size          uint64                 `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadProgress) Reset() {
+	*x = UploadProgress{}
+	mi := &file_data_data_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadProgress) ProtoMessage() {}
+
+func (x *UploadProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadProgress.ProtoReflect.Descriptor instead.
+func (*UploadProgress) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *UploadProgress) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *UploadProgress) GetLoaded() uint64 {
+	if x != nil {
+		return x.Loaded
+	}
+	return 0
+}
+
+func (x *UploadProgress) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+// First event has only cursor and is sent after request check
+type WatchEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cursor        uint64                 `protobuf:"varint,1,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Change        *Change                `protobuf:"bytes,2,opt,name=change,proto3" json:"change,omitempty"`
+	Progress      *UploadProgress        `protobuf:"bytes,3,opt,name=progress,proto3" json:"progress,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEvent) Reset() {
+	*x = WatchEvent{}
+	mi := &file_data_data_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEvent) ProtoMessage() {}
+
+func (x *WatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEvent.ProtoReflect.Descriptor instead.
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *WatchEvent) GetCursor() uint64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *WatchEvent) GetChange() *Change {
+	if x != nil {
+		return x.Change
+	}
+	return nil
+}
+
+func (x *WatchEvent) GetProgress() *UploadProgress {
+	if x != nil {
+		return x.Progress
+	}
+	return nil
+}
+
+type ExtractProgress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Current       string                 `protobuf:"bytes,1,opt,name=current,proto3" json:"current,omitempty"`        // last extracted file
+	Files         uint32                 `protobuf:"varint,2,opt,name=files,proto3" json:"files,omitempty"`           // extracted files count
+	FilesCount    uint32                 `protobuf:"varint,3,opt,name=filesCount,proto3" json:"filesCount,omitempty"` // files count in archive
+	Written       uint64                 `protobuf:"varint,4,opt,name=written,proto3" json:"written,omitempty"`       // extracted bytes
+	Size          uint64                 `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`             // uncompressed archive size
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExtractProgress) Reset() {
+	*x = ExtractProgress{}
+	mi := &file_data_data_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtractProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtractProgress) ProtoMessage() {}
+
+func (x *ExtractProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtractProgress.ProtoReflect.Descriptor instead.
+func (*ExtractProgress) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *ExtractProgress) GetCurrent() string {
+	if x != nil {
+		return x.Current
+	}
+	return ""
+}
+
+func (x *ExtractProgress) GetFiles() uint32 {
+	if x != nil {
+		return x.Files
+	}
+	return 0
+}
+
+func (x *ExtractProgress) GetFilesCount() uint32 {
+	if x != nil {
+		return x.FilesCount
+	}
+	return 0
+}
+
+func (x *ExtractProgress) GetWritten() uint64 {
+	if x != nil {
+		return x.Written
+	}
+	return 0
+}
+
+func (x *ExtractProgress) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type Share struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Username      string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	Path          string                 `protobuf:"bytes,3,opt,name=path,proto3" json:"path,omitempty"`
+	Created       int64                  `protobuf:"varint,4,opt,name=created,proto3" json:"created,omitempty"` // unix time
+	Expires       int64                  `protobuf:"varint,5,opt,name=expires,proto3" json:"expires,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Share) Reset() {
+	*x = Share{}
+	mi := &file_data_data_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Share) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Share) ProtoMessage() {}
+
+func (x *Share) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Share.ProtoReflect.Descriptor instead.
+func (*Share) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *Share) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Share) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *Share) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Share) GetCreated() int64 {
+	if x != nil {
+		return x.Created
+	}
+	return 0
+}
+
+func (x *Share) GetExpires() int64 {
+	if x != nil {
+		return x.Expires
+	}
+	return 0
+}
+
+type SharesList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         []*Share               `protobuf:"bytes,1,rep,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SharesList) Reset() {
+	*x = SharesList{}
+	mi := &file_data_data_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SharesList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SharesList) ProtoMessage() {}
+
+func (x *SharesList) ProtoReflect() protoreflect.Message {
+	mi := &file_data_data_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SharesList.ProtoReflect.Descriptor instead.
+func (*SharesList) Descriptor() ([]byte, []int) {
+	return file_data_data_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *SharesList) GetValue() []*Share {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+var File_data_data_proto protoreflect.FileDescriptor
+
+const file_data_data_proto_rawDesc = "" +
+	"\n" +
+	"\x0fdata/data.proto\x12\x04data\x1a\x1bgoogle/protobuf/empty.proto\"8\n" +
+	"\bFilePart\x12\x14\n" +
+	"\x05chunk\x18\x01 \x01(\fR\x05chunk\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x04R\x06offset\"\xc3\x01\n" +
+	"\x11ConnectionRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12(\n" +
+	"\x04mode\x18\x02 \x01(\x0e2\x14.data.ConnectionModeR\x04mode\x12\x1c\n" +
+	"\tdirectory\x18\x03 \x01(\tR\tdirectory\x12\x1a\n" +
+	"\bfilename\x18\x04 \x01(\tR\bfilename\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x04R\x04size\x12\x1a\n" +
+	"\blifetime\x18\x06 \x01(\x04R\blifetime\"C\n" +
+	"\tSaveChunk\x12\x12\n" +
+	"\x04UUID\x18\x01 \x01(\tR\x04UUID\x12\"\n" +
+	"\x04data\x18\x02 \x01(\v2\x0e.data.FilePartR\x04data\"8\n" +
+	"\bGetChunk\x12\x12\n" +
+	"\x04UUID\x18\x01 \x01(\tR\x04UUID\x12\x18\n" +
+	"\achunkId\x18\x02 \x01(\rR\achunkId\"D\n" +
+	"\x16CloseConnectionRequest\x12\x12\n" +
+	"\x04UUID\x18\x01 \x01(\tR\x04UUID\x12\x16\n" +
+	"\x06remove\x18\x02 \x01(\bR\x06remove\"5\n" +
+	"\tDirectory\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"`\n" +
+	"\bFilePath\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1c\n" +
+	"\tdirectory\x18\x02 \x01(\tR\tdirectory\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\"\x9c\x01\n" +
+	"\x0eExtractRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1c\n" +
+	"\tdirectory\x18\x02 \x01(\tR\tdirectory\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12\x16\n" +
+	"\x06target\x18\x04 \x01(\tR\x06target\x12\x1c\n" +
+	"\toverwrite\x18\x05 \x01(\bR\toverwrite\"\x86\x01\n" +
+	"\x10SignatureRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1c\n" +
+	"\tdirectory\x18\x02 \x01(\tR\tdirectory\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12\x1c\n" +
+	"\tblockSize\x18\x04 \x01(\rR\tblockSize\"\xe5\x01\n" +
+	"\vDeltaHeader\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1c\n" +
+	"\tdirectory\x18\x02 \x01(\tR\tdirectory\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12\x1c\n" +
+	"\tblockSize\x18\x04 \x01(\rR\tblockSize\x12\x1a\n" +
+	"\bbaseSize\x18\x05 \x01(\x04R\bbaseSize\x12 \n" +
+	"\vbaseModTime\x18\x06 \x01(\x04R\vbaseModTime\x12\x12\n" +
+	"\x04size\x18\a \x01(\x04R\x04size\x12\x10\n" +
+	"\x03sum\x18\b \x01(\fR\x03sum\"c\n" +
+	"\aDeltaOp\x12\x1e\n" +
+	"\n" +
+	"blockIndex\x18\x01 \x01(\rR\n" +
+	"blockIndex\x12\x1e\n" +
+	"\n" +
+	"blockCount\x18\x02 \x01(\rR\n" +
+	"blockCount\x12\x18\n" +
+	"\aliteral\x18\x03 \x01(\fR\aliteral\"X\n" +
+	"\n" +
+	"DeltaChunk\x12)\n" +
+	"\x06header\x18\x01 \x01(\v2\x11.data.DeltaHeaderR\x06header\x12\x1f\n" +
+	"\x03ops\x18\x02 \x03(\v2\r.data.DeltaOpR\x03ops\"g\n" +
+	"\x0eChangesRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x19\n" +
+	"\x05since\x18\x02 \x01(\x04H\x00R\x05since\x88\x01\x01\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\rR\x05limitB\b\n" +
+	"\x06_since\"O\n" +
+	"\fWatchRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x19\n" +
+	"\x05since\x18\x02 \x01(\x04H\x00R\x05since\x88\x01\x01B\b\n" +
+	"\x06_since\"k\n" +
+	"\vMoveRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\tR\x02to\x12\x1c\n" +
+	"\toverwrite\x18\x04 \x01(\bR\toverwrite\"\x80\x01\n" +
+	"\fShareRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1c\n" +
+	"\tdirectory\x18\x02 \x01(\tR\tdirectory\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12\x1a\n" +
+	"\blifetime\x18\x04 \x01(\x03R\blifetime\">\n" +
+	"\n" +
+	"ShareToken\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x14\n" +
+	"\x05token\x18\x02 \x01(\tR\x05token\"+\n" +
+	"\rSharesRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\"\x8e\x01\n" +
+	"\n" +
+	"Connection\x12\x12\n" +
+	"\x04UUID\x18\x01 \x01(\tR\x04UUID\x12\x1c\n" +
 	"\tchunkSize\x18\x02 \x01(\x04R\tchunkSize\x12 \n" +
-	"\vchunksCount\x18\x03 \x01(\rR\vchunksCount\"\x1e\n" +
+	"\vchunksCount\x18\x03 \x01(\rR\vchunksCount\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x04R\x04size\x12\x18\n" +
+	"\amodTime\x18\x05 \x01(\x04R\amodTime\"\x1e\n" +
 	"\x06SHASum\x12\x14\n" +
 	"\x05value\x18\x01 \x01(\fR\x05value\"b\n" +
 	"\bFileInfo\x12\x12\n" +
@@ -650,21 +2218,86 @@ const file_data_data_proto_rawDesc = "" +
 	"\tFilesList\x12$\n" +
 	"\x05value\x18\x01 \x03(\v2\x0e.data.FileInfoR\x05value\"\x1c\n" +
 	"\x04Size\x12\x14\n" +
-	"\x05value\x18\x01 \x01(\x04R\x05value*&\n" +
+	"\x05value\x18\x01 \x01(\x04R\x05value\"6\n" +
+	"\bBlockSum\x12\x12\n" +
+	"\x04weak\x18\x01 \x01(\rR\x04weak\x12\x16\n" +
+	"\x06strong\x18\x02 \x01(\fR\x06strong\"\x7f\n" +
+	"\tSignature\x12\x1c\n" +
+	"\tblockSize\x18\x01 \x01(\rR\tblockSize\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x04R\x04size\x12\x18\n" +
+	"\amodTime\x18\x03 \x01(\x04R\amodTime\x12&\n" +
+	"\x06blocks\x18\x04 \x03(\v2\x0e.data.BlockSumR\x06blocks\"S\n" +
+	"\vDeltaResult\x12\x12\n" +
+	"\x04size\x18\x01 \x01(\x04R\x04size\x12\x16\n" +
+	"\x06copied\x18\x02 \x01(\x04R\x06copied\x12\x18\n" +
+	"\aliteral\x18\x03 \x01(\x04R\aliteral\"\x9c\x01\n" +
+	"\x06Change\x12\x16\n" +
+	"\x06cursor\x18\x01 \x01(\x04R\x06cursor\x12\x12\n" +
+	"\x04time\x18\x02 \x01(\x03R\x04time\x12\x0e\n" +
+	"\x02op\x18\x03 \x01(\tR\x02op\x12\x12\n" +
+	"\x04path\x18\x04 \x01(\tR\x04path\x12\x18\n" +
+	"\aoldPath\x18\x05 \x01(\tR\aoldPath\x12\x14\n" +
+	"\x05isDir\x18\x06 \x01(\bR\x05isDir\x12\x12\n" +
+	"\x04size\x18\a \x01(\x04R\x04size\"g\n" +
+	"\vChangesList\x12&\n" +
+	"\achanges\x18\x01 \x03(\v2\f.data.ChangeR\achanges\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\x04R\x06cursor\x12\x18\n" +
+	"\ahasMore\x18\x03 \x01(\bR\ahasMore\"P\n" +
+	"\x0eUploadProgress\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x16\n" +
+	"\x06loaded\x18\x02 \x01(\x04R\x06loaded\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x04R\x04size\"|\n" +
+	"\n" +
+	"WatchEvent\x12\x16\n" +
+	"\x06cursor\x18\x01 \x01(\x04R\x06cursor\x12$\n" +
+	"\x06change\x18\x02 \x01(\v2\f.data.ChangeR\x06change\x120\n" +
+	"\bprogress\x18\x03 \x01(\v2\x14.data.UploadProgressR\bprogress\"\x8f\x01\n" +
+	"\x0fExtractProgress\x12\x18\n" +
+	"\acurrent\x18\x01 \x01(\tR\acurrent\x12\x14\n" +
+	"\x05files\x18\x02 \x01(\rR\x05files\x12\x1e\n" +
+	"\n" +
+	"filesCount\x18\x03 \x01(\rR\n" +
+	"filesCount\x12\x18\n" +
+	"\awritten\x18\x04 \x01(\x04R\awritten\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x04R\x04size\"\x81\x01\n" +
+	"\x05Share\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\x12\x12\n" +
+	"\x04path\x18\x03 \x01(\tR\x04path\x12\x18\n" +
+	"\acreated\x18\x04 \x01(\x03R\acreated\x12\x18\n" +
+	"\aexpires\x18\x05 \x01(\x03R\aexpires\"/\n" +
+	"\n" +
+	"SharesList\x12!\n" +
+	"\x05value\x18\x01 \x03(\v2\v.data.ShareR\x05value*&\n" +
 	"\x0eConnectionMode\x12\n" +
 	"\n" +
 	"\x06RDONLY\x10\x00\x12\b\n" +
-	"\x04RDWR\x10\x012\xa4\x03\n" +
+	"\x04RDWR\x10\x012\xb5\b\n" +
 	"\vDataService\x12=\n" +
 	"\x10CreateConnection\x12\x17.data.ConnectionRequest\x1a\x10.data.Connection\x123\n" +
 	"\bSaveData\x12\x0f.data.SaveChunk\x1a\x16.google.protobuf.Empty\x12)\n" +
 	"\aGetData\x12\x0e.data.GetChunk\x1a\x0e.data.FilePart\x12&\n" +
-	"\x06GetSum\x12\x0e.data.GetChunk\x1a\f.data.SHASum\x12,\n" +
+	"\x06GetSum\x12\x0e.data.GetChunk\x1a\f.data.SHASum\x12G\n" +
+	"\x0fCloseConnection\x12\x1c.data.CloseConnectionRequest\x1a\x16.google.protobuf.Empty\x12,\n" +
 	"\bGetFiles\x12\x0f.data.Directory\x1a\x0f.data.FilesList\x124\n" +
 	"\x15GetAvailableDiskSpace\x12\x0f.data.Directory\x1a\n" +
 	".data.Size\x124\n" +
 	"\tCreateDir\x12\x0f.data.Directory\x1a\x16.google.protobuf.Empty\x124\n" +
-	"\tRemoveDir\x12\x0f.data.Directory\x1a\x16.google.protobuf.EmptyB.Z,github.com/braginantonev/mhserver/proto/datab\x06proto3"
+	"\tRemoveDir\x12\x0f.data.Directory\x1a\x16.google.protobuf.Empty\x124\n" +
+	"\n" +
+	"RemoveFile\x12\x0e.data.FilePath\x1a\x16.google.protobuf.Empty\x121\n" +
+	"\x04Move\x12\x11.data.MoveRequest\x1a\x16.google.protobuf.Empty\x128\n" +
+	"\aExtract\x12\x14.data.ExtractRequest\x1a\x15.data.ExtractProgress0\x01\x127\n" +
+	"\fGetSignature\x12\x16.data.SignatureRequest\x1a\x0f.data.Signature\x123\n" +
+	"\n" +
+	"ApplyDelta\x12\x10.data.DeltaChunk\x1a\x11.data.DeltaResult(\x01\x125\n" +
+	"\n" +
+	"GetChanges\x12\x14.data.ChangesRequest\x1a\x11.data.ChangesList\x126\n" +
+	"\fWatchChanges\x12\x12.data.WatchRequest\x1a\x10.data.WatchEvent0\x01\x12.\n" +
+	"\vCreateShare\x12\x12.data.ShareRequest\x1a\v.data.Share\x12)\n" +
+	"\bGetShare\x12\x10.data.ShareToken\x1a\v.data.Share\x122\n" +
+	"\tGetShares\x12\x13.data.SharesRequest\x1a\x10.data.SharesList\x127\n" +
+	"\vRemoveShare\x12\x10.data.ShareToken\x1a\x16.google.protobuf.EmptyB.Z,github.com/braginantonev/mhserver/proto/datab\x06proto3"
 
 var (
 	file_data_data_proto_rawDescOnce sync.Once
@@ -679,46 +2312,100 @@ func file_data_data_proto_rawDescGZIP() []byte {
 }
 
 var file_data_data_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_data_data_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_data_data_proto_msgTypes = make([]protoimpl.MessageInfo, 33)
 var file_data_data_proto_goTypes = []any{
-	(ConnectionMode)(0),       // 0: data.ConnectionMode
-	(*FilePart)(nil),          // 1: data.FilePart
-	(*ConnectionRequest)(nil), // 2: data.ConnectionRequest
-	(*SaveChunk)(nil),         // 3: data.SaveChunk
-	(*GetChunk)(nil),          // 4: data.GetChunk
-	(*Directory)(nil),         // 5: data.Directory
-	(*Connection)(nil),        // 6: data.Connection
-	(*SHASum)(nil),            // 7: data.SHASum
-	(*FileInfo)(nil),          // 8: data.FileInfo
-	(*FilesList)(nil),         // 9: data.FilesList
-	(*Size)(nil),              // 10: data.Size
-	(*emptypb.Empty)(nil),     // 11: google.protobuf.Empty
+	(ConnectionMode)(0),            // 0: data.ConnectionMode
+	(*FilePart)(nil),               // 1: data.FilePart
+	(*ConnectionRequest)(nil),      // 2: data.ConnectionRequest
+	(*SaveChunk)(nil),              // 3: data.SaveChunk
+	(*GetChunk)(nil),               // 4: data.GetChunk
+	(*CloseConnectionRequest)(nil), // 5: data.CloseConnectionRequest
+	(*Directory)(nil),              // 6: data.Directory
+	(*FilePath)(nil),               // 7: data.FilePath
+	(*ExtractRequest)(nil),         // 8: data.ExtractRequest
+	(*SignatureRequest)(nil),       // 9: data.SignatureRequest
+	(*DeltaHeader)(nil),            // 10: data.DeltaHeader
+	(*DeltaOp)(nil),                // 11: data.DeltaOp
+	(*DeltaChunk)(nil),             // 12: data.DeltaChunk
+	(*ChangesRequest)(nil),         // 13: data.ChangesRequest
+	(*WatchRequest)(nil),           // 14: data.WatchRequest
+	(*MoveRequest)(nil),            // 15: data.MoveRequest
+	(*ShareRequest)(nil),           // 16: data.ShareRequest
+	(*ShareToken)(nil),             // 17: data.ShareToken
+	(*SharesRequest)(nil),          // 18: data.SharesRequest
+	(*Connection)(nil),             // 19: data.Connection
+	(*SHASum)(nil),                 // 20: data.SHASum
+	(*FileInfo)(nil),               // 21: data.FileInfo
+	(*FilesList)(nil),              // 22: data.FilesList
+	(*Size)(nil),                   // 23: data.Size
+	(*BlockSum)(nil),               // 24: data.BlockSum
+	(*Signature)(nil),              // 25: data.Signature
+	(*DeltaResult)(nil),            // 26: data.DeltaResult
+	(*Change)(nil),                 // 27: data.Change
+	(*ChangesList)(nil),            // 28: data.ChangesList
+	(*UploadProgress)(nil),         // 29: data.UploadProgress
+	(*WatchEvent)(nil),             // 30: data.WatchEvent
+	(*ExtractProgress)(nil),        // 31: data.ExtractProgress
+	(*Share)(nil),                  // 32: data.Share
+	(*SharesList)(nil),             // 33: data.SharesList
+	(*emptypb.Empty)(nil),          // 34: google.protobuf.Empty
 }
 var file_data_data_proto_depIdxs = []int32{
 	0,  // 0: data.ConnectionRequest.mode:type_name -> data.ConnectionMode
 	1,  // 1: data.SaveChunk.data:type_name -> data.FilePart
-	8,  // 2: data.FilesList.value:type_name -> data.FileInfo
-	2,  // 3: data.DataService.CreateConnection:input_type -> data.ConnectionRequest
-	3,  // 4: data.DataService.SaveData:input_type -> data.SaveChunk
-	4,  // 5: data.DataService.GetData:input_type -> data.GetChunk
-	4,  // 6: data.DataService.GetSum:input_type -> data.GetChunk
-	5,  // 7: data.DataService.GetFiles:input_type -> data.Directory
-	5,  // 8: data.DataService.GetAvailableDiskSpace:input_type -> data.Directory
-	5,  // 9: data.DataService.CreateDir:input_type -> data.Directory
-	5,  // 10: data.DataService.RemoveDir:input_type -> data.Directory
-	6,  // 11: data.DataService.CreateConnection:output_type -> data.Connection
-	11, // 12: data.DataService.SaveData:output_type -> google.protobuf.Empty
-	1,  // 13: data.DataService.GetData:output_type -> data.FilePart
-	7,  // 14: data.DataService.GetSum:output_type -> data.SHASum
-	9,  // 15: data.DataService.GetFiles:output_type -> data.FilesList
-	10, // 16: data.DataService.GetAvailableDiskSpace:output_type -> data.Size
-	11, // 17: data.DataService.CreateDir:output_type -> google.protobuf.Empty
-	11, // 18: data.DataService.RemoveDir:output_type -> google.protobuf.Empty
-	11, // [11:19] is the sub-list for method output_type
-	3,  // [3:11] is the sub-list for method input_type
-	3,  // [3:3] is the sub-list for extension type_name
-	3,  // [3:3] is the sub-list for extension extendee
-	0,  // [0:3] is the sub-list for field type_name
+	10, // 2: data.DeltaChunk.header:type_name -> data.DeltaHeader
+	11, // 3: data.DeltaChunk.ops:type_name -> data.DeltaOp
+	21, // 4: data.FilesList.value:type_name -> data.FileInfo
+	24, // 5: data.Signature.blocks:type_name -> data.BlockSum
+	27, // 6: data.ChangesList.changes:type_name -> data.Change
+	27, // 7: data.WatchEvent.change:type_name -> data.Change
+	29, // 8: data.WatchEvent.progress:type_name -> data.UploadProgress
+	32, // 9: data.SharesList.value:type_name -> data.Share
+	2,  // 10: data.DataService.CreateConnection:input_type -> data.ConnectionRequest
+	3,  // 11: data.DataService.SaveData:input_type -> data.SaveChunk
+	4,  // 12: data.DataService.GetData:input_type -> data.GetChunk
+	4,  // 13: data.DataService.GetSum:input_type -> data.GetChunk
+	5,  // 14: data.DataService.CloseConnection:input_type -> data.CloseConnectionRequest
+	6,  // 15: data.DataService.GetFiles:input_type -> data.Directory
+	6,  // 16: data.DataService.GetAvailableDiskSpace:input_type -> data.Directory
+	6,  // 17: data.DataService.CreateDir:input_type -> data.Directory
+	6,  // 18: data.DataService.RemoveDir:input_type -> data.Directory
+	7,  // 19: data.DataService.RemoveFile:input_type -> data.FilePath
+	15, // 20: data.DataService.Move:input_type -> data.MoveRequest
+	8,  // 21: data.DataService.Extract:input_type -> data.ExtractRequest
+	9,  // 22: data.DataService.GetSignature:input_type -> data.SignatureRequest
+	12, // 23: data.DataService.ApplyDelta:input_type -> data.DeltaChunk
+	13, // 24: data.DataService.GetChanges:input_type -> data.ChangesRequest
+	14, // 25: data.DataService.WatchChanges:input_type -> data.WatchRequest
+	16, // 26: data.DataService.CreateShare:input_type -> data.ShareRequest
+	17, // 27: data.DataService.GetShare:input_type -> data.ShareToken
+	18, // 28: data.DataService.GetShares:input_type -> data.SharesRequest
+	17, // 29: data.DataService.RemoveShare:input_type -> data.ShareToken
+	19, // 30: data.DataService.CreateConnection:output_type -> data.Connection
+	34, // 31: data.DataService.SaveData:output_type -> google.protobuf.Empty
+	1,  // 32: data.DataService.GetData:output_type -> data.FilePart
+	20, // 33: data.DataService.GetSum:output_type -> data.SHASum
+	34, // 34: data.DataService.CloseConnection:output_type -> google.protobuf.Empty
+	22, // 35: data.DataService.GetFiles:output_type -> data.FilesList
+	23, // 36: data.DataService.GetAvailableDiskSpace:output_type -> data.Size
+	34, // 37: data.DataService.CreateDir:output_type -> google.protobuf.Empty
+	34, // 38: data.DataService.RemoveDir:output_type -> google.protobuf.Empty
+	34, // 39: data.DataService.RemoveFile:output_type -> google.protobuf.Empty
+	34, // 40: data.DataService.Move:output_type -> google.protobuf.Empty
+	31, // 41: data.DataService.Extract:output_type -> data.ExtractProgress
+	25, // 42: data.DataService.GetSignature:output_type -> data.Signature
+	26, // 43: data.DataService.ApplyDelta:output_type -> data.DeltaResult
+	28, // 44: data.DataService.GetChanges:output_type -> data.ChangesList
+	30, // 45: data.DataService.WatchChanges:output_type -> data.WatchEvent
+	32, // 46: data.DataService.CreateShare:output_type -> data.Share
+	32, // 47: data.DataService.GetShare:output_type -> data.Share
+	33, // 48: data.DataService.GetShares:output_type -> data.SharesList
+	34, // 49: data.DataService.RemoveShare:output_type -> google.protobuf.Empty
+	30, // [30:50] is the sub-list for method output_type
+	10, // [10:30] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_data_data_proto_init() }
@@ -726,13 +2413,15 @@ func file_data_data_proto_init() {
 	if File_data_data_proto != nil {
 		return
 	}
+	file_data_data_proto_msgTypes[12].OneofWrappers = []any{}
+	file_data_data_proto_msgTypes[13].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_data_data_proto_rawDesc), len(file_data_data_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   10,
+			NumMessages:   33,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -24,10 +24,22 @@ const (
 	DataService_SaveData_FullMethodName              = "/data.DataService/SaveData"
 	DataService_GetData_FullMethodName               = "/data.DataService/GetData"
 	DataService_GetSum_FullMethodName                = "/data.DataService/GetSum"
+	DataService_CloseConnection_FullMethodName       = "/data.DataService/CloseConnection"
 	DataService_GetFiles_FullMethodName              = "/data.DataService/GetFiles"
 	DataService_GetAvailableDiskSpace_FullMethodName = "/data.DataService/GetAvailableDiskSpace"
 	DataService_CreateDir_FullMethodName             = "/data.DataService/CreateDir"
 	DataService_RemoveDir_FullMethodName             = "/data.DataService/RemoveDir"
+	DataService_RemoveFile_FullMethodName            = "/data.DataService/RemoveFile"
+	DataService_Move_FullMethodName                  = "/data.DataService/Move"
+	DataService_Extract_FullMethodName               = "/data.DataService/Extract"
+	DataService_GetSignature_FullMethodName          = "/data.DataService/GetSignature"
+	DataService_ApplyDelta_FullMethodName            = "/data.DataService/ApplyDelta"
+	DataService_GetChanges_FullMethodName            = "/data.DataService/GetChanges"
+	DataService_WatchChanges_FullMethodName          = "/data.DataService/WatchChanges"
+	DataService_CreateShare_FullMethodName           = "/data.DataService/CreateShare"
+	DataService_GetShare_FullMethodName              = "/data.DataService/GetShare"
+	DataService_GetShares_FullMethodName             = "/data.DataService/GetShares"
+	DataService_RemoveShare_FullMethodName           = "/data.DataService/RemoveShare"
 )
 
 // DataServiceClient is the client API for DataService service.
@@ -38,10 +50,22 @@ type DataServiceClient interface {
 	SaveData(ctx context.Context, in *SaveChunk, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	GetData(ctx context.Context, in *GetChunk, opts ...grpc.CallOption) (*FilePart, error)
 	GetSum(ctx context.Context, in *GetChunk, opts ...grpc.CallOption) (*SHASum, error)
+	CloseConnection(ctx context.Context, in *CloseConnectionRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	GetFiles(ctx context.Context, in *Directory, opts ...grpc.CallOption) (*FilesList, error)
 	GetAvailableDiskSpace(ctx context.Context, in *Directory, opts ...grpc.CallOption) (*Size, error)
 	CreateDir(ctx context.Context, in *Directory, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	RemoveDir(ctx context.Context, in *Directory, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	RemoveFile(ctx context.Context, in *FilePath, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExtractProgress], error)
+	GetSignature(ctx context.Context, in *SignatureRequest, opts ...grpc.CallOption) (*Signature, error)
+	ApplyDelta(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeltaChunk, DeltaResult], error)
+	GetChanges(ctx context.Context, in *ChangesRequest, opts ...grpc.CallOption) (*ChangesList, error)
+	WatchChanges(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+	CreateShare(ctx context.Context, in *ShareRequest, opts ...grpc.CallOption) (*Share, error)
+	GetShare(ctx context.Context, in *ShareToken, opts ...grpc.CallOption) (*Share, error)
+	GetShares(ctx context.Context, in *SharesRequest, opts ...grpc.CallOption) (*SharesList, error)
+	RemoveShare(ctx context.Context, in *ShareToken, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type dataServiceClient struct {
@@ -92,6 +116,16 @@ func (c *dataServiceClient) GetSum(ctx context.Context, in *GetChunk, opts ...gr
 	return out, nil
 }
 
+func (c *dataServiceClient) CloseConnection(ctx context.Context, in *CloseConnectionRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, DataService_CloseConnection_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *dataServiceClient) GetFiles(ctx context.Context, in *Directory, opts ...grpc.CallOption) (*FilesList, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(FilesList)
@@ -132,6 +166,137 @@ func (c *dataServiceClient) RemoveDir(ctx context.Context, in *Directory, opts .
 	return out, nil
 }
 
+func (c *dataServiceClient) RemoveFile(ctx context.Context, in *FilePath, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, DataService_RemoveFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, DataService_Move_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExtractProgress], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DataService_ServiceDesc.Streams[0], DataService_Extract_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExtractRequest, ExtractProgress]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DataService_ExtractClient = grpc.ServerStreamingClient[ExtractProgress]
+
+func (c *dataServiceClient) GetSignature(ctx context.Context, in *SignatureRequest, opts ...grpc.CallOption) (*Signature, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Signature)
+	err := c.cc.Invoke(ctx, DataService_GetSignature_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) ApplyDelta(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeltaChunk, DeltaResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DataService_ServiceDesc.Streams[1], DataService_ApplyDelta_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DeltaChunk, DeltaResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DataService_ApplyDeltaClient = grpc.ClientStreamingClient[DeltaChunk, DeltaResult]
+
+func (c *dataServiceClient) GetChanges(ctx context.Context, in *ChangesRequest, opts ...grpc.CallOption) (*ChangesList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChangesList)
+	err := c.cc.Invoke(ctx, DataService_GetChanges_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) WatchChanges(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DataService_ServiceDesc.Streams[2], DataService_WatchChanges_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DataService_WatchChangesClient = grpc.ServerStreamingClient[WatchEvent]
+
+func (c *dataServiceClient) CreateShare(ctx context.Context, in *ShareRequest, opts ...grpc.CallOption) (*Share, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Share)
+	err := c.cc.Invoke(ctx, DataService_CreateShare_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) GetShare(ctx context.Context, in *ShareToken, opts ...grpc.CallOption) (*Share, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Share)
+	err := c.cc.Invoke(ctx, DataService_GetShare_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) GetShares(ctx context.Context, in *SharesRequest, opts ...grpc.CallOption) (*SharesList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SharesList)
+	err := c.cc.Invoke(ctx, DataService_GetShares_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) RemoveShare(ctx context.Context, in *ShareToken, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, DataService_RemoveShare_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DataServiceServer is the server API for DataService service.
 // All implementations must embed UnimplementedDataServiceServer
 // for forward compatibility.
@@ -140,10 +305,22 @@ type DataServiceServer interface {
 	SaveData(context.Context, *SaveChunk) (*emptypb.Empty, error)
 	GetData(context.Context, *GetChunk) (*FilePart, error)
 	GetSum(context.Context, *GetChunk) (*SHASum, error)
+	CloseConnection(context.Context, *CloseConnectionRequest) (*emptypb.Empty, error)
 	GetFiles(context.Context, *Directory) (*FilesList, error)
 	GetAvailableDiskSpace(context.Context, *Directory) (*Size, error)
 	CreateDir(context.Context, *Directory) (*emptypb.Empty, error)
 	RemoveDir(context.Context, *Directory) (*emptypb.Empty, error)
+	RemoveFile(context.Context, *FilePath) (*emptypb.Empty, error)
+	Move(context.Context, *MoveRequest) (*emptypb.Empty, error)
+	Extract(*ExtractRequest, grpc.ServerStreamingServer[ExtractProgress]) error
+	GetSignature(context.Context, *SignatureRequest) (*Signature, error)
+	ApplyDelta(grpc.ClientStreamingServer[DeltaChunk, DeltaResult]) error
+	GetChanges(context.Context, *ChangesRequest) (*ChangesList, error)
+	WatchChanges(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	CreateShare(context.Context, *ShareRequest) (*Share, error)
+	GetShare(context.Context, *ShareToken) (*Share, error)
+	GetShares(context.Context, *SharesRequest) (*SharesList, error)
+	RemoveShare(context.Context, *ShareToken) (*emptypb.Empty, error)
 	mustEmbedUnimplementedDataServiceServer()
 }
 
@@ -166,6 +343,9 @@ func (UnimplementedDataServiceServer) GetData(context.Context, *GetChunk) (*File
 func (UnimplementedDataServiceServer) GetSum(context.Context, *GetChunk) (*SHASum, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetSum not implemented")
 }
+func (UnimplementedDataServiceServer) CloseConnection(context.Context, *CloseConnectionRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseConnection not implemented")
+}
 func (UnimplementedDataServiceServer) GetFiles(context.Context, *Directory) (*FilesList, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetFiles not implemented")
 }
@@ -178,6 +358,39 @@ func (UnimplementedDataServiceServer) CreateDir(context.Context, *Directory) (*e
 func (UnimplementedDataServiceServer) RemoveDir(context.Context, *Directory) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveDir not implemented")
 }
+func (UnimplementedDataServiceServer) RemoveFile(context.Context, *FilePath) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveFile not implemented")
+}
+func (UnimplementedDataServiceServer) Move(context.Context, *MoveRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Move not implemented")
+}
+func (UnimplementedDataServiceServer) Extract(*ExtractRequest, grpc.ServerStreamingServer[ExtractProgress]) error {
+	return status.Errorf(codes.Unimplemented, "method Extract not implemented")
+}
+func (UnimplementedDataServiceServer) GetSignature(context.Context, *SignatureRequest) (*Signature, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSignature not implemented")
+}
+func (UnimplementedDataServiceServer) ApplyDelta(grpc.ClientStreamingServer[DeltaChunk, DeltaResult]) error {
+	return status.Errorf(codes.Unimplemented, "method ApplyDelta not implemented")
+}
+func (UnimplementedDataServiceServer) GetChanges(context.Context, *ChangesRequest) (*ChangesList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChanges not implemented")
+}
+func (UnimplementedDataServiceServer) WatchChanges(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchChanges not implemented")
+}
+func (UnimplementedDataServiceServer) CreateShare(context.Context, *ShareRequest) (*Share, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateShare not implemented")
+}
+func (UnimplementedDataServiceServer) GetShare(context.Context, *ShareToken) (*Share, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShare not implemented")
+}
+func (UnimplementedDataServiceServer) GetShares(context.Context, *SharesRequest) (*SharesList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShares not implemented")
+}
+func (UnimplementedDataServiceServer) RemoveShare(context.Context, *ShareToken) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveShare not implemented")
+}
 func (UnimplementedDataServiceServer) mustEmbedUnimplementedDataServiceServer() {}
 func (UnimplementedDataServiceServer) testEmbeddedByValue()                     {}
 
@@ -271,6 +484,24 @@ func _DataService_GetSum_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DataService_CloseConnection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseConnectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).CloseConnection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_CloseConnection_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).CloseConnection(ctx, req.(*CloseConnectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _DataService_GetFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Directory)
 	if err := dec(in); err != nil {
@@ -343,6 +574,179 @@ func _DataService_RemoveDir_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DataService_RemoveFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FilePath)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).RemoveFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_RemoveFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).RemoveFile(ctx, req.(*FilePath))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_Move_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).Move(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_Move_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).Move(ctx, req.(*MoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_Extract_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExtractRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DataServiceServer).Extract(m, &grpc.GenericServerStream[ExtractRequest, ExtractProgress]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DataService_ExtractServer = grpc.ServerStreamingServer[ExtractProgress]
+
+func _DataService_GetSignature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).GetSignature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_GetSignature_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).GetSignature(ctx, req.(*SignatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_ApplyDelta_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DataServiceServer).ApplyDelta(&grpc.GenericServerStream[DeltaChunk, DeltaResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DataService_ApplyDeltaServer = grpc.ClientStreamingServer[DeltaChunk, DeltaResult]
+
+func _DataService_GetChanges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).GetChanges(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_GetChanges_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).GetChanges(ctx, req.(*ChangesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_WatchChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DataServiceServer).WatchChanges(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DataService_WatchChangesServer = grpc.ServerStreamingServer[WatchEvent]
+
+func _DataService_CreateShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).CreateShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_CreateShare_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).CreateShare(ctx, req.(*ShareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_GetShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareToken)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).GetShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_GetShare_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).GetShare(ctx, req.(*ShareToken))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_GetShares_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SharesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).GetShares(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_GetShares_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).GetShares(ctx, req.(*SharesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_RemoveShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareToken)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).RemoveShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_RemoveShare_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).RemoveShare(ctx, req.(*ShareToken))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DataService_ServiceDesc is the grpc.ServiceDesc for DataService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -366,6 +770,10 @@ var DataService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetSum",
 			Handler:    _DataService_GetSum_Handler,
 		},
+		{
+			MethodName: "CloseConnection",
+			Handler:    _DataService_CloseConnection_Handler,
+		},
 		{
 			MethodName: "GetFiles",
 			Handler:    _DataService_GetFiles_Handler,
@@ -382,7 +790,55 @@ var DataService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RemoveDir",
 			Handler:    _DataService_RemoveDir_Handler,
 		},
+		{
+			MethodName: "RemoveFile",
+			Handler:    _DataService_RemoveFile_Handler,
+		},
+		{
+			MethodName: "Move",
+			Handler:    _DataService_Move_Handler,
+		},
+		{
+			MethodName: "GetSignature",
+			Handler:    _DataService_GetSignature_Handler,
+		},
+		{
+			MethodName: "GetChanges",
+			Handler:    _DataService_GetChanges_Handler,
+		},
+		{
+			MethodName: "CreateShare",
+			Handler:    _DataService_CreateShare_Handler,
+		},
+		{
+			MethodName: "GetShare",
+			Handler:    _DataService_GetShare_Handler,
+		},
+		{
+			MethodName: "GetShares",
+			Handler:    _DataService_GetShares_Handler,
+		},
+		{
+			MethodName: "RemoveShare",
+			Handler:    _DataService_RemoveShare_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Extract",
+			Handler:       _DataService_Extract_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ApplyDelta",
+			Handler:       _DataService_ApplyDelta_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchChanges",
+			Handler:       _DataService_WatchChanges_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "data/data.proto",
 }
@@ -10,9 +10,12 @@ else
 fi
 
 go build -C cmd/ -o ../build/mhserver -ldflags="-s -w -X=github.com/braginantonev/mhserver/version.Version=${VERSION}"
+go build -C cmd/mhsync -o ../../build/mhsync -ldflags="-s -w -X=github.com/braginantonev/mhserver/version.Version=${VERSION}"
+go build -C cmd/mhctl -o ../../build/mhctl -ldflags="-s -w -X=github.com/braginantonev/mhserver/version.Version=${VERSION}"
 
 cp -r scripts/ build/scripts/
 cp -r sql/ build/
+cp -r internal/repository/database/migrations/ build/sql/migrations/
 cp mhserver.service build/
 
 cd build
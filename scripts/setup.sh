@@ -211,15 +211,8 @@ fi
 
 #* ---------- Create server tables ---------- *#
 
-echo -e "Create server tables..."
-mariadb -u mhserver --password=$db_password -D mhs_main < $EXECUTABLE_PATH/sql/tables.sql
-if [ $? -ne 0 ]; then
-    echo -e "\aError in creating database tables"
-    exit 1
-fi
-
 echo -e "Create test server tables..."
-mariadb -u mhserver_tests -D mhs_main_test < $EXECUTABLE_PATH/sql/tables.sql
+cat $EXECUTABLE_PATH/sql/migrations/*.sql | mariadb -u mhserver_tests -D mhs_main_test
 if [ $? -ne 0 ]; then
     echo -e "\aError in creating database tables"
     exit 1
@@ -297,11 +290,24 @@ echo # SKip the line
 sh /opt/mhserver/scripts/create-ssl-cert.sh
 
 
-#* ------- Generate register secrets ------- *#
+#* ----- Create tables and register secrets ----- *#
 
 echo # SKip the line
 
-sh /opt/mhserver/scripts/generate_reg_keys.sh --db_pass=$db_password
+echo -e "Create server tables..."
+sudo $EXECUTABLE_PATH/mhserver migrate
+if [ $? -ne 0 ]; then
+    echo -e "\aError in creating database tables"
+    exit 1
+fi
+
+echo -e "\nRegister secret keys:"
+sudo $EXECUTABLE_PATH/mhserver keys generate -n 5
+if [ $? -ne 0 ]; then
+    echo -e "\aFailed generate register secret keys"
+    exit 1
+fi
+echo -e "\nUse this secrets to register on server"
 
 
 #* -------- Enable server service ---------- *#